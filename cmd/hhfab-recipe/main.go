@@ -15,10 +15,15 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/lmittmann/tint"
@@ -30,10 +35,13 @@ import (
 
 var version = "(devel)"
 
-func setupLogger(verbose, brief bool) error {
+func setupLogger(verbose, brief bool, output string) error {
 	if verbose && brief {
 		return cli.Exit("verbose and brief are mutually exclusive", 1)
 	}
+	if !slices.Contains(cnc.Outputs, output) {
+		return cli.Exit(fmt.Sprintf("unknown output %q, supported: %s", output, strings.Join(cnc.Outputs, ", ")), 1)
+	}
 
 	logLevel := slog.LevelInfo
 	if verbose {
@@ -43,6 +51,17 @@ func setupLogger(verbose, brief bool) error {
 	}
 
 	logW := os.Stdout
+
+	if output == cnc.OutputJSON {
+		cnc.SetEventOutput(logW)
+		slog.SetDefault(slog.New(cnc.NewEventLogHandler(logLevel)))
+
+		return nil
+	}
+
+	fmt.Println(motd)
+	fmt.Println("Version:", version)
+
 	logger := slog.New(
 		tint.NewHandler(logW, &tint.Options{
 			Level:      logLevel,
@@ -55,13 +74,18 @@ func setupLogger(verbose, brief bool) error {
 	return nil
 }
 
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
 //go:embed motd.txt
 var motd string
 
 func main() {
-	fmt.Println(motd)
-	fmt.Println("Version:", version)
-
 	var verbose, brief bool
 	verboseFlag := &cli.BoolFlag{
 		Name:        "verbose",
@@ -76,6 +100,22 @@ func main() {
 		Destination: &brief,
 	}
 
+	output := cnc.OutputText
+	outputFlag := &cli.StringFlag{
+		Name:        "output",
+		Aliases:     []string{"o"},
+		Usage:       "output format, one of: " + strings.Join(cnc.Outputs, ", ") + " (json emits one progress event per line)",
+		Value:       cnc.OutputText,
+		Destination: &output,
+	}
+
+	var timeout time.Duration
+	timeoutFlag := &cli.DurationFlag{
+		Name:        "timeout",
+		Usage:       "abort after `DURATION` (0 for no timeout)",
+		Destination: &timeout,
+	}
+
 	var basedir string
 	basedirFlag := &cli.StringFlag{
 		Name:        "basedir",
@@ -93,6 +133,46 @@ func main() {
 		Destination: &dryRun,
 	}
 
+	var from, until string
+	var stages cli.UintSlice
+	var components cli.StringSlice
+	selectFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:        "from",
+			Usage:       "select actions starting from the `ACTION` (inclusive)",
+			Destination: &from,
+		},
+		&cli.StringFlag{
+			Name:        "until",
+			Usage:       "select actions up to the `ACTION` (inclusive)",
+			Destination: &until,
+		},
+		&cli.UintSliceFlag{
+			Name:        "stage",
+			Usage:       "select actions from the `STAGE` only, use multiple times for multiple stages",
+			Destination: &stages,
+		},
+		&cli.StringSliceFlag{
+			Name:        "component",
+			Usage:       "select actions from the `COMPONENT` only, use multiple times for multiple components",
+			Destination: &components,
+		},
+	}
+
+	selector := func(cCtx *cli.Context) cnc.RecipeSelector {
+		sel := cnc.RecipeSelector{
+			Actions:    cCtx.Args().Slice(),
+			From:       from,
+			Until:      until,
+			Components: components.Value(),
+		}
+		for _, stage := range stages.Value() {
+			sel.Stages = append(sel.Stages, cnc.Stage(stage))
+		}
+
+		return sel
+	}
+
 	cli.VersionFlag.(*cli.BoolFlag).Aliases = []string{"V"}
 	app := &cli.App{
 		Name:                   "hhfab-recipe",
@@ -105,25 +185,71 @@ func main() {
 			{
 				Name:      "run",
 				Usage:     "run steps from recipe.yaml in the basedir",
-				UsageText: "Empty or 'all' for all actions (default) or list actions as args to run",
-				Flags: []cli.Flag{
+				UsageText: "Empty or 'all' for all actions (default) or list actions as args to run, could be combined with selector flags",
+				Flags: append([]cli.Flag{
 					basedirFlag,
 					verboseFlag,
 					briefFlag,
+					outputFlag,
+					timeoutFlag,
 					dryRunFlag,
+				}, selectFlags...),
+				Before: func(_ *cli.Context) error {
+					return setupLogger(verbose, brief, output)
+				},
+				Action: func(cCtx *cli.Context) error {
+					ctx, cancel := withTimeout(cCtx.Context, timeout)
+					defer cancel()
+
+					return errors.Wrapf(cnc.RunRecipe(ctx, basedir, selector(cCtx), dryRun), "error running recipe")
 				},
+			},
+			{
+				Name:  "preflight",
+				Usage: "run only preflight checks from recipe.yaml in the basedir and report all problems found",
+				Flags: []cli.Flag{
+					basedirFlag,
+					verboseFlag,
+					briefFlag,
+					outputFlag,
+					timeoutFlag,
+				},
+				Before: func(_ *cli.Context) error {
+					return setupLogger(verbose, brief, output)
+				},
+				Action: func(cCtx *cli.Context) error {
+					ctx, cancel := withTimeout(cCtx.Context, timeout)
+					defer cancel()
+
+					sel := cnc.RecipeSelector{Actions: []string{cnc.PreflightAction}}
+
+					return errors.Wrapf(cnc.RunRecipe(ctx, basedir, sel, false), "error running preflight checks")
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "list actions from recipe.yaml in the basedir with their stages and summaries",
+				UsageText: "Empty or 'all' for all actions (default) or list actions as args to show, could be combined with selector flags",
+				Flags: append([]cli.Flag{
+					basedirFlag,
+					verboseFlag,
+					briefFlag,
+				}, selectFlags...),
 				Before: func(_ *cli.Context) error {
-					return setupLogger(verbose, brief)
+					return setupLogger(verbose, brief, output)
 				},
 				Action: func(cCtx *cli.Context) error {
-					return errors.Wrapf(cnc.RunRecipe(basedir, cCtx.Args().Slice(), dryRun), "error running recipe")
+					return errors.Wrapf(cnc.ListRecipe(basedir, selector(cCtx)), "error listing recipe")
 				},
 			},
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		stop()
 		slog.Error("Failed", "err", err.Error())
-		os.Exit(1)
+		os.Exit(1) //nolint:gocritic
 	}
+	stop()
 }
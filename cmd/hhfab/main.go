@@ -19,9 +19,12 @@ import (
 	_ "embed"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
+	"os/signal"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/lmittmann/tint"
@@ -34,6 +37,7 @@ import (
 	"go.githedgehog.com/fabricator/pkg/fab/vlab"
 	"go.githedgehog.com/fabricator/pkg/fab/vlab/testing"
 	"go.githedgehog.com/fabricator/pkg/fab/wiring"
+	"go.githedgehog.com/fabricator/pkg/fab/wiring/visual"
 )
 
 var version = "(devel)"
@@ -42,10 +46,13 @@ const (
 	CategoryWiringGen = "wiring generator options:"
 )
 
-func setupLogger(verbose, brief bool) error {
+func setupLogger(verbose, brief bool, output string) error {
 	if verbose && brief {
 		return cli.Exit("verbose and brief are mutually exclusive", 1)
 	}
+	if !slices.Contains(cnc.Outputs, output) {
+		return cli.Exit(fmt.Sprintf("unknown output %q, supported: %s", output, strings.Join(cnc.Outputs, ", ")), 1)
+	}
 
 	logLevel := slog.LevelInfo
 	if verbose {
@@ -55,14 +62,17 @@ func setupLogger(verbose, brief bool) error {
 	}
 
 	logW := os.Stdout
-	logger := slog.New(
-		tint.NewHandler(logW, &tint.Options{
-			Level:      logLevel,
-			TimeFormat: time.TimeOnly,
-			NoColor:    !isatty.IsTerminal(logW.Fd()),
-		}),
-	)
-	slog.SetDefault(logger)
+
+	var handler slog.Handler = tint.NewHandler(logW, &tint.Options{
+		Level:      logLevel,
+		TimeFormat: time.TimeOnly,
+		NoColor:    !isatty.IsTerminal(logW.Fd()),
+	})
+	if output == cnc.OutputJSON {
+		cnc.SetEventOutput(logW)
+		handler = cnc.NewEventLogHandler(logLevel)
+	}
+	slog.SetDefault(slog.New(handler))
 
 	slog.Debug("\n" + motd)
 	slog.Debug("Version: " + version)
@@ -72,6 +82,14 @@ func setupLogger(verbose, brief bool) error {
 	return nil
 }
 
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
 //go:embed motd.txt
 var motd string
 
@@ -90,6 +108,22 @@ func main() {
 		Destination: &brief,
 	}
 
+	output := cnc.OutputText
+	outputFlag := &cli.StringFlag{
+		Name:        "output",
+		Aliases:     []string{"o"},
+		Usage:       "output format, one of: " + strings.Join(cnc.Outputs, ", ") + " (json emits one progress event per line)",
+		Value:       cnc.OutputText,
+		Destination: &output,
+	}
+
+	var timeout time.Duration
+	timeoutFlag := &cli.DurationFlag{
+		Name:        "timeout",
+		Usage:       "abort after `DURATION` and clean up partial outputs (0 for no timeout)",
+		Destination: &timeout,
+	}
+
 	var basedir, fromConfig, preset string
 	var wiringPath cli.StringSlice
 	basedirFlag := &cli.StringFlag{
@@ -107,6 +141,13 @@ func main() {
 
 	var dryRun, hydrate, nopack bool
 
+	var ipPlan string
+	ipPlanFlag := &cli.StringFlag{
+		Name:        "ip-plan",
+		Usage:       "use IP plan `FILE` (YAML with per-purpose CIDR pools, p2p prefix, offsets and ASN strategy and ranges) for hydration, already hydrated wiring is checked against it",
+		Destination: &ipPlan,
+	}
+
 	var vm string
 	vmFlag := &cli.StringFlag{
 		Name:        "vm",
@@ -116,10 +157,11 @@ func main() {
 
 	var fabricMode string
 	var wgChainControlLink bool
-	var wgControlLinksCount, wgSpinesCount, wgFabricLinksCount, wgMCLAGLeafsCount, wgOrphanLeafsCount, wgMCLAGSessionLinks, wgMCLAGPeerLinks, wgVPCLoopbacks uint
-	var wgESLAGLeafGroups string
+	var wgControlLinksCount, wgControlNodesCount, wgSpinesCount, wgFabricLinksCount, wgMCLAGLeafsCount, wgOrphanLeafsCount, wgMCLAGSessionLinks, wgMCLAGPeerLinks, wgVPCLoopbacks, wgExternalsCount uint
+	var wgESLAGLeafGroups, wgLeafBreakouts, wgTenants string
 	var wgExternal bool
 	var wgMCLAGServers, wgESLAGServers, wgUnbundledServers, wgBundledServers uint
+	var wgTopology string
 
 	fabricModes := []string{}
 	for _, m := range meta.FabricModes {
@@ -127,6 +169,13 @@ func main() {
 	}
 
 	wiringGenFlags := []cli.Flag{
+		&cli.StringFlag{
+			Category:    CategoryWiringGen,
+			Name:        "topology",
+			Aliases:     []string{"t"},
+			Usage:       "generate wiring from topology spec `FILE` (YAML with leaf groups, servers, spines and externals) instead of the count flags",
+			Destination: &wgTopology,
+		},
 		&cli.StringFlag{
 			Name:        "fabric-mode",
 			Aliases:     []string{"m"},
@@ -146,6 +195,13 @@ func main() {
 			Usage:       "number of control links if chain-control-link is enabled",
 			Destination: &wgControlLinksCount,
 		},
+		&cli.UintFlag{
+			Category:    CategoryWiringGen,
+			Name:        "control-nodes-count",
+			Usage:       "number of control nodes, 1 or 3 for HA kube API and registry, switches are booted and managed by the first one only",
+			Value:       1,
+			Destination: &wgControlNodesCount,
+		},
 		&cli.UintFlag{
 			Category:    CategoryWiringGen,
 			Name:        "spines-count",
@@ -200,6 +256,12 @@ func main() {
 			Usage:       "include virtual external switch",
 			Destination: &wgExternal,
 		},
+		&cli.UintFlag{
+			Category:    CategoryWiringGen,
+			Name:        "externals-count",
+			Usage:       "number of virtual external switches to attach to the orphan leafs (overrides --external if set)",
+			Destination: &wgExternalsCount,
+		},
 		&cli.UintFlag{
 			Category:    CategoryWiringGen,
 			Name:        "mclag-servers",
@@ -228,6 +290,59 @@ func main() {
 			Destination: &wgBundledServers,
 			Value:       1,
 		},
+		&cli.StringFlag{
+			Category:    CategoryWiringGen,
+			Name:        "leaf-breakouts",
+			Usage:       "comma separated leaf port ranges with breakout modes, server links use the sub-ports, e.g. E1/1-4=4x25G (not supported by VLAB virtual switches)",
+			Destination: &wgLeafBreakouts,
+		},
+		&cli.StringFlag{
+			Category:    CategoryWiringGen,
+			Name:        "tenants",
+			Usage:       "generate VPCs, attachments and peerings for the servers, installed with the wiring, one of: " + strings.Join(wiring.TenantsPatterns, ", "),
+			Value:       wiring.TenantsNone,
+			Destination: &wgTenants,
+		},
+	}
+
+	wiringBuilder := func(cCtx *cli.Context) (*wiring.Builder, error) {
+		if wgTopology != "" {
+			topo, err := wiring.LoadTopology(wgTopology)
+			if err != nil {
+				return nil, err
+			}
+			if topo.FabricMode == "" {
+				topo.FabricMode = meta.FabricMode(fabricMode)
+			} else if cCtx.IsSet("fabric-mode") && topo.FabricMode != meta.FabricMode(fabricMode) {
+				return nil, errors.Errorf("fabric mode %s doesn't match topology fabric mode %s", fabricMode, topo.FabricMode)
+			}
+			fabricMode = string(topo.FabricMode)
+
+			return &wiring.Builder{Topology: topo, TenantsPattern: wgTenants}, nil
+		}
+
+		return &wiring.Builder{
+			FabricMode:        meta.FabricMode(fabricMode),
+			ChainControlLink:  wgChainControlLink,
+			External:          wgExternal,
+			ExternalsCount:    uint8(wgExternalsCount),
+			ControlLinksCount: uint8(wgControlLinksCount),
+			ControlNodesCount: uint8(wgControlNodesCount),
+			SpinesCount:       uint8(wgSpinesCount),
+			FabricLinksCount:  uint8(wgFabricLinksCount),
+			MCLAGLeafsCount:   uint8(wgMCLAGLeafsCount),
+			ESLAGLeafGroups:   wgESLAGLeafGroups,
+			OrphanLeafsCount:  uint8(wgOrphanLeafsCount),
+			MCLAGSessionLinks: uint8(wgMCLAGSessionLinks),
+			MCLAGPeerLinks:    uint8(wgMCLAGPeerLinks),
+			VPCLoopbacks:      uint8(wgVPCLoopbacks),
+			MCLAGServers:      uint8(wgMCLAGServers),
+			ESLAGServers:      uint8(wgESLAGServers),
+			UnbundledServers:  uint8(wgUnbundledServers),
+			BundledServers:    uint8(wgBundledServers),
+			LeafBreakouts:     wgLeafBreakouts,
+			TenantsPattern:    wgTenants,
+		}, nil
 	}
 
 	mngr := fab.NewCNCManager()
@@ -275,11 +390,16 @@ func main() {
 						Value:       true,
 						Destination: &hydrate,
 					},
+					ipPlanFlag,
 				}, extraInitFlags...),
 				Before: func(_ *cli.Context) error {
-					return setupLogger(verbose, brief)
+					return setupLogger(verbose, brief, output)
 				},
-				Action: func(_ *cli.Context) error {
+				Action: func(cCtx *cli.Context) error {
+					wiringGen, err := wiringBuilder(cCtx)
+					if err != nil {
+						return errors.Wrap(err, "error loading topology")
+					}
 					if fabricMode == "" {
 						fabricMode = string(meta.FabricModeSpineLeaf)
 					}
@@ -287,25 +407,7 @@ func main() {
 						return errors.Errorf("invalid fabric mode %s (supported: %s)", fabricMode, strings.Join(fabricModes, ", "))
 					}
 
-					wiringGen := &wiring.Builder{
-						FabricMode:        meta.FabricMode(fabricMode),
-						ChainControlLink:  wgChainControlLink,
-						External:          wgExternal,
-						ControlLinksCount: uint8(wgControlLinksCount),
-						SpinesCount:       uint8(wgSpinesCount),
-						FabricLinksCount:  uint8(wgFabricLinksCount),
-						MCLAGLeafsCount:   uint8(wgMCLAGLeafsCount),
-						ESLAGLeafGroups:   wgESLAGLeafGroups,
-						OrphanLeafsCount:  uint8(wgOrphanLeafsCount),
-						MCLAGSessionLinks: uint8(wgMCLAGSessionLinks),
-						MCLAGPeerLinks:    uint8(wgMCLAGPeerLinks),
-						VPCLoopbacks:      uint8(wgVPCLoopbacks),
-						MCLAGServers:      uint8(wgMCLAGServers),
-						ESLAGServers:      uint8(wgESLAGServers),
-						UnbundledServers:  uint8(wgUnbundledServers),
-						BundledServers:    uint8(wgBundledServers),
-					}
-					err := mngr.Init(basedir, fromConfig, cnc.Preset(preset), meta.FabricMode(fabricMode), wiringPath.Value(), wiringGen, hydrate)
+					err = mngr.Init(basedir, fromConfig, cnc.Preset(preset), meta.FabricMode(fabricMode), wiringPath.Value(), wiringGen, hydrate, ipPlan)
 					if err != nil {
 						return errors.Wrap(err, "error initializing")
 					}
@@ -320,6 +422,8 @@ func main() {
 					basedirFlag,
 					verboseFlag,
 					briefFlag,
+					outputFlag,
+					timeoutFlag,
 					&cli.BoolFlag{
 						Name:        "nopack",
 						Usage:       "do not pack bundles",
@@ -333,15 +437,18 @@ func main() {
 					// },
 				},
 				Before: func(_ *cli.Context) error {
-					return setupLogger(verbose, brief)
+					return setupLogger(verbose, brief, output)
 				},
-				Action: func(_ *cli.Context) error {
+				Action: func(cCtx *cli.Context) error {
 					err := mngr.Load(basedir)
 					if err != nil {
 						return errors.Wrap(err, "error loading")
 					}
 
-					return errors.Wrap(mngr.Build(!nopack), "error building bundles")
+					ctx, cancel := withTimeout(cCtx.Context, timeout)
+					defer cancel()
+
+					return errors.Wrap(mngr.Build(ctx, !nopack), "error building bundles")
 				},
 			},
 			{
@@ -351,17 +458,21 @@ func main() {
 					basedirFlag,
 					verboseFlag,
 					briefFlag,
+					timeoutFlag,
 				},
 				Before: func(_ *cli.Context) error {
-					return setupLogger(verbose, brief)
+					return setupLogger(verbose, brief, output)
 				},
-				Action: func(_ *cli.Context) error {
+				Action: func(cCtx *cli.Context) error {
 					err := mngr.Load(basedir)
 					if err != nil {
 						return errors.Wrap(err, "error loading")
 					}
 
-					return errors.Wrap(mngr.Pack(), "error packing bundles")
+					ctx, cancel := withTimeout(cCtx.Context, timeout)
+					defer cancel()
+
+					return errors.Wrap(mngr.Pack(ctx), "error packing bundles")
 				},
 			},
 			{
@@ -373,7 +484,7 @@ func main() {
 					briefFlag,
 				},
 				Before: func(_ *cli.Context) error {
-					return setupLogger(verbose, brief)
+					return setupLogger(verbose, brief, output)
 				},
 				Action: func(_ *cli.Context) error {
 					err := mngr.Load(basedir)
@@ -438,7 +549,7 @@ func main() {
 							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -470,7 +581,7 @@ func main() {
 							vmFlag,
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -496,7 +607,7 @@ func main() {
 							vmFlag,
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(_ *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -522,7 +633,7 @@ func main() {
 							vmFlag,
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(_ *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -548,7 +659,7 @@ func main() {
 							briefFlag,
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(_ *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -609,7 +720,7 @@ func main() {
 							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -648,7 +759,7 @@ func main() {
 							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -719,7 +830,7 @@ func main() {
 							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -790,7 +901,7 @@ func main() {
 							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
 							err := mngr.Load(basedir)
@@ -834,9 +945,13 @@ func main() {
 							briefFlag,
 						}, wiringGenFlags...),
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
-						Action: func(_ *cli.Context) error {
+						Action: func(cCtx *cli.Context) error {
+							wiringGen, err := wiringBuilder(cCtx)
+							if err != nil {
+								return errors.Wrap(err, "error loading topology")
+							}
 							if fabricMode == "" {
 								fabricMode = string(meta.FabricModeSpineLeaf)
 							}
@@ -844,28 +959,16 @@ func main() {
 								return errors.Errorf("invalid fabric mode %s (supported: %s)", fabricMode, strings.Join(fabricModes, ", "))
 							}
 
-							data, err := (&wiring.Builder{
-								FabricMode:        meta.FabricMode(fabricMode),
-								ChainControlLink:  wgChainControlLink,
-								ControlLinksCount: uint8(wgControlLinksCount),
-								SpinesCount:       uint8(wgSpinesCount),
-								FabricLinksCount:  uint8(wgFabricLinksCount),
-								MCLAGLeafsCount:   uint8(wgMCLAGLeafsCount),
-								ESLAGLeafGroups:   wgESLAGLeafGroups,
-								OrphanLeafsCount:  uint8(wgOrphanLeafsCount),
-								MCLAGSessionLinks: uint8(wgMCLAGSessionLinks),
-								MCLAGPeerLinks:    uint8(wgMCLAGPeerLinks),
-								VPCLoopbacks:      uint8(wgVPCLoopbacks),
-								MCLAGServers:      uint8(wgMCLAGServers),
-								ESLAGServers:      uint8(wgESLAGServers),
-								UnbundledServers:  uint8(wgUnbundledServers),
-								BundledServers:    uint8(wgBundledServers),
-							}).Build()
+							data, err := wiringGen.Build()
 							if err != nil {
 								return errors.Wrap(err, "error building sample")
 							}
 
-							return errors.Wrapf(data.Write(os.Stdout), "error writing sample")
+							if err := data.Write(os.Stdout); err != nil {
+								return errors.Wrap(err, "error writing sample")
+							}
+
+							return errors.Wrapf(wiringGen.Tenants().Write(os.Stdout), "error writing tenants")
 						},
 					},
 					{
@@ -879,12 +982,17 @@ func main() {
 								Aliases: []string{"w"},
 								Usage:   "use wiring `FILE`",
 							},
+							ipPlanFlag,
+							&cli.BoolFlag{
+								Name:  "incremental",
+								Usage: "keep already assigned ASNs and IPs and only assign missing ones instead of re-assigning everything",
+							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
-							err := wiring.HydratePath(cCtx.String("wiring"))
+							err := wiring.HydratePath(cCtx.String("wiring"), ipPlan, cCtx.Bool("incremental"))
 							if err != nil {
 								return errors.Wrap(err, "error hydrating")
 							}
@@ -892,9 +1000,354 @@ func main() {
 							return nil
 						},
 					},
+					{
+						Name:  "ipam",
+						Usage: "list all IPs allocated in the hydrated wiring diagram with the ip plan pools utilization",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							&cli.StringFlag{
+								Name:    "wiring",
+								Aliases: []string{"w"},
+								Usage:   "use wiring `FILE`",
+							},
+							ipPlanFlag,
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "output format, one of: " + strings.Join(wiring.IPAMFormats, ", "),
+								Value:   wiring.IPAMFormatTable,
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							err := wiring.IPAMPath(cCtx.String("wiring"), ipPlan, cCtx.String("format"), fab.IPAMReserved())
+							if err != nil {
+								return errors.Wrap(err, "error exporting ipam")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "import",
+						Usage: "import wiring diagram from the cabling and device roles spreadsheets (CSV)",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							&cli.StringFlag{
+								Name:  "csv",
+								Usage: "cabling CSV `FILE` with device a, port a, device b, port b and optional purpose columns",
+							},
+							&cli.StringFlag{
+								Name:  "roles",
+								Usage: "device roles CSV `FILE` with device, role and optional group, redundancy and description columns",
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							err := wiring.ImportCSVPath(cCtx.String("csv"), cCtx.String("roles"))
+							if err != nil {
+								return errors.Wrap(err, "error importing")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "cabling-plan",
+						Usage: "generate per rack and per device cabling plan with all physical links from the wiring diagram",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							&cli.StringFlag{
+								Name:    "wiring",
+								Aliases: []string{"w"},
+								Usage:   "use wiring `FILE`",
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "output format, one of: " + strings.Join(wiring.CablingPlanFormats, ", "),
+								Value:   wiring.CablingPlanFormatMarkdown,
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							err := wiring.CablingPlanPath(cCtx.String("wiring"), cCtx.String("format"))
+							if err != nil {
+								return errors.Wrap(err, "error generating cabling plan")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "capacity",
+						Usage: "report per leaf oversubscription and per switch ports utilization for the wiring diagram",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							&cli.StringFlag{
+								Name:    "wiring",
+								Aliases: []string{"w"},
+								Usage:   "use wiring `FILE`",
+							},
+							&cli.StringFlag{
+								Name:    "topology",
+								Aliases: []string{"t"},
+								Usage:   "use switch port profiles from the topology spec `FILE` for the port speeds and total ports",
+							},
+							&cli.StringFlag{
+								Name:  "default-speed",
+								Usage: "port `SPEED` (e.g. 25G) to use if it's missing in the wiring and switch profile",
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "output format, one of: " + strings.Join(wiring.CapacityFormats, ", "),
+								Value:   wiring.CapacityFormatTable,
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							err := wiring.CapacityPath(cCtx.String("wiring"), cCtx.String("topology"), cCtx.String("default-speed"), cCtx.String("format"))
+							if err != nil {
+								return errors.Wrap(err, "error calculating capacity")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "render",
+						Usage: "render the Agent spec the fabric controller builds for the switch from the wiring and fabricator config offline",
+						Flags: []cli.Flag{
+							basedirFlag,
+							verboseFlag,
+							briefFlag,
+							&cli.StringFlag{
+								Name:     "switch",
+								Aliases:  []string{"s"},
+								Usage:    "switch `NAME` to render the Agent spec for",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "wiring",
+								Aliases: []string{"w"},
+								Usage:   "use hydrated wiring `FILE` (incl. VPCs and attachments) instead of the initialized one",
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							err := mngr.Load(basedir)
+							if err != nil {
+								return errors.Wrap(err, "error loading")
+							}
+
+							err = fab.RenderSwitch(cCtx.Context, mngr, cCtx.String("wiring"), cCtx.String("switch"), os.Stdout)
+							if err != nil {
+								return errors.Wrap(err, "error rendering switch")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "apply",
+						Usage: "apply wiring changes to the running fabric using server-side apply in the safe order",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							timeoutFlag,
+							&cli.StringFlag{
+								Name:    "wiring",
+								Aliases: []string{"w"},
+								Usage:   "use wiring `FILE`",
+							},
+							&cli.StringFlag{
+								Name:  "kubeconfig",
+								Usage: "use kubeconfig `FILE` of the fabric control node",
+							},
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "only validate changes on the API server (server-side dry run) without persisting them",
+							},
+							&cli.BoolFlag{
+								Name:  "prune",
+								Usage: "delete wiring objects that exist in the cluster but are missing in the wiring",
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							ctx, cancel := withTimeout(cCtx.Context, timeout)
+							defer cancel()
+
+							err := wiring.ApplyPath(ctx, cCtx.String("wiring"), cCtx.String("kubeconfig"), cCtx.Bool("dry-run"), cCtx.Bool("prune"))
+							if err != nil {
+								return errors.Wrap(err, "error applying wiring")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:      "diff",
+						Usage:     "compare wiring diagrams semantically and report the impact of the changes on the running fabric",
+						ArgsUsage: "OLD-FILE NEW-FILE",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.NArg() != 2 {
+								return cli.Exit("exactly two wiring files expected: OLD-FILE NEW-FILE", 1)
+							}
+
+							err := wiring.DiffPath(cCtx.Args().Get(0), cCtx.Args().Get(1))
+							if err != nil {
+								return errors.Wrap(err, "error comparing wiring")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "lint",
+						Usage: "report all problems in the wiring diagram at once, including fabric validation errors and design rules violations",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							timeoutFlag,
+							&cli.StringFlag{
+								Name:    "wiring",
+								Aliases: []string{"w"},
+								Usage:   "use wiring `FILE`",
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "output format, one of: " + strings.Join(wiring.LintFormats, ", ") + " (SARIF)",
+								Value:   wiring.LintFormatText,
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							ctx, cancel := withTimeout(cCtx.Context, timeout)
+							defer cancel()
+
+							err := fab.LintWiring(ctx, cCtx.String("wiring"), cCtx.String("format"))
+							if err != nil {
+								return errors.Wrap(err, "error linting wiring")
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:  "fuzz",
+						Usage: "generate random topologies and check that they could be built, hydrated and validated",
+						Flags: []cli.Flag{
+							verboseFlag,
+							briefFlag,
+							timeoutFlag,
+							&cli.Int64Flag{
+								Name:  "seed",
+								Usage: "`SEED` of the first topology, each next one uses the next seed (current time if not set)",
+							},
+							&cli.UintFlag{
+								Name:  "count",
+								Usage: "number of topologies to generate",
+								Value: 100,
+							},
+							&cli.StringFlag{
+								Name:  "out-dir",
+								Usage: "save failing topologies to `DIR`",
+								Value: "fuzz",
+							},
+							&cli.UintFlag{
+								Name:  "max-spines",
+								Usage: "max number of spines (per pod if spines per pod)",
+								Value: 4,
+							},
+							&cli.UintFlag{
+								Name:  "max-leafs",
+								Usage: "max number of leafs",
+								Value: 16,
+							},
+							&cli.UintFlag{
+								Name:  "max-servers",
+								Usage: "max number of servers of each type per leaf group",
+								Value: 3,
+							},
+							&cli.UintFlag{
+								Name:  "max-racks",
+								Usage: "max number of racks",
+								Value: 3,
+							},
+							&cli.UintFlag{
+								Name:  "max-externals",
+								Usage: "max number of externals",
+								Value: 2,
+							},
+						},
+						Before: func(_ *cli.Context) error {
+							return setupLogger(verbose, brief, output)
+						},
+						Action: func(cCtx *cli.Context) error {
+							ctx, cancel := withTimeout(cCtx.Context, timeout)
+							defer cancel()
+
+							seed := cCtx.Int64("seed")
+							if !cCtx.IsSet("seed") {
+								seed = time.Now().UnixNano()
+							}
+
+							for _, flag := range []string{"max-spines", "max-leafs", "max-servers", "max-racks", "max-externals"} {
+								if cCtx.Uint(flag) > math.MaxUint8 {
+									return errors.Errorf("invalid %s %d (max: %d)", flag, cCtx.Uint(flag), math.MaxUint8)
+								}
+							}
+
+							err := fab.FuzzWiring(ctx, wiring.FuzzConfig{
+								Seed:   seed,
+								Count:  cCtx.Uint("count"),
+								OutDir: cCtx.String("out-dir"),
+								Bounds: wiring.FuzzBounds{
+									MaxSpines:    uint8(cCtx.Uint("max-spines")),
+									MaxLeafs:     uint8(cCtx.Uint("max-leafs")),
+									MaxServers:   uint8(cCtx.Uint("max-servers")),
+									MaxRacks:     uint8(cCtx.Uint("max-racks")),
+									MaxExternals: uint8(cCtx.Uint("max-externals")),
+								},
+							})
+							if err != nil {
+								return errors.Wrap(err, "error fuzzing wiring")
+							}
+
+							return nil
+						},
+					},
 					{
 						Name:  "graph",
-						Usage: "generate dot graph from wiring diagram (experimental)",
+						Usage: "generate graph from wiring diagram",
 						Flags: []cli.Flag{
 							verboseFlag,
 							briefFlag,
@@ -903,12 +1356,31 @@ func main() {
 								Aliases: []string{"w"},
 								Usage:   "use wiring `FILE`",
 							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "output format, one of: " + strings.Join(visual.Formats, ", "),
+								Value:   visual.FormatDot,
+							},
+							&cli.BoolFlag{
+								Name:  "ports",
+								Usage: "show port names on the links",
+								Value: true,
+							},
+							&cli.BoolFlag{
+								Name:  "ips",
+								Usage: "show IPs and ASNs",
+								Value: true,
+							},
 						},
 						Before: func(_ *cli.Context) error {
-							return setupLogger(verbose, brief)
+							return setupLogger(verbose, brief, output)
 						},
 						Action: func(cCtx *cli.Context) error {
-							data, err := wiring.Visualize(cCtx.String("wiring"))
+							data, err := wiring.Visualize(cCtx.String("wiring"), cCtx.String("format"), visual.Options{
+								Ports: cCtx.Bool("ports"),
+								IPs:   cCtx.Bool("ips"),
+							})
 							if err != nil {
 								return errors.Wrap(err, "error visualizing")
 							}
@@ -923,8 +1395,11 @@ func main() {
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		stop()
 		slog.Error("Failed", "err", err.Error())
-		os.Exit(1)
+		os.Exit(1) //nolint:gocritic
 	}
+	stop()
 }
@@ -20,6 +20,7 @@ import (
 	"os/user"
 	"path/filepath"
 
+	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 	"go.githedgehog.com/fabric/api/meta"
 	"go.githedgehog.com/fabricator/pkg/fab/cnc"
@@ -29,11 +30,14 @@ import (
 
 var (
 	HHSubnet                      = "172.30.0.0/16" // All Hedgehog Fabric IPs assignment will happen from this subnet
+	VLABSubnet                    = "172.31.0.0/16"
+	VPCLoopbackSubnet             = "172.30.240.0/20"
 	ControlKubeClusterCIDR        = "172.28.0.0/16"
 	ControlKubeServiceCIDR        = "172.29.0.0/16"
 	ControlKubeClusterDNS         = "172.29.0.10"
 	ControlVIP                    = "172.30.1.1"
 	ControlVIPMask                = "/32"
+	ControlHASubnet               = "172.30.2.0/24" // Network between control nodes in VLAB if there are more than one
 	ASNSpine               uint32 = 65100
 	ASNLeafStart           uint32 = 65101
 	ZotCheckURL                   = fmt.Sprintf("https://%s:%d/v2/_catalog", ControlVIP, ZotNodePort)
@@ -43,6 +47,13 @@ var (
 	DasBootSyslogNodePort         = 30514
 	ControlProxyNodePort          = 31028
 
+	// Preflight requirements for the control node
+	PreflightDataDir              = "/var/lib/rancher"
+	PreflightK3sDisk       uint64 = 10 * humanize.GiByte
+	PreflightK3sMemory     uint64 = 4 * humanize.GiByte
+	PreflightZotDisk       uint64 = 20 * humanize.GiByte
+	PreflightKernelModules        = []string{"overlay", "br_netfilter"}
+
 	DevSSHKey     = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGpF2+9I1Nj4BcN7y6DjzTbq1VcUYIRGyfzId5ZoBEFj" // 1P: Fabric Dev SSH Key Shared
 	DevPassword   = "$5$8nAYPGcl4l6G7Av1$Qi4/gnM0yPtGv9kjpMh78NuNSfQWy7vR1rulHpurL36"                  //nolint:gosec // 1P: Fabric Dev SONiC Admin
 	DevSonicUsers = []meta.UserCreds{
@@ -214,6 +225,10 @@ var (
 	BundleControlOS = cnc.Bundle{
 		Name: "control-os",
 	}
+	BundleControlJoinInstall = []cnc.Bundle{ // Additional control nodes joining the first one, in the control nodes order
+		{Name: "control-install-2", IsInstaller: true},
+		{Name: "control-install-3", IsInstaller: true},
+	}
 	BundleServerInstall = cnc.Bundle{
 		Name:        "server-install",
 		IsInstaller: true,
@@ -234,7 +249,7 @@ var (
 
 // We expect services installed during the stage to be available at the end of it
 const (
-	Stage                cnc.Stage = iota // Just a placeholder stage
+	Stage                cnc.Stage = iota // Just a placeholder stage, preflight checks are always running first
 	StageInstall0Prep                     // Preparation for K3s and Zot installation
 	StageInstall1K3sZot                   // Kube and Registry Installation, wait for registry available
 	StageInstall2Misc                     // Install misc services and wait for them to be ready
@@ -248,7 +263,7 @@ const (
 func NewCNCManager() *cnc.Manager {
 	return cnc.New(
 		Presets,
-		[]cnc.Bundle{BundleControlInstall, BundleControlOS, BundleServerInstall, BundleServerOS, BundleVlabFiles},
+		append([]cnc.Bundle{BundleControlInstall, BundleControlOS, BundleServerInstall, BundleServerOS, BundleVlabFiles}, BundleControlJoinInstall...),
 		StageMax,
 		[]cnc.Component{
 			&Base{},
@@ -269,6 +284,19 @@ func NewCNCManager() *cnc.Manager {
 	)
 }
 
+// IPAMReserved returns subnets and IPs used by the fabric outside of the wiring to be listed in the IPAM export
+func IPAMReserved() []fabwiring.IPAMEntry {
+	return []fabwiring.IPAMEntry{
+		{Prefix: ControlVIP + ControlVIPMask, Kind: "Fabric", Name: "control-vip"},
+		{Prefix: ControlHASubnet, Kind: "Fabric", Name: "control-ha"},
+		{Prefix: VPCLoopbackSubnet, Kind: "Fabric", Name: "vpc-loopback"},
+		{Prefix: HHSubnet, Kind: "Fabric", Name: "fabric-subnet"},
+		{Prefix: VLABSubnet, Kind: "Fabric", Name: "vlab-subnet"},
+		{Prefix: ControlKubeClusterCIDR, Kind: "K3s", Name: "cluster-cidr"},
+		{Prefix: ControlKubeServiceCIDR, Kind: "K3s", Name: "service-cidr"},
+	}
+}
+
 const (
 	OCIRepoCACN     = "OCI Repository CA"
 	OCIRepoServerCN = "localhost"
@@ -288,19 +316,26 @@ func LoadVLAB(basedir string, mngr *cnc.Manager, dryRun bool, size string, restr
 		sudoSwtpm = true
 	}
 
+	controlJoinInstallers := []string{}
+	for _, bundle := range BundleControlJoinInstall {
+		controlJoinInstallers = append(controlJoinInstallers, filepath.Join(basedir, bundle.Name))
+	}
+
 	svc, err := vlab.Load(&vlab.ServiceConfig{
-		DryRun:            dryRun,
-		Size:              size,
-		SudoSwtpm:         sudoSwtpm,
-		Basedir:           filepath.Join(basedir, BundleVlabVMs.Name),
-		Wiring:            mngr.Wiring(),
-		ControlIgnition:   filepath.Join(basedir, BundleControlOS.Name, ControlOSIgnition),
-		ServerIgnitionDir: filepath.Join(basedir, BundleServerOS.Name),
-		ControlInstaller:  filepath.Join(basedir, BundleControlInstall.Name),
-		ServerInstaller:   filepath.Join(basedir, BundleServerInstall.Name),
-		RestrictServers:   restrictServers,
-		FilesDir:          filepath.Join(basedir, BundleVlabFiles.Name),
-		SSHKey:            filepath.Join(basedir, DefaultVLABSSHKey),
+		DryRun:                dryRun,
+		Size:                  size,
+		SudoSwtpm:             sudoSwtpm,
+		Basedir:               filepath.Join(basedir, BundleVlabVMs.Name),
+		Wiring:                mngr.Wiring(),
+		ControlIgnition:       filepath.Join(basedir, BundleControlOS.Name, ControlOSIgnition),
+		ServerIgnitionDir:     filepath.Join(basedir, BundleServerOS.Name),
+		ControlInstaller:      filepath.Join(basedir, BundleControlInstall.Name),
+		ControlIgnitionDir:    filepath.Join(basedir, BundleControlOS.Name),
+		ControlJoinInstallers: controlJoinInstallers,
+		ServerInstaller:       filepath.Join(basedir, BundleServerInstall.Name),
+		RestrictServers:       restrictServers,
+		FilesDir:              filepath.Join(basedir, BundleVlabFiles.Name),
+		SSHKey:                filepath.Join(basedir, DefaultVLABSSHKey),
 	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading VLAB")
@@ -16,6 +16,7 @@ package fab
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
@@ -97,7 +98,7 @@ func (cfg *Base) Hydrate(preset cnc.Preset, _ meta.FabricMode) error {
 	return nil
 }
 
-func (cfg *Base) Build(basedir string, preset cnc.Preset, _ meta.FabricMode, _ cnc.GetComponent, _ *wiring.Data, _ cnc.AddBuildOp, _ cnc.AddRunOp) error {
+func (cfg *Base) Build(basedir string, preset cnc.Preset, _ meta.FabricMode, _ cnc.GetComponent, _ *wiring.Data, _ cnc.AddBuildOp, install cnc.AddRunOp) error {
 	if cfg.Dev {
 		slog.Warn("Attention! Development mode enabled - this is not secure! Default users and keys will be created.")
 	}
@@ -111,6 +112,12 @@ func (cfg *Base) Build(basedir string, preset cnc.Preset, _ meta.FabricMode, _ c
 		cfg.AuthorizedKeys = append([]string{key}, cfg.AuthorizedKeys...)
 	}
 
+	// certificates are generated before the build, so host clock shouldn't be behind it
+	install(BundleControlInstall, Stage, "base-preflight",
+		&cnc.Preflight{
+			NotBefore: time.Now(),
+		})
+
 	return nil
 }
 
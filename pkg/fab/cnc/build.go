@@ -56,6 +56,9 @@ type File struct {
 	InstallName      string
 	InstallMode      os.FileMode
 	InstallMkdirMode os.FileMode
+	InstallUID       *int
+	InstallGID       *int
+	InstallBackup    bool // keep previous file as a backup for rollback
 }
 
 //
@@ -89,14 +92,16 @@ func (op *FilesORAS) Hydrate() error {
 	return nil
 }
 
-func (op *FilesORAS) Build(basedir string) error {
+func (op *FilesORAS) Build(ctx context.Context, basedir string) (err error) {
 	skip := true
+	missing := []string{}
 
 	for _, f := range op.Files {
 		fPath := filepath.Join(basedir, f.Name)
 		info, err := os.Stat(fPath)
 		if os.IsNotExist(err) {
 			skip = false
+			missing = append(missing, fPath)
 			slog.Debug("File is missing", "path", fPath)
 		} else if err != nil {
 			return errors.Wrapf(err, "error statting file %s", fPath)
@@ -115,6 +120,17 @@ func (op *FilesORAS) Build(basedir string) error {
 
 	slog.Info("Downloading", "name", op.Ref, "to", basedir)
 
+	for _, f := range op.Unpack {
+		missing = append(missing, filepath.Join(basedir, f))
+	}
+
+	// don't leave partially downloaded files behind, so they aren't treated as present on the next build
+	defer func() {
+		if err != nil {
+			removePartial(missing...)
+		}
+	}()
+
 	fs, err := file.New(basedir)
 	if err != nil {
 		return errors.Wrapf(err, "error creating oras file store in %s", basedir)
@@ -146,27 +162,45 @@ func (op *FilesORAS) Build(basedir string) error {
 	pb := mpb.New(mpb.WithWidth(5))
 	bars := sync.Map{}
 
+	blobName := func(desc ocispec.Descriptor) string {
+		if desc.Annotations != nil {
+			if title, exist := desc.Annotations["org.opencontainers.image.title"]; exist {
+				return title
+			}
+		}
+
+		return "blob " + desc.Digest.Encoded()[:12]
+	}
+
 	complete := func(_ context.Context, desc ocispec.Descriptor) error {
 		if v, ok := bars.Load(desc.Digest.String()); ok {
 			v.(*mpb.Bar).SetCurrent(desc.Size)
+		} else if EventsEnabled() && desc.Size >= 1_000_000 {
+			emitProgress(blobName(desc), desc.Size, desc.Size)
 		}
 
 		return nil
 	}
 
-	_, err = oras.Copy(context.Background(), repo, op.Ref.Tag, fs, op.Ref.Tag, oras.CopyOptions{
+	_, err = oras.Copy(ctx, repo, op.Ref.Tag, fs, op.Ref.Tag, oras.CopyOptions{
 		CopyGraphOptions: oras.CopyGraphOptions{
 			Concurrency: 3,
 			PreCopy: func(ctx context.Context, desc ocispec.Descriptor) error {
-				if !slog.Default().Enabled(ctx, slog.LevelInfo) || desc.Size < 1_000_000 { // skip progress bar if < 1MB
+				if desc.Size < 1_000_000 { // skip progress bar if < 1MB
 					return nil
 				}
 
-				name := "blob " + desc.Digest.Encoded()[:12]
-				if desc.Annotations != nil {
-					name = desc.Annotations["org.opencontainers.image.title"]
+				if EventsEnabled() {
+					emitProgress(blobName(desc), 0, desc.Size)
+
+					return nil
 				}
-				name = "Copying " + name
+
+				if !slog.Default().Enabled(ctx, slog.LevelInfo) {
+					return nil
+				}
+
+				name := "Copying " + blobName(desc)
 
 				bars.Store(desc.Digest.String(), pb.AddSpinner(desc.Size,
 					mpb.PrependDecorators(
@@ -193,7 +227,7 @@ func (op *FilesORAS) Build(basedir string) error {
 	pb.Wait()
 
 	for _, f := range op.Unpack {
-		err := UnpackFile(basedir, f)
+		err := UnpackFile(ctx, basedir, f)
 		if err != nil {
 			return errors.Wrap(err, "error unpacking file")
 		}
@@ -211,7 +245,7 @@ func (op *FilesORAS) Build(basedir string) error {
 	return nil
 }
 
-func UnpackFile(basedir string, name string) error { // TODO validate we've got files we've been looking for?
+func UnpackFile(ctx context.Context, basedir string, name string) (err error) { // TODO validate we've got files we've been looking for?
 	fromPath := filepath.Join(basedir, name)
 	from, err := os.Open(fromPath)
 	if err != nil {
@@ -225,10 +259,15 @@ func UnpackFile(basedir string, name string) error { // TODO validate we've got
 		return errors.Wrapf(err, "error creating file %s", toPath)
 	}
 	defer to.Close()
+	defer func() {
+		if err != nil {
+			removePartial(toPath)
+		}
+	}()
 
 	slog.Info("Unpacking", "from", fromPath)
 
-	var reader io.Reader = bufio.NewReader(from)
+	var reader io.Reader = bufio.NewReader(newContextReader(ctx, from))
 
 	if filepath.Ext(name) == ".xz" {
 		reader, err = xz.NewReader(reader)
@@ -256,7 +295,7 @@ func UnpackFile(basedir string, name string) error { // TODO validate we've got
 	}
 
 	var bar *mpb.Bar
-	if slog.Default().Enabled(context.Background(), slog.LevelInfo) && info.Size() > 10_000_000 {
+	if !EventsEnabled() && slog.Default().Enabled(ctx, slog.LevelInfo) && info.Size() > 10_000_000 {
 		bar = p.AddBar(info.Size(),
 			mpb.PrependDecorators(
 				decor.Counters(decor.SizeB1024(0), "% .2f / % .2f", decor.WCSyncSpace),
@@ -304,6 +343,9 @@ func (op *FilesORAS) RunOps() []RunOp {
 				TargetName: f.InstallName,
 				Mode:       f.InstallMode,
 				MkdirMode:  f.InstallMkdirMode,
+				UID:        f.InstallUID,
+				GID:        f.InstallGID,
+				Backup:     f.InstallBackup,
 			})
 		}
 	}
@@ -332,7 +374,7 @@ func (op *FileGenerate) Hydrate() error {
 	return nil
 }
 
-func (op *FileGenerate) Build(basedir string) error {
+func (op *FileGenerate) Build(_ context.Context, basedir string) error {
 	content, err := op.Content()
 	if err != nil {
 		return err
@@ -361,6 +403,9 @@ func (op *FileGenerate) RunOps() []RunOp {
 				TargetName: op.File.InstallName,
 				Mode:       op.File.InstallMode,
 				MkdirMode:  op.File.InstallMkdirMode,
+				UID:        op.File.InstallUID,
+				GID:        op.File.InstallGID,
+				Backup:     op.File.InstallBackup,
 			},
 		}
 	}
@@ -404,7 +449,7 @@ func (op *SyncOCI) filePath() string {
 	return strings.ReplaceAll(fmt.Sprintf("%s@%s", op.Ref.Name, op.Ref.Tag), "/", "_") + ".oci"
 }
 
-func (op *SyncOCI) Build(basedir string) error {
+func (op *SyncOCI) Build(ctx context.Context, basedir string) error {
 	path := filepath.Join(basedir, op.filePath())
 
 	skip := true
@@ -426,8 +471,11 @@ func (op *SyncOCI) Build(basedir string) error {
 	} else {
 		slog.Info("Downloading", "ref", op.Ref, "to", path)
 
-		err = copyOCI("docker://"+op.Ref.String(), "oci:"+path, op.Ref.IsLocalhost())
+		err = copyOCI(ctx, "docker://"+op.Ref.String(), "oci:"+path, op.Ref.IsLocalhost())
 		if err != nil {
+			// partial OCI layout would be treated as present on the next build
+			removePartial(path)
+
 			return err
 		}
 	}
@@ -444,7 +492,7 @@ func (op *SyncOCI) RunOps() []RunOp {
 	}
 }
 
-func copyOCI(from, to string, insecureSource bool) error {
+func copyOCI(ctx context.Context, from, to string, insecureSource bool) error {
 	srcRef, err := alltransports.ParseImageName(from)
 	if err != nil {
 		return errors.Wrapf(err, "error parsing source ref %s", from)
@@ -468,7 +516,7 @@ func copyOCI(from, to string, insecureSource bool) error {
 	barStart := map[string]time.Time{}
 	go func() {
 		for p := range progressChan {
-			if !slog.Default().Enabled(context.Background(), slog.LevelInfo) || p.Artifact.Size < 1_000_000 { // skip progress bae if < 1MB
+			if p.Artifact.Size < 1_000_000 { // skip progress bar if < 1MB
 				continue
 			}
 
@@ -477,6 +525,19 @@ func copyOCI(from, to string, insecureSource bool) error {
 			if title, exist := p.Artifact.Annotations["org.opencontainers.image.title"]; exist {
 				name = title
 			}
+
+			if EventsEnabled() {
+				if p.Event != types.ProgressEventSkipped {
+					emitProgress(name, int64(p.Offset), p.Artifact.Size) //nolint:gosec
+				}
+
+				continue
+			}
+
+			if !slog.Default().Enabled(ctx, slog.LevelInfo) {
+				continue
+			}
+
 			name = "Copying " + name
 
 			digest := p.Artifact.Digest.String()
@@ -506,16 +567,16 @@ func copyOCI(from, to string, insecureSource bool) error {
 		sourceInsecure = types.OptionalBoolTrue
 	}
 
-	_, err = copy.Image(context.Background(), policyCtx, destRef, srcRef, &copy.Options{
+	_, err = copy.Image(ctx, policyCtx, destRef, srcRef, &copy.Options{
 		ProgressInterval:   1 * time.Second,
 		Progress:           progressChan,
 		ImageListSelection: copy.CopyAllImages,
 		SourceCtx: &types.SystemContext{
 			DockerInsecureSkipTLSVerify: sourceInsecure,
-			DockerAuthConfig:            getDockerAuthConfigOrNil(srcRef),
+			DockerAuthConfig:            getDockerAuthConfigOrNil(ctx, srcRef),
 		},
 		DestinationCtx: &types.SystemContext{
-			DockerAuthConfig: getDockerAuthConfigOrNil(destRef),
+			DockerAuthConfig: getDockerAuthConfigOrNil(ctx, destRef),
 		},
 	})
 	if err != nil {
@@ -527,7 +588,7 @@ func copyOCI(from, to string, insecureSource bool) error {
 	return nil
 }
 
-func getDockerAuthConfigOrNil(ref types.ImageReference) *types.DockerAuthConfig {
+func getDockerAuthConfigOrNil(ctx context.Context, ref types.ImageReference) *types.DockerAuthConfig {
 	if ref.Transport().Name() == "docker" {
 		storeOpts := credentials.StoreOptions{}
 		credStore, err := credentials.NewStoreFromDocker(storeOpts)
@@ -538,7 +599,7 @@ func getDockerAuthConfigOrNil(ref types.ImageReference) *types.DockerAuthConfig
 		}
 
 		baseRepo := strings.SplitN(ref.DockerReference().String(), "/", 2)[0]
-		creds, err := credStore.Get(context.Background(), baseRepo)
+		creds, err := credStore.Get(ctx, baseRepo)
 		if err != nil {
 			slog.Warn("Error getting docker credentials", "repo", baseRepo, "err", err)
 
@@ -555,3 +616,14 @@ func getDockerAuthConfigOrNil(ref types.ImageReference) *types.DockerAuthConfig
 
 	return nil
 }
+
+// removePartial removes outputs left after failed or interrupted build
+func removePartial(paths ...string) {
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			slog.Warn("Failed to remove partial output", "path", path, "err", err)
+		} else {
+			slog.Debug("Removed partial output", "path", path)
+		}
+	}
+}
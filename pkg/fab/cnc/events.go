@@ -0,0 +1,259 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+var Outputs = []string{OutputText, OutputJSON}
+
+type EventType string
+
+const (
+	EventActionStarted  EventType = "action-started"  // build or run action started
+	EventActionFinished EventType = "action-finished" // build or run action finished successfully
+	EventActionFailed   EventType = "action-failed"   // build or run action failed, error is set
+	EventProgress       EventType = "progress"        // download or copy progress, current and total are set
+	EventLog            EventType = "log"             // any other log message, level, msg and attrs are set
+)
+
+// Event is a single structured progress event emitted as one JSON object per line in the json output mode.
+//
+// The schema is stable: fields are never renamed or removed, new fields and event types could be added, so
+// consumers should ignore unknown ones. Fields:
+//
+//	time       RFC 3339 timestamp with nanoseconds, always set
+//	type       one of action-started, action-finished, action-failed, progress, log, always set
+//	phase      "build" for hhfab build and "run" for hhfab-recipe, set for action events
+//	name       action name, or file/blob name for progress
+//	stage      recipe stage of the action, set for run action events
+//	component  component the action belongs to
+//	op         short human-readable op summary, e.g. "file /etc/rancher/k3s/config.yaml"
+//	durationMs action duration in milliseconds, set for action-finished and action-failed
+//	error      error message, set for action-failed
+//	current    bytes done, set for progress
+//	total      bytes total, set for progress
+//	level      log level (DEBUG, INFO, WARN, ERROR), set for log
+//	msg        log message, set for log
+//	attrs      log attributes, set for log if any
+type Event struct {
+	Time       time.Time      `json:"time"`
+	Type       EventType      `json:"type"`
+	Phase      string         `json:"phase,omitempty"`
+	Name       string         `json:"name,omitempty"`
+	Stage      *Stage         `json:"stage,omitempty"`
+	Component  string         `json:"component,omitempty"`
+	Op         string         `json:"op,omitempty"`
+	DurationMS *int64         `json:"durationMs,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Current    *int64         `json:"current,omitempty"`
+	Total      *int64         `json:"total,omitempty"`
+	Level      string         `json:"level,omitempty"`
+	Message    string         `json:"msg,omitempty"`
+	Attrs      map[string]any `json:"attrs,omitempty"`
+}
+
+const (
+	PhaseBuild = "build"
+	PhaseRun   = "run"
+)
+
+var events = struct {
+	sync.Mutex
+	out io.Writer
+}{}
+
+// SetEventOutput enables emitting events to the writer, nil disables it
+func SetEventOutput(w io.Writer) {
+	events.Lock()
+	defer events.Unlock()
+
+	events.out = w
+}
+
+// EventsEnabled is true if events are emitted, progress bars should be disabled in such case
+func EventsEnabled() bool {
+	events.Lock()
+	defer events.Unlock()
+
+	return events.out != nil
+}
+
+func EmitEvent(ev Event) {
+	events.Lock()
+	defer events.Unlock()
+
+	if events.out == nil {
+		return
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		data, _ = json.Marshal(Event{Time: ev.Time, Type: EventLog, Level: slog.LevelError.String(), Message: "error marshaling event: " + err.Error()})
+	}
+
+	_, _ = events.out.Write(append(data, '\n'))
+}
+
+// emitActionStarted emits action-started for the action described by the base event
+func emitActionStarted(base Event) {
+	base.Type = EventActionStarted
+	EmitEvent(base)
+}
+
+// emitActionDone emits action-finished or action-failed (if err isn't nil) for the action described by the base event
+func emitActionDone(base Event, start time.Time, err error) {
+	base.Type = EventActionFinished
+	base.DurationMS = ptr(time.Since(start).Milliseconds())
+	if err != nil {
+		base.Type = EventActionFailed
+		base.Error = err.Error()
+	}
+
+	EmitEvent(base)
+}
+
+func emitProgress(name string, current, total int64) {
+	EmitEvent(Event{
+		Type:    EventProgress,
+		Name:    name,
+		Current: ptr(current),
+		Total:   ptr(total),
+	})
+}
+
+// commandOutput is where external commands output goes, stderr if stdout is reserved for events
+func commandOutput() io.Writer {
+	if EventsEnabled() {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// NewEventLogHandler returns slog handler that emits all log records as log events
+func NewEventLogHandler(level slog.Leveler) slog.Handler {
+	return &eventLogHandler{level: level}
+}
+
+type eventLogHandler struct {
+	level slog.Leveler
+	attrs []slog.Attr
+	group string
+}
+
+var _ slog.Handler = (*eventLogHandler)(nil)
+
+func (h *eventLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *eventLogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := map[string]any{}
+	for _, attr := range h.attrs {
+		addEventAttr(attrs, "", attr)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		addEventAttr(attrs, h.group, attr)
+
+		return true
+	})
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+
+	EmitEvent(Event{
+		Time:    r.Time,
+		Type:    EventLog,
+		Level:   r.Level.String(),
+		Message: r.Message,
+		Attrs:   attrs,
+	})
+
+	return nil
+}
+
+func (h *eventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := &eventLogHandler{level: h.level, group: h.group}
+	res.attrs = append(res.attrs, h.attrs...)
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr.Key = h.group + "." + attr.Key
+		}
+		res.attrs = append(res.attrs, attr)
+	}
+
+	return res
+}
+
+func (h *eventLogHandler) WithGroup(name string) slog.Handler {
+	res := &eventLogHandler{level: h.level, attrs: h.attrs, group: name}
+	if h.group != "" {
+		res.group = h.group + "." + name
+	}
+
+	return res
+}
+
+func addEventAttr(res map[string]any, prefix string, attr slog.Attr) {
+	key := attr.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() { //nolint:exhaustive
+	case slog.KindGroup:
+		for _, sub := range value.Group() {
+			addEventAttr(res, key, sub)
+		}
+	case slog.KindDuration:
+		res[key] = value.Duration().String()
+	case slog.KindTime:
+		res[key] = value.Time()
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			res[key] = v.Error()
+		case fmt.Stringer:
+			res[key] = v.String()
+		default:
+			res[key] = v
+		}
+	default:
+		res[key] = value.Any()
+	}
+}
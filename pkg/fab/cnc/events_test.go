@@ -0,0 +1,68 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_EventLogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	SetEventOutput(buf)
+	defer SetEventOutput(nil)
+
+	logger := slog.New(NewEventLogHandler(slog.LevelInfo)).With("bundle", "control-install")
+	logger.Debug("Hidden")
+	logger.WithGroup("op").Info("Running", "name", "k3s-config", "took", time.Second, "err", errors.New("boom"))
+	emitActionDone(Event{Phase: PhaseRun, Name: "k3s-config", Stage: ptr(Stage(1))}, time.Now(), errors.New("failed"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 events, got %d: %s", len(lines), buf.String())
+	}
+
+	ev := Event{}
+	if err := json.Unmarshal([]byte(lines[0]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != EventLog || ev.Level != "INFO" || ev.Message != "Running" {
+		t.Errorf("unexpected log event: %s", lines[0])
+	}
+	for key, value := range map[string]any{
+		"bundle":  "control-install",
+		"op.name": "k3s-config",
+		"op.took": "1s",
+		"op.err":  "boom",
+	} {
+		if ev.Attrs[key] != value {
+			t.Errorf("attr %s = %v, want %v", key, ev.Attrs[key], value)
+		}
+	}
+
+	ev = Event{}
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != EventActionFailed || ev.Error != "failed" || ev.DurationMS == nil || ev.Stage == nil || *ev.Stage != 1 {
+		t.Errorf("unexpected action event: %s", lines[1])
+	}
+}
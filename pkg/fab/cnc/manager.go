@@ -35,6 +35,9 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+// TenantsFile is the file in the basedir with the tenant objects installed together with the wiring
+const TenantsFile = "tenants.yaml"
+
 type Preset string
 
 type Bundle struct {
@@ -82,22 +85,25 @@ type (
 	AddRunOp     func(bundle Bundle, stage Stage, name string, op RunOp)
 )
 
+// BuildOp and RunOp are expected to stop as soon as ctx is done and to clean up partial outputs they've created
+
 type BuildOp interface {
 	Hydrate() error
-	Build(basedir string) error
+	Build(ctx context.Context, basedir string) error
 	RunOps() []RunOp
 }
 
 type RunOp interface {
 	Hydrate() error
 	Summary() string
-	Run(basedir string) error
+	Run(ctx context.Context, basedir string) error
 }
 
 type Manager struct {
 	basedir    string
 	preset     Preset
 	wiring     *wiring.Data
+	tenants    *fabwiring.Tenants
 	presets    []Preset
 	bundles    []Bundle
 	maxStage   Stage
@@ -169,7 +175,7 @@ func (mngr *Manager) prepare() error {
 	return nil
 }
 
-func (mngr *Manager) Init(basedir string, fromConfig string, preset Preset, fabricMode meta.FabricMode, wiringPath []string, wiringGen *fabwiring.Builder, hydrate bool) error {
+func (mngr *Manager) Init(basedir string, fromConfig string, preset Preset, fabricMode meta.FabricMode, wiringPath []string, wiringGen *fabwiring.Builder, hydrate bool, ipPlanPath string) error {
 	if _, err := os.Stat(basedir); err == nil {
 		if !os.IsNotExist(err) {
 			return errors.Errorf("basedir %s already exists, please, remove it first", basedir)
@@ -191,11 +197,13 @@ func (mngr *Manager) Init(basedir string, fromConfig string, preset Preset, fabr
 			return errors.Wrapf(err, "error creating wiring")
 		}
 
+		mngr.tenants = &fabwiring.Tenants{}
 		for _, path := range wiringPath {
-			err = wiring.LoadDataFrom(path, data)
+			tenants, err := fabwiring.LoadWiring(path, data)
 			if err != nil {
 				return errors.Wrapf(err, "error loading wiring from %s", path)
 			}
+			mngr.tenants.Append(tenants)
 		}
 
 		mngr.wiring = data
@@ -211,6 +219,7 @@ func (mngr *Manager) Init(basedir string, fromConfig string, preset Preset, fabr
 		}
 
 		mngr.wiring = data
+		mngr.tenants = wiringGen.Tenants()
 	}
 
 	if fromConfig != "" {
@@ -232,18 +241,45 @@ func (mngr *Manager) Init(basedir string, fromConfig string, preset Preset, fabr
 		return errors.Errorf("unknown preset: %s", preset)
 	}
 
+	hydrateCfg := *mngr.hydrateCfg
+	if ipPlanPath != "" {
+		slog.Info("Loading IP plan", "from", ipPlanPath)
+
+		plan, err := fabwiring.LoadIPPlan(ipPlanPath, hydrateCfg.Subnet)
+		if err != nil {
+			return errors.Wrapf(err, "error loading ip plan")
+		}
+		hydrateCfg.IPPlan = plan
+	}
+
 	if err := fabwiring.IsHydrated(mngr.wiring); err != nil {
 		err = errors.Wrapf(err, "error validating wiring")
 
 		if hydrate {
 			slog.Warn("Wiring is not hydrated, hydrating", "reason", err.Error())
 
-			if err := fabwiring.Hydrate(mngr.wiring, mngr.hydrateCfg); err != nil {
+			// keep everything already assigned and only fill the gaps
+			hydrateCfg.Incremental = true
+
+			report, err := fabwiring.Hydrate(mngr.wiring, &hydrateCfg)
+			if err != nil {
 				return errors.Wrapf(err, "error hydrating wiring")
 			}
+			for _, a := range report.Assigned {
+				slog.Info("Assigned", "kind", a.Kind, "name", a.Name, "field", a.Field, "value", a.Value)
+			}
 		} else {
 			return err
 		}
+	} else if hydrateCfg.IPPlan != nil {
+		// wiring is already hydrated so the plan is only used to check existing assignments
+		ipam, err := fabwiring.BuildIPAM(mngr.wiring, hydrateCfg.IPPlan, nil)
+		if err != nil {
+			return errors.Wrapf(err, "error checking wiring against ip plan")
+		}
+		if err := ipam.CheckPools(); err != nil {
+			return errors.Wrapf(err, "hydrated wiring doesn't match ip plan %s", ipPlanPath)
+		}
 	}
 
 	if err := mngr.prepare(); err != nil {
@@ -284,6 +320,11 @@ func (mngr *Manager) Save() error {
 		return errors.Wrapf(err, "error saving wiring")
 	}
 
+	err = mngr.tenants.SaveTo(filepath.Join(mngr.basedir, TenantsFile))
+	if err != nil {
+		return errors.Wrapf(err, "error saving tenants")
+	}
+
 	return nil
 }
 
@@ -363,6 +404,11 @@ func (mngr *Manager) Load(basedir string) error {
 	}
 	mngr.wiring = wiringData
 
+	mngr.tenants, err = fabwiring.LoadTenants(filepath.Join(basedir, TenantsFile))
+	if err != nil {
+		return errors.Wrapf(err, "error loading tenants")
+	}
+
 	err = mngr.prepare()
 	if err != nil {
 		return errors.Wrapf(err, "error preparing")
@@ -371,10 +417,11 @@ func (mngr *Manager) Load(basedir string) error {
 	return nil
 }
 
-func (mngr *Manager) Build(pack bool) error {
+func (mngr *Manager) Build(ctx context.Context, pack bool) error {
 	start := time.Now()
 
 	actions := map[Bundle][][]recipeContext{}
+	preflights := map[Bundle]*Preflight{}
 	for _, bundle := range mngr.bundles {
 		actions[bundle] = make([][]recipeContext, mngr.maxStage)
 
@@ -397,9 +444,13 @@ func (mngr *Manager) Build(pack bool) error {
 			continue
 		}
 
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "building interrupted")
+		}
+
 		slog.Info("Building", "component", comp.Name())
 
-		adder := &opAdder{mngr: mngr}
+		adder := &opAdder{ctx: ctx, mngr: mngr, comp: comp.Name()}
 		err := comp.Build(mngr.basedir, mngr.preset, mngr.fabricMode, mngr.getComponent, mngr.wiring, adder.addBuildOp, adder.addRunOp)
 		if err != nil {
 			return errors.Wrapf(err, "error building component %s", comp.Name())
@@ -414,6 +465,23 @@ func (mngr *Manager) Build(pack bool) error {
 				return errors.Wrapf(err, "error hydrating run op %s", runOp.name)
 			}
 
+			if installFile, ok := runOp.op.(*InstallFile); ok {
+				err = installFile.UpdateChecksum(filepath.Join(mngr.basedir, runOp.bundle.Name))
+				if err != nil {
+					return errors.Wrapf(err, "error calculating checksum for run op %s", runOp.name)
+				}
+			}
+
+			// all preflight checks are merged into a single action so all problems are reported at once
+			if preflight, ok := runOp.op.(*Preflight); ok {
+				if preflights[runOp.bundle] == nil {
+					preflights[runOp.bundle] = &Preflight{}
+				}
+				preflights[runOp.bundle].Merge(preflight)
+
+				continue
+			}
+
 			actions[runOp.bundle][int(runOp.stage)] = append(actions[runOp.bundle][int(runOp.stage)], runOp)
 		}
 
@@ -425,16 +493,37 @@ func (mngr *Manager) Build(pack bool) error {
 			continue
 		}
 
+		// bundles used only for some wirings (e.g. additional control nodes) are skipped if nothing is installed from them
+		if preflights[bundle] == nil && !slices.ContainsFunc(actions[bundle], func(stage []recipeContext) bool { return len(stage) > 0 }) {
+			slog.Debug("Skipping empty bundle", "bundle", bundle.Name)
+
+			if err := os.RemoveAll(filepath.Join(mngr.basedir, bundle.Name)); err != nil {
+				return errors.Wrapf(err, "error removing empty bundle dir %s", bundle.Name)
+			}
+
+			continue
+		}
+
 		slog.Info("Creating recipe", "bundle", bundle.Name)
 
 		recipe := &Recipe{}
 
+		if preflight := preflights[bundle]; preflight != nil {
+			slog.Info("Planned", "bundle", bundle.Name, "name", PreflightAction, "op", preflight.Summary())
+			recipe.Actions = append(recipe.Actions, RecipeAction{
+				Name: PreflightAction,
+				Op:   preflight,
+			})
+		}
+
 		for stage := 0; stage < int(mngr.maxStage); stage++ {
 			for _, action := range actions[bundle][stage] {
 				slog.Info("Planned", "bundle", bundle.Name, "name", action.name, "op", action.op.Summary())
 				recipe.Actions = append(recipe.Actions, RecipeAction{
-					Name: action.name,
-					Op:   action.op,
+					Name:      action.name,
+					Stage:     action.stage,
+					Component: action.comp,
+					Op:        action.op,
 				})
 			}
 		}
@@ -455,13 +544,13 @@ func (mngr *Manager) Build(pack bool) error {
 	slog.Info("Building done", "took", time.Since(start))
 
 	if pack {
-		return errors.Wrapf(mngr.Pack(), "error packing bundles")
+		return errors.Wrapf(mngr.Pack(ctx), "error packing bundles")
 	}
 
 	return nil
 }
 
-func (mngr *Manager) Pack() error {
+func (mngr *Manager) Pack(ctx context.Context) error {
 	start := time.Now()
 
 	for _, bundle := range mngr.bundles {
@@ -471,6 +560,14 @@ func (mngr *Manager) Pack() error {
 
 		target := bundle.Name + ".tgz"
 
+		if _, err := os.Stat(filepath.Join(mngr.basedir, bundle.Name)); errors.Is(err, os.ErrNotExist) {
+			if err := os.Remove(filepath.Join(mngr.basedir, target)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return errors.Wrapf(err, "error removing stale target %s", target)
+			}
+
+			continue
+		}
+
 		slog.Info("Packing", "bundle", bundle.Name, "target", target)
 
 		files, err := archiver.FilesFromDisk(nil, map[string]string{
@@ -494,8 +591,13 @@ func (mngr *Manager) Pack() error {
 			Archival: archiver.Tar{},
 		}
 
-		err = format.Archive(context.Background(), out, files)
+		err = format.Archive(ctx, out, files)
 		if err != nil {
+			out.Close()
+			if rmErr := os.Remove(out.Name()); rmErr != nil {
+				slog.Warn("Failed to remove partial archive", "target", target, "err", rmErr)
+			}
+
 			return errors.Wrapf(err, "error archiving bundle %s", bundle.Name)
 		}
 	}
@@ -520,7 +622,9 @@ func (mngr *Manager) getComponent(name string) Component {
 }
 
 type opAdder struct {
+	ctx     context.Context //nolint:containedctx
 	mngr    *Manager
+	comp    string
 	err     error
 	actions []recipeContext
 }
@@ -528,6 +632,7 @@ type opAdder struct {
 type recipeContext struct {
 	bundle Bundle
 	stage  Stage
+	comp   string
 	name   string
 	op     RunOp
 }
@@ -566,6 +671,12 @@ func (adder *opAdder) validate(bundle Bundle, stage Stage, name string, addedOps
 		return false
 	}
 
+	if name == PreflightAction {
+		adder.err = errors.Errorf("op name %s is reserved", name)
+
+		return false
+	}
+
 	if _, exist := addedOps[name]; exist {
 		adder.err = errors.Errorf("duplicate added op name: %s", name)
 
@@ -592,7 +703,16 @@ func (adder *opAdder) addBuildOp(bundle Bundle, stage Stage, name string, op Bui
 		return
 	}
 
-	err = op.Build(filepath.Join(adder.mngr.basedir, bundle.Name))
+	ev := Event{
+		Phase:     PhaseBuild,
+		Name:      name,
+		Component: adder.comp,
+		Op:        getShortTypeName(op),
+	}
+	start := time.Now()
+	emitActionStarted(ev)
+	err = op.Build(adder.ctx, filepath.Join(adder.mngr.basedir, bundle.Name))
+	emitActionDone(ev, start, err)
 	if err != nil {
 		adder.err = errors.Wrapf(err, "error building op %s", name)
 
@@ -610,6 +730,7 @@ func (adder *opAdder) addBuildOp(bundle Bundle, stage Stage, name string, op Bui
 		adder.actions = append(adder.actions, recipeContext{
 			bundle: bundle,
 			stage:  stage,
+			comp:   adder.comp,
 			name:   name,
 			op:     runOp,
 		})
@@ -635,6 +756,7 @@ func (adder *opAdder) addRunOp(bundle Bundle, stage Stage, name string, op RunOp
 	adder.actions = append(adder.actions, recipeContext{
 		bundle: bundle,
 		stage:  stage,
+		comp:   adder.comp,
 		name:   name,
 		op:     op,
 	})
@@ -660,6 +782,20 @@ func (mngr *Manager) Wiring() *wiring.Data {
 	return mngr.wiring
 }
 
+// Tenants returns tenant objects installed with the wiring
+func (mngr *Manager) Tenants() *fabwiring.Tenants {
+	return mngr.tenants
+}
+
 func (mngr *Manager) Preset() Preset {
 	return mngr.preset
 }
+
+func (mngr *Manager) FabricMode() meta.FabricMode {
+	return mngr.fabricMode
+}
+
+// Component returns the enabled component by name, nil if it's not enabled
+func (mngr *Manager) Component(name string) Component {
+	return mngr.getComponent(name)
+}
@@ -0,0 +1,484 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// PreflightAction is the name of the recipe action all preflight ops of a bundle are merged into
+	PreflightAction = "preflight"
+	// PreflightPassedFile is created in the basedir once preflight checks passed, memory, disk and ports checks are only
+	// reported as warnings after that so the recipe could be re-run on the partially installed node
+	PreflightPassedFile = ".preflight-passed"
+)
+
+//
+// RunOp Preflight
+//
+
+// Preflight checks that the host is able to run the rest of the recipe, all checks are always executed and all
+// failures are reported at once. Preflight ops added by components are merged into a single action.
+type Preflight struct {
+	Disks         []PreflightDisk      `json:"disks,omitempty"`
+	Memory        uint64               `json:"memory,omitempty"`
+	TCPPorts      []int                `json:"tcpPorts,omitempty"`
+	UDPPorts      []int                `json:"udpPorts,omitempty"`
+	Interfaces    []PreflightInterface `json:"interfaces,omitempty"`
+	KernelModules []string             `json:"kernelModules,omitempty"`
+	NotBefore     time.Time            `json:"notBefore,omitempty"`
+}
+
+// PreflightDisk is a free space required at the path, requirements on the same filesystem are summed up
+type PreflightDisk struct {
+	Path string `json:"path,omitempty"`
+	Size uint64 `json:"size,omitempty"`
+}
+
+// PreflightInterface is a network interface expected on the host, IP is checked to not be used by other interfaces
+type PreflightInterface struct {
+	Name string `json:"name,omitempty"`
+	MAC  string `json:"mac,omitempty"`
+	IP   string `json:"ip,omitempty"`
+}
+
+var _ RunOp = (*Preflight)(nil)
+
+func (op *Preflight) Hydrate() error {
+	for _, d := range op.Disks {
+		if !filepath.IsAbs(d.Path) {
+			return errors.Errorf("disk path %s is not absolute", d.Path)
+		}
+	}
+
+	for _, port := range append(slices.Clone(op.TCPPorts), op.UDPPorts...) {
+		if port <= 0 || port > 65535 {
+			return errors.Errorf("invalid port %d", port)
+		}
+	}
+
+	for _, iface := range op.Interfaces {
+		if iface.Name == "" && iface.MAC == "" {
+			return errors.New("interface name or mac should be set")
+		}
+		if iface.MAC != "" {
+			if _, err := net.ParseMAC(iface.MAC); err != nil {
+				return errors.Wrapf(err, "invalid interface mac %s", iface.MAC)
+			}
+		}
+		if iface.IP != "" {
+			if _, err := parseIPOrCIDR(iface.IP); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, module := range op.KernelModules {
+		if module == "" || strings.ContainsAny(module, "/ ") {
+			return errors.Errorf("invalid kernel module name %q", module)
+		}
+	}
+
+	return nil
+}
+
+func (op *Preflight) Summary() string {
+	parts := []string{}
+	if len(op.Disks) > 0 {
+		parts = append(parts, "disk")
+	}
+	if op.Memory > 0 {
+		parts = append(parts, "memory")
+	}
+	if len(op.TCPPorts)+len(op.UDPPorts) > 0 {
+		parts = append(parts, "ports")
+	}
+	if len(op.Interfaces) > 0 {
+		parts = append(parts, "interfaces")
+	}
+	if len(op.KernelModules) > 0 {
+		parts = append(parts, "modules")
+	}
+	if !op.NotBefore.IsZero() {
+		parts = append(parts, "clock")
+	}
+
+	return fmt.Sprintf("preflight %s", strings.Join(parts, ","))
+}
+
+// Merge adds all requirements from the other preflight op
+func (op *Preflight) Merge(other *Preflight) {
+	op.Disks = append(op.Disks, other.Disks...)
+	op.Memory += other.Memory
+
+	for _, port := range other.TCPPorts {
+		if !slices.Contains(op.TCPPorts, port) {
+			op.TCPPorts = append(op.TCPPorts, port)
+		}
+	}
+	for _, port := range other.UDPPorts {
+		if !slices.Contains(op.UDPPorts, port) {
+			op.UDPPorts = append(op.UDPPorts, port)
+		}
+	}
+
+	op.Interfaces = append(op.Interfaces, other.Interfaces...)
+
+	for _, module := range other.KernelModules {
+		if !slices.Contains(op.KernelModules, module) {
+			op.KernelModules = append(op.KernelModules, module)
+		}
+	}
+
+	if other.NotBefore.After(op.NotBefore) {
+		op.NotBefore = other.NotBefore
+	}
+}
+
+func (op *Preflight) Run(_ context.Context, basedir string) error {
+	var res *multierror.Error
+
+	passedFile := filepath.Join(basedir, PreflightPassedFile)
+	_, err := os.Stat(passedFile)
+	resumed := err == nil
+
+	for _, check := range []struct {
+		run func() error
+		// memory, disk space and ports are most probably taken by the components installed by the previous run
+		resumable bool
+	}{
+		{run: op.checkClock},
+		{run: op.checkMemory, resumable: true},
+		{run: op.checkDisks, resumable: true},
+		{run: op.checkPorts, resumable: true},
+		{run: op.checkInterfaces},
+		{run: op.checkKernelModules},
+	} {
+		err := check.run()
+		if err != nil && resumed && check.resumable {
+			slog.Warn("Ignoring preflight check failure as checks already passed before", "err", err.Error())
+
+			continue
+		}
+		if err != nil {
+			res = multierror.Append(res, err)
+		}
+	}
+
+	if err := res.ErrorOrNil(); err != nil {
+		return errors.Wrapf(err, "preflight checks failed")
+	}
+
+	if !resumed {
+		if err := os.WriteFile(passedFile, []byte(time.Now().Format(time.RFC3339)+"\n"), 0o644); err != nil { //nolint:gosec
+			return errors.Wrapf(err, "error writing %s", passedFile)
+		}
+	}
+
+	slog.Info("All preflight checks passed")
+
+	return nil
+}
+
+func (op *Preflight) checkClock() error {
+	if op.NotBefore.IsZero() {
+		return nil
+	}
+
+	if now := time.Now(); now.Before(op.NotBefore) {
+		return errors.Errorf("system clock %s is behind the bundle build time %s by %s, certificates will not be valid yet",
+			now.UTC().Format(time.RFC3339), op.NotBefore.UTC().Format(time.RFC3339), op.NotBefore.Sub(now).Round(time.Second))
+	}
+
+	return nil
+}
+
+func (op *Preflight) checkMemory() error {
+	if op.Memory == 0 {
+		return nil
+	}
+
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return errors.Wrapf(err, "error getting memory info")
+	}
+
+	if vm.Available < op.Memory {
+		return errors.Errorf("not enough memory: %s available, %s required", humanize.IBytes(vm.Available), humanize.IBytes(op.Memory))
+	}
+
+	return nil
+}
+
+func (op *Preflight) checkDisks() error {
+	if len(op.Disks) == 0 {
+		return nil
+	}
+
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return errors.Wrapf(err, "error getting disk partitions")
+	}
+
+	mountpoints := make([]string, 0, len(partitions))
+	for _, p := range partitions {
+		mountpoints = append(mountpoints, p.Mountpoint)
+	}
+
+	required := map[string]uint64{}
+	paths := map[string][]string{}
+	for _, d := range op.Disks {
+		mountpoint := findMountpoint(existingPath(d.Path), mountpoints)
+		required[mountpoint] += d.Size
+		if !slices.Contains(paths[mountpoint], d.Path) {
+			paths[mountpoint] = append(paths[mountpoint], d.Path)
+		}
+	}
+
+	var res *multierror.Error
+	for mountpoint, size := range required {
+		usage, err := disk.Usage(mountpoint)
+		if err != nil {
+			res = multierror.Append(res, errors.Wrapf(err, "error getting disk usage for %s", mountpoint))
+
+			continue
+		}
+
+		if usage.Free < size {
+			res = multierror.Append(res, errors.Errorf("not enough disk space on %s (for %s): %s free, %s required",
+				mountpoint, strings.Join(paths[mountpoint], ", "), humanize.IBytes(usage.Free), humanize.IBytes(size)))
+		}
+	}
+
+	return res.ErrorOrNil()
+}
+
+// existingPath returns the closest existing parent of the path with symlinks resolved
+func existingPath(path string) string {
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func findMountpoint(path string, mountpoints []string) string {
+	res := "/"
+	for _, mountpoint := range mountpoints {
+		if len(mountpoint) <= len(res) {
+			continue
+		}
+		if path == mountpoint || strings.HasPrefix(path, strings.TrimSuffix(mountpoint, "/")+"/") {
+			res = mountpoint
+		}
+	}
+
+	return res
+}
+
+func (op *Preflight) checkPorts() error {
+	var res *multierror.Error
+
+	for _, port := range op.TCPPorts {
+		l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+		if err != nil {
+			res = multierror.Append(res, errors.Errorf("tcp port %d is already in use", port))
+
+			continue
+		}
+		l.Close()
+	}
+
+	for _, port := range op.UDPPorts {
+		l, err := net.ListenPacket("udp", ":"+strconv.Itoa(port))
+		if err != nil {
+			res = multierror.Append(res, errors.Errorf("udp port %d is already in use", port))
+
+			continue
+		}
+		l.Close()
+	}
+
+	return res.ErrorOrNil()
+}
+
+func (op *Preflight) checkInterfaces() error {
+	if len(op.Interfaces) == 0 {
+		return nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return errors.Wrapf(err, "error getting network interfaces")
+	}
+
+	var res *multierror.Error
+	for _, expected := range op.Interfaces {
+		var found *net.Interface
+		for idx := range ifaces {
+			if (expected.Name != "" && ifaces[idx].Name == expected.Name) ||
+				(expected.Name == "" && strings.EqualFold(ifaces[idx].HardwareAddr.String(), expected.MAC)) {
+				found = &ifaces[idx]
+
+				break
+			}
+		}
+
+		if found == nil {
+			res = multierror.Append(res, errors.Errorf("management interface %s not found", expected.String()))
+
+			continue
+		}
+
+		if expected.MAC != "" {
+			mac, _ := net.ParseMAC(expected.MAC)
+			if found.HardwareAddr.String() != mac.String() {
+				res = multierror.Append(res, errors.Errorf("management interface %s has mac %s, expected %s",
+					found.Name, found.HardwareAddr, mac))
+			}
+		}
+
+		if expected.IP == "" {
+			continue
+		}
+
+		ip, _ := parseIPOrCIDR(expected.IP)
+		for _, iface := range ifaces {
+			if iface.Name == found.Name {
+				continue
+			}
+
+			addrs, err := iface.Addrs()
+			if err != nil {
+				res = multierror.Append(res, errors.Wrapf(err, "error getting addresses of interface %s", iface.Name))
+
+				continue
+			}
+
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+					res = multierror.Append(res, errors.Errorf("management ip %s is already assigned to interface %s, expected on %s",
+						ip, iface.Name, found.Name))
+				}
+			}
+		}
+	}
+
+	return res.ErrorOrNil()
+}
+
+func (iface PreflightInterface) String() string {
+	if iface.Name != "" && iface.MAC != "" {
+		return fmt.Sprintf("%s (%s)", iface.Name, iface.MAC)
+	}
+	if iface.Name != "" {
+		return iface.Name
+	}
+
+	return iface.MAC
+}
+
+func parseIPOrCIDR(value string) (net.IP, error) {
+	if ip, _, err := net.ParseCIDR(value); err == nil {
+		return ip, nil
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return ip, nil
+	}
+
+	return nil, errors.Errorf("invalid ip %s", value)
+}
+
+func (op *Preflight) checkKernelModules() error {
+	if len(op.KernelModules) == 0 {
+		return nil
+	}
+
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return errors.Wrapf(err, "error getting kernel release")
+	}
+	modulesDir := filepath.Join("/lib/modules", strings.TrimSpace(string(release)))
+
+	available := map[string]bool{}
+	for _, name := range []string{"modules.builtin", "modules.dep"} {
+		err := readModuleNames(filepath.Join(modulesDir, name), available)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+	}
+
+	var res *multierror.Error
+	for _, module := range op.KernelModules {
+		name := normalizeModuleName(module)
+		if available[name] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join("/sys/module", name)); err == nil {
+			continue
+		}
+
+		res = multierror.Append(res, errors.Errorf("kernel module %s is not loaded, built-in or available in %s", module, modulesDir))
+	}
+
+	return res.ErrorOrNil()
+}
+
+// readModuleNames parses modules.builtin and modules.dep, both are starting with the module path on each line
+func readModuleNames(path string, res map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		modPath, _, _ := strings.Cut(scanner.Text(), ":")
+		name, _, _ := strings.Cut(filepath.Base(strings.TrimSpace(modPath)), ".ko")
+		if name != "" {
+			res[normalizeModuleName(name)] = true
+		}
+	}
+
+	return errors.Wrapf(scanner.Err(), "error reading %s", path)
+}
+
+func normalizeModuleName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
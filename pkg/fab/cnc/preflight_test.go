@@ -0,0 +1,74 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_findMountpoint(t *testing.T) {
+	mountpoints := []string{"/", "/var", "/var/lib/rancher", "/var/lib/ranch", "/opt/"}
+
+	tests := []struct {
+		path   string
+		result string
+	}{
+		{path: "/", result: "/"},
+		{path: "/etc/rancher", result: "/"},
+		{path: "/var", result: "/var"},
+		{path: "/var/lib", result: "/var"},
+		{path: "/var/lib/rancher", result: "/var/lib/rancher"},
+		{path: "/var/lib/rancher/k3s", result: "/var/lib/rancher"},
+		{path: "/var/lib/rancherx", result: "/var"},
+		{path: "/opt/bin", result: "/opt/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if res := findMountpoint(test.path, mountpoints); res != test.result {
+				t.Errorf("findMountpoint(%s) = %s, want %s", test.path, res, test.result)
+			}
+		})
+	}
+}
+
+func Test_PreflightRunResumed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	op := &Preflight{TCPPorts: []int{l.Addr().(*net.TCPAddr).Port}}
+	basedir := t.TempDir()
+
+	if err := op.Run(context.Background(), basedir); err == nil {
+		t.Errorf("Run() with port in use succeeded, want error")
+	}
+	if _, err := os.Stat(filepath.Join(basedir, PreflightPassedFile)); err == nil {
+		t.Errorf("Run() failed but created %s", PreflightPassedFile)
+	}
+
+	if err := os.WriteFile(filepath.Join(basedir, PreflightPassedFile), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Run(context.Background(), basedir); err != nil {
+		t.Errorf("Run() with port in use after preflight passed = %v, want no error", err)
+	}
+}
@@ -15,11 +15,14 @@
 package cnc
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/pkg/errors"
@@ -32,8 +35,10 @@ type Recipe struct {
 }
 
 type RecipeAction struct {
-	Name string `json:"name,omitempty"`
-	Op   RunOp  `json:"op,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Stage     Stage  `json:"stage,omitempty"`
+	Component string `json:"component,omitempty"`
+	Op        RunOp  `json:"op,omitempty"`
 }
 
 type RecipeSaver struct {
@@ -41,9 +46,11 @@ type RecipeSaver struct {
 }
 
 type RecipeSaverItem struct {
-	Name string `json:"name,omitempty"`
-	Type string `json:"action,omitempty"`
-	Op   any    `json:"params,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Stage     Stage  `json:"stage,omitempty"`
+	Component string `json:"component,omitempty"`
+	Type      string `json:"action,omitempty"`
+	Op        any    `json:"params,omitempty"`
 }
 
 func getShortTypeName(a any) string {
@@ -73,9 +80,11 @@ func (r *Recipe) Save(basedir string) error {
 		}
 
 		saver.Actions = append(saver.Actions, RecipeSaverItem{
-			Name: action.Name,
-			Type: getShortTypeName(action.Op),
-			Op:   action.Op,
+			Name:      action.Name,
+			Stage:     action.Stage,
+			Component: action.Component,
+			Type:      getShortTypeName(action.Op),
+			Op:        action.Op,
 		})
 	}
 
@@ -128,20 +137,141 @@ func (r *Recipe) Load(basedir string) error {
 		}
 
 		r.Actions = append(r.Actions, RecipeAction{
-			Name: item.Name,
-			Op:   op,
+			Name:      item.Name,
+			Stage:     item.Stage,
+			Component: item.Component,
+			Op:        op,
 		})
 	}
 
 	return nil
 }
 
-func RunRecipe(basedir string, steps []string, dryRun bool) error {
+// RecipeSelector selects actions from the recipe, all set conditions should match for action to be selected
+type RecipeSelector struct {
+	Actions    []string // action names, empty or "all" for all actions
+	From       string   // first action (by name) to select, inclusive
+	Until      string   // last action (by name) to select, inclusive
+	Stages     []Stage  // stages to select actions from
+	Components []string // components to select actions from
+}
+
+func (sel RecipeSelector) String() string {
+	parts := []string{}
+
+	if len(sel.Actions) > 0 {
+		parts = append(parts, "actions="+strings.Join(sel.Actions, ","))
+	}
+	if sel.From != "" {
+		parts = append(parts, "from="+sel.From)
+	}
+	if sel.Until != "" {
+		parts = append(parts, "until="+sel.Until)
+	}
+	if len(sel.Stages) > 0 {
+		stages := []string{}
+		for _, stage := range sel.Stages {
+			stages = append(stages, fmt.Sprintf("%d", stage))
+		}
+		parts = append(parts, "stages="+strings.Join(stages, ","))
+	}
+	if len(sel.Components) > 0 {
+		parts = append(parts, "components="+strings.Join(sel.Components, ","))
+	}
+
+	if len(parts) == 0 {
+		return "all"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Select returns a list of flags, one for each action of the recipe, true if action is selected
+func (sel RecipeSelector) Select(actions []RecipeAction) ([]bool, error) {
+	allActions := len(sel.Actions) == 0 || len(sel.Actions) == 1 && sel.Actions[0] == "all"
+
+	for _, name := range sel.Actions {
+		if name == "all" && len(sel.Actions) > 1 {
+			return nil, errors.New("'all' can't be combined with other action names")
+		}
+		if name != "all" && !slices.ContainsFunc(actions, func(action RecipeAction) bool { return action.Name == name }) {
+			return nil, errors.Errorf("unknown action: %s", name)
+		}
+	}
+
+	from := 0
+	if sel.From != "" {
+		from = slices.IndexFunc(actions, func(action RecipeAction) bool { return action.Name == sel.From })
+		if from < 0 {
+			return nil, errors.Errorf("unknown action to start from: %s", sel.From)
+		}
+	}
+
+	until := len(actions) - 1
+	if sel.Until != "" {
+		until = -1
+		for idx, action := range actions {
+			if action.Name == sel.Until {
+				until = idx // last action with the name as build ops could produce multiple run ops
+			}
+		}
+		if until < 0 {
+			return nil, errors.Errorf("unknown action to run until: %s", sel.Until)
+		}
+	}
+
+	if from > until {
+		return nil, errors.Errorf("action %s goes after %s in the recipe", sel.From, sel.Until)
+	}
+
+	for _, comp := range sel.Components {
+		if !slices.ContainsFunc(actions, func(action RecipeAction) bool { return action.Component == comp }) {
+			return nil, errors.Errorf("unknown component: %s", comp)
+		}
+	}
+
+	res := make([]bool, len(actions))
+	for idx, action := range actions {
+		res[idx] = idx >= from && idx <= until &&
+			(allActions || slices.Contains(sel.Actions, action.Name)) &&
+			(len(sel.Stages) == 0 || slices.Contains(sel.Stages, action.Stage)) &&
+			(len(sel.Components) == 0 || slices.Contains(sel.Components, action.Component))
+	}
+
+	return res, nil
+}
+
+func ListRecipe(basedir string, sel RecipeSelector) error {
+	recipe := &Recipe{}
+	err := recipe.Load(basedir)
+	if err != nil {
+		return errors.Wrapf(err, "error loading recipe from %s", basedir)
+	}
+
+	selected, err := sel.Select(recipe.Actions)
+	if err != nil {
+		return errors.Wrapf(err, "error selecting actions")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSTAGE\tCOMPONENT\tNAME\tSUMMARY")
+	for idx, action := range recipe.Actions {
+		if !selected[idx] {
+			continue
+		}
+
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", idx+1, action.Stage, action.Component, action.Name, action.Op.Summary())
+	}
+
+	return errors.Wrapf(w.Flush(), "error writing actions list")
+}
+
+func RunRecipe(ctx context.Context, basedir string, sel RecipeSelector, dryRun bool) error {
 	if dryRun {
 		slog.Warn("Dry run, not actually running anything")
 	}
 
-	slog.Info("Running recipe", "basedir", basedir, "steps", strings.Join(steps, " "), "dryRun", dryRun)
+	slog.Info("Running recipe", "basedir", basedir, "select", sel.String(), "dryRun", dryRun)
 
 	runStart := time.Now()
 
@@ -153,15 +283,33 @@ func RunRecipe(basedir string, steps []string, dryRun bool) error {
 
 	slog.Debug("Loaded recipe", "actions", len(recipe.Actions))
 
-	for _, action := range recipe.Actions {
+	selected, err := sel.Select(recipe.Actions)
+	if err != nil {
+		return errors.Wrapf(err, "error selecting actions")
+	}
+
+	for idx, action := range recipe.Actions {
 		opStart := time.Now()
-		if len(steps) == 0 || len(steps) == 1 && steps[0] == "all" || len(steps) > 0 && slices.Contains(steps, action.Name) {
-			slog.Info("Running", "name", action.Name, "op", action.Op.Summary())
+		if selected[idx] {
+			if err := ctx.Err(); err != nil {
+				return errors.Wrapf(err, "recipe interrupted before action %s", action.Name)
+			}
+
+			slog.Info("Running", "name", action.Name, "stage", action.Stage, "op", action.Op.Summary())
+			ev := Event{
+				Phase:     PhaseRun,
+				Name:      action.Name,
+				Stage:     ptr(action.Stage),
+				Component: action.Component,
+				Op:        action.Op.Summary(),
+			}
+			emitActionStarted(ev)
 			if !dryRun {
-				err = action.Op.Run(basedir)
-				if err != nil {
-					return errors.Wrapf(err, "error running action %s", action.Name)
-				}
+				err = action.Op.Run(ctx, basedir)
+			}
+			emitActionDone(ev, opStart, err)
+			if err != nil {
+				return errors.Wrapf(err, "error running action %s", action.Name)
 			}
 		} else {
 			slog.Debug("Skipping", "name", action.Name, "op", action.Op.Summary())
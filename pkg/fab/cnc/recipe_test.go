@@ -0,0 +1,124 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"slices"
+	"testing"
+)
+
+func Test_RecipeSelector_Select(t *testing.T) {
+	actions := []RecipeAction{
+		{Name: "k3s-files", Stage: 1, Component: "k3s"},
+		{Name: "k3s-files", Stage: 1, Component: "k3s"},
+		{Name: "zot-files", Stage: 1, Component: "zot"},
+		{Name: "k3s-install", Stage: 2, Component: "k3s"},
+		{Name: "fabric-install", Stage: 4, Component: "fabric"},
+		{Name: "fabric-wait", Stage: 4, Component: "fabric"},
+		{Name: "reloader", Stage: 6, Component: "misc"},
+	}
+
+	tests := []struct {
+		name   string
+		sel    RecipeSelector
+		result []bool
+		error  bool
+	}{
+		{
+			name:   "empty",
+			result: []bool{true, true, true, true, true, true, true},
+		},
+		{
+			name:   "all",
+			sel:    RecipeSelector{Actions: []string{"all"}},
+			result: []bool{true, true, true, true, true, true, true},
+		},
+		{
+			name:   "names",
+			sel:    RecipeSelector{Actions: []string{"k3s-files", "fabric-wait"}},
+			result: []bool{true, true, false, false, false, true, false},
+		},
+		{
+			name:   "from",
+			sel:    RecipeSelector{From: "fabric-install"},
+			result: []bool{false, false, false, false, true, true, true},
+		},
+		{
+			name:   "until-last-with-name",
+			sel:    RecipeSelector{Until: "k3s-files"},
+			result: []bool{true, true, false, false, false, false, false},
+		},
+		{
+			name:   "from-until",
+			sel:    RecipeSelector{From: "zot-files", Until: "fabric-install"},
+			result: []bool{false, false, true, true, true, false, false},
+		},
+		{
+			name:   "stage",
+			sel:    RecipeSelector{Stages: []Stage{1, 6}},
+			result: []bool{true, true, true, false, false, false, true},
+		},
+		{
+			name:   "component",
+			sel:    RecipeSelector{Components: []string{"fabric"}},
+			result: []bool{false, false, false, false, true, true, false},
+		},
+		{
+			name:   "component-and-from",
+			sel:    RecipeSelector{Components: []string{"k3s"}, From: "zot-files"},
+			result: []bool{false, false, false, true, false, false, false},
+		},
+		{
+			name:  "unknown-name",
+			sel:   RecipeSelector{Actions: []string{"unknown"}},
+			error: true,
+		},
+		{
+			name:  "all-and-names",
+			sel:   RecipeSelector{Actions: []string{"all", "k3s-files"}},
+			error: true,
+		},
+		{
+			name:  "unknown-from",
+			sel:   RecipeSelector{From: "unknown"},
+			error: true,
+		},
+		{
+			name:  "from-after-until",
+			sel:   RecipeSelector{From: "fabric-wait", Until: "zot-files"},
+			error: true,
+		},
+		{
+			name:  "unknown-component",
+			sel:   RecipeSelector{Components: []string{"unknown"}},
+			error: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.sel.Select(actions)
+			if tt.error && err == nil {
+				t.Errorf("Select(%s) expected error, got nil", tt.sel)
+			}
+			if !tt.error && err != nil {
+				t.Errorf("Select(%s) expected no error, got %v", tt.sel, err)
+			}
+			if !tt.error && !slices.Equal(result, tt.result) {
+				t.Errorf("Select(%s) expected %v, got %v", tt.sel, tt.result, result)
+			}
+		})
+	}
+}
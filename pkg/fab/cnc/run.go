@@ -16,7 +16,10 @@ package cnc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -35,6 +38,7 @@ var RunOpsList = []RunOp{
 	&WaitURL{},
 	&PushOCI{},
 	&WaitKube{},
+	&Preflight{},
 }
 
 //
@@ -47,6 +51,10 @@ type InstallFile struct {
 	TargetName string      `json:"targetName,omitempty"`
 	Mode       os.FileMode `json:"mode,omitempty"`
 	MkdirMode  os.FileMode `json:"mkdirMode,omitempty"`
+	UID        *int        `json:"uid,omitempty"`
+	GID        *int        `json:"gid,omitempty"`
+	Backup     bool        `json:"backup,omitempty"` // keep previous file as <target>.bak
+	SHA256     string      `json:"sha256,omitempty"` // calculated at build time, identical target is skipped
 }
 
 var _ RunOp = (*InstallFile)(nil)
@@ -67,6 +75,12 @@ func (op *InstallFile) Hydrate() error {
 	if op.MkdirMode == 0 {
 		op.MkdirMode = 0o755
 	}
+	if op.UID != nil && *op.UID < 0 {
+		return errors.Errorf("invalid uid %d", *op.UID)
+	}
+	if op.GID != nil && *op.GID < 0 {
+		return errors.Errorf("invalid gid %d", *op.GID)
+	}
 
 	return nil
 }
@@ -75,22 +89,160 @@ func (op *InstallFile) TargetPath() string {
 	return filepath.Join(op.Target, op.TargetName)
 }
 
+func (op *InstallFile) BackupPath() string {
+	return op.TargetPath() + ".bak"
+}
+
 func (op *InstallFile) Summary() string {
 	return fmt.Sprintf("file %s", filepath.Join(op.Target, op.TargetName))
 }
 
-func (op *InstallFile) Run(basedir string) error {
+// UpdateChecksum records checksum of the file from the bundle so it could be verified and skipped on re-runs
+func (op *InstallFile) UpdateChecksum(basedir string) error {
+	sum, err := fileSHA256(filepath.Join(basedir, op.Name))
+	if err != nil {
+		return err
+	}
+
+	op.SHA256 = sum
+
+	return nil
+}
+
+func (op *InstallFile) Run(ctx context.Context, basedir string) error {
 	err := os.MkdirAll(op.Target, op.MkdirMode)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create directory %s", op.Target)
 	}
 
-	content, err := os.ReadFile(filepath.Join(basedir, op.Name))
+	if op.SHA256 != "" {
+		sum, err := fileSHA256(op.TargetPath())
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		if sum == op.SHA256 {
+			slog.Info("File is up to date, skipping", "target", op.TargetPath())
+
+			return op.setMeta(op.TargetPath())
+		}
+	}
+
+	src, err := os.Open(filepath.Join(basedir, op.Name))
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file %s", op.Name)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(op.Target, "."+op.TargetName+".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temp file in %s", op.Target)
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		tmp.Close()
+		os.Remove(tmpPath) // no-op after successful rename
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(tmp, io.TeeReader(newContextReader(ctx, src), hash)); err != nil {
+		return errors.Wrapf(err, "failed to write file %s", op.TargetName)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); op.SHA256 != "" && sum != op.SHA256 {
+		return errors.Errorf("checksum mismatch for file %s: %s, expected %s", op.Name, sum, op.SHA256)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return errors.Wrapf(err, "failed to sync file %s", tmpPath)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close file %s", tmpPath)
+	}
+
+	if err := op.setMeta(tmpPath); err != nil {
+		return err
+	}
+
+	if op.Backup {
+		if err := op.backup(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpPath, op.TargetPath()); err != nil {
+		return errors.Wrapf(err, "failed to move file %s to %s", tmpPath, op.TargetPath())
+	}
+
+	return syncDir(op.Target)
+}
+
+// setMeta sets mode and owner explicitly so it doesn't depend on umask or existing file
+func (op *InstallFile) setMeta(path string) error {
+	if err := os.Chmod(path, op.Mode); err != nil {
+		return errors.Wrapf(err, "failed to set mode for %s", path)
+	}
+
+	if op.UID != nil || op.GID != nil {
+		uid, gid := -1, -1
+		if op.UID != nil {
+			uid = *op.UID
+		}
+		if op.GID != nil {
+			gid = *op.GID
+		}
+
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return errors.Wrapf(err, "failed to set owner for %s", path)
+		}
+	}
+
+	return nil
+}
+
+// backup hard links existing target so it's always present at the target path until replaced
+func (op *InstallFile) backup() error {
+	if _, err := os.Lstat(op.TargetPath()); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to stat %s", op.TargetPath())
+	}
+
+	if err := os.Remove(op.BackupPath()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to remove old backup %s", op.BackupPath())
+	}
+
+	if err := os.Link(op.TargetPath(), op.BackupPath()); err != nil {
+		return errors.Wrapf(err, "failed to backup %s", op.TargetPath())
+	}
+
+	slog.Debug("Backup created", "target", op.TargetPath(), "backup", op.BackupPath())
+
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open file %s", path)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", errors.Wrapf(err, "failed to read file %s", path)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
 	if err != nil {
-		return errors.Wrapf(err, "failed to read file %s", op.Name)
+		return errors.Wrapf(err, "failed to open dir %s", path)
 	}
+	defer dir.Close()
 
-	return errors.Wrapf(os.WriteFile(op.TargetPath(), content, op.Mode), "failed to write file %s", op.TargetName)
+	return errors.Wrapf(dir.Sync(), "failed to sync dir %s", path)
 }
 
 //
@@ -118,14 +270,14 @@ func (op *ExecCommand) Summary() string {
 	return fmt.Sprintf("exec %s", op.Name)
 }
 
-func (op *ExecCommand) Run(basedir string) error {
-	cmd := exec.Command(op.Name, op.Args...) //nolint:gosec
+func (op *ExecCommand) Run(ctx context.Context, basedir string) error {
+	cmd := exec.CommandContext(ctx, op.Name, op.Args...) //nolint:gosec
 
 	cmd.Dir = basedir
 	cmd.Env = append(os.Environ(), op.Env...)
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stdout
+	cmd.Stdout = commandOutput()
+	cmd.Stderr = commandOutput()
 
 	return errors.Wrapf(cmd.Run(), "failed to execute command %s", op.Name)
 }
@@ -158,9 +310,14 @@ func (op *WaitURL) Summary() string {
 	return fmt.Sprintf("wait %s", op.URL)
 }
 
-func (op *WaitURL) Run(_ string) error {
-	return op.Wait.Wait(func() error {
-		resp, err := http.Get(op.URL) //nolint:noctx
+func (op *WaitURL) Run(ctx context.Context, _ string) error {
+	return op.Wait.Wait(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, op.URL, nil)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create request for %s", op.URL)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return errors.Wrapf(err, "failed to get %s", op.URL)
 		}
@@ -197,8 +354,8 @@ func (op *PushOCI) Summary() string {
 	return fmt.Sprintf("push %s", op.Target.Name+":"+op.Target.Tag)
 }
 
-func (op *PushOCI) Run(basedir string) error {
-	err := copyOCI("oci:"+filepath.Join(basedir, op.Name), "docker://"+op.Target.String(), false)
+func (op *PushOCI) Run(ctx context.Context, basedir string) error {
+	err := copyOCI(ctx, "oci:"+filepath.Join(basedir, op.Name), "docker://"+op.Target.String(), false)
 	if err != nil {
 		return err
 	}
@@ -245,20 +402,22 @@ func (op *WaitKube) Summary() string {
 	return fmt.Sprintf("wait %s", op.Name)
 }
 
-func (op *WaitKube) waitForResource() error {
+func (op *WaitKube) waitForResource(ctx context.Context) error {
 	start := time.Now()
 	for {
 		if time.Since(start) > op.TimeoutResource {
 			return errors.Errorf("timeout")
 		}
 
-		time.Sleep(op.Interval)
+		if err := sleepContext(ctx, op.Interval); err != nil {
+			return err
+		}
 
-		cmd := exec.Command("kubectl", "get", op.Name) //nolint:gosec
+		cmd := exec.CommandContext(ctx, "kubectl", "get", op.Name) //nolint:gosec
 
-		if slog.Default().Enabled(context.TODO(), slog.LevelDebug) {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stdout
+		if slog.Default().Enabled(ctx, slog.LevelDebug) {
+			cmd.Stdout = commandOutput()
+			cmd.Stderr = commandOutput()
 		}
 
 		if cmd.Run() == nil {
@@ -267,30 +426,30 @@ func (op *WaitKube) waitForResource() error {
 	}
 }
 
-func (op *WaitKube) Run(_ string) error {
+func (op *WaitKube) Run(ctx context.Context, _ string) error {
 	// wait for resource existence first
-	err := op.waitForResource()
+	err := op.waitForResource(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "error waiting for resource %s", op.Name)
 	}
 
 	var cmd *exec.Cmd
 	if strings.HasPrefix(op.Name, "deployment") {
-		cmd = exec.Command("kubectl", //nolint:gosec
+		cmd = exec.CommandContext(ctx, "kubectl", //nolint:gosec
 			"wait",
 			"--for=condition=available",
 			"--timeout="+op.Timeout.String(), op.Name)
 	} else if strings.HasPrefix(op.Name, "job") {
-		cmd = exec.Command("kubectl", //nolint:gosec
+		cmd = exec.CommandContext(ctx, "kubectl", //nolint:gosec
 			"wait",
 			"--for=condition=complete",
 			"--timeout="+op.Timeout.String(), op.Name)
 	} else if strings.HasPrefix(op.Name, "daemonset") {
-		cmd = exec.Command("kubectl", //nolint:gosec
+		cmd = exec.CommandContext(ctx, "kubectl", //nolint:gosec
 			"rollout", "status",
 			"--timeout="+op.Timeout.String(), op.Name)
 	} else if strings.HasPrefix(op.Name, "controlagent") {
-		cmd = exec.Command("kubectl", //nolint:gosec
+		cmd = exec.CommandContext(ctx, "kubectl", //nolint:gosec
 			"wait",
 			"--for=condition=applied",
 			"--timeout="+op.Timeout.String(), op.Name)
@@ -298,7 +457,7 @@ func (op *WaitKube) Run(_ string) error {
 	// otherwise we've just waited for the resource to exist
 
 	if cmd != nil {
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = commandOutput()
 		cmd.Stderr = os.Stderr
 
 		return errors.Wrapf(cmd.Run(), "error waiting for condition %s", op.Name)
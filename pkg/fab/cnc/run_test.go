@@ -0,0 +1,106 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_InstallFile_Run(t *testing.T) {
+	basedir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "etc")
+
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	write(filepath.Join(basedir, "config.yaml"), "new")
+
+	op := &InstallFile{Name: "config.yaml", Target: target, Mode: 0o640, Backup: true}
+	if err := op.Hydrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.UpdateChecksum(basedir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write(op.TargetPath(), "old")
+
+	if err := op.Run(context.Background(), basedir); err != nil {
+		t.Fatal(err)
+	}
+	if content := read(op.TargetPath()); content != "new" {
+		t.Errorf("target content %q, want %q", content, "new")
+	}
+	if content := read(op.BackupPath()); content != "old" {
+		t.Errorf("backup content %q, want %q", content, "old")
+	}
+	if info, err := os.Stat(op.TargetPath()); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("target mode %v (err %v), want %v", info.Mode().Perm(), err, os.FileMode(0o640))
+	}
+
+	// identical target is skipped and backup is kept
+	if err := op.Run(context.Background(), basedir); err != nil {
+		t.Fatal(err)
+	}
+	if content := read(op.BackupPath()); content != "old" {
+		t.Errorf("backup content after re-run %q, want %q", content, "old")
+	}
+
+	// changed source doesn't match recorded checksum and target stays intact
+	write(filepath.Join(basedir, "config.yaml"), "corrupted")
+	write(op.TargetPath(), "other")
+	if err := op.Run(context.Background(), basedir); err == nil {
+		t.Errorf("expected checksum mismatch error")
+	}
+	if content := read(op.TargetPath()); content != "other" {
+		t.Errorf("target content after failure %q, want %q", content, "other")
+	}
+
+	// cancelled run doesn't touch the target
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	op.SHA256 = ""
+	if err := op.Run(ctx, basedir); err == nil {
+		t.Errorf("expected error for cancelled context")
+	}
+	if content := read(op.TargetPath()); content != "other" {
+		t.Errorf("target content after cancel %q, want %q", content, "other")
+	}
+
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only target and backup in %s, got %d entries", target, len(entries))
+	}
+}
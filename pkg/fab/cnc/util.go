@@ -15,6 +15,8 @@
 package cnc
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -30,7 +32,7 @@ func ReadOrGenerateSSHKey(basedir string, name string, comment string) (string,
 			Args: []string{
 				"-t", "ed25519", "-C", comment, "-f", name, "-N", "",
 			},
-		}).Run(basedir)
+		}).Run(context.Background(), basedir)
 		if err != nil {
 			return "", err
 		}
@@ -43,3 +45,21 @@ func ReadOrGenerateSSHKey(basedir string, name string, comment string) (string,
 
 	return string(data), nil
 }
+
+// contextReader stops reading as soon as ctx is done, so long copies could be interrupted
+type contextReader struct {
+	ctx context.Context //nolint:containedctx
+	r   io.Reader
+}
+
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, errors.Wrapf(err, "interrupted")
+	}
+
+	return r.r.Read(p) //nolint:wrapcheck
+}
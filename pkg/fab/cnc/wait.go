@@ -15,6 +15,7 @@
 package cnc
 
 import (
+	"context"
 	"log/slog"
 	"time"
 
@@ -39,8 +40,10 @@ func (w *WaitParams) Hydrate() error {
 	return nil
 }
 
-func (w *WaitParams) Wait(checker func() error) error {
-	time.Sleep(w.Delay)
+func (w *WaitParams) Wait(ctx context.Context, checker func() error) error {
+	if err := sleepContext(ctx, w.Delay); err != nil {
+		return err
+	}
 
 	var err error
 	for attempt := 0; attempt < w.Attempts; attempt++ {
@@ -53,9 +56,24 @@ func (w *WaitParams) Wait(checker func() error) error {
 			break
 		}
 
-		time.Sleep(w.Interval)
+		if err := sleepContext(ctx, w.Interval); err != nil {
+			return err
+		}
 	}
 
 	// TODO maybe slog?
 	return errors.Wrapf(err, "failed after %d attempts", w.Attempts)
 }
+
+// sleepContext sleeps for the duration or returns an error if ctx is done earlier
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "interrupted")
+	case <-timer.C:
+		return nil
+	}
+}
@@ -17,6 +17,7 @@ package fab
 import (
 	_ "embed"
 	"fmt"
+	"net/netip"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -25,6 +26,7 @@ import (
 	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
 	"go.githedgehog.com/fabric/pkg/wiring"
 	"go.githedgehog.com/fabricator/pkg/fab/cnc"
+	"go.githedgehog.com/fabricator/pkg/fab/vlab"
 )
 
 const (
@@ -70,8 +72,8 @@ func (cfg *ControlOS) Hydrate(_ cnc.Preset, _ meta.FabricMode) error {
 	return nil
 }
 
-func (cfg *ControlOS) Build(_ string, _ cnc.Preset, _ meta.FabricMode, get cnc.GetComponent, data *wiring.Data, run cnc.AddBuildOp, _ cnc.AddRunOp) error {
-	hostname, err := getControlNodeName(data)
+func (cfg *ControlOS) Build(_ string, preset cnc.Preset, _ meta.FabricMode, get cnc.GetComponent, data *wiring.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
+	nodes, err := getControlNodes(data)
 	if err != nil {
 		return err
 	}
@@ -92,33 +94,118 @@ func (cfg *ControlOS) Build(_ string, _ cnc.Preset, _ meta.FabricMode, get cnc.G
 
 	controlVIP := ControlVIP + ControlVIPMask
 
-	run(BundleControlOS, Stage, "ignition-control",
-		&cnc.FileGenerate{
-			File: cnc.File{
-				Name: ControlOSIgnition,
-			},
-			Content: cnc.IgnitionFromButaneTemplate(controlButaneTemplate,
-				"cfg", cfg,
-				"username", username,
-				"hostname", hostname,
-				"authorizedKeys", authorizedKeys,
-				"ports", buildControlPorts(data),
-				"controlVIP", controlVIP,
-				"passwordHash", cfg.PasswordHash,
-			),
-		})
+	for idx, node := range nodes {
+		// control nodes are only connected to each other by the dedicated network in VLAB
+		haIP, haMAC := "", ""
+		if len(nodes) > 1 && preset == PresetVLAB {
+			haIP, err = controlHAIP(idx)
+			if err != nil {
+				return err
+			}
+			haIP += "/" + strings.SplitN(ControlHASubnet, "/", 2)[1]
+			haMAC = vlab.ControlHAMAC(idx)
+		}
+
+		name, ignition := "ignition-control", ControlOSIgnition
+		if node.Join {
+			name, ignition = "ignition-"+node.Name, fmt.Sprintf("%s.ignition.json", node.Name)
+		}
+
+		run(BundleControlOS, Stage, name,
+			&cnc.FileGenerate{
+				File: cnc.File{
+					Name: ignition,
+				},
+				Content: cnc.IgnitionFromButaneTemplate(controlButaneTemplate,
+					"cfg", cfg,
+					"username", username,
+					"hostname", node.Name,
+					"authorizedKeys", authorizedKeys,
+					"ports", buildControlPorts(data, node.Name),
+					"controlVIP", controlVIP,
+					"haIP", haIP,
+					"haMAC", haMAC,
+					"passwordHash", cfg.PasswordHash,
+				),
+			})
+
+		preflight := &cnc.Preflight{}
+		for _, port := range buildControlPorts(data, node.Name) {
+			preflight.Interfaces = append(preflight.Interfaces, cnc.PreflightInterface{
+				Name: port.PortName,
+				MAC:  port.MAC,
+				IP:   port.IP,
+			})
+		}
+
+		install(node.Bundle, Stage, "control-os-preflight", preflight)
+	}
 
 	return nil
 }
 
-func getControlNodeName(data *wiring.Data) (string, error) {
+// controlNode is a control node with its install bundle, all nodes except the first one are joining the first one
+type controlNode struct {
+	Name   string
+	Bundle cnc.Bundle
+	Join   bool
+}
+
+func getControlNodes(data *wiring.Data) ([]controlNode, error) {
+	nodes := []controlNode{}
 	for _, server := range data.Server.All() {
-		if server.Spec.Type == wiringapi.ServerTypeControl {
-			return server.Name, nil
+		if server.Spec.Type != wiringapi.ServerTypeControl {
+			continue
+		}
+
+		if len(nodes) > len(BundleControlJoinInstall) {
+			return nil, errors.Errorf("too many control nodes, up to %d supported", len(BundleControlJoinInstall)+1)
 		}
+
+		node := controlNode{
+			Name:   server.Name,
+			Bundle: BundleControlInstall,
+		}
+		if len(nodes) > 0 {
+			node.Bundle = BundleControlJoinInstall[len(nodes)-1]
+			node.Join = true
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 0 {
+		return nil, errors.New("no control node found")
+	}
+	if len(nodes) == 2 {
+		return nil, errors.New("2 control nodes can't keep quorum, use 1 or 3 for HA")
+	}
+
+	return nodes, nil
+}
+
+func getControlNodeName(data *wiring.Data) (string, error) {
+	nodes, err := getControlNodes(data)
+	if err != nil {
+		return "", err
+	}
+
+	return nodes[0].Name, nil
+}
+
+// controlHAIP returns the address of the control node in the control HA network by its position
+func controlHAIP(idx int) (string, error) {
+	prefix, err := netip.ParsePrefix(ControlHASubnet)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing control HA subnet %s", ControlHASubnet)
+	}
+
+	addr := prefix.Addr()
+	for i := 0; i < 10+idx; i++ {
+		addr = addr.Next()
 	}
 
-	return "", errors.New("no control node found")
+	return addr.String(), nil
 }
 
 type renderPort struct {
@@ -129,11 +216,11 @@ type renderPort struct {
 	MAC        string
 }
 
-func buildControlPorts(data *wiring.Data) []renderPort {
+func buildControlPorts(data *wiring.Data, node string) []renderPort {
 	res := []renderPort{}
 
 	for idx, conn := range data.Connection.All() {
-		if conn.Spec.Management == nil {
+		if conn.Spec.Management == nil || conn.Spec.Management.Link.Server.DeviceName() != node {
 			continue
 		}
 
@@ -158,6 +158,11 @@ func (cfg *DasBoot) Build(_ string, preset cnc.Preset, _ meta.FabricMode, get cn
 	target := BaseConfig(get).Target
 	targetInCluster := BaseConfig(get).TargetInCluster
 
+	install(BundleControlInstall, Stage, "das-boot-preflight",
+		&cnc.Preflight{
+			UDPPorts: []int{DasBootNTPNodePort, DasBootSyslogNodePort},
+		})
+
 	run(BundleControlInstall, StageInstall4DasBoot, "das-boot-rsyslog-image",
 		&cnc.SyncOCI{
 			Ref:    cfg.RsyslogImageRef,
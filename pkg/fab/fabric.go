@@ -20,6 +20,7 @@ import (
 	_ "embed"
 	"fmt"
 	"log/slog"
+	"path/filepath"
 	"slices"
 
 	helm "github.com/k3s-io/helm-controller/pkg/apis/helm.cattle.io/v1"
@@ -28,6 +29,7 @@ import (
 	"go.githedgehog.com/fabric/api/meta"
 	wiringlib "go.githedgehog.com/fabric/pkg/wiring"
 	"go.githedgehog.com/fabricator/pkg/fab/cnc"
+	fabwiring "go.githedgehog.com/fabricator/pkg/fab/wiring"
 )
 
 //go:embed fabric_values.tmpl.yaml
@@ -138,11 +140,25 @@ func (cfg *Fabric) buildFabricConfig(fabricMode meta.FabricMode, get cnc.GetComp
 
 	cfg.Alloy.ControlProxyURL = fmt.Sprintf("http://%s:%d", ControlVIP, ControlProxyNodePort)
 
+	fabricCfg := defaultFabricConfig(fabricMode, K3sConfig(get).ClusterCIDR, K3sConfig(get).ServiceCIDR)
+	fabricCfg.AgentRepo = target.Fallback(cfg.AgentRef).RepoName()
+	fabricCfg.AgentRepoCA = ZotConfig(get).TLS.CA.Cert
+	fabricCfg.Users = users
+	fabricCfg.DHCPMode = meta.DHCPMode(cfg.DHCPServer)
+	fabricCfg.BaseVPCCommunity = cfg.BaseVPCCommunity
+	fabricCfg.ServerFacingMTUOffset = uint16(cfg.ServerFacingMTUOffset)
+	fabricCfg.Alloy = cfg.Alloy
+	fabricCfg.AlloyRepo = target.Fallback(cfg.AlloyRef).RepoName()
+	fabricCfg.AlloyVersion = target.Fallback(cfg.AlloyRef).Tag
+
+	return fabricCfg
+}
+
+// defaultFabricConfig returns fabric config with all values that don't depend on the fabric component config
+func defaultFabricConfig(fabricMode meta.FabricMode, clusterCIDR, serviceCIDR string) *meta.FabricConfig {
 	return &meta.FabricConfig{
-		ControlVIP:  ControlVIP + ControlVIPMask,
-		APIServer:   fmt.Sprintf("%s:%d", ControlVIP, K3sAPIPort),
-		AgentRepo:   target.Fallback(cfg.AgentRef).RepoName(),
-		AgentRepoCA: ZotConfig(get).TLS.CA.Cert,
+		ControlVIP: ControlVIP + ControlVIPMask,
+		APIServer:  fmt.Sprintf("%s:%d", ControlVIP, K3sAPIPort),
 		VPCIRBVLANRanges: []meta.VLANRange{
 			{From: 3000, To: 3999}, // TODO make configurable
 		},
@@ -151,29 +167,55 @@ func (cfg *Fabric) buildFabricConfig(fabricMode meta.FabricMode, get cnc.GetComp
 		},
 		VPCPeeringDisabled: false,
 		ReservedSubnets: []string{ // TODO make configurable
-			K3sConfig(get).ClusterCIDR,
-			K3sConfig(get).ServiceCIDR,
-			"172.30.0.0/16", // Fabric subnet // TODO make configurable
-			"172.31.0.0/16", // VLAB subnet // TODO make configurable
+			clusterCIDR,
+			serviceCIDR,
+			HHSubnet,   // Fabric subnet // TODO make configurable
+			VLABSubnet, // VLAB subnet // TODO make configurable
 		},
-		Users:                 users,
-		DHCPMode:              meta.DHCPMode(cfg.DHCPServer),
-		DHCPDConfigMap:        "fabric-dhcp-server-config",
-		DHCPDConfigKey:        "dhcpd.conf",
-		FabricMode:            fabricMode,
-		BaseVPCCommunity:      cfg.BaseVPCCommunity,
-		VPCLoopbackSubnet:     "172.30.240.0/20", // TODO make configurable
-		FabricMTU:             9100,              // TODO make configurable
-		ServerFacingMTUOffset: uint16(cfg.ServerFacingMTUOffset),
-		ESLAGMACBase:          "f2:00:00:00:00:00", // TODO make configurable
-		ESLAGESIPrefix:        "00:f2:00:00:",      // TODO make configurable
-		Alloy:                 cfg.Alloy,
-		AlloyRepo:             target.Fallback(cfg.AlloyRef).RepoName(),
-		AlloyVersion:          target.Fallback(cfg.AlloyRef).Tag,
-		DefaultMaxPathsEBGP:   64,
+		DHCPDConfigMap:      "fabric-dhcp-server-config",
+		DHCPDConfigKey:      "dhcpd.conf",
+		FabricMode:          fabricMode,
+		VPCLoopbackSubnet:   VPCLoopbackSubnet,   // TODO make configurable
+		FabricMTU:           9100,                // TODO make configurable
+		ESLAGMACBase:        "f2:00:00:00:00:00", // TODO make configurable
+		ESLAGESIPrefix:      "00:f2:00:00:",      // TODO make configurable
+		DefaultMaxPathsEBGP: 64,
 	}
 }
 
+// switchUsers returns users to create on the switches, dev users and keys are added for the dev builds
+func (cfg *Fabric) switchUsers(get cnc.GetComponent) []meta.UserCreds {
+	users := append([]meta.UserCreds{}, cfg.SwitchUsers...)
+	slog.Info("Base config", "dev", BaseConfig(get).Dev)
+	if BaseConfig(get).Dev {
+		for _, devUser := range DevSonicUsers {
+			ok := true
+			for _, user := range users {
+				if user.Name == devUser.Name {
+					slog.Warn("Skipping dev user as it's already used", "user", user.Name)
+					ok = false
+
+					break
+				}
+			}
+
+			if !ok {
+				continue
+			}
+
+			slog.Debug("Adding dev user", "user", devUser.Name)
+			users = append(users, devUser)
+		}
+
+		for idx := range users {
+			users[idx].SSHKeys = append(users[idx].SSHKeys, BaseConfig(get).AuthorizedKeys...)
+			slog.Debug("Adding dev ssh keys to user", "user", users[idx])
+		}
+	}
+
+	return users
+}
+
 func (cfg *Fabric) Validate(_ string, _ cnc.Preset, fabricMode meta.FabricMode, get cnc.GetComponent, wiring *wiringlib.Data) error {
 	fabricCfg := cfg.buildFabricConfig(fabricMode, get, []meta.UserCreds{})
 
@@ -181,6 +223,23 @@ func (cfg *Fabric) Validate(_ string, _ cnc.Preset, fabricMode meta.FabricMode,
 		return errors.Wrapf(err, "error validating wiring")
 	}
 
+	controlNodeName, err := getControlNodeName(wiring)
+	if err != nil {
+		return errors.Wrap(err, "error getting control node name")
+	}
+
+	// DHCP and das-boot services used by switches to boot are only running on the first control node, so additional
+	// control nodes only make kube API and registry HA but not the switch management
+	for _, conn := range wiring.Connection.All() {
+		if conn.Spec.Management == nil {
+			continue
+		}
+		if server := conn.Spec.Management.Link.Server.DeviceName(); server != controlNodeName {
+			return errors.Errorf("management connection %s is attached to %s, switches could only be managed by the first control node %s",
+				conn.Name, server, controlNodeName)
+		}
+	}
+
 	if err := cfg.Alloy.Validate(); err != nil {
 		return errors.Wrap(err, "error validating alloy config")
 	}
@@ -188,7 +247,7 @@ func (cfg *Fabric) Validate(_ string, _ cnc.Preset, fabricMode meta.FabricMode,
 	return nil
 }
 
-func (cfg *Fabric) Build(_ string, _ cnc.Preset, fabricMode meta.FabricMode, get cnc.GetComponent, wiring *wiringlib.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
+func (cfg *Fabric) Build(basedir string, _ cnc.Preset, fabricMode meta.FabricMode, get cnc.GetComponent, wiring *wiringlib.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
 	cfg.FabricAPIChartRef = cfg.FabricAPIChartRef.Fallback(cfg.Ref, BaseConfig(get).Source)
 	cfg.FabricChartRef = cfg.FabricChartRef.Fallback(cfg.Ref, BaseConfig(get).Source)
 	cfg.FabricImageRef = cfg.FabricImageRef.Fallback(cfg.Ref, BaseConfig(get).Source)
@@ -206,6 +265,11 @@ func (cfg *Fabric) Build(_ string, _ cnc.Preset, fabricMode meta.FabricMode, get
 	target := BaseConfig(get).Target
 	targetInCluster := BaseConfig(get).TargetInCluster
 
+	install(BundleControlInstall, Stage, "fabric-preflight",
+		&cnc.Preflight{
+			TCPPorts: []int{ControlProxyNodePort},
+		})
+
 	controlNodeName, err := getControlNodeName(wiring)
 	if err != nil {
 		return errors.Wrap(err, "error getting control node name")
@@ -322,33 +386,7 @@ func (cfg *Fabric) Build(_ string, _ cnc.Preset, fabricMode meta.FabricMode, get
 		))
 	}
 
-	users := append([]meta.UserCreds{}, cfg.SwitchUsers...)
-	slog.Info("Base config", "dev", BaseConfig(get).Dev)
-	if BaseConfig(get).Dev {
-		for _, devUser := range DevSonicUsers {
-			ok := true
-			for _, user := range users {
-				if user.Name == devUser.Name {
-					slog.Warn("Skipping dev user as it's already used", "user", user.Name)
-					ok = false
-
-					break
-				}
-			}
-
-			if !ok {
-				continue
-			}
-
-			slog.Debug("Adding dev user", "user", devUser.Name)
-			users = append(users, devUser)
-		}
-
-		for idx := range users {
-			users[idx].SSHKeys = append(users[idx].SSHKeys, BaseConfig(get).AuthorizedKeys...)
-			slog.Debug("Adding dev ssh keys to user", "user", users[idx])
-		}
-	}
+	users := cfg.switchUsers(get)
 
 	admin := false
 	for _, user := range users {
@@ -437,5 +475,27 @@ func (cfg *Fabric) Build(_ string, _ cnc.Preset, fabricMode meta.FabricMode, get
 			Name: "controlagent/" + controlNodeName,
 		})
 
+	// tenants are installed after the wiring is applied as VPC attachments are validated against the connections
+	tenants, err := fabwiring.LoadTenants(filepath.Join(basedir, cnc.TenantsFile))
+	if err != nil {
+		return errors.Wrap(err, "error loading tenants")
+	}
+	if len(tenants.Objects()) > 0 {
+		tenantsData := &bytes.Buffer{}
+		if err := tenants.Write(tenantsData); err != nil {
+			return errors.Wrap(err, "error writing tenants")
+		}
+
+		run(BundleControlInstall, StageInstall3Fabric, "fabric-tenants",
+			&cnc.FileGenerate{
+				File: cnc.File{
+					Name:          "tenants.yaml",
+					InstallTarget: "/var/lib/rancher/k3s/server/manifests",
+					InstallName:   "hh-tenants.yaml",
+				},
+				Content: cnc.FromValue(tenantsData.String()),
+			})
+	}
+
 	return nil
 }
@@ -0,0 +1,55 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fab
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pkg/errors"
+	"go.githedgehog.com/fabric/api/meta"
+	"go.githedgehog.com/fabricator/pkg/fab/wiring"
+)
+
+// offlineFabricConfig returns the default fabric config to validate wiring without the installer config, fabric mode
+// is set by the caller
+func offlineFabricConfig() *meta.FabricConfig {
+	fabricCfg := defaultFabricConfig("", ControlKubeClusterCIDR, ControlKubeServiceCIDR)
+	fabricCfg.DHCPMode = meta.DHCPModeHedgehog
+	fabricCfg.BaseVPCCommunity = "50000:0"
+	fabricCfg.ServerFacingMTUOffset = 64
+
+	return fabricCfg
+}
+
+// FuzzWiring runs the wiring fuzzer validating generated wirings against the default fabric config
+func FuzzWiring(ctx context.Context, cfg wiring.FuzzConfig) error {
+	failures, err := wiring.Fuzz(ctx, cfg, offlineFabricConfig())
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Fuzzing done", "seed", cfg.Seed, "count", cfg.Count, "failures", len(failures))
+	if len(failures) > 0 {
+		return errors.Errorf("found %d failing topologies, saved to %s", len(failures), cfg.OutDir)
+	}
+
+	return nil
+}
+
+// LintWiring lints the wiring file including the fabric validation with the default fabric config
+func LintWiring(ctx context.Context, wiringPath string, format string) error {
+	return wiring.LintPath(ctx, wiringPath, format, offlineFabricConfig())
+}
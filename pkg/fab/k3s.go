@@ -15,13 +15,14 @@
 package fab
 
 import (
+	"crypto/rand"
 	_ "embed"
+	"encoding/hex"
 	"slices"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
 	"go.githedgehog.com/fabric/api/meta"
-	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
 	"go.githedgehog.com/fabric/pkg/wiring"
 	"go.githedgehog.com/fabricator/pkg/fab/cnc"
 )
@@ -37,6 +38,8 @@ type K3s struct {
 	ServiceCIDR string   `json:"serviceCIDR,omitempty"`
 	ClusterDNS  string   `json:"clusterDNS,omitempty"`
 	TLSSAN      []string `json:"tlsSAN,omitempty"`
+	Token       string   `json:"token,omitempty"`      // shared secret for the additional control nodes to join the cluster
+	JoinServer  string   `json:"joinServer,omitempty"` // address of the first control node to join, control HA network one in VLAB
 
 	tlsSAN cli.StringSlice
 }
@@ -59,6 +62,12 @@ func (cfg *K3s) Flags() []cli.Flag {
 			EnvVars:     []string{"HHFAB_TLS_SAN"},
 			Destination: &cfg.tlsSAN,
 		},
+		&cli.StringFlag{
+			Name:        "k3s-join-server",
+			Usage:       "address of the first control node for the other ones to join, required for multiple control nodes outside of VLAB",
+			EnvVars:     []string{"HHFAB_K3S_JOIN_SERVER"},
+			Destination: &cfg.JoinServer,
+		},
 	}
 }
 
@@ -77,6 +86,14 @@ func (cfg *K3s) Hydrate(_ cnc.Preset, _ meta.FabricMode) error {
 		cfg.ClusterDNS = ControlKubeClusterDNS
 	}
 
+	if cfg.Token == "" {
+		token := make([]byte, 32)
+		if _, err := rand.Read(token); err != nil {
+			return errors.Wrapf(err, "error generating k3s token")
+		}
+		cfg.Token = hex.EncodeToString(token)
+	}
+
 	for _, tlsSAN := range append([]string{
 		"127.0.0.1",
 		"kube-fabric.local",
@@ -90,78 +107,108 @@ func (cfg *K3s) Hydrate(_ cnc.Preset, _ meta.FabricMode) error {
 	return nil
 }
 
-func (cfg *K3s) Build(_ string, _ cnc.Preset, _ meta.FabricMode, get cnc.GetComponent, wiring *wiring.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
+func (cfg *K3s) Build(_ string, preset cnc.Preset, _ meta.FabricMode, get cnc.GetComponent, wiring *wiring.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
 	cfg.Ref = cfg.Ref.Fallback(BaseConfig(get).Source)
 
-	run(BundleControlInstall, StageInstall0Prep, "k3s-airgap-files",
-		&cnc.FilesORAS{
-			Ref: cfg.Ref,
-			Files: []cnc.File{
-				{
-					Name:          "k3s-install.sh",
-					InstallTarget: "/opt/bin",
-					InstallMode:   0o755,
-				},
-				{
-					Name:          "k3s",
-					InstallTarget: "/opt/bin",
-					InstallMode:   0o755,
-				},
-				{
-					Name:          "k3s-airgap-images-amd64.tar.gz",
-					InstallTarget: "/var/lib/rancher/k3s/agent/images",
-				},
-			},
-		})
+	run(BundleControlInstall, StageInstall0Prep, "k3s-airgap-files", k3sAirgapFiles(cfg.Ref))
 
-	controlNodeName, err := cfg.ControlNodeName(wiring)
+	nodes, err := getControlNodes(wiring)
 	if err != nil {
-		return errors.Wrap(err, "error getting control node name")
+		return errors.Wrap(err, "error getting control nodes")
 	}
 
-	run(BundleControlInstall, StageInstall0Prep, "k3s-config",
-		&cnc.FileGenerate{
-			File: cnc.File{
-				Name:          "k3s-config.yaml",
-				InstallTarget: "/etc/rancher/k3s",
-				InstallName:   "config.yaml",
-			},
-			Content: cnc.FromTemplate(k3sConfigTemplate,
-				"cfg", cfg,
-				"controlNodeName", controlNodeName,
-			),
-		})
-
-	install(BundleControlInstall, StageInstall1K3sZot, "k3s-airgap-install",
-		&cnc.ExecCommand{
-			Name: "k3s-install.sh",
-			Args: []string{"--disable=servicelb,traefik"},
-			Env: []string{
-				"INSTALL_K3S_SKIP_DOWNLOAD=true",
-				"INSTALL_K3S_BIN_DIR=/opt/bin",
-			},
-		})
-
-	return nil
-}
-
-func (cfg *K3s) ControlNodeName(data *wiring.Data) (string, error) {
-	name := ""
-	for _, server := range data.Server.All() {
-		if server.Spec.Type == wiringapi.ServerTypeControl {
-			if name != "" {
-				return "", errors.New("multiple control nodes found")
+	for idx, node := range nodes {
+		nodeIP, server := "", cfg.JoinServer
+		if len(nodes) > 1 && preset == PresetVLAB {
+			if nodeIP, err = controlHAIP(idx); err != nil {
+				return err
 			}
+			if server == "" {
+				if server, err = controlHAIP(0); err != nil {
+					return err
+				}
+			}
+		}
+		if len(nodes) > 1 && server == "" {
+			return errors.Errorf("k3s join server is required for multiple control nodes")
+		}
 
-			name = server.Name
+		token := ""
+		if len(nodes) > 1 {
+			token = cfg.Token
+		}
+		if !node.Join {
+			server = ""
+		}
+
+		if node.Join {
+			run(node.Bundle, StageInstall0Prep, "k3s-airgap-files", k3sAirgapFiles(cfg.Ref))
 		}
-	}
 
-	if name == "" {
-		return "", errors.New("no control node found")
+		run(node.Bundle, StageInstall0Prep, "k3s-config",
+			&cnc.FileGenerate{
+				File: cnc.File{
+					Name:          "k3s-config.yaml",
+					InstallTarget: "/etc/rancher/k3s",
+					InstallName:   "config.yaml",
+					InstallBackup: true,
+				},
+				Content: cnc.FromTemplate(k3sConfigTemplate,
+					"cfg", cfg,
+					"controlNodeName", node.Name,
+					"nodeIP", nodeIP,
+					"token", token,
+					"server", server,
+					"port", K3sAPIPort,
+					// single control node keeps the default sqlite datastore, embedded etcd is only needed for HA
+					"clusterInit", len(nodes) > 1 && !node.Join,
+				),
+			})
+
+		install(node.Bundle, Stage, "k3s-preflight",
+			&cnc.Preflight{
+				Disks: []cnc.PreflightDisk{
+					{Path: PreflightDataDir, Size: PreflightK3sDisk},
+				},
+				Memory:        PreflightK3sMemory,
+				TCPPorts:      []int{K3sAPIPort},
+				KernelModules: PreflightKernelModules,
+			})
+
+		install(node.Bundle, StageInstall1K3sZot, "k3s-airgap-install",
+			&cnc.ExecCommand{
+				Name: "k3s-install.sh",
+				Args: []string{"--disable=servicelb,traefik"},
+				Env: []string{
+					"INSTALL_K3S_SKIP_DOWNLOAD=true",
+					"INSTALL_K3S_BIN_DIR=/opt/bin",
+				},
+			})
 	}
 
-	return name, nil
+	return nil
+}
+
+func k3sAirgapFiles(ref cnc.Ref) *cnc.FilesORAS {
+	return &cnc.FilesORAS{
+		Ref: ref,
+		Files: []cnc.File{
+			{
+				Name:          "k3s-install.sh",
+				InstallTarget: "/opt/bin",
+				InstallMode:   0o755,
+			},
+			{
+				Name:          "k3s",
+				InstallTarget: "/opt/bin",
+				InstallMode:   0o755,
+			},
+			{
+				Name:          "k3s-airgap-images-amd64.tar.gz",
+				InstallTarget: "/var/lib/rancher/k3s/agent/images",
+			},
+		},
+	}
 }
 
 func K3sConfig(get cnc.GetComponent) *K3s {
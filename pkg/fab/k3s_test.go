@@ -0,0 +1,99 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fab
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	"go.githedgehog.com/fabricator/pkg/fab/cnc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_K3sConfig_ClusterInit(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		nodes int
+		want  map[cnc.Bundle]string // expected datastore line by bundle
+	}{
+		{
+			name:  "single",
+			nodes: 1,
+			want:  map[cnc.Bundle]string{BundleControlInstall: ""},
+		},
+		{
+			name:  "ha",
+			nodes: 3,
+			want: map[cnc.Bundle]string{
+				BundleControlInstall:        "cluster-init: true",
+				BundleControlJoinInstall[0]: "server: https://172.30.2.1:6443",
+				BundleControlJoinInstall[1]: "server: https://172.30.2.1:6443",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := wiring.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for idx := 1; idx <= tt.nodes; idx++ {
+				if err := data.Add(&wiringapi.Server{
+					TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindServer, APIVersion: wiringapi.GroupVersion.String()},
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("control-%d", idx)},
+					Spec:       wiringapi.ServerSpec{Type: wiringapi.ServerTypeControl},
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := &K3s{JoinServer: "172.30.2.1"}
+			get := func(string) cnc.Component { return &Base{} }
+			configs := map[cnc.Bundle]string{}
+			run := func(bundle cnc.Bundle, _ cnc.Stage, name string, op cnc.BuildOp) {
+				if gen, ok := op.(*cnc.FileGenerate); ok && name == "k3s-config" {
+					content, err := gen.Content()
+					if err != nil {
+						t.Fatal(err)
+					}
+					configs[bundle] = content
+				}
+			}
+			install := func(cnc.Bundle, cnc.Stage, string, cnc.RunOp) {}
+
+			if err := cfg.Build("", PresetBM, meta.FabricModeSpineLeaf, get, data, run, install); err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			if len(configs) != len(tt.want) {
+				t.Fatalf("got k3s configs for %d bundles, want %d", len(configs), len(tt.want))
+			}
+			for bundle, want := range tt.want {
+				config := configs[bundle]
+				for _, line := range []string{"cluster-init: true", "server: https://"} {
+					if strings.Contains(config, line) != (want != "" && strings.HasPrefix(want, line)) {
+						t.Errorf("bundle %s: unexpected presence of %q in config:\n%s", bundle.Name, line, config)
+					}
+				}
+				if want != "" && !strings.Contains(config, want) {
+					t.Errorf("bundle %s: expected %q in config:\n%s", bundle.Name, want, config)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fab
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	wiringlib "go.githedgehog.com/fabric/pkg/wiring"
+	"go.githedgehog.com/fabricator/pkg/fab/cnc"
+	"go.githedgehog.com/fabricator/pkg/fab/wiring"
+	"sigs.k8s.io/yaml"
+)
+
+func FabricConfig(get cnc.GetComponent) *Fabric {
+	return get((&Fabric{}).Name()).(*Fabric)
+}
+
+// RenderSwitch writes the Agent spec built by the fabric controller for the switch from the hydrated wiring and the
+// same fabric config that is installed on the control node, wiring with tenants is loaded from the file if specified
+// instead of the installer one
+func RenderSwitch(ctx context.Context, mngr *cnc.Manager, wiringPath string, switchName string, w io.Writer) error {
+	if switchName == "" {
+		return errors.Errorf("switch name is not specified")
+	}
+
+	data, tenants := mngr.Wiring(), mngr.Tenants()
+	if wiringPath != "" {
+		var err error
+		if data, err = wiringlib.New(); err != nil {
+			return errors.Wrapf(err, "error creating wiring data")
+		}
+		if tenants, err = wiring.LoadWiring(wiringPath, data); err != nil {
+			return errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
+		}
+	}
+
+	get := mngr.Component
+	cfg := FabricConfig(get)
+	fabricCfg := cfg.buildFabricConfig(mngr.FabricMode(), get, cfg.switchUsers(get))
+
+	agent, err := wiring.RenderAgent(ctx, data, tenants, fabricCfg, switchName)
+	if err != nil {
+		return errors.Wrapf(err, "error rendering switch %s agent", switchName)
+	}
+
+	out, err := yaml.Marshal(agent.Spec)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling agent spec")
+	}
+	_, err = w.Write(out)
+
+	return errors.Wrapf(err, "error writing agent spec")
+}
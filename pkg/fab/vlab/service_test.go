@@ -56,6 +56,10 @@ func Test_portIdForName(t *testing.T) {
 			port:  "E2/1",
 			error: true,
 		},
+		{
+			port:  "E1/1/1",
+			error: true,
+		},
 	}
 
 	for _, tt := range tests {
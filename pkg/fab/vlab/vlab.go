@@ -37,8 +37,14 @@ const (
 	SSHPortBase      = 22000
 	IfPortBase       = 30000
 	IfPortNull       = IfPortBase + 9000
+	IfPortControlHA  = IfPortBase + 9100 // multicast port for the network between control nodes
 	IfPortVMIDMult   = 100
 	IfPortPortIDMult = 1
+
+	ControlHAMACTmpl  = "0c:20:12:fd:00:%02d" // control nodes are connected to each other using it if there are more than one
+	ControlHAMcast    = "230.0.0.1"
+	ControlNodesMax   = 3
+	ControlHAConnName = "control-ha"
 )
 
 var RequiredCommands = []string{
@@ -57,22 +63,29 @@ type Service struct {
 }
 
 type ServiceConfig struct {
-	DryRun            bool
-	Size              string
-	SudoSwtpm         bool
-	CharNBDDev        string
-	InstallComplete   bool
-	RunComplete       string
-	OnReady           []string
-	RestrictServers   bool
-	Basedir           string
-	Wiring            *wiring.Data
-	ControlIgnition   string
-	ServerIgnitionDir string
-	ControlInstaller  string
-	ServerInstaller   string
-	FilesDir          string
-	SSHKey            string
+	DryRun                bool
+	Size                  string
+	SudoSwtpm             bool
+	CharNBDDev            string
+	InstallComplete       bool
+	RunComplete           string
+	OnReady               []string
+	RestrictServers       bool
+	Basedir               string
+	Wiring                *wiring.Data
+	ControlIgnition       string
+	ServerIgnitionDir     string
+	ControlInstaller      string
+	ControlIgnitionDir    string   // ignitions for the additional control nodes named <name>.ignition.json
+	ControlJoinInstallers []string // installers for the additional control nodes, in the control nodes order
+	ServerInstaller       string
+	FilesDir              string
+	SSHKey                string
+}
+
+// ControlHAMAC returns MAC address of the control HA network interface of the control node by its position
+func ControlHAMAC(idx int) string {
+	return fmt.Sprintf(ControlHAMACTmpl, idx)
 }
 
 func Load(cfg *ServiceConfig) (*Service, error) {
@@ -286,9 +299,14 @@ func (svc *Service) vmSelector(name string, mode string, msg string) (*VM, error
 }
 
 func (svc *Service) findJumpForSwitch(name string) (string, string, error) {
-	var controlVM *VM
-	for _, vm := range svc.mngr.sortedVMs() {
-		if vm.Type == VMTypeControl {
+	// the control node with management link to the switch is used, it's the first one unless wiring is custom
+	controlVM := svc.mngr.firstControlVM()
+	for _, conn := range svc.cfg.Wiring.Connection.All() {
+		if conn.Spec.Management == nil || conn.Spec.Management.Link.Switch.DeviceName() != name {
+			continue
+		}
+
+		if vm, exist := svc.mngr.vms[conn.Spec.Management.Link.Server.DeviceName()]; exist && vm.Type == VMTypeControl {
 			controlVM = vm
 
 			break
@@ -16,7 +16,11 @@ package vlab
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+	"go.githedgehog.com/fabricator/pkg/fab/wiring"
 )
 
 func Test_VM_UUID(t *testing.T) {
@@ -47,3 +51,33 @@ func Test_VM_UUID(t *testing.T) {
 		})
 	}
 }
+
+func Test_NewVMManager_Breakouts(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		breakouts string
+		error     bool
+	}{
+		{name: "no-breakouts"},
+		{name: "breakouts", breakouts: "E1/5-6=4x25G", error: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := (&wiring.Builder{
+				FabricMode:       meta.FabricModeSpineLeaf,
+				UnbundledServers: 1,
+				LeafBreakouts:    tt.breakouts,
+			}).Build()
+			if err != nil {
+				t.Fatalf("error building wiring: %v", err)
+			}
+
+			_, err = NewVMManager(&Config{}, data, t.TempDir(), VMSizeDefault, false)
+			if tt.error && (err == nil || !strings.Contains(err.Error(), "breakouts")) {
+				t.Errorf("NewVMManager() expected breakouts error, got %v", err)
+			}
+			if !tt.error && err != nil {
+				t.Errorf("NewVMManager() expected no error, got %v", err)
+			}
+		})
+	}
+}
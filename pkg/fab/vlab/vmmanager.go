@@ -15,6 +15,7 @@
 package vlab
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -22,6 +23,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
@@ -133,6 +135,7 @@ type VMInterface struct {
 	Connection  string
 	Netdev      string
 	Passthrough string
+	MAC         string // overrides the generated one
 }
 
 func NewVMManager(cfg *Config, data *wiring.Data, basedir string, size string, restrictServers bool) (*VMManager, error) {
@@ -176,6 +179,12 @@ func NewVMManager(cfg *Config, data *wiring.Data, basedir string, size string, r
 			return nil, errors.Errorf("duplicate server/switch name: %s", server.Name)
 		}
 
+		// kube API and registry are only forwarded from the first control node
+		hostfwd := fmt.Sprintf("hostfwd=tcp:0.0.0.0:%d-:22", sshPortFor(vmID))
+		if vmID == 0 {
+			hostfwd += fmt.Sprintf(",hostfwd=tcp:0.0.0.0:%d-:6443,hostfwd=tcp:0.0.0.0:%d-:31000", KubePort, RegistryPort)
+		}
+
 		mngr.vms[server.Name] = &VM{
 			ID:     vmID,
 			Name:   server.Name,
@@ -185,8 +194,8 @@ func NewVMManager(cfg *Config, data *wiring.Data, basedir string, size string, r
 				0: {
 					Connection: "host",
 					// TODO optionally make control node isolated using ",restrict=yes"
-					Netdev: fmt.Sprintf("user,hostfwd=tcp:0.0.0.0:%d-:22,hostfwd=tcp:0.0.0.0:%d-:6443,hostfwd=tcp:0.0.0.0:%d-:31000,hostname=%s,domainname=local,dnssearch=local,net=172.31.%d.0/24,dhcpstart=172.31.%d.10",
-						sshPortFor(vmID), KubePort, RegistryPort, server.Name, vmID, vmID),
+					Netdev: fmt.Sprintf("user,%s,hostname=%s,domainname=local,dnssearch=local,net=172.31.%d.0/24,dhcpstart=172.31.%d.10",
+						hostfwd, server.Name, vmID, vmID),
 				},
 			},
 		}
@@ -194,11 +203,12 @@ func NewVMManager(cfg *Config, data *wiring.Data, basedir string, size string, r
 		vmID++
 	}
 
-	if vmID == 0 {
+	controlNodes := vmID
+	if controlNodes == 0 {
 		return nil, errors.Errorf("control node is required")
 	}
-	if vmID > 1 {
-		return nil, errors.Errorf("multiple control nodes not support")
+	if controlNodes > ControlNodesMax {
+		return nil, errors.Errorf("up to %d control nodes supported", ControlNodesMax)
 	}
 
 	for _, server := range data.Server.All() {
@@ -249,6 +259,14 @@ func NewVMManager(cfg *Config, data *wiring.Data, basedir string, size string, r
 			}
 		}
 
+		// virtual switches have a single interface per front panel port, so sub-ports can't be mapped to VM interfaces
+		if len(sw.Spec.PortBreakouts) > 0 {
+			ports := maps.Keys(sw.Spec.PortBreakouts)
+			sort.Strings(ports)
+
+			return nil, errors.Errorf("virtual switch %s doesn't support port breakouts (%s), remove them or use hardware switch", sw.Name, strings.Join(ports, ", "))
+		}
+
 		mngr.vms[sw.Name] = &VM{
 			ID:         vmID,
 			Name:       sw.Name,
@@ -368,6 +386,15 @@ func NewVMManager(cfg *Config, data *wiring.Data, basedir string, size string, r
 				vm.Interfaces[iface] = VMInterface{}
 			}
 		}
+
+		// control nodes are connected to each other using the shared segment, control VMs are always first
+		if vm.Type == VMTypeControl && controlNodes > 1 {
+			vm.Interfaces[maxDevID+1] = VMInterface{
+				Connection: ControlHAConnName,
+				Netdev:     fmt.Sprintf("socket,mcast=%s:%d,localaddr=127.0.0.1", ControlHAMcast, IfPortControlHA),
+				MAC:        ControlHAMAC(vm.ID),
+			}
+		}
 	}
 
 	return mngr, nil
@@ -455,6 +482,34 @@ func (mngr *VMManager) sortedVMs() []*VM {
 	return vms
 }
 
+// firstControlVM returns the control VM the other ones are joining, control VMs are always created first
+func (mngr *VMManager) firstControlVM() *VM {
+	for _, vm := range mngr.sortedVMs() {
+		if vm.Type == VMTypeControl {
+			return vm
+		}
+	}
+
+	return nil
+}
+
+func (mngr *VMManager) waitFirstControlInstalled(ctx context.Context) error {
+	first := mngr.firstControlVM()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for !first.Installed.Is() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "error waiting for the first control node to be installed")
+		}
+	}
+
+	return nil
+}
+
 func (mngr *VMManager) LogOverview() {
 	for _, vm := range mngr.sortedVMs() {
 		if vm.Type == VMTypeSwitchHW {
@@ -502,6 +557,9 @@ func portIDForName(name string) (int, error) {
 		return 0, nil
 	} else if strings.HasPrefix(name, "E1/") { // hedgehog port names
 		port, _ := strings.CutPrefix(name, "E1/")
+		if strings.Contains(port, "/") {
+			return -1, errors.Errorf("breakout sub-port '%s' isn't supported by virtual switches", name)
+		}
 		idx, err := strconv.Atoi(port)
 
 		return idx, errors.Wrapf(err, "error converting port name '%s' to port id", name)
@@ -144,7 +144,11 @@ func (vm *VM) RunVM(ctx context.Context, svcCfg *ServiceConfig) func() error {
 			if iface.Passthrough != "" {
 				device = fmt.Sprintf("vfio-pci,host=%s,id=%s", iface.Passthrough, deviceID)
 			} else {
-				device = fmt.Sprintf("e1000,mac=%s", vm.macFor(ifaceID))
+				mac := iface.MAC
+				if mac == "" {
+					mac = vm.macFor(ifaceID)
+				}
+				device = fmt.Sprintf("e1000,mac=%s", mac)
 				if iface.Netdev != "" {
 					device += fmt.Sprintf(",netdev=%s", deviceID)
 					netdev = fmt.Sprintf("%s,id=%s", iface.Netdev, deviceID)
@@ -177,6 +181,14 @@ func (vm *VM) RunInstall(ctx context.Context, svc *Service) func() error {
 		if vm.Installed.Is() {
 			slog.Debug("VM is already installed", "name", vm.Name)
 		} else {
+			// additional control nodes are joining the first one so it should be installed already
+			if vm.Type == VMTypeControl && vm.ID > 0 {
+				slog.Info("Waiting for the first control node to be installed", "name", vm.Name)
+				if err := svc.mngr.waitFirstControlInstalled(ctx); err != nil {
+					return err
+				}
+			}
+
 			slog.Info("Installing VM", "name", vm.Name, "type", vm.Type)
 
 			timeout := 10 * time.Minute // TODO
@@ -218,6 +230,11 @@ func (vm *VM) RunInstall(ctx context.Context, svc *Service) func() error {
 			installerPath := svcCfg.ControlInstaller
 			if vm.Type == VMTypeServer {
 				installerPath = svcCfg.ServerInstaller
+			} else if vm.ID > 0 {
+				if vm.ID > len(svcCfg.ControlJoinInstallers) {
+					return errors.Errorf("no installer for control node %s", vm.Name)
+				}
+				installerPath = svcCfg.ControlJoinInstallers[vm.ID-1]
 			}
 			installer := filepath.Base(installerPath)
 
@@ -238,7 +255,7 @@ func (vm *VM) RunInstall(ctx context.Context, svc *Service) func() error {
 				return errors.Wrap(err, "error installing vm")
 			}
 
-			if vm.Type == VMTypeControl {
+			if vm.Type == VMTypeControl && vm.ID == 0 {
 				err = vm.download(ctx, svcCfg, true, "/etc/rancher/k3s/k3s.yaml", filepath.Join(svcCfg.Basedir, "kubeconfig.yaml"))
 				if err != nil {
 					return errors.Wrapf(err, "error downloading kubeconfig")
@@ -253,7 +270,7 @@ func (vm *VM) RunInstall(ctx context.Context, svc *Service) func() error {
 			}
 		}
 
-		if vm.Type != VMTypeControl {
+		if vm.Type != VMTypeControl || vm.ID > 0 {
 			return nil
 		}
 
@@ -361,8 +378,10 @@ func (vm *VM) Prepare(ctx context.Context, svcCfg *ServiceConfig) error {
 		files["efi_code.fd"] = filepath.Join(svcCfg.FilesDir, "flatcar_efi_code.fd")
 		files["efi_vars.fd"] = filepath.Join(svcCfg.FilesDir, "flatcar_efi_vars.fd")
 
-		if vm.Type == VMTypeControl {
+		if vm.Type == VMTypeControl && vm.ID == 0 {
 			files["ignition.json"] = svcCfg.ControlIgnition
+		} else if vm.Type == VMTypeControl {
+			files["ignition.json"] = filepath.Join(svcCfg.ControlIgnitionDir, fmt.Sprintf("%s.ignition.json", vm.Name))
 		} else {
 			files["ignition.json"] = filepath.Join(svcCfg.ServerIgnitionDir, fmt.Sprintf("%s.ignition.json", vm.Name))
 		}
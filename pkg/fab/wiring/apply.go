@@ -0,0 +1,272 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/pkg/errors"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/util/kubeutil"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ApplyFieldOwner is the field manager used for the server-side apply
+const ApplyFieldOwner = "hhfab"
+
+// applyKinds are the kinds managed by apply in the safe order, prune goes in the reverse one
+var applyKinds = []string{
+	wiringapi.KindVLANNamespace,
+	wiringapi.KindSwitchGroup,
+	wiringapi.KindSwitch,
+	wiringapi.KindServer,
+	wiringapi.KindConnection,
+}
+
+type ApplyOp struct {
+	Kind   string
+	Name   string
+	Delete bool
+}
+
+// ApplyPlan is the wiring diff between the cluster and the desired wiring with the ordered ops to get there
+type ApplyPlan struct {
+	Diff *WiringDiff
+	Ops  []ApplyOp
+}
+
+// PlanApply compares current (cluster) and desired wiring, objects only present in the cluster are deleted only if
+// prune is enabled
+func PlanApply(current, desired *wiring.Data, prune bool) (*ApplyPlan, error) {
+	for _, kind := range applyKinds {
+		for _, obj := range wiringObjects(desired, kind) {
+			// the same defaults webhook sets on create, e.g. connection labels
+			if defaulter, ok := obj.(interface{ Default() }); ok {
+				defaulter.Default()
+			}
+		}
+	}
+
+	diff, err := Diff(current, desired)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error comparing wiring")
+	}
+
+	plan := &ApplyPlan{Diff: diff}
+	for _, kind := range applyKinds {
+		for _, obj := range diff.Objects {
+			if obj.Kind == kind && obj.Op != DiffRemoved {
+				plan.Ops = append(plan.Ops, ApplyOp{Kind: obj.Kind, Name: obj.Name})
+			}
+		}
+	}
+	if prune {
+		for idx := len(applyKinds) - 1; idx >= 0; idx-- {
+			for _, obj := range diff.Objects {
+				if obj.Kind == applyKinds[idx] && obj.Op == DiffRemoved {
+					plan.Ops = append(plan.Ops, ApplyOp{Kind: obj.Kind, Name: obj.Name, Delete: true})
+				}
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// Write writes the diff followed by the ordered list of ops
+func (p *ApplyPlan) Write(w io.Writer) {
+	p.Diff.Write(w)
+
+	fmt.Fprintln(w)
+	if len(p.Ops) == 0 {
+		fmt.Fprintln(w, "Plan: nothing to do")
+
+		return
+	}
+	fmt.Fprintln(w, "Plan:")
+	for idx, op := range p.Ops {
+		action := "apply"
+		if op.Delete {
+			action = "delete"
+		}
+		fmt.Fprintf(w, "  %d. %s %s %s\n", idx+1, action, op.Kind, op.Name)
+	}
+}
+
+func wiringObjects(data *wiring.Data, kind string) []client.Object {
+	res := []client.Object{}
+	add := func(obj client.Object) { res = append(res, obj) }
+
+	switch kind {
+	case wiringapi.KindVLANNamespace:
+		for _, obj := range data.VLANNamespace.All() {
+			add(obj)
+		}
+	case wiringapi.KindSwitchGroup:
+		for _, obj := range data.SwitchGroup.All() {
+			add(obj)
+		}
+	case wiringapi.KindSwitch:
+		for _, obj := range data.Switch.All() {
+			add(obj)
+		}
+	case wiringapi.KindServer:
+		for _, obj := range data.Server.All() {
+			add(obj)
+		}
+	case wiringapi.KindConnection:
+		for _, obj := range data.Connection.All() {
+			add(obj)
+		}
+	}
+
+	return res
+}
+
+func wiringObject(data *wiring.Data, kind, name string) client.Object {
+	objs := wiringObjects(data, kind)
+	idx := slices.IndexFunc(objs, func(obj client.Object) bool { return obj.GetName() == name })
+	if idx < 0 {
+		return nil
+	}
+
+	return objs[idx]
+}
+
+// loadClusterWiring loads all wiring objects managed by apply from the cluster
+func loadClusterWiring(ctx context.Context, kube client.Client) (*wiring.Data, error) {
+	data, err := wiring.New()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating wiring data")
+	}
+
+	for _, list := range []client.ObjectList{
+		&wiringapi.VLANNamespaceList{},
+		&wiringapi.SwitchGroupList{},
+		&wiringapi.SwitchList{},
+		&wiringapi.ServerList{},
+		&wiringapi.ConnectionList{},
+	} {
+		if err := kube.List(ctx, list, client.InNamespace(metav1.NamespaceDefault)); err != nil {
+			return nil, errors.Wrapf(err, "error listing %T", list)
+		}
+		if err := apimeta.EachListItem(list, func(obj runtime.Object) error {
+			return data.Add(obj.(client.Object)) //nolint:forcetypeassert
+		}); err != nil {
+			return nil, errors.Wrapf(err, "error adding %T items", list)
+		}
+	}
+
+	return data, nil
+}
+
+// Apply executes the plan using server-side apply, with dry run all changes are only validated by the API server
+func Apply(ctx context.Context, kube client.Client, plan *ApplyPlan, current, desired *wiring.Data, dryRun bool) error {
+	for _, op := range plan.Ops {
+		if op.Delete {
+			obj := wiringObject(current, op.Kind, op.Name)
+			if obj == nil {
+				return errors.Errorf("%s %s not found in cluster", op.Kind, op.Name)
+			}
+
+			opts := []client.DeleteOption{}
+			if dryRun {
+				opts = append(opts, client.DryRunAll)
+			}
+			if err := kube.Delete(ctx, obj, opts...); client.IgnoreNotFound(err) != nil {
+				return errors.Wrapf(err, "error deleting %s %s", op.Kind, op.Name)
+			}
+			slog.Info("Deleted", "kind", op.Kind, "name", op.Name, "dryRun", dryRun)
+
+			continue
+		}
+
+		obj := wiringObject(desired, op.Kind, op.Name)
+		if obj == nil {
+			return errors.Errorf("%s %s not found in wiring", op.Kind, op.Name)
+		}
+
+		obj = obj.DeepCopyObject().(client.Object) //nolint:forcetypeassert
+		obj.GetObjectKind().SetGroupVersionKind(wiringapi.GroupVersion.WithKind(op.Kind))
+		obj.SetNamespace(cmp.Or(obj.GetNamespace(), metav1.NamespaceDefault))
+		obj.SetResourceVersion("")
+		obj.SetManagedFields(nil)
+
+		opts := []client.PatchOption{client.FieldOwner(ApplyFieldOwner), client.ForceOwnership}
+		if dryRun {
+			opts = append(opts, client.DryRunAll)
+		}
+		if err := kube.Patch(ctx, obj, client.Apply, opts...); err != nil {
+			return errors.Wrapf(err, "error applying %s %s", op.Kind, op.Name)
+		}
+		slog.Info("Applied", "kind", op.Kind, "name", op.Name, "dryRun", dryRun)
+	}
+
+	return nil
+}
+
+// ApplyPath loads the wiring, writes the plan to stdout and applies it to the cluster
+func ApplyPath(ctx context.Context, wiringPath, kubeconfig string, dryRun, prune bool) error {
+	if wiringPath == "" {
+		return errors.Errorf("wiring path is not specified")
+	}
+	if kubeconfig == "" {
+		return errors.Errorf("kubeconfig is not specified")
+	}
+
+	desired, err := wiring.New()
+	if err != nil {
+		return errors.Wrapf(err, "error creating wiring data")
+	}
+	tenants, err := LoadWiring(wiringPath, desired)
+	if err != nil {
+		return errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
+	}
+	if len(tenants.Objects()) > 0 {
+		slog.Warn("Wiring contains VPCs and attachments, they are ignored by apply")
+	}
+
+	kube, err := kubeutil.NewClient(ctx, kubeconfig, wiringapi.SchemeBuilder)
+	if err != nil {
+		return errors.Wrapf(err, "error creating kube client")
+	}
+
+	current, err := loadClusterWiring(ctx, kube)
+	if err != nil {
+		return errors.Wrapf(err, "error loading wiring from cluster")
+	}
+
+	plan, err := PlanApply(current, desired, prune)
+	if err != nil {
+		return err
+	}
+	plan.Write(os.Stdout)
+
+	if !prune && slices.ContainsFunc(plan.Diff.Objects, func(obj DiffObject) bool { return obj.Op == DiffRemoved }) {
+		slog.Warn("Some objects exist only in the cluster, use --prune to delete them")
+	}
+
+	return Apply(ctx, kube, plan, current, desired, dryRun)
+}
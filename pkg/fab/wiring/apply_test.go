@@ -0,0 +1,86 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PlanApply(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		prune bool
+		want  []string
+	}{
+		{
+			name: "no-prune",
+			want: []string{"apply SwitchGroup mclag-1", "apply Connection server-1--leaf-1--unbundled"},
+		},
+		{
+			name:  "prune",
+			prune: true,
+			want: []string{
+				"apply SwitchGroup mclag-1", "apply Connection server-1--leaf-1--unbundled",
+				"delete Connection server-2--leaf-2--unbundled", "delete Switch leaf-3",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			current := diffTestData(t, 65101, "leaf-1/E1/1", "172.30.30.1/31", nil)
+			if err := current.Add(
+				&wiringapi.Switch{
+					TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindSwitch, APIVersion: wiringapi.GroupVersion.String()},
+					ObjectMeta: metav1.ObjectMeta{Name: "leaf-3"},
+				},
+				&wiringapi.Connection{
+					TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindConnection, APIVersion: wiringapi.GroupVersion.String()},
+					ObjectMeta: metav1.ObjectMeta{Name: "server-2--leaf-2--unbundled"},
+				},
+			); err != nil {
+				t.Fatalf("error adding objects: %v", err)
+			}
+
+			desired := diffTestData(t, 65101, "leaf-1/E1/2", "172.30.30.1/31", nil)
+			if err := desired.Add(&wiringapi.SwitchGroup{
+				TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindSwitchGroup, APIVersion: wiringapi.GroupVersion.String()},
+				ObjectMeta: metav1.ObjectMeta{Name: "mclag-1"},
+			}); err != nil {
+				t.Fatalf("error adding objects: %v", err)
+			}
+
+			plan, err := PlanApply(current, desired, tt.prune)
+			if err != nil {
+				t.Fatalf("PlanApply() error = %v", err)
+			}
+
+			got := []string{}
+			for _, op := range plan.Ops {
+				action := "apply"
+				if op.Delete {
+					action = "delete"
+				}
+				got = append(got, fmt.Sprintf("%s %s %s", action, op.Kind, op.Name))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("PlanApply() ops = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
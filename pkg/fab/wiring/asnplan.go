@@ -0,0 +1,208 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+)
+
+const (
+	// ASNOverride is a switch annotation with the ASN that is always used for the switch instead of the allocated one
+	ASNOverride = "asn.hhfab.fabric.githedgehog.com/override"
+	// RackAnnotation is a switch annotation with the rack name, used by the per-rack ASN strategy
+	RackAnnotation = "rack.hhfab.fabric.githedgehog.com"
+)
+
+type ASNStrategy string
+
+const (
+	ASNStrategyPerLeaf            ASNStrategy = "per-leaf"             // each leaf gets own ASN, MCLAG peers share it
+	ASNStrategyPerRedundancyGroup ASNStrategy = "per-redundancy-group" // all leafs of the MCLAG or ESLAG group share ASN
+	ASNStrategyPerRack            ASNStrategy = "per-rack"             // all leafs in the rack share ASN, leafs should be annotated with rack
+)
+
+var ASNStrategies = []ASNStrategy{ASNStrategyPerLeaf, ASNStrategyPerRedundancyGroup, ASNStrategyPerRack}
+
+const (
+	ASNPrivate4ByteStart = 4200000000
+	ASNPrivate4ByteEnd   = 4294967294
+)
+
+// ASNRange is a single ASN or an inclusive range, e.g. "65100" or "65101-65199"
+type ASNRange string
+
+// ASNPlan defines how hydration assigns ASNs, it's a part of the IPPlan file. Example:
+//
+//	asn:
+//	  strategy: per-redundancy-group
+//	  private4Byte: true
+//	  leaf: 4200001000-4200001999
+//
+// Ranges that aren't set are taken from the hydrate config (spine ASN and leaf ASN start), or from the 4-byte private
+// range if private4Byte is set. All spines share the first ASN of the spine range. Virtual edge ASN is used in the
+// standard BGP communities and so it should be a 2-byte one.
+type ASNPlan struct {
+	Strategy     ASNStrategy `json:"strategy,omitempty"`     // one of per-leaf (default), per-redundancy-group, per-rack
+	Private4Byte bool        `json:"private4Byte,omitempty"` // use 4-byte private ASNs (4200000000-4294967294) by default
+	Spine        ASNRange    `json:"spine,omitempty"`
+	Leaf         ASNRange    `json:"leaf,omitempty"`
+	VirtualEdge  ASNRange    `json:"virtualEdge,omitempty"`
+}
+
+type asnRange struct {
+	name       string
+	start, end uint32
+}
+
+func (r ASNRange) parse(name string) (asnRange, error) {
+	res := asnRange{name: name}
+
+	from, to, isRange := strings.Cut(string(r), "-")
+	start, err := strconv.ParseUint(strings.TrimSpace(from), 10, 32)
+	if err != nil {
+		return res, errors.Wrapf(err, "error parsing %s ASN range %s", name, r)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.ParseUint(strings.TrimSpace(to), 10, 32)
+		if err != nil {
+			return res, errors.Wrapf(err, "error parsing %s ASN range %s", name, r)
+		}
+	}
+
+	if start == 0 || start > end {
+		return res, errors.Errorf("invalid %s ASN range %s", name, r)
+	}
+
+	res.start, res.end = uint32(start), uint32(end)
+
+	return res, nil
+}
+
+func (r asnRange) String() string {
+	if r.start == r.end {
+		return fmt.Sprintf("%d", r.start)
+	}
+
+	return fmt.Sprintf("%d-%d", r.start, r.end)
+}
+
+func (r asnRange) contains(asn uint32) bool {
+	return asn >= r.start && asn <= r.end
+}
+
+type asnRanges struct {
+	strategy    ASNStrategy
+	spine       asnRange
+	leaf        asnRange
+	virtualEdge asnRange
+}
+
+// ranges returns ranges for all roles with defaults filled from the hydrate config
+func (plan *ASNPlan) ranges(cfg *HydrateConfig) (*asnRanges, error) {
+	res := &asnRanges{strategy: plan.Strategy}
+	if res.strategy == "" {
+		res.strategy = ASNStrategyPerLeaf
+	}
+	if !slices.Contains(ASNStrategies, res.strategy) {
+		return nil, errors.Errorf("unknown ASN strategy %s", res.strategy)
+	}
+
+	spine := ASNRange(fmt.Sprintf("%d", cfg.SpineASN))
+	leaf := ASNRange(fmt.Sprintf("%d-%d", cfg.LeafASNStart, 65534))
+	if plan.Private4Byte {
+		spine = ASNRange(fmt.Sprintf("%d", ASNPrivate4ByteStart))
+		leaf = ASNRange(fmt.Sprintf("%d-%d", ASNPrivate4ByteStart+1, ASNPrivate4ByteEnd))
+	}
+	virtualEdge := ASNRange(fmt.Sprintf("%d-%d", VirtualEdgeASN, VirtualEdgeASN+99))
+
+	for _, r := range []struct {
+		name   string
+		value  ASNRange
+		def    ASNRange
+		target *asnRange
+	}{
+		{"spine", plan.Spine, spine, &res.spine},
+		{"leaf", plan.Leaf, leaf, &res.leaf},
+		{"virtualEdge", plan.VirtualEdge, virtualEdge, &res.virtualEdge},
+	} {
+		value := r.value
+		if value == "" {
+			value = r.def
+		}
+
+		var err error
+		if *r.target, err = value.parse(r.name); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.virtualEdge.end > 65535 {
+		return nil, errors.Errorf("virtual edge ASN range %s should be 2-byte", res.virtualEdge)
+	}
+
+	all := []asnRange{res.spine, res.leaf, res.virtualEdge}
+	for idx, a := range all {
+		for _, b := range all[idx+1:] {
+			if a.start <= b.end && b.start <= a.end {
+				return nil, errors.Errorf("ASN ranges %s (%s) and %s (%s) overlap", a.name, a, b.name, b)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// check returns an error if the switch can't be grouped with the ASN strategy
+func (r *asnRanges) check(sw *wiringapi.Switch) error {
+	if r.strategy == ASNStrategyPerRack && sw.Spec.Role.IsLeaf() && sw.Annotations[RackAnnotation] == "" {
+		return errors.Errorf("leaf %s has no %s annotation required by the %s ASN strategy", sw.Name, RackAnnotation, r.strategy)
+	}
+
+	return nil
+}
+
+// group returns the key of the ASN group for the switch, all switches in the same group share ASN, switch should be
+// checked first
+func (r *asnRanges) group(sw *wiringapi.Switch, mclagPeer map[string]string) string {
+	if sw.Spec.Role.IsSpine() {
+		return "spine"
+	}
+	if !sw.Spec.Role.IsLeaf() {
+		return "switch:" + sw.Name
+	}
+
+	switch r.strategy {
+	case ASNStrategyPerRack:
+		return "rack:" + sw.Annotations[RackAnnotation]
+	case ASNStrategyPerRedundancyGroup:
+		if sw.Spec.Redundancy.Group != "" {
+			return "redundancy:" + sw.Spec.Redundancy.Group
+		}
+	case ASNStrategyPerLeaf:
+	}
+
+	if peer, ok := mclagPeer[sw.Name]; ok {
+		return "mclag:" + min(sw.Name, peer) + "," + max(sw.Name, peer)
+	}
+
+	return "switch:" + sw.Name
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"strings"
+	"testing"
+
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ASNPlan_ranges(t *testing.T) {
+	cfg := DefaultHydrateConfig()
+
+	for _, test := range []struct {
+		name                     string
+		plan                     ASNPlan
+		spine, leaf, virtualEdge string
+		error                    bool
+	}{
+		{
+			name:        "default",
+			spine:       "65100",
+			leaf:        "65101-65534",
+			virtualEdge: "64100-64199",
+		},
+		{
+			name:        "private-4-byte",
+			plan:        ASNPlan{Private4Byte: true, Leaf: "4200001000-4200001999"},
+			spine:       "4200000000",
+			leaf:        "4200001000-4200001999",
+			virtualEdge: "64100-64199",
+		},
+		{
+			name:  "unknown-strategy",
+			plan:  ASNPlan{Strategy: "per-everything"},
+			error: true,
+		},
+		{
+			name:  "overlap",
+			plan:  ASNPlan{Spine: "65100-65200"},
+			error: true,
+		},
+		{
+			name:  "reversed",
+			plan:  ASNPlan{Leaf: "65200-65101"},
+			error: true,
+		},
+		{
+			name:  "virtual-edge-4-byte",
+			plan:  ASNPlan{VirtualEdge: "4200000100"},
+			error: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := test.plan.ranges(cfg)
+			if test.error {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.spine.String() != test.spine || r.leaf.String() != test.leaf || r.virtualEdge.String() != test.virtualEdge {
+				t.Errorf("got ranges %s, %s, %s, want %s, %s, %s", r.spine, r.leaf, r.virtualEdge, test.spine, test.leaf, test.virtualEdge)
+			}
+		})
+	}
+}
+
+func Test_asnRanges_group(t *testing.T) {
+	leaf := func(name, group, rack string) *wiringapi.Switch {
+		return &wiringapi.Switch{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{RackAnnotation: rack}},
+			Spec: wiringapi.SwitchSpec{
+				Role:       wiringapi.SwitchRoleServerLeaf,
+				Redundancy: wiringapi.SwitchRedundancy{Group: group},
+			},
+		}
+	}
+
+	sws := []*wiringapi.Switch{
+		leaf("leaf-01", "mclag-1", "rack-1"),
+		leaf("leaf-02", "mclag-1", "rack-1"),
+		leaf("leaf-03", "eslag-1", "rack-1"),
+		leaf("leaf-04", "eslag-1", "rack-2"),
+		leaf("leaf-05", "", "rack-2"),
+	}
+	mclagPeer := map[string]string{"leaf-01": "leaf-02", "leaf-02": "leaf-01"}
+
+	for _, test := range []struct {
+		strategy ASNStrategy
+		shared   []bool // if the switch shares ASN with the previous one
+	}{
+		{ASNStrategyPerLeaf, []bool{true, false, false}},
+		{ASNStrategyPerRedundancyGroup, []bool{true, false, true, false}},
+		{ASNStrategyPerRack, []bool{true, true, false, true}},
+	} {
+		r := &asnRanges{strategy: test.strategy}
+		for idx, shared := range test.shared {
+			prev, sw := sws[idx], sws[idx+1]
+			if got := r.group(prev, mclagPeer) == r.group(sw, mclagPeer); got != shared {
+				t.Errorf("%s: %s and %s share ASN %t, want %t", test.strategy, prev.Name, sw.Name, got, shared)
+			}
+		}
+	}
+}
+
+func Test_asnRanges_check(t *testing.T) {
+	sw := &wiringapi.Switch{
+		ObjectMeta: metav1.ObjectMeta{Name: "leaf-01"},
+		Spec:       wiringapi.SwitchSpec{Role: wiringapi.SwitchRoleServerLeaf},
+	}
+
+	if err := (&asnRanges{strategy: ASNStrategyPerLeaf}).check(sw); err != nil {
+		t.Errorf("expected no error for per-leaf strategy, got %v", err)
+	}
+
+	err := (&asnRanges{strategy: ASNStrategyPerRack}).check(sw)
+	if err == nil || !strings.Contains(err.Error(), "leaf leaf-01 has no "+RackAnnotation+" annotation") {
+		t.Errorf("expected missing rack annotation error for leaf-01, got %v", err)
+	}
+
+	sw.Annotations = map[string]string{RackAnnotation: "rack-1"}
+	if err := (&asnRanges{strategy: ASNStrategyPerRack}).check(sw); err != nil {
+		t.Errorf("expected no error for annotated leaf, got %v", err)
+	}
+}
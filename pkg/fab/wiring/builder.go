@@ -17,6 +17,7 @@ package wiring
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -29,11 +30,16 @@ import (
 )
 
 const (
-	Rack     = "rack-1"
-	Control  = "control-1"
-	External = "virtual-edge-1"
+	Rack    = "rack-1"
+	Control = "control-1"
 
 	VirtualEdgeDest = "external.hhfab.fabric.githedgehog.com/dest" // HHFAB annotation to specify destination for external connection
+
+	// HHFAB annotations on external connection to override values allocated by hydration for the virtual edge
+	VirtualEdgeVLANOverride      = "external.hhfab.fabric.githedgehog.com/vlan"
+	VirtualEdgeSubnet            = "external.hhfab.fabric.githedgehog.com/subnet"
+	VirtualEdgeInboundCommunity  = "external.hhfab.fabric.githedgehog.com/inbound-community"
+	VirtualEdgeOutboundCommunity = "external.hhfab.fabric.githedgehog.com/outbound-community"
 )
 
 type Builder struct {
@@ -42,7 +48,9 @@ type Builder struct {
 	FabricMode        meta.FabricMode // fabric mode
 	ChainControlLink  bool            // true if not all switches attached directly to control node
 	External          bool            // true if virtual external should be applied
+	ExternalsCount    uint8           // number of virtual externals to generate, overrides External if set
 	ControlLinksCount uint8           // number of control links to generate
+	ControlNodesCount uint8           // number of control nodes to generate, 1 or 3, switches are only attached to the first one
 	SpinesCount       uint8           // number of spines to generate
 	FabricLinksCount  uint8           // number of links for each spine <> leaf pair
 	MCLAGLeafsCount   uint8           // number of MCLAG server-leafs to generate
@@ -55,114 +63,58 @@ type Builder struct {
 	ESLAGServers      uint8           // number of ESLAG servers to generate for ESLAG switches
 	UnbundledServers  uint8           // number of unbundled servers to generate for switches (only for one of the first switch in the redundancy group or orphan switch)
 	BundledServers    uint8           // number of bundled servers to generate for switches (only for one of the second switch in the redundancy group or orphan switch)
+	LeafBreakouts     string          // comma separated leaf port ranges with breakout modes, server links use sub-ports, e.g. E1/1-4=4x25G
+	Topology          *Topology       // topology spec to use instead of the counts above
+	TenantsPattern    string          // tenant objects to generate with the wiring, one of TenantsPatterns, none by default
 
 	data         *wiring.Data
+	tenants      *Tenants
 	ifaceTracker map[string]uint8 // next available interface ID for each switch
+	topo         *Topology
+	switchID     uint8                    // switch ID counter
+	leafID       uint8                    // leaf ID counter
+	serverID     uint8                    // server ID counter
+	mclagID      uint8                    // MCLAG group ID counter
+	eslagID      uint8                    // ESLAG group ID counter
+	leafs        []string                 // all leafs in order
+	orphans      []string                 // orphan leafs in order
+	profiles     map[string][]profilePort // ports of all available switch profiles
+	ports        map[string]*switchPorts  // ports allocated on each switch
+	breakouts    map[string]string        // breakout modes by port for all leafs
+	portErr      error                    // first port allocation error
+	groupProfile string                   // switch profile for the leaf group currently being built
+	rack         string                   // rack currently being built, empty if there are no racks
+	chain        bool                     // true if leafs in the current rack are chained to control node
+	controlLinks uint8                    // number of control links in the current rack if chaining
 }
 
 func (b *Builder) Build() (*wiring.Data, error) {
-	if b.FabricMode == meta.FabricModeSpineLeaf {
-		if b.ChainControlLink && b.ControlLinksCount == 0 {
-			b.ControlLinksCount = 2
-		}
-		if b.SpinesCount == 0 {
-			b.SpinesCount = 2
-		}
-		if b.FabricLinksCount == 0 {
-			b.FabricLinksCount = 2
-		}
-		if b.MCLAGLeafsCount == 0 && b.OrphanLeafsCount == 0 && b.ESLAGLeafGroups == "" {
-			b.MCLAGLeafsCount = 2
-			b.ESLAGLeafGroups = "2"
-			b.OrphanLeafsCount = 1
-		}
-	} else if b.FabricMode == meta.FabricModeCollapsedCore {
-		if b.ChainControlLink {
-			return nil, errors.Errorf("control link chaining not supported for collapsed core fabric mode")
-		}
-		if b.External {
-			return nil, errors.Errorf("external not supported for collapsed core fabric mode")
-		}
-		if b.SpinesCount > 0 {
-			return nil, errors.Errorf("spines not supported for collapsed core fabric mode")
-		}
-		if b.FabricLinksCount > 0 {
-			return nil, errors.Errorf("fabric links not supported for collapsed core fabric mode")
-		}
-
-		if b.MCLAGLeafsCount == 0 {
-			b.MCLAGLeafsCount = 2
-		}
-		if b.MCLAGLeafsCount > 2 {
-			return nil, errors.Errorf("MCLAG leafs count must be 2 for collapsed core fabric mode")
-		}
-		if b.OrphanLeafsCount > 0 {
-			return nil, errors.Errorf("orphan leafs not supported for collapsed core fabric mode")
-		}
-
-		if b.ESLAGLeafGroups != "" {
-			return nil, errors.Errorf("ESLAG not supported for collapsed core fabric mode")
+	topo := b.Topology
+	if topo == nil {
+		var err error
+		if topo, err = b.topology(); err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, errors.Errorf("unsupported fabric mode %s", b.FabricMode)
 	}
 
-	if b.MCLAGSessionLinks == 0 {
-		b.MCLAGSessionLinks = 2
-	}
-	if b.MCLAGPeerLinks == 0 {
-		b.MCLAGPeerLinks = 2
-	}
-	if b.VPCLoopbacks == 0 {
-		b.VPCLoopbacks = 2
+	topo.Default()
+	if err := topo.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "error validating topology")
 	}
 
-	totalESLAGLeafs := uint8(0)
-	eslagLeafGroups := []uint8{}
-
-	if b.ESLAGLeafGroups != "" {
-		parts := strings.Split(b.ESLAGLeafGroups, ",")
-		for _, part := range parts {
-			part = strings.TrimSpace(part)
-			leafs, err := strconv.ParseUint(part, 10, 8)
-			if err != nil {
-				return nil, errors.Errorf("invalid ESLAG leaf group %s", part)
-			}
-
-			if leafs < 2 || leafs > 4 {
-				return nil, errors.Errorf("ESLAG leaf group must have 2-4 leafs")
-			}
-
-			totalESLAGLeafs += uint8(leafs)
-			eslagLeafGroups = append(eslagLeafGroups, uint8(leafs))
-		}
-	}
-
-	if b.ChainControlLink && b.ControlLinksCount == 0 {
-		return nil, errors.Errorf("control links count must be greater than 0 if chaining control links")
+	slog.Info("Building wiring diagram", "fabricMode", topo.FabricMode, "chainControlLink", topo.ChainControlLink, "controlLinksCount", topo.ControlLinks)
+	if topo.FabricMode == meta.FabricModeSpineLeaf {
+		slog.Info("                    >>>", "spinesCount", topo.Spines, "fabricLinksCount", topo.FabricLinks)
 	}
-	if b.MCLAGLeafsCount%2 != 0 {
-		return nil, errors.Errorf("MCLAG leafs count must be even")
+	logLeafGroups(topo.LeafGroups)
+	for _, rack := range topo.RackList() {
+		slog.Info("                    >>>", "rack", rack.Name, "pod", rack.Pod, "chainControlLink", rack.ChainControlLink || topo.ChainControlLink, "controlLinksCount", rack.ControlLinks)
+		logLeafGroups(rack.LeafGroups)
 	}
-	if b.MCLAGLeafsCount+b.OrphanLeafsCount+totalESLAGLeafs == 0 {
-		return nil, errors.Errorf("total leafs count must be greater than 0")
+	if len(topo.Racks) > 0 {
+		slog.Info("                    >>>", "spinesPerPod", topo.SpinesPerPod)
 	}
-	if b.MCLAGLeafsCount > 0 && b.MCLAGSessionLinks == 0 {
-		return nil, errors.Errorf("MCLAG session links count must be greater than 0")
-	}
-	if b.MCLAGLeafsCount > 0 && b.MCLAGPeerLinks == 0 {
-		return nil, errors.Errorf("MCLAG peer links count must be greater than 0")
-	}
-
-	slog.Info("Building wiring diagram", "fabricMode", b.FabricMode, "chainControlLink", b.ChainControlLink, "controlLinksCount", b.ControlLinksCount)
-	if b.FabricMode == meta.FabricModeSpineLeaf {
-		slog.Info("                    >>>", "spinesCount", b.SpinesCount, "fabricLinksCount", b.FabricLinksCount)
-		slog.Info("                    >>>", "eslagLeafGroups", b.ESLAGLeafGroups)
-	}
-	slog.Info("                    >>>", "mclagLeafsCount", b.MCLAGLeafsCount, "mclagSessionLinks", b.MCLAGSessionLinks, "mclagPeerLinks", b.MCLAGPeerLinks)
-	slog.Info("                    >>>", "orphanLeafsCount", b.OrphanLeafsCount)
-	slog.Info("                    >>>", "vpcLoopbacks", b.VPCLoopbacks)
-	slog.Info("                    >>>", "mclagServers", b.MCLAGServers, "eslagServers", b.ESLAGServers, "unbundledServers", b.UnbundledServers, "bundledServers", b.BundledServers)
+	slog.Info("                    >>>", "vpcLoopbacks", topo.VPCLoopbacks, "externals", len(topo.Externals))
 
 	var err error
 	b.data, err = wiring.New()
@@ -205,497 +157,680 @@ func (b *Builder) Build() (*wiring.Data, error) {
 	}
 
 	b.ifaceTracker = map[string]uint8{}
-
-	if _, err := b.createServer(Control, wiringapi.ServerSpec{
-		Type:        wiringapi.ServerTypeControl,
-		Description: "Control node",
-	}); err != nil {
+	b.topo = topo
+	b.ports = map[string]*switchPorts{}
+	b.portErr = nil
+	if b.profiles, err = topo.portProfiles(); err != nil {
 		return nil, err
 	}
+	if b.breakouts, err = expandBreakouts(topo.LeafBreakouts); err != nil {
+		return nil, errors.Wrapf(err, "invalid leaf breakouts")
+	}
+	b.switchID = 1
+	b.leafID = 1
+	b.serverID = 1
+	b.mclagID = 1
+	b.eslagID = 1
+	b.leafs = nil
+	b.orphans = nil
+
+	for controlID := uint8(1); controlID <= topo.ControlNodes; controlID++ {
+		if _, err := b.createServer(controlName(controlID), wiringapi.ServerSpec{
+			Type:        wiringapi.ServerTypeControl,
+			Description: "Control node",
+		}); err != nil {
+			return nil, err
+		}
+	}
 
 	if _, err := b.createSwitchGroup("empty"); err != nil {
 		return nil, err
 	}
 
-	switchID := uint8(1) // switch ID counter
+	b.chain, b.controlLinks = topo.ChainControlLink, topo.ControlLinks
+	if err := b.buildLeafGroups(topo.LeafGroups); err != nil {
+		return nil, err
+	}
 
-	leafID := uint8(1)   // leaf ID counter
-	serverID := uint8(1) // server ID counter
+	// pods in order with their leafs, only used for spines per pod
+	pods := []string{}
+	podLeafs := map[string][]string{}
 
-	for mclagID := uint8(1); mclagID <= b.MCLAGLeafsCount/2; mclagID++ {
-		leaf1Name := fmt.Sprintf("leaf-%02d", leafID)
-		leaf2Name := fmt.Sprintf("leaf-%02d", leafID+1)
+	for _, rack := range topo.RackList() {
+		if _, err := b.createSwitchGroup(rack.Name); err != nil {
+			return nil, err
+		}
 
-		sg := fmt.Sprintf("mclag-%d", mclagID)
-		if _, err := b.createSwitchGroup(sg); err != nil {
+		b.rack = rack.Name
+		b.chain, b.controlLinks = rack.ChainControlLink || topo.ChainControlLink, rack.ControlLinks
+		b.leafID, b.serverID, b.mclagID, b.eslagID = 1, 1, 1, 1
+
+		leafs := len(b.leafs)
+		if err := b.buildLeafGroups(rack.LeafGroups); err != nil {
 			return nil, err
 		}
 
-		if _, err := b.createSwitch(leaf1Name, wiringapi.SwitchSpec{
-			Role:        wiringapi.SwitchRoleServerLeaf,
-			Description: fmt.Sprintf("VS-%02d MCLAG %d", switchID, mclagID),
-			Groups:      []string{sg},
-			Redundancy: wiringapi.SwitchRedundancy{
-				Group: sg,
-				Type:  meta.RedundancyTypeMCLAG,
-			},
-		}); err != nil {
+		if _, exist := podLeafs[rack.Pod]; !exist {
+			pods = append(pods, rack.Pod)
+		}
+		podLeafs[rack.Pod] = append(podLeafs[rack.Pod], b.leafs[leafs:]...)
+	}
+	b.rack = ""
+
+	// external switches, for now it's only virtual edges attached to the orphan leafs starting from the last one, each
+	// external should use its own border leaf
+	borderLeafs := map[string]bool{} // false if reserved by the external with explicit leaf, true if already attached
+	for _, ext := range topo.Externals {
+		if ext.Leaf != "" {
+			borderLeafs[ext.Leaf] = false
+		}
+	}
+	for idx, ext := range topo.Externals {
+		leafName := ext.Leaf
+		for orphanID := len(b.orphans) - 1; leafName == "" && orphanID >= 0; orphanID-- {
+			if _, taken := borderLeafs[b.orphans[orphanID]]; !taken {
+				leafName = b.orphans[orphanID]
+			}
+		}
+		if leafName == "" {
+			return nil, errors.Errorf("external switch %d requires free orphan leaf, found only %d orphan leafs", idx+1, len(b.orphans))
+		}
+		if !slices.Contains(b.leafs, leafName) {
+			return nil, errors.Errorf("external switch leaf %s not found", leafName)
+		}
+		if borderLeafs[leafName] {
+			return nil, errors.Errorf("external switch leaf %s already has external attached", leafName)
+		}
+		borderLeafs[leafName] = true
+
+		name := externalName(uint8(idx + 1)) //nolint:gosec
+		sw, err := b.createSwitch(name, wiringapi.SwitchSpec{
+			Role:        wiringapi.SwitchRoleVirtualEdge,
+			Description: "Virtual edge",
+		})
+		if err != nil {
 			return nil, err
 		}
-		if _, err := b.createSwitch(leaf2Name, wiringapi.SwitchSpec{
-			Role:        wiringapi.SwitchRoleServerLeaf,
-			Description: fmt.Sprintf("VS-%02d MCLAG %d", switchID+1, mclagID),
-			Groups:      []string{sg},
-			Redundancy: wiringapi.SwitchRedundancy{
-				Group: sg,
-				Type:  meta.RedundancyTypeMCLAG,
-			},
-		}); err != nil {
+		if ext.ASN != 0 {
+			sw.Annotations = map[string]string{ASNOverride: fmt.Sprintf("%d", ext.ASN)}
+		}
+		if _, err := b.createControlConnection(name); err != nil {
 			return nil, err
 		}
+		if _, err := b.createExternalConnection(leafName, name, ext); err != nil {
+			return nil, err
+		}
+	}
 
-		if !b.ChainControlLink {
-			if _, err := b.createManagementConnection(leaf1Name); err != nil {
-				return nil, err
-			}
-			if _, err := b.createManagementConnection(leaf2Name); err != nil {
-				return nil, err
-			}
-		} else if leafID < b.ControlLinksCount {
-			if _, err := b.createControlConnection(leaf1Name); err != nil {
-				return nil, err
-			}
-			if _, err := b.createControlConnection(leaf2Name); err != nil {
-				return nil, err
+	type spineLeafs struct {
+		name  string
+		leafs []string
+	}
+	spines := []spineLeafs{}
+	if topo.SpinesPerPod {
+		for _, pod := range pods {
+			for spineID := uint8(1); spineID <= topo.Spines; spineID++ {
+				spines = append(spines, spineLeafs{b.name(pod, "spine", spineID), podLeafs[pod]})
 			}
 		}
-
-		switchID += 2
-		leafID += 2
-
-		sessionLinks := []wiringapi.SwitchToSwitchLink{}
-		for i := uint8(0); i < b.MCLAGSessionLinks; i++ {
-			sessionLinks = append(sessionLinks, wiringapi.SwitchToSwitchLink{
-				Switch1: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf1Name)},
-				Switch2: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name)},
-			})
+	} else {
+		for spineID := uint8(1); spineID <= topo.Spines; spineID++ {
+			spines = append(spines, spineLeafs{b.name("", "spine", spineID), b.leafs})
 		}
+	}
 
-		peerLinks := []wiringapi.SwitchToSwitchLink{}
-		for i := uint8(0); i < b.MCLAGPeerLinks; i++ {
-			peerLinks = append(peerLinks, wiringapi.SwitchToSwitchLink{
-				Switch1: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf1Name)},
-				Switch2: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name)},
-			})
-		}
+	for _, spine := range spines {
+		spineName := spine.name
 
-		if _, err := b.createConnection(wiringapi.ConnectionSpec{
-			MCLAGDomain: &wiringapi.ConnMCLAGDomain{
-				SessionLinks: sessionLinks,
-				PeerLinks:    peerLinks,
-			},
+		if _, err := b.createSwitch(spineName, wiringapi.SwitchSpec{
+			Role:        wiringapi.SwitchRoleSpine,
+			Description: fmt.Sprintf("VS-%02d", b.switchID),
 		}); err != nil {
 			return nil, err
 		}
 
-		for i := 0; i < int(b.MCLAGServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
-
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d MCLAG %s %s", serverID, leaf1Name, leaf2Name),
-			}); err != nil {
-				return nil, err
-			}
-
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				MCLAG: &wiringapi.ConnMCLAG{
-					Links: []wiringapi.ServerToSwitchLink{
-						{
-							Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-							Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf1Name)},
-						},
-						{
-							Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-							Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name)},
-						},
-					},
-				},
-			}); err != nil {
+		if !topo.ChainControlLink {
+			if _, err := b.createManagementConnection(spineName); err != nil {
 				return nil, err
 			}
-
-			serverID++
 		}
 
-		for i := 0; i < int(b.UnbundledServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
+		b.switchID++
 
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d Unbundled %s", serverID, leaf1Name),
-			}); err != nil {
-				return nil, err
+		for _, leafName := range spine.leafs {
+			links := []wiringapi.FabricLink{}
+			for spinePortID := uint8(0); spinePortID < topo.FabricLinks; spinePortID++ {
+				spinePort := b.nextSwitchPort(spineName, PortRoleUplink)
+				leafPort := b.nextSwitchPort(leafName, PortRoleUplink)
+
+				links = append(links, wiringapi.FabricLink{
+					Spine: wiringapi.ConnFabricLinkSwitch{BasePortName: wiringapi.BasePortName{Port: spinePort}},
+					Leaf:  wiringapi.ConnFabricLinkSwitch{BasePortName: wiringapi.BasePortName{Port: leafPort}},
+				})
 			}
 
 			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				Unbundled: &wiringapi.ConnUnbundled{
-					Link: wiringapi.ServerToSwitchLink{
-						Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-						Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf1Name)},
-					},
+				Fabric: &wiringapi.ConnFabric{
+					Links: links,
 				},
 			}); err != nil {
 				return nil, err
 			}
-
-			serverID++
 		}
+	}
 
-		for i := 0; i < int(b.BundledServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
+	if topo.VPCLoopbacks > 0 {
+		for _, sw := range b.data.Switch.All() {
+			if !sw.Spec.Role.IsLeaf() {
+				continue
+			}
 
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d Bundled %s", serverID, leaf2Name),
-			}); err != nil {
-				return nil, err
+			loops := []wiringapi.SwitchToSwitchLink{}
+			for i := uint8(0); i < topo.VPCLoopbacks; i++ {
+				loops = append(loops, wiringapi.SwitchToSwitchLink{
+					Switch1: wiringapi.BasePortName{Port: b.nextLoopbackPort(sw.Name)},
+					Switch2: wiringapi.BasePortName{Port: b.nextLoopbackPort(sw.Name)},
+				})
 			}
 
 			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				Bundled: &wiringapi.ConnBundled{
-					Links: []wiringapi.ServerToSwitchLink{
-						{
-							Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-							Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name)},
-						},
-						{
-							Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-							Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name)},
-						},
-					},
+				VPCLoopback: &wiringapi.ConnVPCLoopback{
+					Links: loops,
 				},
 			}); err != nil {
 				return nil, err
 			}
+		}
+	}
 
-			serverID++
+	if b.portErr != nil {
+		return nil, b.portErr
+	}
+
+	for name := range topo.SwitchProfiles {
+		if _, exist := b.ports[name]; !exist {
+			return nil, errors.Errorf("switch profile override for unknown switch %s", name)
 		}
 	}
 
-	for eslagID := uint8(0); eslagID < uint8(len(eslagLeafGroups)); eslagID++ {
-		sg := fmt.Sprintf("eslag-%d", eslagID+1)
-		if _, err := b.createSwitchGroup(sg); err != nil {
+	if b.Hydrated {
+		if _, err := Hydrate(b.data, DefaultHydrateConfig()); err != nil {
 			return nil, err
 		}
+	}
 
-		leafs := eslagLeafGroups[eslagID]
-		leafNames := []string{}
-		for eslagLeafID := uint8(0); eslagLeafID < leafs; eslagLeafID++ {
-			leafName := fmt.Sprintf("leaf-%02d", leafID+eslagLeafID)
-			leafNames = append(leafNames, leafName)
+	pattern := b.TenantsPattern
+	if pattern == "" {
+		pattern = TenantsNone
+	}
+	if b.tenants, err = BuildTenants(b.data, pattern); err != nil {
+		return nil, errors.Wrapf(err, "error building tenants")
+	}
 
-			if _, err := b.createSwitch(leafName, wiringapi.SwitchSpec{
-				Role:        wiringapi.SwitchRoleServerLeaf,
-				Description: fmt.Sprintf("VS-%02d ESLAG %d", switchID+eslagLeafID, eslagID+1),
-				Groups:      []string{sg},
-				Redundancy: wiringapi.SwitchRedundancy{
-					Group: sg,
-					Type:  meta.RedundancyTypeESLAG,
-				},
-			}); err != nil {
-				return nil, err
-			}
+	return b.data, nil
+}
 
-			if !b.ChainControlLink {
-				if _, err := b.createManagementConnection(leafName); err != nil {
-					return nil, err
-				}
-			} else if leafID < b.ControlLinksCount {
-				if _, err := b.createControlConnection(leafName); err != nil {
-					return nil, err
-				}
-			}
-		}
+// Tenants returns tenant objects generated by the last build, empty if no tenants pattern is set
+func (b *Builder) Tenants() *Tenants {
+	if b.tenants == nil {
+		return &Tenants{}
+	}
 
-		switchID += leafs
-		leafID += leafs
+	return b.tenants
+}
 
-		for i := 0; i < int(b.ESLAGServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
+// topology converts the counts to the topology with the same defaults and layout as before the topology spec
+func (b *Builder) topology() (*Topology, error) {
+	topo := &Topology{
+		FabricMode:       b.FabricMode,
+		Spines:           b.SpinesCount,
+		FabricLinks:      b.FabricLinksCount,
+		ChainControlLink: b.ChainControlLink,
+		ControlLinks:     b.ControlLinksCount,
+		ControlNodes:     b.ControlNodesCount,
+		VPCLoopbacks:     b.VPCLoopbacks,
+	}
+	breakouts, err := parseBreakouts(b.LeafBreakouts)
+	if err != nil {
+		return nil, err
+	}
+	if len(breakouts) > 0 {
+		topo.LeafBreakouts = breakouts
+	}
 
-			leafNamesStr := strings.Join(leafNames, " ")
+	externals := b.ExternalsCount
+	if externals == 0 && b.External {
+		externals = 1
+	}
+	for range externals {
+		topo.Externals = append(topo.Externals, TopologyExternal{})
+	}
 
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d ESLAG %s", serverID, leafNamesStr),
-			}); err != nil {
-				return nil, err
-			}
+	mclagLeafs, orphanLeafs, eslagGroups := b.MCLAGLeafsCount, b.OrphanLeafsCount, b.ESLAGLeafGroups
+	if b.FabricMode == meta.FabricModeSpineLeaf {
+		if mclagLeafs == 0 && orphanLeafs == 0 && eslagGroups == "" {
+			mclagLeafs = 2
+			eslagGroups = "2"
+			orphanLeafs = 1
+		}
+	} else if b.FabricMode == meta.FabricModeCollapsedCore {
+		if mclagLeafs == 0 {
+			mclagLeafs = 2
+		}
+		if mclagLeafs > 2 {
+			return nil, errors.Errorf("MCLAG leafs count must be 2 for collapsed core fabric mode")
+		}
+		if orphanLeafs > 0 {
+			return nil, errors.Errorf("orphan leafs not supported for collapsed core fabric mode")
+		}
+		if eslagGroups != "" {
+			return nil, errors.Errorf("ESLAG not supported for collapsed core fabric mode")
+		}
+	}
 
-			links := []wiringapi.ServerToSwitchLink{}
-			for _, leafName := range leafNames {
-				links = append(links, wiringapi.ServerToSwitchLink{
-					Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-					Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafName)},
-				})
-			}
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				ESLAG: &wiringapi.ConnESLAG{
-					Links: links,
-				},
-			}); err != nil {
-				return nil, err
-			}
+	if mclagLeafs%2 != 0 {
+		return nil, errors.Errorf("MCLAG leafs count must be even")
+	}
 
-			serverID++
-		}
+	servers := TopologyServers{
+		Unbundled: b.UnbundledServers,
+		Bundled:   b.BundledServers,
+	}
 
-		for i := 0; i < int(b.UnbundledServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
+	if mclagLeafs > 0 {
+		mclagServers := servers
+		mclagServers.MCLAG = b.MCLAGServers
+		topo.LeafGroups = append(topo.LeafGroups, TopologyLeafGroup{
+			Redundancy:   meta.RedundancyTypeMCLAG,
+			Leafs:        2,
+			Count:        mclagLeafs / 2,
+			SessionLinks: b.MCLAGSessionLinks,
+			PeerLinks:    b.MCLAGPeerLinks,
+			Servers:      mclagServers,
+		})
+	}
 
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d Unbundled %s", serverID, leafNames[0]),
-			}); err != nil {
-				return nil, err
+	if eslagGroups != "" {
+		eslagServers := servers
+		eslagServers.ESLAG = b.ESLAGServers
+		for _, part := range strings.Split(eslagGroups, ",") {
+			part = strings.TrimSpace(part)
+			leafs, err := strconv.ParseUint(part, 10, 8)
+			if err != nil {
+				return nil, errors.Errorf("invalid ESLAG leaf group %s", part)
 			}
 
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				Unbundled: &wiringapi.ConnUnbundled{
-					Link: wiringapi.ServerToSwitchLink{
-						Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-						Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafNames[0])},
-					},
-				},
-			}); err != nil {
-				return nil, err
+			if leafs < 2 || leafs > 4 {
+				return nil, errors.Errorf("ESLAG leaf group must have 2-4 leafs")
 			}
 
-			serverID++
+			topo.LeafGroups = append(topo.LeafGroups, TopologyLeafGroup{
+				Redundancy: meta.RedundancyTypeESLAG,
+				Leafs:      uint8(leafs),
+				Servers:    eslagServers,
+			})
 		}
+	}
 
-		if leafs > 1 {
-			for i := 0; i < int(b.BundledServers); i++ {
-				serverName := fmt.Sprintf("server-%02d", serverID)
+	if orphanLeafs > 0 {
+		topo.LeafGroups = append(topo.LeafGroups, TopologyLeafGroup{
+			Leafs:   1,
+			Count:   orphanLeafs,
+			Servers: servers,
+		})
+	}
 
-				if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-					Description: fmt.Sprintf("S-%02d Bundled %s", serverID, leafNames[1]),
-				}); err != nil {
-					return nil, err
-				}
+	if len(topo.LeafGroups) == 0 {
+		return nil, errors.Errorf("total leafs count must be greater than 0")
+	}
 
-				if _, err := b.createConnection(wiringapi.ConnectionSpec{
-					Bundled: &wiringapi.ConnBundled{
-						Links: []wiringapi.ServerToSwitchLink{
-							{
-								Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-								Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafNames[1])},
-							},
-							{
-								Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-								Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafNames[1])},
-							},
-						},
-					},
-				}); err != nil {
-					return nil, err
-				}
+	return topo, nil
+}
+
+func logLeafGroups(groups []TopologyLeafGroup) {
+	for _, group := range groups {
+		redundancy := string(group.Redundancy)
+		if redundancy == "" {
+			redundancy = "orphan"
+		}
+		slog.Info("                    >>>", "leafGroup", redundancy, "leafs", group.Leafs, "count", group.Count,
+			"mclagServers", group.Servers.MCLAG, "eslagServers", group.Servers.ESLAG, "unbundledServers", group.Servers.Unbundled, "bundledServers", group.Servers.Bundled)
+	}
+}
 
-				serverID++
+func (b *Builder) buildLeafGroups(groups []TopologyLeafGroup) error {
+	defer func() { b.groupProfile = "" }()
+
+	for _, group := range groups {
+		b.groupProfile = group.Profile
+		for i := uint8(0); i < group.Count; i++ {
+			var err error
+			switch group.Redundancy {
+			case meta.RedundancyTypeMCLAG:
+				err = b.buildMCLAGGroup(group)
+			case meta.RedundancyTypeESLAG:
+				err = b.buildESLAGGroup(group)
+			case meta.RedundancyTypeNone:
+				for j := uint8(0); j < group.Leafs && err == nil; j++ {
+					err = b.buildOrphanLeaf(group)
+				}
+			}
+			if err != nil {
+				return err
 			}
 		}
 	}
 
-	for idx := uint8(1); idx <= b.OrphanLeafsCount; idx++ {
-		leafName := fmt.Sprintf("leaf-%02d", leafID)
+	return nil
+}
+
+// name returns name for the spine, leaf, server or switch group. Without racks historical names are kept with spines,
+// leafs and servers zero-padded, e.g. spine-01, leaf-01, server-01 and mclag-1. With racks nothing is padded and names
+// are prefixed with the rack or the pod for per pod spines, e.g. spine-1, pod-1-spine-1, rack-2-leaf-1, rack-2-mclag-1.
+func (b *Builder) name(prefix, kind string, id uint8) string {
+	if prefix != "" {
+		return fmt.Sprintf("%s-%s-%d", prefix, kind, id)
+	}
+	if len(b.topo.Racks) == 0 && (kind == "spine" || kind == "leaf" || kind == "server") {
+		return fmt.Sprintf("%s-%02d", kind, id)
+	}
 
+	return fmt.Sprintf("%s-%d", kind, id)
+}
+
+// controlLink attaches leaf to the control node directly or using chained control link if it's one of the first ones
+func (b *Builder) controlLink(leafName string, leafID uint8) error {
+	if !b.chain {
+		_, err := b.createManagementConnection(leafName)
+
+		return err
+	}
+	if leafID < b.controlLinks {
+		_, err := b.createControlConnection(leafName)
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *Builder) buildMCLAGGroup(group TopologyLeafGroup) error {
+	mclagID := b.mclagID
+	leaf1Name := b.name(b.rack, "leaf", b.leafID)
+	leaf2Name := b.name(b.rack, "leaf", b.leafID+1)
+
+	sg := b.name(b.rack, "mclag", mclagID)
+	if _, err := b.createSwitchGroup(sg); err != nil {
+		return err
+	}
+
+	for idx, leafName := range []string{leaf1Name, leaf2Name} {
 		if _, err := b.createSwitch(leafName, wiringapi.SwitchSpec{
 			Role:        wiringapi.SwitchRoleServerLeaf,
-			Description: fmt.Sprintf("VS-%02d", switchID),
+			Description: fmt.Sprintf("VS-%02d MCLAG %d", b.switchID+uint8(idx), mclagID),
+			Groups:      []string{sg},
+			Redundancy: wiringapi.SwitchRedundancy{
+				Group: sg,
+				Type:  meta.RedundancyTypeMCLAG,
+			},
 		}); err != nil {
-			return nil, err
+			return err
 		}
+	}
 
-		if !b.ChainControlLink {
-			if _, err := b.createManagementConnection(leafName); err != nil {
-				return nil, err
-			}
-		} else if leafID < b.ControlLinksCount {
-			if _, err := b.createControlConnection(leafName); err != nil {
-				return nil, err
-			}
+	for _, leafName := range []string{leaf1Name, leaf2Name} {
+		if err := b.controlLink(leafName, b.leafID); err != nil {
+			return err
 		}
+	}
 
-		switchID++
-		leafID++
+	b.leafs = append(b.leafs, leaf1Name, leaf2Name)
+	b.switchID += 2
+	b.leafID += 2
+	b.mclagID++
+
+	sessionLinks := []wiringapi.SwitchToSwitchLink{}
+	for i := uint8(0); i < group.SessionLinks; i++ {
+		sessionLinks = append(sessionLinks, wiringapi.SwitchToSwitchLink{
+			Switch1: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf1Name, PortRoleUplink)},
+			Switch2: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name, PortRoleUplink)},
+		})
+	}
 
-		for i := 0; i < int(b.UnbundledServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
+	peerLinks := []wiringapi.SwitchToSwitchLink{}
+	for i := uint8(0); i < group.PeerLinks; i++ {
+		peerLinks = append(peerLinks, wiringapi.SwitchToSwitchLink{
+			Switch1: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf1Name, PortRoleUplink)},
+			Switch2: wiringapi.BasePortName{Port: b.nextSwitchPort(leaf2Name, PortRoleUplink)},
+		})
+	}
 
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d Unbundled %s", serverID, leafName),
-			}); err != nil {
-				return nil, err
-			}
+	if _, err := b.createConnection(wiringapi.ConnectionSpec{
+		MCLAGDomain: &wiringapi.ConnMCLAGDomain{
+			SessionLinks: sessionLinks,
+			PeerLinks:    peerLinks,
+		},
+	}); err != nil {
+		return err
+	}
 
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				Unbundled: &wiringapi.ConnUnbundled{
-					Link: wiringapi.ServerToSwitchLink{
-						Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-						Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafName)},
-					},
-				},
-			}); err != nil {
-				return nil, err
-			}
+	for i := uint8(0); i < group.Servers.MCLAG; i++ {
+		serverName, err := b.nextServer(fmt.Sprintf("MCLAG %s %s", leaf1Name, leaf2Name))
+		if err != nil {
+			return err
+		}
 
-			serverID++
+		if _, err := b.createConnection(wiringapi.ConnectionSpec{
+			MCLAG: &wiringapi.ConnMCLAG{
+				Links: b.serverLinks(serverName, []string{leaf1Name, leaf2Name}, group.Servers.MCLAGLinks),
+			},
+		}); err != nil {
+			return err
 		}
+	}
 
-		for i := 0; i < int(b.BundledServers); i++ {
-			serverName := fmt.Sprintf("server-%02d", serverID)
+	return b.buildServers(group, leaf1Name, leaf2Name)
+}
 
-			if _, err := b.createServer(serverName, wiringapi.ServerSpec{
-				Description: fmt.Sprintf("S-%02d Bundled %s", serverID, leafName),
-			}); err != nil {
-				return nil, err
-			}
+func (b *Builder) buildESLAGGroup(group TopologyLeafGroup) error {
+	eslagID := b.eslagID
+	sg := b.name(b.rack, "eslag", eslagID)
+	if _, err := b.createSwitchGroup(sg); err != nil {
+		return err
+	}
 
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				Bundled: &wiringapi.ConnBundled{
-					Links: []wiringapi.ServerToSwitchLink{
-						{
-							Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-							Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafName)},
-						},
-						{
-							Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
-							Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafName)},
-						},
-					},
-				},
-			}); err != nil {
-				return nil, err
-			}
+	leafNames := []string{}
+	for eslagLeafID := uint8(0); eslagLeafID < group.Leafs; eslagLeafID++ {
+		leafName := b.name(b.rack, "leaf", b.leafID+eslagLeafID)
+		leafNames = append(leafNames, leafName)
 
-			serverID++
+		if _, err := b.createSwitch(leafName, wiringapi.SwitchSpec{
+			Role:        wiringapi.SwitchRoleServerLeaf,
+			Description: fmt.Sprintf("VS-%02d ESLAG %d", b.switchID+eslagLeafID, eslagID),
+			Groups:      []string{sg},
+			Redundancy: wiringapi.SwitchRedundancy{
+				Group: sg,
+				Type:  meta.RedundancyTypeESLAG,
+			},
+		}); err != nil {
+			return err
+		}
+
+		if err := b.controlLink(leafName, b.leafID); err != nil {
+			return err
 		}
 	}
 
-	// external switch. For now it's only orphan leafs
-	if b.External {
-		if b.OrphanLeafsCount < 1 {
-			return nil, errors.Errorf("external switch requires at least one orphan leaf")
+	b.leafs = append(b.leafs, leafNames...)
+	b.switchID += group.Leafs
+	b.leafID += group.Leafs
+	b.eslagID++
+
+	for i := uint8(0); i < group.Servers.ESLAG; i++ {
+		serverName, err := b.nextServer("ESLAG " + strings.Join(leafNames, " "))
+		if err != nil {
+			return err
 		}
-		if _, err := b.createSwitch(External, wiringapi.SwitchSpec{
-			Role:        wiringapi.SwitchRoleVirtualEdge,
-			Description: "Virtual edge",
+
+		if _, err := b.createConnection(wiringapi.ConnectionSpec{
+			ESLAG: &wiringapi.ConnESLAG{
+				Links: b.serverLinks(serverName, leafNames, group.Servers.ESLAGLinks),
+			},
 		}); err != nil {
-			return nil, err
-		}
-		if _, err := b.createControlConnection(External); err != nil {
-			return nil, err
+			return err
 		}
-		// (LeafID - 1) is now pointing on the last Orphan Leaf. We will use it to connect external switch to the last orphan leaf
-		if _, err := b.createExternalConnection(fmt.Sprintf("leaf-%02d", leafID-1)); err != nil {
-			return nil, err
-		}
-		leafID++ //nolint:ineffassign
 	}
 
-	for spineID := uint8(1); spineID <= b.SpinesCount; spineID++ {
-		spineName := fmt.Sprintf("spine-%02d", spineID)
+	return b.buildServers(group, leafNames[0], leafNames[1])
+}
 
-		if _, err := b.createSwitch(spineName, wiringapi.SwitchSpec{
-			Role:        wiringapi.SwitchRoleSpine,
-			Description: fmt.Sprintf("VS-%02d", switchID),
-		}); err != nil {
-			return nil, err
-		}
+func (b *Builder) buildOrphanLeaf(group TopologyLeafGroup) error {
+	leafName := b.name(b.rack, "leaf", b.leafID)
 
-		if !b.ChainControlLink {
-			if _, err := b.createManagementConnection(spineName); err != nil {
-				return nil, err
-			}
-		}
+	if _, err := b.createSwitch(leafName, wiringapi.SwitchSpec{
+		Role:        wiringapi.SwitchRoleServerLeaf,
+		Description: fmt.Sprintf("VS-%02d", b.switchID),
+	}); err != nil {
+		return err
+	}
 
-		switchID++
+	if err := b.controlLink(leafName, b.leafID); err != nil {
+		return err
+	}
 
-		for leafID := uint8(1); leafID <= b.MCLAGLeafsCount+b.OrphanLeafsCount+totalESLAGLeafs; leafID++ {
-			leafName := fmt.Sprintf("leaf-%02d", leafID)
+	b.leafs = append(b.leafs, leafName)
+	b.orphans = append(b.orphans, leafName)
+	b.switchID++
+	b.leafID++
 
-			links := []wiringapi.FabricLink{}
-			for spinePortID := uint8(0); spinePortID < b.FabricLinksCount; spinePortID++ {
-				spinePort := b.nextSwitchPort(spineName)
-				leafPort := b.nextSwitchPort(leafName)
+	return b.buildServers(group, leafName, leafName)
+}
 
-				links = append(links, wiringapi.FabricLink{
-					Spine: wiringapi.ConnFabricLinkSwitch{BasePortName: wiringapi.BasePortName{Port: spinePort}},
-					Leaf:  wiringapi.ConnFabricLinkSwitch{BasePortName: wiringapi.BasePortName{Port: leafPort}},
-				})
-			}
+// buildServers creates unbundled servers attached to the first leaf and bundled ones attached to the second leaf
+func (b *Builder) buildServers(group TopologyLeafGroup, first, second string) error {
+	for i := uint8(0); i < group.Servers.Unbundled; i++ {
+		serverName, err := b.nextServer("Unbundled " + first)
+		if err != nil {
+			return err
+		}
 
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				Fabric: &wiringapi.ConnFabric{
-					Links: links,
+		if _, err := b.createConnection(wiringapi.ConnectionSpec{
+			Unbundled: &wiringapi.ConnUnbundled{
+				Link: wiringapi.ServerToSwitchLink{
+					Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
+					Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(first, PortRoleServer)},
 				},
-			}); err != nil {
-				return nil, err
-			}
+			},
+		}); err != nil {
+			return err
 		}
 	}
 
-	if b.VPCLoopbacks > 0 {
-		for _, sw := range b.data.Switch.All() {
-			if !sw.Spec.Role.IsLeaf() {
-				continue
-			}
-
-			loops := []wiringapi.SwitchToSwitchLink{}
-			for i := uint8(0); i < b.VPCLoopbacks; i++ {
-				loops = append(loops, wiringapi.SwitchToSwitchLink{
-					Switch1: wiringapi.BasePortName{Port: b.nextSwitchPort(sw.Name)},
-					Switch2: wiringapi.BasePortName{Port: b.nextSwitchPort(sw.Name)},
-				})
-			}
+	for i := uint8(0); i < group.Servers.Bundled; i++ {
+		serverName, err := b.nextServer("Bundled " + second)
+		if err != nil {
+			return err
+		}
 
-			if _, err := b.createConnection(wiringapi.ConnectionSpec{
-				VPCLoopback: &wiringapi.ConnVPCLoopback{
-					Links: loops,
-				},
-			}); err != nil {
-				return nil, err
-			}
+		if _, err := b.createConnection(wiringapi.ConnectionSpec{
+			Bundled: &wiringapi.ConnBundled{
+				Links: b.serverLinks(serverName, []string{second}, group.Servers.BundledLinks),
+			},
+		}); err != nil {
+			return err
 		}
 	}
 
-	if b.Hydrated {
-		// TODO extract to a single place
-		if err := Hydrate(b.data, &HydrateConfig{
-			Subnet:       "172.30.0.0/16",
-			SpineASN:     65100,
-			LeafASNStart: 65101,
-		}); err != nil {
-			return nil, err
+	return nil
+}
+
+// nextServer creates server with the next available name and description
+func (b *Builder) nextServer(description string) (string, error) {
+	serverName := b.name(b.rack, "server", b.serverID)
+
+	if _, err := b.createServer(serverName, wiringapi.ServerSpec{
+		Description: fmt.Sprintf("S-%02d %s", b.serverID, description),
+	}); err != nil {
+		return "", err
+	}
+
+	b.serverID++
+
+	return serverName, nil
+}
+
+// serverLinks returns links from the server to each of the leafs, count links per leaf
+func (b *Builder) serverLinks(serverName string, leafNames []string, count uint8) []wiringapi.ServerToSwitchLink {
+	links := []wiringapi.ServerToSwitchLink{}
+	for _, leafName := range leafNames {
+		for i := uint8(0); i < count; i++ {
+			links = append(links, wiringapi.ServerToSwitchLink{
+				Server: wiringapi.BasePortName{Port: b.nextServerPort(serverName)},
+				Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(leafName, PortRoleServer)},
+			})
 		}
 	}
 
-	return b.data, nil
+	return links
 }
 
-func (b *Builder) nextSwitchPort(switchName string) string {
-	ifaceID := b.ifaceTracker[switchName]
-	portName := fmt.Sprintf("%s/E1/%d", switchName, ifaceID+1)
+// nextSwitchPort allocates next free port for the role on the switch according to its profile, error is reported
+// at the end of the build
+func (b *Builder) nextSwitchPort(switchName string, role string) string {
+	return b.allocSwitchPort(switchName, role, role == PortRoleServer)
+}
+
+// nextLoopbackPort allocates next free server port on the switch for the VPC loopback, loopbacks are wired on the
+// whole front panel ports, so breakout sub-ports are skipped
+func (b *Builder) nextLoopbackPort(switchName string) string {
+	return b.allocSwitchPort(switchName, PortRoleServer, false)
+}
 
-	offset := 1
-	if ifaceID >= 48 {
-		offset = 4
+func (b *Builder) allocSwitchPort(switchName string, role string, subPorts bool) string {
+	ports, exist := b.ports[switchName]
+	if !exist {
+		if b.portErr == nil {
+			b.portErr = errors.Errorf("switch %s not found", switchName)
+		}
+
+		return ""
 	}
-	ifaceID += uint8(offset)
 
-	if ifaceID > 76 {
-		slog.Error("Too many interfaces for switch", "switch", switchName)
+	port, err := ports.alloc(role, subPorts)
+	if err != nil {
+		if b.portErr == nil {
+			b.portErr = errors.Wrapf(err, "switch %s", switchName)
+		}
+
+		return ""
 	}
 
-	b.ifaceTracker[switchName] = ifaceID
+	if port.speed != "" {
+		sw := b.data.Switch.Get(switchName)
+		if sw.Spec.PortSpeeds == nil {
+			sw.Spec.PortSpeeds = map[string]string{}
+		}
+		sw.Spec.PortSpeeds[port.name] = port.speed
+	}
+	if port.breakout != "" {
+		sw := b.data.Switch.Get(switchName)
+		if sw.Spec.PortBreakouts == nil {
+			sw.Spec.PortBreakouts = map[string]string{}
+		}
+		sw.Spec.PortBreakouts[port.parent] = port.breakout
+	}
 
-	return portName
+	return fmt.Sprintf("%s/%s", switchName, port.name)
+}
+
+// controlName returns the name of the control node by its position, the first one is always Control
+func controlName(controlID uint8) string {
+	return fmt.Sprintf("control-%d", controlID)
+}
+
+// externalName returns the name of the virtual edge by its position
+func externalName(externalID uint8) string {
+	return fmt.Sprintf("virtual-edge-%d", externalID)
 }
 
 func (b *Builder) nextControlPort(serverName string) string {
@@ -734,6 +869,32 @@ func (b *Builder) createSwitchGroup(name string) (*wiringapi.SwitchGroup, error)
 
 func (b *Builder) createSwitch(name string, spec wiringapi.SwitchSpec) (*wiringapi.Switch, error) { //nolint:unparam
 	spec.Profile = meta.SwitchProfileVS
+	if profile, exist := b.topo.SwitchProfiles[name]; exist {
+		spec.Profile = profile
+	} else if spec.Role == wiringapi.SwitchRoleSpine {
+		spec.Profile = b.topo.SpineProfile
+	} else if spec.Role.IsLeaf() {
+		spec.Profile = b.topo.LeafProfile
+		if b.groupProfile != "" {
+			spec.Profile = b.groupProfile
+		}
+	}
+	ports := b.profiles[spec.Profile]
+	if spec.Role.IsLeaf() && len(b.breakouts) > 0 {
+		var err error
+		if ports, err = applyBreakouts(ports, b.breakouts); err != nil {
+			return nil, errors.Wrapf(err, "switch %s", name)
+		}
+	}
+	b.ports[name] = &switchPorts{
+		profile: spec.Profile,
+		ports:   ports,
+		used:    make([]bool, len(ports)),
+	}
+
+	if b.rack != "" {
+		spec.Groups = append(spec.Groups, b.rack)
+	}
 
 	sw := &wiringapi.Switch{
 		TypeMeta: metav1.TypeMeta{
@@ -741,7 +902,8 @@ func (b *Builder) createSwitch(name string, spec wiringapi.SwitchSpec) (*wiringa
 			APIVersion: wiringapi.GroupVersion.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:        name,
+			Annotations: b.rackAnnotations(),
 		},
 		Spec: spec,
 	}
@@ -760,7 +922,8 @@ func (b *Builder) createServer(name string, spec wiringapi.ServerSpec) (*wiringa
 			APIVersion: wiringapi.GroupVersion.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:        name,
+			Annotations: b.rackAnnotations(),
 		},
 		Spec: spec,
 	}
@@ -772,7 +935,20 @@ func (b *Builder) createServer(name string, spec wiringapi.ServerSpec) (*wiringa
 	return server, errors.Wrapf(b.data.Add(server), "error creating server %s", name)
 }
 
+// rackAnnotations returns annotations for the objects in the rack currently being built, nil if there are no racks
+func (b *Builder) rackAnnotations() map[string]string {
+	if b.rack == "" {
+		return nil
+	}
+
+	return map[string]string{RackAnnotation: b.rack}
+}
+
 func (b *Builder) createConnection(spec wiringapi.ConnectionSpec) (*wiringapi.Connection, error) {
+	if b.portErr != nil {
+		return nil, b.portErr
+	}
+
 	name := spec.GenerateName()
 
 	conn := &wiringapi.Connection{
@@ -799,7 +975,7 @@ func (b *Builder) createManagementConnection(switchName string) (*wiringapi.Conn
 		Management: &wiringapi.ConnMgmt{
 			Link: wiringapi.ConnMgmtLink{
 				Server: wiringapi.ConnMgmtLinkServer{
-					BasePortName: wiringapi.BasePortName{Port: b.nextControlPort(Control)},
+					BasePortName: wiringapi.BasePortName{Port: b.nextControlPort(controlName(1))},
 				},
 				Switch: wiringapi.ConnMgmtLinkSwitch{
 					BasePortName: wiringapi.BasePortName{Port: fmt.Sprintf("%s/M1", switchName)},
@@ -811,14 +987,17 @@ func (b *Builder) createManagementConnection(switchName string) (*wiringapi.Conn
 }
 
 func (b *Builder) createControlConnection(switchName string) (*wiringapi.Connection, error) {
-	port := b.nextSwitchPort(switchName)
-	oniePortName := fmt.Sprintf("eth%d", b.ifaceTracker[switchName])
+	port := b.nextSwitchPort(switchName, PortRoleUplink)
+	oniePortName, err := oniePortName(strings.TrimPrefix(port, switchName+"/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "switch %s", switchName)
+	}
 
 	return b.createConnection(wiringapi.ConnectionSpec{
 		Management: &wiringapi.ConnMgmt{
 			Link: wiringapi.ConnMgmtLink{
 				Server: wiringapi.ConnMgmtLinkServer{
-					BasePortName: wiringapi.BasePortName{Port: b.nextControlPort(Control)},
+					BasePortName: wiringapi.BasePortName{Port: b.nextControlPort(controlName(1))},
 				},
 				Switch: wiringapi.ConnMgmtLinkSwitch{
 					BasePortName: wiringapi.BasePortName{Port: port},
@@ -829,17 +1008,50 @@ func (b *Builder) createControlConnection(switchName string) (*wiringapi.Connect
 	})
 }
 
-func (b *Builder) createExternalConnection(switchName string) (*wiringapi.Connection, error) {
+// oniePortName returns the ONIE interface for the front panel port, E1/N is ethN, sub-ports of the breakout ports
+// aren't available in ONIE
+func oniePortName(port string) (string, error) {
+	if port == "" {
+		return "", nil // port allocation error is reported by the builder
+	}
+
+	id, ok := strings.CutPrefix(port, "E1/")
+	if !ok || strings.Contains(id, "/") {
+		return "", errors.Errorf("port %s can't be used for control link as it's not a front panel port", port)
+	}
+	if n, err := strconv.ParseUint(id, 10, 8); err != nil || n == 0 {
+		return "", errors.Errorf("invalid port %s for control link", port)
+	}
+
+	return "eth" + id, nil
+}
+
+func (b *Builder) createExternalConnection(switchName, externalName string, ext TopologyExternal) (*wiringapi.Connection, error) {
 	conn, err := b.createConnection(wiringapi.ConnectionSpec{
 		External: &wiringapi.ConnExternal{
 			Link: wiringapi.ConnExternalLink{
-				Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(switchName)},
+				Switch: wiringapi.BasePortName{Port: b.nextSwitchPort(switchName, PortRoleUplink)},
 			},
 		},
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	conn.Annotations = make(map[string]string)
-	conn.Annotations[VirtualEdgeDest] = b.nextSwitchPort(string(External)) // TODO: Generate it from CLI
+	conn.Annotations[VirtualEdgeDest] = b.nextSwitchPort(externalName, PortRoleUplink)
+	if ext.VLAN != 0 {
+		conn.Annotations[VirtualEdgeVLANOverride] = fmt.Sprintf("%d", ext.VLAN)
+	}
+	if ext.Subnet != "" {
+		conn.Annotations[VirtualEdgeSubnet] = ext.Subnet
+	}
+	if ext.InboundCommunity != "" {
+		conn.Annotations[VirtualEdgeInboundCommunity] = ext.InboundCommunity
+	}
+	if ext.OutboundCommunity != "" {
+		conn.Annotations[VirtualEdgeOutboundCommunity] = ext.OutboundCommunity
+	}
 
-	return conn, err
+	return conn, nil
 }
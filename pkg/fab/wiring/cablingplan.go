@@ -0,0 +1,274 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+)
+
+const (
+	CablingPlanFormatCSV      = "csv"
+	CablingPlanFormatMarkdown = "markdown"
+	CablingPlanFormatHTML     = "html"
+)
+
+var CablingPlanFormats = []string{CablingPlanFormatCSV, CablingPlanFormatMarkdown, CablingPlanFormatHTML}
+
+// CablingPlanEntry is a single link as seen from one of its ends, so each link is listed for both devices
+type CablingPlanEntry struct {
+	Label      string // suggested cable label built from both ends, so it's the same for them and stable across changes
+	Rack       string
+	Device     string
+	Port       string
+	IP         string
+	MAC        string
+	PeerRack   string
+	PeerDevice string
+	PeerPort   string
+	PeerIP     string
+	PeerMAC    string
+	Purpose    string
+	Connection string
+}
+
+// CablingPlanDevice is a device with all its links
+type CablingPlanDevice struct {
+	Name    string
+	Entries []CablingPlanEntry
+}
+
+// CablingPlanRack is a rack with all its devices
+type CablingPlanRack struct {
+	Name    string
+	Devices []CablingPlanDevice
+}
+
+type CablingPlan struct {
+	Racks []CablingPlanRack
+}
+
+// BuildCablingPlan lists all physical links of the wiring per rack and per device, devices without rack annotation
+// are in the default rack
+func BuildCablingPlan(data *wiring.Data) *CablingPlan {
+	racks := map[string]string{}
+	macs := map[string]string{}
+	for _, sw := range data.Switch.All() {
+		racks[sw.Name] = cmp.Or(sw.Annotations[RackAnnotation], Rack)
+		macs[sw.Name] = sw.Spec.Boot.MAC
+	}
+	for _, server := range data.Server.All() {
+		racks[server.Name] = cmp.Or(server.Annotations[RackAnnotation], Rack)
+	}
+
+	links := []Link{}
+	for _, conn := range data.Connection.All() {
+		for _, link := range ConnectionLinks(conn) {
+			// switch management MAC is the one used for the boot
+			if link.Type == wiringapi.ConnectionTypeManagement && link.B.Port == "M1" {
+				link.B.MAC = macs[link.B.Device]
+			}
+			links = append(links, link)
+		}
+	}
+	slices.SortStableFunc(links, func(a, b Link) int {
+		return cmp.Or(
+			cmp.Compare(racks[a.A.Device], racks[b.A.Device]),
+			cmp.Compare(a.A.Device, b.A.Device),
+			comparePorts(a.A.Port, b.A.Port),
+		)
+	})
+
+	entries := []CablingPlanEntry{}
+	for _, link := range links {
+		label := cableLabel(link)
+		for _, ends := range [][2]LinkEnd{{link.A, link.B}, {link.B, link.A}} {
+			local, peer := ends[0], ends[1]
+			if local.Device == LinkDeviceExternal {
+				continue
+			}
+
+			entries = append(entries, CablingPlanEntry{
+				Label:      label,
+				Rack:       racks[local.Device],
+				Device:     local.Device,
+				Port:       local.Port,
+				IP:         local.IP,
+				MAC:        local.MAC,
+				PeerRack:   racks[peer.Device],
+				PeerDevice: peer.Device,
+				PeerPort:   peer.Port,
+				PeerIP:     peer.IP,
+				PeerMAC:    peer.MAC,
+				Purpose:    link.Purpose,
+				Connection: link.Connection,
+			})
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b CablingPlanEntry) int {
+		return cmp.Or(
+			cmp.Compare(a.Rack, b.Rack),
+			cmp.Compare(a.Device, b.Device),
+			comparePorts(a.Port, b.Port),
+		)
+	})
+
+	plan := &CablingPlan{}
+	for _, entry := range entries {
+		if len(plan.Racks) == 0 || plan.Racks[len(plan.Racks)-1].Name != entry.Rack {
+			plan.Racks = append(plan.Racks, CablingPlanRack{Name: entry.Rack})
+		}
+		rack := &plan.Racks[len(plan.Racks)-1]
+		if len(rack.Devices) == 0 || rack.Devices[len(rack.Devices)-1].Name != entry.Device {
+			rack.Devices = append(rack.Devices, CablingPlanDevice{Name: entry.Device})
+		}
+		device := &rack.Devices[len(rack.Devices)-1]
+		device.Entries = append(device.Entries, entry)
+	}
+
+	return plan
+}
+
+// cableLabel returns the label for the link built from its ends in the stable order, e.g. leaf-01/E1/1--spine-01/E1/3
+func cableLabel(link Link) string {
+	ends := []LinkEnd{link.A, link.B}
+	slices.SortFunc(ends, func(a, b LinkEnd) int {
+		return cmp.Or(cmp.Compare(a.Device, b.Device), comparePorts(a.Port, b.Port))
+	})
+
+	names := []string{}
+	for _, end := range ends {
+		if end.Port == "" {
+			names = append(names, end.Device)
+		} else {
+			names = append(names, end.Device+"/"+end.Port)
+		}
+	}
+
+	return strings.Join(names, "--")
+}
+
+func (plan *CablingPlan) Write(w io.Writer, format string) error {
+	switch format {
+	case CablingPlanFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{
+			"label", "rack", "device", "port", "ip", "mac", "peer rack", "peer device", "peer port", "peer ip", "peer mac",
+			"purpose", "connection",
+		}); err != nil {
+			return errors.Wrapf(err, "error writing csv")
+		}
+		for _, rack := range plan.Racks {
+			for _, device := range rack.Devices {
+				for _, e := range device.Entries {
+					if err := cw.Write([]string{
+						e.Label, e.Rack, e.Device, e.Port, e.IP, e.MAC, e.PeerRack, e.PeerDevice, e.PeerPort, e.PeerIP, e.PeerMAC,
+						e.Purpose, e.Connection,
+					}); err != nil {
+						return errors.Wrapf(err, "error writing csv")
+					}
+				}
+			}
+		}
+		cw.Flush()
+
+		return errors.Wrapf(cw.Error(), "error writing csv")
+	case CablingPlanFormatMarkdown:
+		fmt.Fprintln(w, "# Cabling plan")
+		for _, rack := range plan.Racks {
+			fmt.Fprintf(w, "\n## %s\n", rack.Name)
+			for _, device := range rack.Devices {
+				fmt.Fprintf(w, "\n### %s\n\n", device.Name)
+				fmt.Fprintln(w, "| Label | Port | Peer | Peer port | Peer rack | Purpose | IP | MAC | Peer IP | Peer MAC | Done |")
+				fmt.Fprintln(w, "|---|---|---|---|---|---|---|---|---|---|---|")
+				for _, e := range device.Entries {
+					fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | [ ] |\n",
+						e.Label, e.Port, e.PeerDevice, e.PeerPort, e.PeerRack, e.Purpose, e.IP, e.MAC, e.PeerIP, e.PeerMAC)
+				}
+			}
+		}
+
+		return nil
+	case CablingPlanFormatHTML:
+		return errors.Wrapf(cablingPlanHTML.Execute(w, plan), "error writing html")
+	default:
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(CablingPlanFormats, ", "))
+	}
+}
+
+var cablingPlanHTML = template.Must(template.New("cabling-plan").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cabling plan</title>
+<style>
+body { font-family: sans-serif; font-size: 12px; margin: 2em; }
+h2 { page-break-before: always; }
+h2:first-of-type { page-break-before: avoid; }
+h3 { margin-top: 1.5em; }
+table { border-collapse: collapse; width: 100%; page-break-inside: avoid; }
+th, td { border: 1px solid #888; padding: 4px 6px; text-align: left; }
+th { background: #eee; }
+td.label { font-family: monospace; font-weight: bold; }
+td.done { width: 3em; }
+</style>
+</head>
+<body>
+<h1>Cabling plan</h1>
+{{- range .Racks }}
+<h2>{{ .Name }}</h2>
+{{- range .Devices }}
+<h3>{{ .Name }}</h3>
+<table>
+<tr><th>Label</th><th>Port</th><th>Peer</th><th>Peer port</th><th>Peer rack</th><th>Purpose</th><th>IP</th><th>MAC</th><th>Peer IP</th><th>Peer MAC</th><th>Done</th></tr>
+{{- range .Entries }}
+<tr><td class="label">{{ .Label }}</td><td>{{ .Port }}</td><td>{{ .PeerDevice }}</td><td>{{ .PeerPort }}</td><td>{{ .PeerRack }}</td><td>{{ .Purpose }}</td><td>{{ .IP }}</td><td>{{ .MAC }}</td><td>{{ .PeerIP }}</td><td>{{ .PeerMAC }}</td><td class="done"></td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
+
+// CablingPlanPath loads wiring from the file and writes the cabling plan in the format to stdout
+func CablingPlanPath(wiringPath string, format string) error {
+	if wiringPath == "" {
+		return errors.Errorf("wiring path is not specified")
+	}
+	if !slices.Contains(CablingPlanFormats, format) {
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(CablingPlanFormats, ", "))
+	}
+
+	data, err := wiring.New()
+	if err != nil {
+		return errors.Wrapf(err, "error creating wiring data")
+	}
+	if _, err := LoadWiring(wiringPath, data); err != nil {
+		return errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
+	}
+
+	return BuildCablingPlan(data).Write(os.Stdout, format)
+}
@@ -0,0 +1,42 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"testing"
+)
+
+func Test_cableLabel(t *testing.T) {
+	spine := LinkEnd{Device: "spine-01", Port: "E1/3"}
+	leaf := LinkEnd{Device: "leaf-01", Port: "E1/1"}
+
+	for _, test := range []struct {
+		name   string
+		link   Link
+		result string
+	}{
+		{name: "ordered", link: Link{A: leaf, B: spine}, result: "leaf-01/E1/1--spine-01/E1/3"},
+		{name: "reversed", link: Link{A: spine, B: leaf}, result: "leaf-01/E1/1--spine-01/E1/3"},
+		{name: "same device", link: Link{A: LinkEnd{Device: "leaf-01", Port: "E1/10"}, B: LinkEnd{Device: "leaf-01", Port: "E1/9"}},
+			result: "leaf-01/E1/9--leaf-01/E1/10"},
+		{name: "external", link: Link{A: leaf, B: LinkEnd{Device: LinkDeviceExternal}}, result: "external--leaf-01/E1/1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if res := cableLabel(test.link); res != test.result {
+				t.Errorf("cableLabel() = %s, want %s", res, test.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+)
+
+const (
+	CapacityFormatTable    = "table"
+	CapacityFormatMarkdown = "markdown"
+	CapacityFormatJSON     = "json"
+)
+
+var CapacityFormats = []string{CapacityFormatTable, CapacityFormatMarkdown, CapacityFormatJSON}
+
+// CapacityPorts is the front panel ports utilization of the switch, total and free are only known if the switch
+// profile is known
+type CapacityPorts struct {
+	Used  int `json:"used"`
+	Total int `json:"total,omitempty"`
+	Free  int `json:"free,omitempty"`
+}
+
+// CapacityLeaf is the capacity of a single leaf, bandwidth is in Mbps and counted only for the ports with known speed
+type CapacityLeaf struct {
+	Name             string        `json:"name"`
+	Profile          string        `json:"profile,omitempty"`
+	Redundancy       string        `json:"redundancy,omitempty"`      // mclag or eslag
+	RedundancyGroup  string        `json:"redundancyGroup,omitempty"` // MCLAG or ESLAG group name
+	GroupSize        int           `json:"groupSize,omitempty"`       // number of leafs in the redundancy group
+	ServerLinks      int           `json:"serverLinks"`
+	ServerBandwidth  uint64        `json:"serverBandwidth"`
+	UplinkLinks      int           `json:"uplinkLinks"`
+	UplinkBandwidth  uint64        `json:"uplinkBandwidth"`
+	Oversubscription float64       `json:"oversubscription,omitempty"` // server to uplink bandwidth ratio, 0 if unknown
+	MCLAGDomainLinks int           `json:"mclagDomainLinks,omitempty"` // MCLAG peer and session links
+	VPCLoopbacks     int           `json:"vpcLoopbacks,omitempty"`     // VPC loopback links, each takes two ports
+	ExternalLinks    int           `json:"externalLinks,omitempty"`
+	UnknownSpeed     int           `json:"unknownSpeed,omitempty"` // server and uplink ports with unknown speed
+	Ports            CapacityPorts `json:"ports"`
+}
+
+// CapacitySpine is the capacity of a single spine, bandwidth is in Mbps
+type CapacitySpine struct {
+	Name         string        `json:"name"`
+	Profile      string        `json:"profile,omitempty"`
+	Leafs        int           `json:"leafs"`
+	FabricLinks  int           `json:"fabricLinks"`
+	Bandwidth    uint64        `json:"bandwidth"`
+	UnknownSpeed int           `json:"unknownSpeed,omitempty"`
+	Ports        CapacityPorts `json:"ports"`
+}
+
+type Capacity struct {
+	Leafs  []CapacityLeaf  `json:"leafs"`
+	Spines []CapacitySpine `json:"spines,omitempty"`
+}
+
+// capacitySwitch resolves port speeds and counts ports of a single switch
+type capacitySwitch struct {
+	sw           *wiringapi.Switch
+	profile      []profilePort // nil if the switch profile is unknown
+	defaultSpeed string
+	used         map[string]bool
+}
+
+// speed returns the port speed in Mbps from the wiring, switch profile or default speed in that order, breakout port
+// speed is taken from the breakout mode of its parent port, 0 if unknown
+func (s *capacitySwitch) speed(port string) uint64 {
+	if speed, exist := s.sw.Spec.PortSpeeds[port]; exist {
+		return parseSpeed(speed)
+	}
+	if strings.Count(port, "/") == 2 {
+		parent := port[:strings.LastIndex(port, "/")]
+		if mode, exist := s.sw.Spec.PortBreakouts[parent]; exist {
+			_, speed, _ := strings.Cut(mode, "x")
+
+			return parseSpeed(speed)
+		}
+	}
+	for _, p := range s.profile {
+		if p.name == port && p.speed != "" {
+			return parseSpeed(p.speed)
+		}
+	}
+
+	return parseSpeed(s.defaultSpeed)
+}
+
+// ports returns the front panel ports utilization, broken out ports are counted per breakout port
+func (s *capacitySwitch) ports() CapacityPorts {
+	res := CapacityPorts{Used: len(s.used)}
+	if s.profile == nil {
+		return res
+	}
+
+	for _, p := range s.profile {
+		count := 1
+		if mode, exist := s.sw.Spec.PortBreakouts[p.name]; exist {
+			if n, _, ok := strings.Cut(mode, "x"); ok {
+				if parsed, err := strconv.Atoi(n); err == nil && parsed > 0 {
+					count = parsed
+				}
+			}
+		}
+		res.Total += count
+	}
+	res.Free = max(res.Total-res.Used, 0)
+
+	return res
+}
+
+// parseSpeed parses port speed like 25G or 100M into Mbps, 0 if it's empty or invalid
+func parseSpeed(speed string) uint64 {
+	speed = strings.TrimSpace(strings.ToUpper(speed))
+	mult := uint64(1)
+	switch {
+	case strings.HasSuffix(speed, "G"):
+		mult = 1000
+		speed = strings.TrimSuffix(speed, "G")
+	case strings.HasSuffix(speed, "M"):
+		speed = strings.TrimSuffix(speed, "M")
+	default:
+		return 0
+	}
+
+	value, err := strconv.ParseUint(speed, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return value * mult
+}
+
+// formatSpeed formats bandwidth in Mbps, e.g. 1200G or 100M, "-" if it's unknown
+func formatSpeed(mbps uint64) string {
+	if mbps == 0 {
+		return "-"
+	}
+	if mbps%1000 == 0 {
+		return fmt.Sprintf("%dG", mbps/1000)
+	}
+
+	return fmt.Sprintf("%dM", mbps)
+}
+
+// formatRatio formats oversubscription ratio, e.g. 3.00:1, "-" if it's unknown
+func formatRatio(ratio float64) string {
+	if ratio == 0 {
+		return "-"
+	}
+
+	return strconv.FormatFloat(ratio, 'f', 2, 64) + ":1"
+}
+
+// BuildCapacity calculates per leaf oversubscription and per switch ports utilization, switch profiles are used to
+// get port speeds missing in the wiring and total number of ports, default speed is used for the rest of the ports
+func BuildCapacity(data *wiring.Data, profiles map[string][]profilePort, defaultSpeed string) *Capacity {
+	switches := map[string]*capacitySwitch{}
+	groups := map[string]int{}
+	for _, sw := range data.Switch.All() {
+		switches[sw.Name] = &capacitySwitch{
+			sw:           sw,
+			profile:      profiles[sw.Spec.Profile],
+			defaultSpeed: defaultSpeed,
+			used:         map[string]bool{},
+		}
+		if sw.Spec.Redundancy.Group != "" {
+			groups[sw.Spec.Redundancy.Group]++
+		}
+	}
+
+	leafs := map[string]*CapacityLeaf{}
+	spines := map[string]*CapacitySpine{}
+	spineLeafs := map[string]map[string]bool{}
+	for _, sw := range data.Switch.All() {
+		switch {
+		case sw.Spec.Role.IsLeaf():
+			leafs[sw.Name] = &CapacityLeaf{
+				Name:            sw.Name,
+				Profile:         sw.Spec.Profile,
+				Redundancy:      string(sw.Spec.Redundancy.Type),
+				RedundancyGroup: sw.Spec.Redundancy.Group,
+				GroupSize:       groups[sw.Spec.Redundancy.Group],
+			}
+		case sw.Spec.Role.IsSpine():
+			spines[sw.Name] = &CapacitySpine{Name: sw.Name, Profile: sw.Spec.Profile}
+			spineLeafs[sw.Name] = map[string]bool{}
+		}
+	}
+
+	for _, conn := range data.Connection.All() {
+		for _, link := range ConnectionLinks(conn) {
+			for _, end := range []LinkEnd{link.A, link.B} {
+				// management port isn't a front panel one
+				if s, exist := switches[end.Device]; exist && end.Port != "M1" {
+					s.used[end.Port] = true
+				}
+			}
+
+			switch link.Type {
+			case wiringapi.ConnectionTypeUnbundled, wiringapi.ConnectionTypeBundled, wiringapi.ConnectionTypeMCLAG,
+				wiringapi.ConnectionTypeESLAG:
+				if leaf, exist := leafs[link.B.Device]; exist {
+					leaf.ServerLinks++
+					speed := switches[link.B.Device].speed(link.B.Port)
+					leaf.ServerBandwidth += speed
+					if speed == 0 {
+						leaf.UnknownSpeed++
+					}
+				}
+			case wiringapi.ConnectionTypeFabric:
+				if leaf, exist := leafs[link.B.Device]; exist {
+					leaf.UplinkLinks++
+					speed := switches[link.B.Device].speed(link.B.Port)
+					leaf.UplinkBandwidth += speed
+					if speed == 0 {
+						leaf.UnknownSpeed++
+					}
+				}
+				if spine, exist := spines[link.A.Device]; exist {
+					spine.FabricLinks++
+					spineLeafs[spine.Name][link.B.Device] = true
+					speed := switches[link.A.Device].speed(link.A.Port)
+					spine.Bandwidth += speed
+					if speed == 0 {
+						spine.UnknownSpeed++
+					}
+				}
+			case wiringapi.ConnectionTypeMCLAGDomain:
+				for _, end := range []LinkEnd{link.A, link.B} {
+					if leaf, exist := leafs[end.Device]; exist {
+						leaf.MCLAGDomainLinks++
+					}
+				}
+			case wiringapi.ConnectionTypeVPCLoopback:
+				if leaf, exist := leafs[link.A.Device]; exist {
+					leaf.VPCLoopbacks++
+				}
+			case wiringapi.ConnectionTypeExternal, wiringapi.ConnectionTypeStaticExternal:
+				if leaf, exist := leafs[link.A.Device]; exist {
+					leaf.ExternalLinks++
+				}
+			}
+		}
+	}
+
+	res := &Capacity{}
+	for _, name := range sortedMapKeys(leafs) {
+		leaf := leafs[name]
+		if leaf.UplinkBandwidth > 0 && leaf.ServerBandwidth > 0 {
+			leaf.Oversubscription = float64(leaf.ServerBandwidth) / float64(leaf.UplinkBandwidth)
+		}
+		leaf.Ports = switches[name].ports()
+		res.Leafs = append(res.Leafs, *leaf)
+	}
+	for _, name := range sortedMapKeys(spines) {
+		spine := spines[name]
+		spine.Leafs = len(spineLeafs[name])
+		spine.Ports = switches[name].ports()
+		res.Spines = append(res.Spines, *spine)
+	}
+
+	return res
+}
+
+func (c *Capacity) Write(w io.Writer, format string) error {
+	leafRow := func(l CapacityLeaf) []string {
+		redundancy := "-"
+		if l.Redundancy != "" {
+			redundancy = fmt.Sprintf("%s %s (%d)", l.Redundancy, l.RedundancyGroup, l.GroupSize)
+		}
+
+		return []string{
+			l.Name, l.Profile, redundancy,
+			fmt.Sprintf("%d x %s", l.ServerLinks, formatSpeed(l.ServerBandwidth)),
+			fmt.Sprintf("%d x %s", l.UplinkLinks, formatSpeed(l.UplinkBandwidth)),
+			formatRatio(l.Oversubscription),
+			strconv.Itoa(l.MCLAGDomainLinks), strconv.Itoa(l.VPCLoopbacks), strconv.Itoa(l.ExternalLinks),
+			strconv.Itoa(l.Ports.Used), formatPorts(l.Ports.Total), formatPorts(l.Ports.Free),
+		}
+	}
+	leafHeader := []string{
+		"LEAF", "PROFILE", "REDUNDANCY", "SERVER LINKS", "UPLINKS", "OVERSUBSCRIPTION", "MCLAG DOMAIN", "VPC LOOPBACKS",
+		"EXTERNAL", "USED", "TOTAL", "FREE",
+	}
+	spineRow := func(s CapacitySpine) []string {
+		return []string{
+			s.Name, s.Profile, strconv.Itoa(s.Leafs), fmt.Sprintf("%d x %s", s.FabricLinks, formatSpeed(s.Bandwidth)),
+			strconv.Itoa(s.Ports.Used), formatPorts(s.Ports.Total), formatPorts(s.Ports.Free),
+		}
+	}
+	spineHeader := []string{"SPINE", "PROFILE", "LEAFS", "FABRIC LINKS", "USED", "TOTAL", "FREE"}
+
+	switch format {
+	case CapacityFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return errors.Wrapf(enc.Encode(c), "error encoding capacity")
+	case CapacityFormatMarkdown:
+		table := func(header []string, rows [][]string) {
+			fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+			fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(header)))
+			for _, row := range rows {
+				fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+			}
+		}
+
+		fmt.Fprintln(w, "# Capacity")
+		fmt.Fprintln(w, "\n## Leafs")
+		fmt.Fprintln(w)
+		rows := [][]string{}
+		for _, leaf := range c.Leafs {
+			rows = append(rows, leafRow(leaf))
+		}
+		table(leafHeader, rows)
+		if len(c.Spines) > 0 {
+			fmt.Fprintln(w, "\n## Spines")
+			fmt.Fprintln(w)
+			rows = [][]string{}
+			for _, spine := range c.Spines {
+				rows = append(rows, spineRow(spine))
+			}
+			table(spineHeader, rows)
+		}
+
+		return nil
+	case CapacityFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(leafHeader, "\t"))
+		for _, leaf := range c.Leafs {
+			fmt.Fprintln(tw, strings.Join(leafRow(leaf), "\t"))
+		}
+		if len(c.Spines) > 0 {
+			fmt.Fprintln(tw)
+			fmt.Fprintln(tw, strings.Join(spineHeader, "\t"))
+			for _, spine := range c.Spines {
+				fmt.Fprintln(tw, strings.Join(spineRow(spine), "\t"))
+			}
+		}
+
+		return errors.Wrapf(tw.Flush(), "error writing table")
+	default:
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(CapacityFormats, ", "))
+	}
+}
+
+func formatPorts(ports int) string {
+	if ports == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(ports)
+}
+
+// CapacityPath loads wiring from the file and writes the capacity report in the format to stdout, switch profiles
+// are taken from the topology file if it's specified in addition to the built-in ones
+func CapacityPath(wiringPath string, topologyPath string, defaultSpeed string, format string) error {
+	if wiringPath == "" {
+		return errors.Errorf("wiring path is not specified")
+	}
+	if !slices.Contains(CapacityFormats, format) {
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(CapacityFormats, ", "))
+	}
+	if defaultSpeed != "" && parseSpeed(defaultSpeed) == 0 {
+		return errors.Errorf("invalid default speed %q, expected e.g. 25G", defaultSpeed)
+	}
+
+	topo := &Topology{}
+	if topologyPath != "" {
+		var err error
+		if topo, err = LoadTopology(topologyPath); err != nil {
+			return errors.Wrapf(err, "error loading topology")
+		}
+	}
+	profiles, err := topo.portProfiles()
+	if err != nil {
+		return errors.Wrapf(err, "error loading switch profiles")
+	}
+
+	data, err := wiring.New()
+	if err != nil {
+		return errors.Wrapf(err, "error creating wiring data")
+	}
+	if _, err := LoadWiring(wiringPath, data); err != nil {
+		return errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
+	}
+
+	return BuildCapacity(data, profiles, defaultSpeed).Write(os.Stdout, format)
+}
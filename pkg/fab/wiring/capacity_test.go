@@ -0,0 +1,104 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"testing"
+)
+
+func Test_parseSpeed(t *testing.T) {
+	for _, tt := range []struct {
+		speed string
+		want  uint64
+	}{
+		{"25G", 25000},
+		{"100g", 100000},
+		{"100M", 100},
+		{"", 0},
+		{"4x25G", 0},
+		{"fast", 0},
+	} {
+		if got := parseSpeed(tt.speed); got != tt.want {
+			t.Errorf("parseSpeed(%q) = %d, want %d", tt.speed, got, tt.want)
+		}
+	}
+}
+
+func Test_BuildCapacity(t *testing.T) {
+	data := diffTestData(t, 65101, "leaf-1/E1/1", "172.30.30.1/31", nil)
+
+	for _, tt := range []struct {
+		name         string
+		profiles     map[string][]profilePort
+		defaultSpeed string
+		wantRatio    float64
+		wantUplink   uint64
+		wantPorts    CapacityPorts
+		wantUnknown  int
+	}{
+		{
+			name:        "no-speeds",
+			wantPorts:   CapacityPorts{Used: 2},
+			wantUnknown: 2,
+		},
+		{
+			name:         "default-speed",
+			defaultSpeed: "25G",
+			wantRatio:    1,
+			wantUplink:   25000,
+			wantPorts:    CapacityPorts{Used: 2},
+		},
+		{
+			name: "profile",
+			profiles: map[string][]profilePort{
+				"": {{name: "E1/1", speed: "25G"}, {name: "E1/2", speed: "25G"}, {name: "E1/49", speed: "100G"}},
+			},
+			defaultSpeed: "10G",
+			wantRatio:    0.25,
+			wantUplink:   100000,
+			wantPorts:    CapacityPorts{Used: 2, Total: 3, Free: 1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := BuildCapacity(data, tt.profiles, tt.defaultSpeed)
+			if len(res.Leafs) != 2 || len(res.Spines) != 1 {
+				t.Fatalf("expected 2 leafs and 1 spine, got %d and %d", len(res.Leafs), len(res.Spines))
+			}
+
+			leaf := res.Leafs[0]
+			if leaf.ServerLinks != 1 || leaf.UplinkLinks != 1 {
+				t.Errorf("expected 1 server link and 1 uplink, got %d and %d", leaf.ServerLinks, leaf.UplinkLinks)
+			}
+			if leaf.Oversubscription != tt.wantRatio {
+				t.Errorf("expected oversubscription %v, got %v", tt.wantRatio, leaf.Oversubscription)
+			}
+			if leaf.UplinkBandwidth != tt.wantUplink {
+				t.Errorf("expected uplink bandwidth %d, got %d", tt.wantUplink, leaf.UplinkBandwidth)
+			}
+			if leaf.Ports != tt.wantPorts {
+				t.Errorf("expected ports %+v, got %+v", tt.wantPorts, leaf.Ports)
+			}
+			if leaf.UnknownSpeed != tt.wantUnknown {
+				t.Errorf("expected %d ports with unknown speed, got %d", tt.wantUnknown, leaf.UnknownSpeed)
+			}
+			if leaf.GroupSize != 2 {
+				t.Errorf("expected redundancy group size 2, got %d", leaf.GroupSize)
+			}
+			if spine := res.Spines[0]; spine.Leafs != 1 || spine.Ports.Used != 1 {
+				t.Errorf("expected spine with 1 leaf and 1 used port, got %+v", spine)
+			}
+		})
+	}
+}
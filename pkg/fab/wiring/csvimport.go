@@ -0,0 +1,583 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.githedgehog.com/fabric/api/meta"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ImportRoleServer  = "server"
+	ImportRoleControl = "control"
+
+	ImportPurposeFabric       = "fabric"
+	ImportPurposeMCLAGPeer    = "mclag-peer"
+	ImportPurposeMCLAGSession = "mclag-session"
+	ImportPurposeManagement   = "management"
+	ImportPurposeVPCLoopback  = "vpc-loopback"
+	ImportPurposeMCLAG        = "mclag"
+	ImportPurposeESLAG        = "eslag"
+	ImportPurposeBundled      = "bundled"
+	ImportPurposeUnbundled    = "unbundled"
+
+	importPurposeMCLAGDomain = "mclag-domain" // peer and session links together
+)
+
+var ImportPurposes = []string{
+	ImportPurposeFabric, ImportPurposeMCLAGPeer, ImportPurposeMCLAGSession, ImportPurposeManagement, ImportPurposeVPCLoopback,
+	ImportPurposeMCLAG, ImportPurposeESLAG, ImportPurposeBundled, ImportPurposeUnbundled,
+}
+
+// importDevice is a single row of the roles CSV
+type importDevice struct {
+	name        string
+	role        string
+	group       string
+	redundancy  meta.RedundancyType
+	description string
+}
+
+func (d *importDevice) isSwitch() bool {
+	return d.role != ImportRoleServer && d.role != ImportRoleControl
+}
+
+func (d *importDevice) isLeaf() bool {
+	return wiringapi.SwitchRole(d.role).IsLeaf()
+}
+
+// importLink is a single row of the cabling CSV with the devices resolved
+type importLink struct {
+	row     string
+	a, b    *importDevice
+	portA   string
+	portB   string
+	purpose string
+}
+
+// importConn is a set of links that end up in the same connection
+type importConn struct {
+	purpose string
+	links   []importLink
+}
+
+// importErrors collects errors for all rows to report them at once
+type importErrors []string
+
+func (e *importErrors) add(row string, format string, args ...any) {
+	*e = append(*e, row+": "+fmt.Sprintf(format, args...))
+}
+
+func (e importErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return errors.Errorf("errors found:\n  %s", strings.Join(e, "\n  "))
+}
+
+// ImportCSV builds wiring from the cabling and roles spreadsheets.
+//
+// Roles CSV describes all devices with columns device, role (spine, server-leaf, border-leaf, mixed-leaf, server or
+// control), group (switch group, used as redundancy group if redundancy is set), redundancy (mclag or eslag) and
+// description, only device and role are required.
+//
+// Cabling CSV lists all links with columns device a, port a, device b, port b and purpose. Connection type is inferred
+// from the device roles and groups, so purpose is only required for the MCLAG session and peer links (mclag-session or
+// mclag-peer) and for the servers with multiple unbundled connections (unbundled). Links of the server to the leafs
+// end up in a single connection: unbundled or bundled for a single leaf, MCLAG or ESLAG for the redundancy group.
+func ImportCSV(cabling io.Reader, cablingName string, roles io.Reader, rolesName string) (*wiring.Data, error) {
+	errs := importErrors{}
+
+	devices, deviceNames, err := readImportRoles(roles, rolesName, &errs)
+	if err != nil {
+		return nil, err
+	}
+
+	conns, err := readImportCabling(cabling, cablingName, devices, &errs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	data, err := wiring.New()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating wiring data")
+	}
+
+	groups := []string{}
+	for _, name := range deviceNames {
+		dev := devices[name]
+		if dev.group != "" && !slices.Contains(groups, dev.group) {
+			groups = append(groups, dev.group)
+			if err := data.Add(&wiringapi.SwitchGroup{
+				TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindSwitchGroup, APIVersion: wiringapi.GroupVersion.String()},
+				ObjectMeta: metav1.ObjectMeta{Name: dev.group},
+			}); err != nil {
+				return nil, errors.Wrapf(err, "error creating switch group %s", dev.group)
+			}
+		}
+
+		if dev.isSwitch() {
+			spec := wiringapi.SwitchSpec{
+				Role:        wiringapi.SwitchRole(dev.role),
+				Description: dev.description,
+			}
+			if dev.group != "" {
+				spec.Groups = []string{dev.group}
+			}
+			if dev.redundancy != meta.RedundancyTypeNone {
+				spec.Redundancy = wiringapi.SwitchRedundancy{Group: dev.group, Type: dev.redundancy}
+			}
+
+			if err := data.Add(&wiringapi.Switch{
+				TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindSwitch, APIVersion: wiringapi.GroupVersion.String()},
+				ObjectMeta: metav1.ObjectMeta{Name: dev.name},
+				Spec:       spec,
+			}); err != nil {
+				return nil, errors.Wrapf(err, "error creating switch %s", dev.name)
+			}
+
+			continue
+		}
+
+		spec := wiringapi.ServerSpec{Description: dev.description}
+		if dev.role == ImportRoleControl {
+			spec.Type = wiringapi.ServerTypeControl
+		}
+		if err := data.Add(&wiringapi.Server{
+			TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindServer, APIVersion: wiringapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: dev.name},
+			Spec:       spec,
+		}); err != nil {
+			return nil, errors.Wrapf(err, "error creating server %s", dev.name)
+		}
+	}
+
+	for _, conn := range conns {
+		spec, err := conn.spec()
+		if err != nil {
+			errs.add(conn.links[0].row, "%s", err)
+
+			continue
+		}
+		if err := data.Add(&wiringapi.Connection{
+			TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindConnection, APIVersion: wiringapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: spec.GenerateName()},
+			Spec:       spec,
+		}); err != nil {
+			errs.add(conn.links[0].row, "%s", err)
+		}
+	}
+
+	return data, errs.err()
+}
+
+// ImportCSVPath imports wiring from the cabling and roles CSV files and writes it to stdout
+func ImportCSVPath(cablingPath, rolesPath string) error {
+	if cablingPath == "" {
+		return errors.Errorf("cabling CSV path is not specified")
+	}
+	if rolesPath == "" {
+		return errors.Errorf("roles CSV path is not specified")
+	}
+
+	cabling, err := os.Open(cablingPath)
+	if err != nil {
+		return errors.Wrapf(err, "error opening cabling CSV %s", cablingPath)
+	}
+	defer cabling.Close()
+
+	roles, err := os.Open(rolesPath)
+	if err != nil {
+		return errors.Wrapf(err, "error opening roles CSV %s", rolesPath)
+	}
+	defer roles.Close()
+
+	data, err := ImportCSV(cabling, filepath.Base(cablingPath), roles, filepath.Base(rolesPath))
+	if err != nil {
+		return errors.Wrapf(err, "error importing wiring")
+	}
+
+	return errors.Wrapf(data.Write(os.Stdout), "error writing wiring data")
+}
+
+// readImportCSV reads CSV with the header and returns rows as maps from the normalized column name, e.g. "Device A"
+// and "device_a" are both "devicea"
+func readImportCSV(r io.Reader, name string, required ...string) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", name)
+	}
+	if len(records) == 0 {
+		return nil, errors.Errorf("%s is empty", name)
+	}
+
+	header := []string{}
+	for _, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(column))
+		column = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(column)
+		header = append(header, column)
+	}
+	for _, column := range required {
+		if !slices.Contains(header, column) {
+			return nil, errors.Errorf("%s: column %q is missing", name, column)
+		}
+	}
+
+	rows := []map[string]string{}
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for idx, value := range record {
+			if idx < len(header) {
+				row[header[idx]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readImportRoles(r io.Reader, name string, errs *importErrors) (map[string]*importDevice, []string, error) {
+	rows, err := readImportCSV(r, name, "device", "role")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	devices := map[string]*importDevice{}
+	names := []string{}
+	for idx, row := range rows {
+		rowName := fmt.Sprintf("%s row %d", name, idx+2)
+
+		dev := &importDevice{
+			name:        row["device"],
+			role:        strings.ToLower(row["role"]),
+			group:       row["group"],
+			redundancy:  meta.RedundancyType(strings.ToLower(row["redundancy"])),
+			description: row["description"],
+		}
+
+		switch {
+		case dev.name == "":
+			errs.add(rowName, "device name is empty")
+		case devices[dev.name] != nil:
+			errs.add(rowName, "duplicate device %s", dev.name)
+		case dev.isSwitch() && (!slices.Contains(wiringapi.SwitchRoles, wiringapi.SwitchRole(dev.role)) || dev.role == string(wiringapi.SwitchRoleVirtualEdge)):
+			errs.add(rowName, "unsupported role %q for %s", dev.role, dev.name)
+		case !dev.isSwitch() && (dev.group != "" || dev.redundancy != meta.RedundancyTypeNone):
+			errs.add(rowName, "group and redundancy are only supported for switches, %s is %s", dev.name, dev.role)
+		case !slices.Contains(meta.RedundancyTypes, dev.redundancy):
+			errs.add(rowName, "unknown redundancy type %q for %s", dev.redundancy, dev.name)
+		case dev.redundancy != meta.RedundancyTypeNone && (dev.group == "" || !dev.isLeaf()):
+			errs.add(rowName, "redundancy requires group and is only supported for leafs, %s", dev.name)
+		default:
+			devices[dev.name] = dev
+			names = append(names, dev.name)
+		}
+	}
+
+	// all switches in the redundancy group should have the same redundancy type
+	redundancy := map[string]meta.RedundancyType{}
+	for _, devName := range names {
+		dev := devices[devName]
+		if dev.group == "" {
+			continue
+		}
+		if other, exist := redundancy[dev.group]; exist && other != dev.redundancy {
+			errs.add(name, "group %s has switches with different redundancy types %q and %q", dev.group, other, dev.redundancy)
+		}
+		redundancy[dev.group] = dev.redundancy
+	}
+
+	return devices, names, nil
+}
+
+func readImportCabling(r io.Reader, name string, devices map[string]*importDevice, errs *importErrors) ([]*importConn, error) {
+	rows, err := readImportCSV(r, name, "devicea", "porta", "deviceb", "portb")
+	if err != nil {
+		return nil, err
+	}
+
+	conns := []*importConn{}
+	keys := map[string]*importConn{}
+	add := func(key string, purpose string, link importLink) {
+		if key != "" {
+			if conn, exist := keys[key]; exist {
+				if conn.purpose != purpose {
+					errs.add(link.row, "link of %s is %s but previous links are %s", key, purpose, conn.purpose)
+
+					return
+				}
+				conn.links = append(conn.links, link)
+
+				return
+			}
+		}
+
+		conn := &importConn{purpose: purpose, links: []importLink{link}}
+		conns = append(conns, conn)
+		if key != "" {
+			keys[key] = conn
+		}
+	}
+
+	// server links are grouped by the server to infer connection type when all rows are read
+	servers := []string{}
+	serverLinks := map[string][]importLink{}
+
+	for idx, row := range rows {
+		link := importLink{
+			row:     fmt.Sprintf("%s row %d", name, idx+2),
+			portA:   row["porta"],
+			portB:   row["portb"],
+			purpose: strings.ToLower(row["purpose"]),
+		}
+
+		if link.purpose != "" && !slices.Contains(ImportPurposes, link.purpose) {
+			errs.add(link.row, "unknown purpose %q, supported: %s", link.purpose, strings.Join(ImportPurposes, ", "))
+
+			continue
+		}
+		if link.portA == "" || link.portB == "" {
+			errs.add(link.row, "both ports are required")
+
+			continue
+		}
+
+		link.a, link.b = devices[row["devicea"]], devices[row["deviceb"]]
+		if link.a == nil || link.b == nil {
+			missing := row["devicea"]
+			if link.a != nil {
+				missing = row["deviceb"]
+			}
+			errs.add(link.row, "unknown device %q", missing)
+
+			continue
+		}
+
+		// switch is always b for server links and spine is always a for fabric links
+		if link.a.isSwitch() && (!link.b.isSwitch() || link.b.role == string(wiringapi.SwitchRoleSpine)) {
+			link.a, link.b, link.portA, link.portB = link.b, link.a, link.portB, link.portA
+		}
+		a, b := link.a, link.b
+
+		switch {
+		case !b.isSwitch():
+			errs.add(link.row, "links between servers %s and %s are not supported", a.name, b.name)
+		case a.role == ImportRoleControl:
+			if link.purpose != "" && link.purpose != ImportPurposeManagement {
+				errs.add(link.row, "link between control node %s and switch %s could only be management", a.name, b.name)
+
+				continue
+			}
+			add("", ImportPurposeManagement, link)
+		case a.role == ImportRoleServer:
+			if !b.isLeaf() {
+				errs.add(link.row, "server %s could only be attached to leafs, %s is %s", a.name, b.name, b.role)
+
+				continue
+			}
+			if link.purpose == ImportPurposeUnbundled {
+				add("", ImportPurposeUnbundled, link)
+
+				continue
+			}
+			if _, exist := serverLinks[a.name]; !exist {
+				servers = append(servers, a.name)
+			}
+			serverLinks[a.name] = append(serverLinks[a.name], link)
+		case a.role == string(wiringapi.SwitchRoleSpine):
+			if !b.isLeaf() {
+				errs.add(link.row, "spine %s could only be connected to leafs, %s is %s", a.name, b.name, b.role)
+
+				continue
+			}
+			if link.purpose != "" && link.purpose != ImportPurposeFabric {
+				errs.add(link.row, "link between spine %s and leaf %s could only be fabric", a.name, b.name)
+
+				continue
+			}
+			add("fabric "+a.name+" "+b.name, ImportPurposeFabric, link)
+		case a == b:
+			if link.purpose != "" && link.purpose != ImportPurposeVPCLoopback {
+				errs.add(link.row, "link from switch %s to itself could only be vpc-loopback", a.name)
+
+				continue
+			}
+			add("vpc-loopback "+a.name, ImportPurposeVPCLoopback, link)
+		case a.redundancy == meta.RedundancyTypeMCLAG && a.group == b.group:
+			if link.purpose != ImportPurposeMCLAGPeer && link.purpose != ImportPurposeMCLAGSession {
+				errs.add(link.row, "purpose mclag-peer or mclag-session is required for links between MCLAG peers %s and %s", a.name, b.name)
+
+				continue
+			}
+			add("mclag-domain "+a.group, importPurposeMCLAGDomain, link)
+		default:
+			errs.add(link.row, "can't infer connection type for %s (%s) and %s (%s)", a.name, a.role, b.name, b.role)
+		}
+	}
+
+	for _, server := range servers {
+		links := serverLinks[server]
+		purpose, err := inferServerPurpose(links)
+		if err != nil {
+			errs.add(links[0].row, "%s", err)
+
+			continue
+		}
+
+		for _, link := range links {
+			if link.purpose != "" && link.purpose != purpose {
+				errs.add(link.row, "link of server %s is %s but inferred connection type is %s", server, link.purpose, purpose)
+			}
+		}
+
+		conns = append(conns, &importConn{purpose: purpose, links: links})
+	}
+
+	return conns, nil
+}
+
+// inferServerPurpose returns connection type for all server links to the leafs
+func inferServerPurpose(links []importLink) (string, error) {
+	server := links[0].a.name
+	leafs := []*importDevice{}
+	for _, link := range links {
+		if !slices.Contains(leafs, link.b) {
+			leafs = append(leafs, link.b)
+		}
+	}
+
+	if len(leafs) == 1 {
+		if len(links) == 1 && links[0].purpose != ImportPurposeBundled {
+			return ImportPurposeUnbundled, nil
+		}
+
+		return ImportPurposeBundled, nil
+	}
+
+	names := []string{}
+	for _, leaf := range leafs {
+		names = append(names, leaf.name)
+	}
+	for _, leaf := range leafs[1:] {
+		if leaf.group == "" || leaf.group != leafs[0].group || leaf.redundancy == meta.RedundancyTypeNone {
+			return "", errors.Errorf("server %s is attached to leafs %s that aren't in the same redundancy group", server, strings.Join(names, ", "))
+		}
+	}
+
+	if leafs[0].redundancy == meta.RedundancyTypeMCLAG {
+		if len(leafs) != 2 {
+			return "", errors.Errorf("MCLAG server %s should be attached to exactly 2 leafs, got %s", server, strings.Join(names, ", "))
+		}
+
+		return ImportPurposeMCLAG, nil
+	}
+
+	return ImportPurposeESLAG, nil
+}
+
+// spec returns connection spec for the links
+func (c *importConn) spec() (wiringapi.ConnectionSpec, error) {
+	port := func(device *importDevice, port string) wiringapi.BasePortName {
+		return wiringapi.BasePortName{Port: device.name + "/" + port}
+	}
+	serverLinks := func() []wiringapi.ServerToSwitchLink {
+		links := []wiringapi.ServerToSwitchLink{}
+		for _, link := range c.links {
+			links = append(links, wiringapi.ServerToSwitchLink{Server: port(link.a, link.portA), Switch: port(link.b, link.portB)})
+		}
+
+		return links
+	}
+
+	first := c.links[0]
+
+	switch c.purpose {
+	case ImportPurposeManagement:
+		onie := "eth0"
+		if first.portB != "M1" {
+			var err error
+			if onie, err = oniePortName(first.portB); err != nil {
+				return wiringapi.ConnectionSpec{}, errors.Wrapf(err, "switch %s", first.b.name)
+			}
+		}
+
+		return wiringapi.ConnectionSpec{Management: &wiringapi.ConnMgmt{Link: wiringapi.ConnMgmtLink{
+			Server: wiringapi.ConnMgmtLinkServer{BasePortName: port(first.a, first.portA)},
+			Switch: wiringapi.ConnMgmtLinkSwitch{BasePortName: port(first.b, first.portB), ONIEPortName: onie},
+		}}}, nil
+	case ImportPurposeFabric:
+		links := []wiringapi.FabricLink{}
+		for _, link := range c.links {
+			links = append(links, wiringapi.FabricLink{
+				Spine: wiringapi.ConnFabricLinkSwitch{BasePortName: port(link.a, link.portA)},
+				Leaf:  wiringapi.ConnFabricLinkSwitch{BasePortName: port(link.b, link.portB)},
+			})
+		}
+
+		return wiringapi.ConnectionSpec{Fabric: &wiringapi.ConnFabric{Links: links}}, nil
+	case ImportPurposeVPCLoopback:
+		links := []wiringapi.SwitchToSwitchLink{}
+		for _, link := range c.links {
+			links = append(links, wiringapi.SwitchToSwitchLink{Switch1: port(link.a, link.portA), Switch2: port(link.b, link.portB)})
+		}
+
+		return wiringapi.ConnectionSpec{VPCLoopback: &wiringapi.ConnVPCLoopback{Links: links}}, nil
+	case importPurposeMCLAGDomain:
+		domain := &wiringapi.ConnMCLAGDomain{}
+		for _, link := range c.links {
+			// keep the same switch on the same side for all links
+			if link.a != first.a {
+				link.a, link.b, link.portA, link.portB = link.b, link.a, link.portB, link.portA
+			}
+			l := wiringapi.SwitchToSwitchLink{Switch1: port(link.a, link.portA), Switch2: port(link.b, link.portB)}
+			if link.purpose == ImportPurposeMCLAGSession {
+				domain.SessionLinks = append(domain.SessionLinks, l)
+			} else {
+				domain.PeerLinks = append(domain.PeerLinks, l)
+			}
+		}
+
+		return wiringapi.ConnectionSpec{MCLAGDomain: domain}, nil
+	case ImportPurposeMCLAG:
+		return wiringapi.ConnectionSpec{MCLAG: &wiringapi.ConnMCLAG{Links: serverLinks()}}, nil
+	case ImportPurposeESLAG:
+		return wiringapi.ConnectionSpec{ESLAG: &wiringapi.ConnESLAG{Links: serverLinks()}}, nil
+	case ImportPurposeBundled:
+		return wiringapi.ConnectionSpec{Bundled: &wiringapi.ConnBundled{Links: serverLinks()}}, nil
+	default:
+		return wiringapi.ConnectionSpec{Unbundled: &wiringapi.ConnUnbundled{Link: serverLinks()[0]}}, nil
+	}
+}
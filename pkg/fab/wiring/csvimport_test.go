@@ -0,0 +1,146 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"strings"
+	"testing"
+)
+
+const testImportRoles = `Device,Role,Group,Redundancy
+control-1,control,,
+spine-1,spine,,
+leaf-1,server-leaf,mclag-1,mclag
+leaf-2,server-leaf,mclag-1,mclag
+leaf-3,server-leaf,eslag-1,eslag
+leaf-4,server-leaf,eslag-1,eslag
+leaf-5,server-leaf,,
+server-1,server,,
+server-2,server,,
+server-3,server,,
+server-4,server,,
+`
+
+func Test_ImportCSV(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		cabling string
+		conns   []string
+		errors  []string
+	}{
+		{
+			name: "inferred",
+			cabling: `Device A,Port A,Device B,Port B,Purpose
+control-1,enp2s1,leaf-1,M1,
+spine-1,E1/1,leaf-1,E1/1,
+leaf-1,E1/2,spine-1,E1/2,
+leaf-1,E1/3,leaf-2,E1/3,mclag-peer
+leaf-2,E1/4,leaf-1,E1/4,mclag-session
+server-1,enp2s1,leaf-1,E1/5,
+leaf-2,E1/5,server-1,enp2s2,
+server-2,enp2s1,leaf-3,E1/1,
+server-2,enp2s2,leaf-4,E1/1,
+server-3,enp2s1,leaf-5,E1/1,
+server-3,enp2s2,leaf-5,E1/2,
+server-4,enp2s1,leaf-5,E1/3,
+leaf-5,E1/4,leaf-5,E1/5,
+`,
+			conns: []string{
+				"control-1--leaf-1--management",
+				"leaf-1--leaf-2--mclag-domain",
+				"leaf-5--vpc-loopback",
+				"server-1--leaf-1--leaf-2--mclag",
+				"server-2--leaf-3--leaf-4--eslag",
+				"server-3--leaf-5--bundled",
+				"server-4--leaf-5--unbundled",
+				"spine-1--leaf-1--fabric",
+			},
+		},
+		{
+			name: "errors",
+			cabling: `device_a,port_a,device_b,port_b,purpose
+leaf-1,E1/3,leaf-2,E1/3,
+server-1,enp2s1,leaf-1,E1/1,
+server-1,enp2s2,leaf-5,E1/1,
+spine-1,E1/1,leaf-9,E1/1,
+leaf-3,E1/1,leaf-4,E1/1,
+server-2,enp2s1,leaf-5,E1/2,mclag
+`,
+			errors: []string{
+				"row 2: purpose mclag-peer or mclag-session is required",
+				"row 3: server server-1 is attached to leafs leaf-1, leaf-5",
+				"row 5: unknown device \"leaf-9\"",
+				"row 6: can't infer connection type",
+				"row 7: link of server server-2 is mclag but inferred connection type is unbundled",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := ImportCSV(strings.NewReader(test.cabling), "cabling.csv", strings.NewReader(testImportRoles), "roles.csv")
+			if len(test.errors) > 0 {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				for _, expected := range test.errors {
+					if !strings.Contains(err.Error(), "cabling.csv "+expected) {
+						t.Errorf("expected error %q, got %v", expected, err)
+					}
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conns := []string{}
+			for _, conn := range data.Connection.All() {
+				conns = append(conns, conn.Name)
+			}
+			if strings.Join(conns, " ") != strings.Join(test.conns, " ") {
+				t.Errorf("got connections %v, want %v", conns, test.conns)
+			}
+		})
+	}
+}
+
+func Test_ImportCSV_ONIEPortName(t *testing.T) {
+	cabling := `Device A,Port A,Device B,Port B,Purpose
+control-1,enp2s1,leaf-1,M1,
+control-1,enp2s2,leaf-5,E1/6,
+`
+	data, err := ImportCSV(strings.NewReader(cabling), "cabling.csv", strings.NewReader(testImportRoles), "roles.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onie := map[string]string{}
+	for _, conn := range data.Connection.All() {
+		if conn.Spec.Management != nil {
+			onie[conn.Spec.Management.Link.Switch.Port] = conn.Spec.Management.Link.Switch.ONIEPortName
+		}
+	}
+	if onie["leaf-1/M1"] != "eth0" || onie["leaf-5/E1/6"] != "eth6" {
+		t.Errorf("expected ONIE ports eth0 for leaf-1/M1 and eth6 for leaf-5/E1/6, got %v", onie)
+	}
+
+	cabling = `Device A,Port A,Device B,Port B,Purpose
+control-1,enp2s1,leaf-5,E1/6/1,
+`
+	_, err = ImportCSV(strings.NewReader(cabling), "cabling.csv", strings.NewReader(testImportRoles), "roles.csv")
+	if err == nil || !strings.Contains(err.Error(), "cabling.csv row 2: switch leaf-5: port E1/6/1 can't be used for control link") {
+		t.Errorf("expected control link sub-port error, got %v", err)
+	}
+}
@@ -0,0 +1,527 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+)
+
+const (
+	DiffAdded    = "added"
+	DiffRemoved  = "removed"
+	DiffModified = "modified"
+)
+
+// Impact categories, in the order they are reported
+const (
+	ImpactCabling      = "cabling"
+	ImpactProvisioning = "provisioning"
+	ImpactBGP          = "bgp"
+	ImpactRedundancy   = "redundancy"
+	ImpactConfig       = "config"
+)
+
+var impactCategories = []string{ImpactCabling, ImpactProvisioning, ImpactBGP, ImpactRedundancy, ImpactConfig}
+
+// DiffChange is a single field change, path is a dot separated path in the object with list items identified by the
+// ports they reference if any, e.g. spec.fabric.links[spine-1/E1/1,leaf-1/E1/49].leaf.ip
+type DiffChange struct {
+	Path string
+	Old  string
+	New  string
+}
+
+type DiffObject struct {
+	Kind    string
+	Name    string
+	Op      string
+	Changes []DiffChange
+}
+
+// DiffImpact is the expected effect of the changes on the running fabric
+type DiffImpact struct {
+	Category string
+	Message  string
+}
+
+type WiringDiff struct {
+	Objects []DiffObject
+	Impacts []DiffImpact
+}
+
+// Diff compares wirings semantically: objects are matched by kind and name, empty and defaulted fields are ignored
+// and lists are compared regardless of the order, objects are reported in the order they could be applied
+func Diff(oldData, newData *wiring.Data) (*WiringDiff, error) {
+	diff := &WiringDiff{}
+
+	if err := diffObjects(diff, wiringapi.KindVLANNamespace, oldData.VLANNamespace.All(), newData.VLANNamespace.All()); err != nil {
+		return nil, err
+	}
+	if err := diffObjects(diff, wiringapi.KindSwitchGroup, oldData.SwitchGroup.All(), newData.SwitchGroup.All()); err != nil {
+		return nil, err
+	}
+	if err := diffObjects(diff, wiringapi.KindSwitch, oldData.Switch.All(), newData.Switch.All()); err != nil {
+		return nil, err
+	}
+	if err := diffObjects(diff, wiringapi.KindServer, oldData.Server.All(), newData.Server.All()); err != nil {
+		return nil, err
+	}
+	if err := diffObjects(diff, wiringapi.KindConnection, oldData.Connection.All(), newData.Connection.All()); err != nil {
+		return nil, err
+	}
+
+	impacts := map[string][]string{}
+	addImpact := func(category, format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		if !slices.Contains(impacts[category], msg) {
+			impacts[category] = append(impacts[category], msg)
+		}
+	}
+
+	diffCabling(oldData, newData, addImpact)
+	diffSwitchImpacts(diff, oldData, newData, addImpact)
+	diffConnectionImpacts(diff, oldData, newData, addImpact)
+
+	for _, category := range impactCategories {
+		for _, msg := range impacts[category] {
+			diff.Impacts = append(diff.Impacts, DiffImpact{Category: category, Message: msg})
+		}
+	}
+
+	return diff, nil
+}
+
+type namedObject interface {
+	GetName() string
+}
+
+func diffObjects[T namedObject](diff *WiringDiff, kind string, oldObjs, newObjs []T) error {
+	flatten := func(objs []T) (map[string]map[string]string, error) {
+		res := map[string]map[string]string{}
+		for _, obj := range objs {
+			fields, err := flattenObject(obj)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error flattening %s %s", kind, obj.GetName())
+			}
+			res[obj.GetName()] = fields
+		}
+
+		return res, nil
+	}
+
+	oldFields, err := flatten(oldObjs)
+	if err != nil {
+		return err
+	}
+	newFields, err := flatten(newObjs)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range oldFields {
+		names = append(names, name)
+	}
+	for name := range newFields {
+		if _, exist := oldFields[name]; !exist {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		oldObj, oldExist := oldFields[name]
+		newObj, newExist := newFields[name]
+
+		switch {
+		case !oldExist:
+			diff.Objects = append(diff.Objects, DiffObject{Kind: kind, Name: name, Op: DiffAdded})
+		case !newExist:
+			diff.Objects = append(diff.Objects, DiffObject{Kind: kind, Name: name, Op: DiffRemoved})
+		default:
+			changes := []DiffChange{}
+			for _, path := range sortedMapKeys(mergeKeys(oldObj, newObj)) {
+				if oldObj[path] != newObj[path] {
+					changes = append(changes, DiffChange{Path: path, Old: oldObj[path], New: newObj[path]})
+				}
+			}
+			if len(changes) > 0 {
+				diff.Objects = append(diff.Objects, DiffObject{Kind: kind, Name: name, Op: DiffModified, Changes: changes})
+			}
+		}
+	}
+
+	return nil
+}
+
+func mergeKeys(a, b map[string]string) map[string]bool {
+	res := map[string]bool{}
+	for k := range a {
+		res[k] = true
+	}
+	for k := range b {
+		res[k] = true
+	}
+
+	return res
+}
+
+// flattenObject returns all non-empty fields of the object spec, labels and annotations by their paths
+func flattenObject(obj any) (map[string]string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshaling")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	raw := map[string]any{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling")
+	}
+
+	res := map[string]string{}
+	if meta, ok := raw["metadata"].(map[string]any); ok {
+		flattenValue(res, "metadata.labels", meta["labels"])
+		flattenValue(res, "metadata.annotations", meta["annotations"])
+	}
+	flattenValue(res, "spec", raw["spec"])
+
+	return res, nil
+}
+
+func flattenValue(res map[string]string, path string, value any) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]any:
+		for key, item := range v {
+			flattenValue(res, path+"."+key, item)
+		}
+	case []any:
+		scalars := []string{}
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+			default:
+				if s := fmt.Sprint(item); s != "" {
+					scalars = append(scalars, s)
+				}
+			}
+		}
+		// lists of scalars are sets, e.g. groups
+		if len(scalars) == len(v) {
+			if len(scalars) > 0 {
+				slices.Sort(scalars)
+				res[path] = strings.Join(scalars, ", ")
+			}
+
+			return
+		}
+
+		// list items are identified by the ports they reference, e.g. links, or by the content otherwise
+		items := map[string]any{}
+		for _, item := range v {
+			key := strings.Join(collectPorts(item), ",")
+			if key == "" {
+				data, _ := json.Marshal(item)
+				key = string(data)
+			}
+			items[key] = item
+		}
+		for idx, key := range sortedMapKeys(items) {
+			segment := key
+			if strings.HasPrefix(key, "{") || strings.HasPrefix(key, "[") {
+				segment = fmt.Sprintf("%d", idx)
+			}
+			flattenValue(res, path+"["+segment+"]", items[key])
+		}
+	case bool:
+		if v {
+			res[path] = "true"
+		}
+	case json.Number:
+		if v.String() != "0" {
+			res[path] = v.String()
+		}
+	default:
+		if s := fmt.Sprint(v); s != "" {
+			res[path] = s
+		}
+	}
+}
+
+func collectPorts(value any) []string {
+	res := []string{}
+	switch v := value.(type) {
+	case map[string]any:
+		if port, ok := v["port"].(string); ok {
+			res = append(res, port)
+		}
+		for _, key := range sortedMapKeys(v) {
+			if key != "port" {
+				res = append(res, collectPorts(v[key])...)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			res = append(res, collectPorts(item)...)
+		}
+	}
+
+	return res
+}
+
+// diffCabling compares physical links regardless of the connections they belong to and reports changed switch ports
+func diffCabling(oldData, newData *wiring.Data, addImpact func(category, format string, args ...any)) {
+	peers := func(data *wiring.Data) map[string]string {
+		res := map[string]string{}
+		for _, conn := range data.Connection.All() {
+			for _, link := range ConnectionLinks(conn) {
+				res[link.A.String()] = link.B.String()
+				res[link.B.String()] = link.A.String()
+			}
+		}
+
+		return res
+	}
+	switches := map[string]bool{}
+	for _, data := range []*wiring.Data{oldData, newData} {
+		for _, sw := range data.Switch.All() {
+			switches[sw.Name] = true
+		}
+	}
+
+	oldPeers, newPeers := peers(oldData), peers(newData)
+	ports := []LinkEnd{}
+	for port := range mergeKeys(oldPeers, newPeers) {
+		device, local, _ := strings.Cut(port, "/")
+		if switches[device] && oldPeers[port] != newPeers[port] {
+			ports = append(ports, LinkEnd{Device: device, Port: local})
+		}
+	}
+	slices.SortFunc(ports, func(a, b LinkEnd) int {
+		return cmp.Or(cmp.Compare(a.Device, b.Device), comparePorts(a.Port, b.Port))
+	})
+
+	for _, port := range ports {
+		oldPeer, newPeer := oldPeers[port.String()], newPeers[port.String()]
+		switch {
+		case oldPeer == "":
+			addImpact(ImpactCabling, "new cable on %s %s to %s", port.Device, port.Port, newPeer)
+		case newPeer == "":
+			addImpact(ImpactCabling, "cable removal on %s %s from %s", port.Device, port.Port, oldPeer)
+		default:
+			addImpact(ImpactCabling, "re-cabling on %s %s: %s -> %s", port.Device, port.Port, oldPeer, newPeer)
+		}
+	}
+}
+
+func diffSwitchImpacts(diff *WiringDiff, oldData, newData *wiring.Data, addImpact func(category, format string, args ...any)) {
+	asnChanged := map[string]bool{}
+	for _, obj := range diff.Objects {
+		if obj.Kind != wiringapi.KindSwitch {
+			continue
+		}
+
+		switch obj.Op {
+		case DiffAdded:
+			addImpact(ImpactProvisioning, "new switch %s has to be installed and provisioned", obj.Name)
+
+			continue
+		case DiffRemoved:
+			addImpact(ImpactProvisioning, "switch %s will be decommissioned", obj.Name)
+
+			continue
+		}
+
+		ports := []string{}
+		for _, change := range obj.Changes {
+			field, rest, _ := strings.Cut(strings.TrimPrefix(change.Path, "spec."), ".")
+			switch field {
+			case "asn":
+				asnChanged[obj.Name] = true
+			case "protocolIP":
+				addImpact(ImpactBGP, "protocol IP change on %s: BGP sessions will reset", obj.Name)
+			case "vtepIP":
+				addImpact(ImpactBGP, "VTEP IP change on %s: VXLAN tunnels will be re-established", obj.Name)
+			case "ip":
+				addImpact(ImpactConfig, "switch IP change on %s: switch will be reconfigured", obj.Name)
+			case "role":
+				addImpact(ImpactProvisioning, "role change on %s: switch has to be re-installed", obj.Name)
+			case "profile":
+				addImpact(ImpactProvisioning, "profile change on %s: switch model changes, it has to be re-installed", obj.Name)
+			case "boot":
+				addImpact(ImpactProvisioning, "boot identity change on %s: switch has to be re-provisioned", obj.Name)
+			case "redundancy":
+				addImpact(ImpactRedundancy, "redundancy change on %s: multi-homed servers traffic will be disrupted", obj.Name)
+			case "portSpeeds", "portBreakouts", "portGroupSpeeds", "portAutoNegs":
+				if !slices.Contains(ports, rest) {
+					ports = append(ports, rest)
+				}
+			}
+		}
+		if len(ports) > 0 {
+			slices.SortFunc(ports, comparePorts)
+			addImpact(ImpactConfig, "port configuration change on %s %s: ports will flap", obj.Name, strings.Join(ports, ", "))
+		}
+	}
+
+	// ASN changes are reported per redundancy group if all its members are affected
+	groups := map[string][]string{}
+	for _, sw := range newData.Switch.All() {
+		if group := sw.Spec.Redundancy.Group; group != "" {
+			groups[group] = append(groups[group], sw.Name)
+		}
+	}
+	reported := map[string]bool{}
+	for _, name := range sortedMapKeys(asnChanged) {
+		if reported[name] {
+			continue
+		}
+
+		group := newData.Switch.Get(name).Spec.Redundancy.Group
+		members := groups[group]
+		all := group != ""
+		for _, member := range members {
+			all = all && asnChanged[member]
+		}
+		if all {
+			slices.Sort(members)
+			for _, member := range members {
+				reported[member] = true
+			}
+			addImpact(ImpactBGP, "ASN change on redundancy group %s (%s): BGP sessions will reset", group, strings.Join(members, ", "))
+
+			continue
+		}
+
+		old := oldData.Switch.Get(name)
+		addImpact(ImpactBGP, "ASN change on %s (%d -> %d): BGP sessions will reset", name, old.Spec.ASN, newData.Switch.Get(name).Spec.ASN)
+	}
+}
+
+func diffConnectionImpacts(diff *WiringDiff, oldData, newData *wiring.Data, addImpact func(category, format string, args ...any)) {
+	for _, obj := range diff.Objects {
+		if obj.Kind != wiringapi.KindConnection || obj.Op != DiffModified {
+			continue
+		}
+
+		oldLinks := map[string]Link{}
+		for _, link := range ConnectionLinks(oldData.Connection.Get(obj.Name)) {
+			oldLinks[link.A.String()+" - "+link.B.String()] = link
+		}
+
+		for _, link := range ConnectionLinks(newData.Connection.Get(obj.Name)) {
+			key := link.A.String() + " - " + link.B.String()
+			old, exist := oldLinks[key]
+			if !exist || old.A.IP == link.A.IP && old.B.IP == link.B.IP {
+				continue
+			}
+
+			switch link.Type {
+			case wiringapi.ConnectionTypeFabric:
+				addImpact(ImpactBGP, "IP change on fabric link %s: BGP session will reset", key)
+			case wiringapi.ConnectionTypeManagement:
+				addImpact(ImpactProvisioning, "IP change on management link %s: switch has to be re-provisioned", key)
+			default:
+				addImpact(ImpactConfig, "IP change on %s link %s", link.Type, key)
+			}
+		}
+
+		// changes that are neither cabling nor IPs, e.g. VLANs or MTU
+		for _, change := range obj.Changes {
+			if field := change.Path[strings.LastIndex(change.Path, ".")+1:]; field != "port" && field != "ip" {
+				addImpact(ImpactConfig, "configuration change on connection %s: links may flap", obj.Name)
+
+				break
+			}
+		}
+	}
+}
+
+// Write writes human readable diff with the impact report
+func (d *WiringDiff) Write(w io.Writer) {
+	if len(d.Objects) == 0 {
+		fmt.Fprintln(w, "No changes")
+
+		return
+	}
+
+	ops := map[string]string{DiffAdded: "+", DiffRemoved: "-", DiffModified: "~"}
+	for _, obj := range d.Objects {
+		fmt.Fprintf(w, "%s %s %s\n", ops[obj.Op], obj.Kind, obj.Name)
+		for _, change := range obj.Changes {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", change.Path, cmp.Or(change.Old, "<none>"), cmp.Or(change.New, "<none>"))
+		}
+	}
+
+	fmt.Fprintln(w)
+	if len(d.Impacts) == 0 {
+		fmt.Fprintln(w, "Impact: none")
+
+		return
+	}
+	fmt.Fprintln(w, "Impact:")
+	for _, impact := range d.Impacts {
+		fmt.Fprintf(w, "  %s: %s\n", impact.Category, impact.Message)
+	}
+}
+
+// DiffPath loads both wirings and writes the diff to stdout
+func DiffPath(oldPath, newPath string) error {
+	load := func(path string) (*wiring.Data, error) {
+		if path == "" {
+			return nil, errors.Errorf("wiring path is not specified")
+		}
+
+		data, err := wiring.New()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating wiring data")
+		}
+		if _, err := LoadWiring(path, data); err != nil {
+			return nil, errors.Wrapf(err, "error loading wiring data from %s", path)
+		}
+
+		return data, nil
+	}
+
+	oldData, err := load(oldPath)
+	if err != nil {
+		return err
+	}
+	newData, err := load(newPath)
+	if err != nil {
+		return err
+	}
+
+	diff, err := Diff(oldData, newData)
+	if err != nil {
+		return err
+	}
+	diff.Write(os.Stdout)
+
+	return nil
+}
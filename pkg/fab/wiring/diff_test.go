@@ -0,0 +1,132 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func diffTestData(t *testing.T, asn uint32, serverPort string, leafIP string, groups []string) *wiring.Data {
+	t.Helper()
+
+	leaf := func(name string) client.Object {
+		return &wiringapi.Switch{
+			TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindSwitch, APIVersion: wiringapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: wiringapi.SwitchSpec{
+				Role:       wiringapi.SwitchRoleServerLeaf,
+				ASN:        asn,
+				Groups:     groups,
+				Redundancy: wiringapi.SwitchRedundancy{Group: "mclag-1", Type: meta.RedundancyTypeMCLAG},
+			},
+		}
+	}
+
+	data, err := wiring.New(
+		leaf("leaf-1"),
+		leaf("leaf-2"),
+		&wiringapi.Switch{
+			TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindSwitch, APIVersion: wiringapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: "spine-1"},
+			Spec:       wiringapi.SwitchSpec{Role: wiringapi.SwitchRoleSpine, ASN: 65100},
+		},
+		&wiringapi.Connection{
+			TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindConnection, APIVersion: wiringapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: "spine-1--leaf-1--fabric"},
+			Spec: wiringapi.ConnectionSpec{Fabric: &wiringapi.ConnFabric{Links: []wiringapi.FabricLink{{
+				Spine: wiringapi.ConnFabricLinkSwitch{BasePortName: wiringapi.BasePortName{Port: "spine-1/E1/1"}, IP: "172.30.30.0/31"},
+				Leaf:  wiringapi.ConnFabricLinkSwitch{BasePortName: wiringapi.BasePortName{Port: "leaf-1/E1/49"}, IP: leafIP},
+			}}}},
+		},
+		&wiringapi.Connection{
+			TypeMeta:   metav1.TypeMeta{Kind: wiringapi.KindConnection, APIVersion: wiringapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: "server-1--leaf-1--unbundled"},
+			Spec: wiringapi.ConnectionSpec{Unbundled: &wiringapi.ConnUnbundled{Link: wiringapi.ServerToSwitchLink{
+				Server: wiringapi.BasePortName{Port: "server-1/enp2s1"},
+				Switch: wiringapi.BasePortName{Port: serverPort},
+			}}},
+		},
+	)
+	if err != nil {
+		t.Fatalf("error creating wiring data: %v", err)
+	}
+
+	return data
+}
+
+func Test_Diff(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		old, new    *wiring.Data
+		wantObjects []string
+		wantImpacts []string
+	}{
+		{
+			name: "no-changes",
+			old:  diffTestData(t, 65101, "leaf-1/E1/1", "172.30.30.1/31", []string{"a", "b"}),
+			new:  diffTestData(t, 65101, "leaf-1/E1/1", "172.30.30.1/31", []string{"b", "a"}),
+		},
+		{
+			name: "changes",
+			old:  diffTestData(t, 65101, "leaf-1/E1/1", "172.30.30.1/31", nil),
+			new:  diffTestData(t, 65102, "leaf-1/E1/5", "172.30.30.3/31", nil),
+			wantObjects: []string{
+				"modified Switch leaf-1 spec.asn: 65101 -> 65102",
+				"modified Switch leaf-2 spec.asn: 65101 -> 65102",
+				"modified Connection server-1--leaf-1--unbundled spec.unbundled.link.switch.port: leaf-1/E1/1 -> leaf-1/E1/5",
+				"modified Connection spine-1--leaf-1--fabric spec.fabric.links[leaf-1/E1/49,spine-1/E1/1].leaf.ip: 172.30.30.1/31 -> 172.30.30.3/31",
+			},
+			wantImpacts: []string{
+				"cabling: cable removal on leaf-1 E1/1 from server-1/enp2s1",
+				"cabling: new cable on leaf-1 E1/5 to server-1/enp2s1",
+				"bgp: ASN change on redundancy group mclag-1 (leaf-1, leaf-2): BGP sessions will reset",
+				"bgp: IP change on fabric link spine-1/E1/1 - leaf-1/E1/49: BGP session will reset",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := Diff(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+
+			objects := []string{}
+			for _, obj := range diff.Objects {
+				for _, change := range obj.Changes {
+					objects = append(objects, fmt.Sprintf("%s %s %s %s: %s -> %s", obj.Op, obj.Kind, obj.Name, change.Path, change.Old, change.New))
+				}
+			}
+			impacts := []string{}
+			for _, impact := range diff.Impacts {
+				impacts = append(impacts, impact.Category+": "+impact.Message)
+			}
+
+			if !slices.Equal(objects, tt.wantObjects) {
+				t.Errorf("Diff() objects = %q, want %q", objects, tt.wantObjects)
+			}
+			if !slices.Equal(impacts, tt.wantImpacts) {
+				t.Errorf("Diff() impacts = %q, want %q", impacts, tt.wantImpacts)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.githedgehog.com/fabric/api/meta"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	"sigs.k8s.io/yaml"
+)
+
+// Fuzz stages in the order they are run for each topology
+const (
+	FuzzStageBuild    = "build"
+	FuzzStageHydrate  = "hydrate"
+	FuzzStageHydrated = "hydrated"
+	FuzzStageValidate = "validate"
+)
+
+// FuzzBounds limits the random topologies, zero values are replaced with the defaults
+type FuzzBounds struct {
+	MaxSpines    uint8 // spines (per pod if spines per pod), 4 by default
+	MaxLeafs     uint8 // leafs in the whole fabric, 16 by default
+	MaxServers   uint8 // servers of each type per leaf group, 3 by default
+	MaxRacks     uint8 // racks, 3 by default
+	MaxExternals uint8 // externals, limited by the number of orphan leafs, 2 by default
+}
+
+func (b *FuzzBounds) Default() {
+	if b.MaxSpines == 0 {
+		b.MaxSpines = 4
+	}
+	if b.MaxLeafs == 0 {
+		b.MaxLeafs = 16
+	}
+	if b.MaxServers == 0 {
+		b.MaxServers = 3
+	}
+	if b.MaxRacks == 0 {
+		b.MaxRacks = 3
+	}
+	if b.MaxExternals == 0 {
+		b.MaxExternals = 2
+	}
+}
+
+type FuzzConfig struct {
+	Seed   int64  // seed of the first topology, each next one uses the next seed
+	Count  uint   // number of topologies to generate
+	OutDir string // directory to save failing topologies to
+	Bounds FuzzBounds
+}
+
+type FuzzFailure struct {
+	Seed  int64
+	Stage string
+	Err   string
+	Path  string
+}
+
+// Fuzz generates random topologies and runs build, hydrate, hydration check and fabric validation on each of them,
+// failing topologies are saved to the output directory and could be reproduced using the same seed and count 1
+func Fuzz(ctx context.Context, cfg FuzzConfig, fabricCfg *meta.FabricConfig) ([]FuzzFailure, error) {
+	cfg.Bounds.Default()
+
+	if err := os.MkdirAll(cfg.OutDir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "error creating output dir %s", cfg.OutDir)
+	}
+
+	failures := []FuzzFailure{}
+	for idx := uint(0); idx < cfg.Count; idx++ {
+		if err := ctx.Err(); err != nil {
+			return failures, errors.Wrapf(err, "fuzzing interrupted")
+		}
+
+		seed := cfg.Seed + int64(idx)
+		topo := RandomTopology(rand.New(rand.NewSource(seed)), cfg.Bounds)
+
+		// topology is defaulted by the builder so it has to be saved before running
+		topoData, err := yaml.Marshal(topo)
+		if err != nil {
+			return failures, errors.Wrapf(err, "error marshaling topology for seed %d", seed)
+		}
+
+		stage, err := fuzzTopology(ctx, topo, fabricCfg)
+		if err == nil {
+			slog.Debug("Passed", "seed", seed)
+
+			continue
+		}
+
+		failure := FuzzFailure{
+			Seed:  seed,
+			Stage: stage,
+			Err:   err.Error(),
+			Path:  filepath.Join(cfg.OutDir, fmt.Sprintf("fuzz-%d.yaml", seed)),
+		}
+
+		bounds := cfg.Bounds
+		header := fmt.Sprintf("# hhfab wiring fuzz --seed %d --count 1 --max-spines %d --max-leafs %d --max-servers %d"+
+			" --max-racks %d --max-externals %d\n", seed, bounds.MaxSpines, bounds.MaxLeafs, bounds.MaxServers,
+			bounds.MaxRacks, bounds.MaxExternals)
+		header += fmt.Sprintf("# hhfab wiring sample --topology %s\n", failure.Path)
+		header += fmt.Sprintf("# stage: %s\n# error: %s\n", stage, strings.ReplaceAll(failure.Err, "\n", " "))
+		if err := os.WriteFile(failure.Path, append([]byte(header), topoData...), 0o644); err != nil { //nolint:gosec
+			return failures, errors.Wrapf(err, "error saving failing topology %s", failure.Path)
+		}
+
+		slog.Warn("Failed", "seed", seed, "stage", stage, "err", failure.Err, "saved", failure.Path)
+		failures = append(failures, failure)
+	}
+
+	return failures, nil
+}
+
+// fuzzTopology runs all stages on the topology returning the failed one, panics are reported as errors
+func fuzzTopology(ctx context.Context, topo *Topology, fabricCfg *meta.FabricConfig) (stage string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+
+	stage = FuzzStageBuild
+	data, err := (&Builder{Topology: topo}).Build()
+	if err != nil {
+		return stage, err
+	}
+
+	stage = FuzzStageHydrate
+	if _, err := Hydrate(data, DefaultHydrateConfig()); err != nil {
+		return stage, err
+	}
+
+	stage = FuzzStageHydrated
+	if err := IsHydrated(data); err != nil {
+		return stage, err
+	}
+
+	stage = FuzzStageValidate
+	cfg := *fabricCfg
+	cfg.FabricMode = topo.FabricMode
+	if err := wiring.ValidateFabric(ctx, data.Native, &cfg); err != nil {
+		return stage, err
+	}
+
+	return "", nil
+}
+
+// RandomTopology generates random structurally valid topology within the bounds
+func RandomTopology(rnd *rand.Rand, bounds FuzzBounds) *Topology {
+	bounds.Default()
+
+	upTo := func(n uint8) uint8 { return uint8(rnd.Intn(int(n) + 1)) } //nolint:gosec
+
+	topo := &Topology{
+		ControlNodes: 1,
+		VPCLoopbacks: 1 + upTo(1),
+	}
+	if rnd.Intn(4) == 0 {
+		topo.ControlNodes = 3
+	}
+
+	if rnd.Intn(8) == 0 {
+		topo.FabricMode = meta.FabricModeCollapsedCore
+		topo.LeafGroups = []TopologyLeafGroup{randomLeafGroup(rnd, bounds, meta.RedundancyTypeMCLAG, 2, 1)}
+
+		return topo
+	}
+
+	topo.FabricMode = meta.FabricModeSpineLeaf
+	topo.Spines = 1 + upTo(bounds.MaxSpines-1)
+	topo.FabricLinks = 1 + upTo(1)
+	if rnd.Intn(3) == 0 {
+		topo.ChainControlLink = true
+		topo.ControlLinks = 1 + upTo(1)
+	}
+
+	groups := []TopologyLeafGroup{}
+	orphans := uint8(0)
+	for leafs := 1 + upTo(bounds.MaxLeafs-1); leafs > 0; {
+		redundancies := []meta.RedundancyType{meta.RedundancyTypeNone}
+		if leafs >= 2 {
+			redundancies = append(redundancies, meta.RedundancyTypeMCLAG, meta.RedundancyTypeESLAG)
+		}
+
+		redundancy := redundancies[rnd.Intn(len(redundancies))]
+		groupLeafs := uint8(1)
+		switch redundancy {
+		case meta.RedundancyTypeMCLAG:
+			groupLeafs = 2
+		case meta.RedundancyTypeESLAG:
+			groupLeafs = 2 + upTo(min(leafs, 4)-2)
+		}
+		count := 1 + upTo(min(leafs/groupLeafs, 2)-1)
+
+		groups = append(groups, randomLeafGroup(rnd, bounds, redundancy, groupLeafs, count))
+		if redundancy == meta.RedundancyTypeNone {
+			orphans += count
+		}
+		leafs -= groupLeafs * count
+	}
+
+	if rnd.Intn(3) == 0 {
+		racks := 1 + upTo(min(bounds.MaxRacks, uint8(len(groups)))-1) //nolint:gosec
+		pods := 1 + upTo(min(racks, 2)-1)
+		for idx := uint8(0); idx < racks; idx++ {
+			rack := TopologyRack{Pod: fmt.Sprintf("pod-%d", 1+idx%pods)}
+			if rnd.Intn(3) == 0 {
+				rack.ChainControlLink = true
+				rack.ControlLinks = 1 + upTo(1)
+			}
+			topo.Racks = append(topo.Racks, rack)
+		}
+		for idx, group := range groups {
+			rack := &topo.Racks[idx%int(racks)]
+			rack.LeafGroups = append(rack.LeafGroups, group)
+		}
+		topo.SpinesPerPod = pods > 1 && rnd.Intn(2) == 0
+	} else {
+		topo.LeafGroups = groups
+	}
+
+	for range upTo(min(bounds.MaxExternals, orphans)) {
+		topo.Externals = append(topo.Externals, TopologyExternal{})
+	}
+
+	return topo
+}
+
+func randomLeafGroup(rnd *rand.Rand, bounds FuzzBounds, redundancy meta.RedundancyType, leafs, count uint8) TopologyLeafGroup {
+	upTo := func(n uint8) uint8 { return uint8(rnd.Intn(int(n) + 1)) } //nolint:gosec
+
+	group := TopologyLeafGroup{
+		Redundancy: redundancy,
+		Leafs:      leafs,
+		Count:      count,
+		Servers: TopologyServers{
+			Unbundled: upTo(bounds.MaxServers),
+			Bundled:   upTo(bounds.MaxServers),
+		},
+	}
+
+	switch redundancy {
+	case meta.RedundancyTypeMCLAG:
+		group.SessionLinks = 1 + upTo(1)
+		group.PeerLinks = 1 + upTo(1)
+		group.Servers.MCLAG = upTo(bounds.MaxServers)
+	case meta.RedundancyTypeESLAG:
+		group.Servers.ESLAG = upTo(bounds.MaxServers)
+	}
+
+	return group
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+)
+
+func Test_RandomTopology(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		topo := RandomTopology(rand.New(rand.NewSource(seed)), FuzzBounds{})
+		if again := RandomTopology(rand.New(rand.NewSource(seed)), FuzzBounds{}); !reflect.DeepEqual(topo, again) {
+			t.Fatalf("seed %d: topology isn't reproducible", seed)
+		}
+
+		topo.Default()
+		if err := topo.Validate(); err != nil {
+			t.Errorf("seed %d: invalid topology: %v", seed, err)
+		}
+	}
+}
+
+func Test_Fuzz(t *testing.T) {
+	failures, err := Fuzz(context.Background(), FuzzConfig{Seed: 1, Count: 20, OutDir: t.TempDir()}, &meta.FabricConfig{})
+	if err != nil {
+		t.Fatalf("Fuzz() error = %v", err)
+	}
+	for _, failure := range failures {
+		t.Errorf("seed %d failed at %s: %s", failure.Seed, failure.Stage, failure.Err)
+	}
+}
@@ -15,12 +15,17 @@
 package wiring
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net/netip"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/pkg/errors"
 	agentapi "go.githedgehog.com/fabric/api/agent/v1alpha2"
@@ -31,19 +36,32 @@ import (
 )
 
 func IsHydrated(data *wiring.Data) error {
+	if issues := hydrationIssues(data); len(issues) > 0 {
+		return errors.New(issues[0].Message)
+	}
+
+	return nil
+}
+
+// hydrationIssues returns all missing or invalid values that should be set by hydration
+func hydrationIssues(data *wiring.Data) []lintIssue {
+	issues := []lintIssue{}
+	add := func(kind, name, format string, args ...any) {
+		issues = append(issues, lintIssue{Kind: kind, Name: name, Message: fmt.Sprintf(format, args...)})
+	}
+
 	for _, sw := range data.Switch.All() {
 		if sw.Spec.Role == "" {
-			return errors.Errorf("role not set for switch %s", sw.Name)
-		}
-		if !slices.Contains(wiringapi.SwitchRoles, sw.Spec.Role) {
-			return errors.Errorf("role %s not valid for switch %s", sw.Spec.Role, sw.Name)
+			add(wiringapi.KindSwitch, sw.Name, "role not set for switch %s", sw.Name)
+		} else if !slices.Contains(wiringapi.SwitchRoles, sw.Spec.Role) {
+			add(wiringapi.KindSwitch, sw.Name, "role %s not valid for switch %s", sw.Spec.Role, sw.Name)
 		}
 
 		if sw.Spec.ASN == 0 {
-			return errors.Errorf("ASN not set for switch %s", sw.Name)
+			add(wiringapi.KindSwitch, sw.Name, "ASN not set for switch %s", sw.Name)
 		}
 		if sw.Spec.IP == "" {
-			return errors.Errorf("IP not set for switch %s", sw.Name)
+			add(wiringapi.KindSwitch, sw.Name, "IP not set for switch %s", sw.Name)
 		}
 	}
 
@@ -52,42 +70,54 @@ func IsHydrated(data *wiring.Data) error {
 			link := conn.Spec.Management.Link
 
 			if link.Server.IP == "" {
-				return errors.Errorf("server IP not set for management link %s", conn.Name)
+				add(wiringapi.KindConnection, conn.Name, "server IP not set for management link %s", conn.Name)
 			}
 			if link.Switch.IP == "" {
-				return errors.Errorf("switch IP not set for management link %s", conn.Name)
+				add(wiringapi.KindConnection, conn.Name, "switch IP not set for management link %s", conn.Name)
 			}
 		}
 
 		if conn.Spec.Fabric != nil {
 			for linkIdx, link := range conn.Spec.Fabric.Links {
 				if link.Spine.IP == "" {
-					return errors.Errorf("spine IP not set for fabric conn %s/%d", conn.Name, linkIdx)
+					add(wiringapi.KindConnection, conn.Name, "spine IP not set for fabric conn %s/%d", conn.Name, linkIdx)
 				}
 				if link.Leaf.IP == "" {
-					return errors.Errorf("leaf IP not set for fabric conn %s/%d", conn.Name, linkIdx)
+					add(wiringapi.KindConnection, conn.Name, "leaf IP not set for fabric conn %s/%d", conn.Name, linkIdx)
 				}
 			}
 		}
 	}
 
-	return nil
+	return issues
 }
 
 type HydrateConfig struct {
 	Subnet       string
 	SpineASN     uint32
 	LeafASNStart uint32
+	IPPlan       *IPPlan // default plan for the subnet is used if not set
+	Incremental  bool    // keep already assigned values and only allocate missing ones
 }
 
-func createExternal(e agentapi.VirtualEdgeConfig, data *wiring.Data) error {
+// DefaultHydrateConfig is used when there is no fabricator config available, e.g. for wiring sample and hydrate
+func DefaultHydrateConfig() *HydrateConfig {
+	return &HydrateConfig{
+		Subnet:       "172.30.0.0/16",
+		SpineASN:     65100,
+		LeafASNStart: 65101,
+	}
+}
+
+// createExternal adds the external for the virtual edge or overwrites the spec of the existing one
+func createExternal(name string, e agentapi.VirtualEdgeConfig, data *wiring.Data) error {
 	external := &vpcapi.External{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "External",
 			APIVersion: vpcapi.GroupVersion.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "virtual-edge",
+			Name: name,
 		},
 		Spec: vpcapi.ExternalSpec{
 			IPv4Namespace:     "default",
@@ -96,10 +126,17 @@ func createExternal(e agentapi.VirtualEdgeConfig, data *wiring.Data) error {
 		},
 	}
 
+	if existing := data.External.Get(name); existing != nil {
+		existing.Spec = external.Spec
+
+		return nil
+	}
+
 	return errors.Wrapf(data.Add(external), "error adding external object")
 }
 
-func createExternalAttachment(e agentapi.VirtualEdgeConfig, data *wiring.Data, conn string) error {
+// createExternalAttachment adds the attachment for the virtual edge or overwrites the spec of the existing one
+func createExternalAttachment(name string, external string, e agentapi.VirtualEdgeConfig, data *wiring.Data, conn string, asn uint32, bits int) error {
 	vlan, err := strconv.ParseUint(e.IfVlan, 10, 16)
 	if err != nil {
 		return errors.Wrapf(err, "error parsing VLAN %s", e.IfVlan)
@@ -114,22 +151,28 @@ func createExternalAttachment(e agentapi.VirtualEdgeConfig, data *wiring.Data, c
 			APIVersion: vpcapi.GroupVersion.String(),
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "virtual-edge-attachment",
+			Name: name,
 		},
 		Spec: vpcapi.ExternalAttachmentSpec{
-			External:   "virtual-edge",
+			External:   external,
 			Connection: conn,
 			Switch: vpcapi.ExternalAttachmentSwitch{
 				VLAN: uint16(vlan),
-				IP:   fmt.Sprintf("%s/24", e.NeighborIP),
+				IP:   fmt.Sprintf("%s/%d", e.NeighborIP, bits),
 			},
 			Neighbor: vpcapi.ExternalAttachmentNeighbor{
-				ASN: VirtualEdgeASN,
+				ASN: asn,
 				IP:  virtualEdgeIP,
 			},
 		},
 	}
 
+	if existing := data.ExternalAttachment.Get(name); existing != nil {
+		existing.Spec = attachment.Spec
+
+		return nil
+	}
+
 	return errors.Wrapf(data.Add(attachment), "error adding external attachment object")
 }
 
@@ -137,19 +180,23 @@ const (
 	SpineOffset = 200
 	LeafOffset  = 100
 
-	// 1 is reserved for the control VIP
+	// 1 is reserved for the control VIP, 2 for the network between control nodes
 	MCLAGSessionIPNet = 5
 	SwitchIPNet       = 10
 	ProtocolIPNet     = 11
 	VTEPIPNet         = 12
 	ControlIPNet      = 20 // single /24 is more than enough
 	FabricIPNet       = 30 // can take more than one /24, let's book 10
-	VirtualEdgeIPNet  = 40 // single /24 is more than enough
+	VirtualEdgeIPNet  = 40 // single /24 is more than enough, the only external uses all of it
+	VirtualEdgePrefix = 27 // each of the multiple externals gets the next free /27 from the pool
 	VirtualEdgeCfg    = "virtual-edge.hhfab.fabric.githedgehog.com/external-cfg"
 	VirtualEdgeASN    = 64100
+	VirtualEdgeVLAN   = 200 // VLAN of the first external, next ones are using the following VLANs
 )
 
-func HydratePath(wiringPath string) error {
+// HydratePath hydrates wiring from the file and writes result to stdout with tenants kept as is, report of the assigned
+// values goes to stderr
+func HydratePath(wiringPath string, ipPlanPath string, incremental bool) error {
 	if wiringPath == "" {
 		return errors.Errorf("wiring path is not specified")
 	}
@@ -158,170 +205,710 @@ func HydratePath(wiringPath string) error {
 	if err != nil {
 		return errors.Wrapf(err, "error creating wiring data")
 	}
-	err = wiring.LoadDataFrom(wiringPath, data)
+	tenants, err := LoadWiring(wiringPath, data)
 	if err != nil {
 		return errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
 	}
 
-	// TODO config
-	if err := Hydrate(data, &HydrateConfig{
-		Subnet:       "172.30.0.0/16",
-		SpineASN:     65100,
-		LeafASNStart: 65101,
-	}); err != nil {
+	cfg := DefaultHydrateConfig()
+	cfg.Incremental = incremental
+	if ipPlanPath != "" {
+		cfg.IPPlan, err = LoadIPPlan(ipPlanPath, cfg.Subnet)
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := Hydrate(data, cfg)
+	if err != nil {
 		return errors.Wrapf(err, "error hydrating wiring data")
 	}
 
-	return errors.Wrapf(data.Write(os.Stdout), "error writing wiring data")
+	if err := report.Print(os.Stderr); err != nil {
+		return err
+	}
+
+	if err := data.Write(os.Stdout); err != nil {
+		return errors.Wrapf(err, "error writing wiring data")
+	}
+
+	return errors.Wrapf(tenants.Write(os.Stdout), "error writing tenants")
+}
+
+// HydrateReport lists values assigned during hydration
+type HydrateReport struct {
+	Assigned []HydrateAssignment
 }
 
-func Hydrate(data *wiring.Data, cfg *HydrateConfig) error {
-	if !strings.HasSuffix(cfg.Subnet, ".0.0/16") {
-		return errors.Errorf("Subnet %s is expected to be x.y.0.0/16", cfg.Subnet)
+type HydrateAssignment struct {
+	Kind  string
+	Name  string
+	Field string
+	Value string
+}
+
+func (r *HydrateReport) add(kind, name, field, value string) {
+	r.Assigned = append(r.Assigned, HydrateAssignment{Kind: kind, Name: name, Field: field, Value: value})
+}
+
+func (r *HydrateReport) Print(w io.Writer) error {
+	if len(r.Assigned) == 0 {
+		_, err := fmt.Fprintln(w, "Nothing assigned, wiring is already hydrated")
+
+		return errors.Wrapf(err, "error writing report")
 	}
-	cfg.Subnet = strings.TrimSuffix(cfg.Subnet, ".0.0/16")
 
-	// make sure we don't have any leftover data
-	for _, sw := range data.Switch.All() {
-		sw.Spec.ASN = 0
-		sw.Spec.IP = ""
-		sw.Spec.VTEPIP = ""
-		sw.Spec.ProtocolIP = ""
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tFIELD\tVALUE")
+	for _, a := range r.Assigned {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Kind, a.Name, a.Field, a.Value)
 	}
 
-	mclagPeer := map[string]string{}
-	var externalSwitches []string
-	var externalConnections []string
-	for _, conn := range data.Connection.All() {
+	return errors.Wrapf(tw.Flush(), "error writing report")
+}
+
+// Hydrate assigns ASNs and IPs to the wiring objects. In the incremental mode all already assigned values are kept,
+// checked for collisions and only missing ones are allocated from the rest of the pools, so existing fabric could be
+// extended without renumbering. Otherwise everything is re-assigned from scratch.
+func Hydrate(data *wiring.Data, cfg *HydrateConfig) (*HydrateReport, error) {
+	plan := cfg.IPPlan
+	if plan == nil {
+		var err error
+		plan, err = DefaultIPPlan(cfg.Subnet)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ips, err := plan.allocators()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error validating ip plan")
+	}
+
+	asns, err := plan.ASN.ranges(cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error validating ASN plan")
+	}
+
+	h := &hydrator{
+		cfg:        cfg,
+		plan:       plan,
+		ips:        ips,
+		asns:       asns,
+		data:       data,
+		usedIPs:    map[netip.Addr]string{},
+		usedASNs:   map[uint32]string{},
+		groupASN:   map[string]uint32{},
+		leafGroups: map[string]uint32{},
+		mclagPeer:  map[string]string{},
+		report:     &HydrateReport{},
+	}
+
+	switches := data.Switch.All()
+	slices.SortFunc(switches, func(a, b *wiringapi.Switch) int { return strings.Compare(a.Name, b.Name) })
+	conns := data.Connection.All()
+	slices.SortFunc(conns, func(a, b *wiringapi.Connection) int { return strings.Compare(a.Name, b.Name) })
+
+	if !cfg.Incremental {
+		// make sure we don't have any leftover data
+		for _, sw := range switches {
+			sw.Spec.ASN = 0
+			sw.Spec.IP = ""
+			sw.Spec.VTEPIP = ""
+			sw.Spec.ProtocolIP = ""
+			delete(sw.Annotations, VirtualEdgeCfg)
+		}
+		for _, conn := range conns {
+			if conn.Spec.Management != nil {
+				conn.Spec.Management.Link.Server.IP = ""
+				conn.Spec.Management.Link.Switch.IP = ""
+			}
+			if conn.Spec.Fabric != nil {
+				for idx := range conn.Spec.Fabric.Links {
+					conn.Spec.Fabric.Links[idx].Spine.IP = ""
+					conn.Spec.Fabric.Links[idx].Leaf.IP = ""
+				}
+			}
+		}
+	}
+
+	// external connections by the virtual edge they are going to, the only one is used if there is no destination
+	externalConns := map[string][]*wiringapi.Connection{}
+	externals := []*wiringapi.Connection{}
+	for _, conn := range conns {
 		if conn.Spec.MCLAGDomain != nil {
 			sws, _, _, _, err := conn.Spec.Endpoints()
 			if err != nil {
-				return errors.Wrapf(err, "error getting endpoints for MCLAG domain connection %s", conn.Name)
+				return nil, errors.Wrapf(err, "error getting endpoints for MCLAG domain connection %s", conn.Name)
 			}
 			if len(sws) != 2 {
-				return errors.Errorf("MCLAG domain connection %s has %d endpoints, expected 2", conn.Name, len(sws))
+				return nil, errors.Errorf("MCLAG domain connection %s has %d endpoints, expected 2", conn.Name, len(sws))
 			}
 
-			mclagPeer[sws[0]] = sws[1]
-			mclagPeer[sws[1]] = sws[0]
+			h.mclagPeer[sws[0]] = sws[1]
+			h.mclagPeer[sws[1]] = sws[0]
 		}
 		if conn.Spec.External != nil {
 			sws, _, _, _, err := conn.Spec.Endpoints()
 			if err != nil {
-				return errors.Wrapf(err, "error getting endpoints for external connection %s", conn.Name)
+				return nil, errors.Wrapf(err, "error getting endpoints for external connection %s", conn.Name)
 			}
 			if len(sws) != 1 {
-				return errors.Errorf("external connection %s has %d endpoints, expected 1", conn.Name, len(sws))
+				return nil, errors.Errorf("external connection %s has %d endpoints, expected 1", conn.Name, len(sws))
 			}
-			externalSwitches = append(externalSwitches, sws[0])
-			externalConnections = append(externalConnections, conn.Name)
+			dest, _, _ := strings.Cut(conn.Annotations[VirtualEdgeDest], "/")
+			externalConns[dest] = append(externalConns[dest], conn)
+			externals = append(externals, conn)
 		}
 	}
 
-	spine := 0
-	leaf := 0
-	for _, sw := range data.Switch.All() {
+	virtualEdges := 0
+	for _, sw := range switches {
+		if sw.Spec.Role.IsVirtualEdge() {
+			virtualEdges++
+		}
+	}
+
+	for _, sw := range switches {
+		if err := asns.check(sw); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sw := range switches {
+		if peer, ok := h.mclagPeer[sw.Name]; ok {
+			if peerSw := data.Switch.Get(peer); peerSw != nil && asns.group(sw, h.mclagPeer) != asns.group(peerSw, h.mclagPeer) {
+				return nil, errors.Errorf("MCLAG peers %s and %s should share ASN but they are in different groups for the %s ASN strategy", sw.Name, peer, asns.strategy)
+			}
+		}
+	}
+
+	if err := h.applyASNOverrides(switches); err != nil {
+		return nil, err
+	}
+
+	if err := h.reserveExisting(switches, conns); err != nil {
+		return nil, err
+	}
+
+	spine := uint64(0)
+	leaf := uint64(0)
+	virtualEdge := 0
+	for _, sw := range switches {
 		if sw.Spec.Role.IsSpine() {
-			sw.Spec.ASN = cfg.SpineASN
-			sw.Spec.IP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, SwitchIPNet, spine+SpineOffset)
-			sw.Spec.ProtocolIP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, ProtocolIPNet, spine+SpineOffset)
+			if err := h.assignASN(sw, asns.spine, 0); err != nil {
+				return nil, errors.Wrapf(err, "error assigning ASN to spine %s", sw.Name)
+			}
+			if err := h.assignSwitchIPs(sw, uint64(plan.SpineOffset)+spine, false); err != nil {
+				return nil, errors.Wrapf(err, "error assigning IPs to spine %s", sw.Name)
+			}
 
 			spine++
 		}
 		if sw.Spec.Role.IsLeaf() {
-			sw.Spec.ASN = cfg.LeafASNStart + uint32(leaf)
-			sw.Spec.IP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, SwitchIPNet, leaf+LeafOffset)
-			sw.Spec.ProtocolIP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, ProtocolIPNet, leaf+LeafOffset)
-			sw.Spec.VTEPIP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, VTEPIPNet, leaf+LeafOffset)
-
-			// MCLAG pair should have the same ASN and VTEP IP
-			if peer, ok := mclagPeer[sw.Name]; ok {
-				if peerSw := data.Switch.Get(peer); peerSw != nil {
-					if peerSw.Spec.ASN != 0 && peerSw.Spec.VTEPIP != "" {
-						sw.Spec.ASN = peerSw.Spec.ASN
-						sw.Spec.VTEPIP = peerSw.Spec.VTEPIP
-					}
-				}
+			// MCLAG pair should have the same VTEP IP
+			var peerSw *wiringapi.Switch
+			if peer, ok := h.mclagPeer[sw.Name]; ok {
+				peerSw = data.Switch.Get(peer)
+			}
+
+			if err := h.assignASN(sw, asns.leaf, uint32(leaf)); err != nil {
+				return nil, errors.Wrapf(err, "error assigning ASN to leaf %s", sw.Name)
+			}
+			if sw.Spec.VTEPIP == "" && peerSw != nil && peerSw.Spec.VTEPIP != "" {
+				sw.Spec.VTEPIP = peerSw.Spec.VTEPIP
+				h.report.add("Switch", sw.Name, "vtepIP", sw.Spec.VTEPIP)
+			}
+			if err := h.assignSwitchIPs(sw, uint64(plan.LeafOffset)+leaf, true); err != nil {
+				return nil, errors.Wrapf(err, "error assigning IPs to leaf %s", sw.Name)
 			}
 
 			leaf++
 		}
 		if sw.Spec.Role.IsVirtualEdge() {
-			sw.Spec.ASN = VirtualEdgeASN
-			sw.Spec.IP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, SwitchIPNet, leaf+LeafOffset)
-			sw.Spec.ProtocolIP = fmt.Sprintf("%s.%d.%d/32", cfg.Subnet, ProtocolIPNet, leaf+LeafOffset)
-			if len(externalSwitches) != 1 {
-				return errors.Errorf("expected exactly one external switch for virtual edge, got %d", len(externalSwitches))
+			if err := h.assignASN(sw, asns.virtualEdge, uint32(virtualEdge)); err != nil {
+				return nil, errors.Wrapf(err, "error assigning ASN to virtual edge %s", sw.Name)
+			}
+			if err := h.assignSwitchIPs(sw, uint64(plan.LeafOffset)+leaf, false); err != nil {
+				return nil, errors.Wrapf(err, "error assigning IPs to virtual edge %s", sw.Name)
 			}
 
-			if borderSw := data.Switch.Get(externalSwitches[0]); borderSw != nil {
-				externalConfig := agentapi.VirtualEdgeConfig{
-					ASN:          fmt.Sprintf("%d", borderSw.Spec.ASN),
-					VRF:          "default",
-					CommunityIn:  fmt.Sprintf("%d:%d", VirtualEdgeASN, borderSw.Spec.ASN),
-					CommunityOut: fmt.Sprintf("%d:%d", borderSw.Spec.ASN, VirtualEdgeASN),
-					NeighborIP:   fmt.Sprintf("%s.%d.%d", cfg.Subnet, VirtualEdgeIPNet, 1),
-					IfName:       "E1/2",
-					IfVlan:       "200",
-					IfIP:         fmt.Sprintf("%s.%d.%d/24", cfg.Subnet, VirtualEdgeIPNet, leaf+LeafOffset),
-				}
-
-				encodedConfig := map[string]agentapi.VirtualEdgeConfig{}
-				encodedConfig[borderSw.Name] = externalConfig
-				encoded, err := json.Marshal(encodedConfig)
-				if err != nil {
-					return errors.Wrapf(err, "error encoding external config")
-				}
-				sw.Annotations = make(map[string]string)
-				sw.Annotations[VirtualEdgeCfg] = string(encoded)
-
-				err = createExternal(externalConfig, data)
-				if err != nil {
-					return errors.Wrapf(err, "error creating external object")
-				}
+			veConns := externalConns[sw.Name]
+			if len(veConns) == 0 && virtualEdges == 1 && len(externals) == 1 {
+				veConns = externals
+			}
+			if len(veConns) != 1 {
+				return nil, errors.Errorf("expected exactly one external connection for virtual edge %s, got %d", sw.Name, len(veConns))
+			}
 
-				err = createExternalAttachment(externalConfig, data, externalConnections[0])
-				if err != nil {
-					return errors.Wrapf(err, "error creating external attachment object")
+			if _, exist := sw.Annotations[VirtualEdgeCfg]; !exist {
+				if err := h.createVirtualEdge(sw, virtualEdge, virtualEdges, leaf, veConns[0]); err != nil {
+					return nil, errors.Wrapf(err, "error creating virtual edge %s", sw.Name)
 				}
 			}
+
+			virtualEdge++
 		}
 
 		if err := data.Update(sw); err != nil {
-			return errors.Wrapf(err, "error updating switch %s", sw.Name)
+			return nil, errors.Wrapf(err, "error updating switch %s", sw.Name)
 		}
 	}
 
-	control := 0
-	fabric := 0
-	fabricNet := 0
-	for _, conn := range data.Connection.All() {
+	control := uint64(0)
+	fabric := uint64(0)
+	for _, conn := range conns {
 		if conn.Spec.Management != nil {
-			conn.Spec.Management.Link.Server.IP = fmt.Sprintf("%s.%d.%d/31", cfg.Subnet, ControlIPNet, control)
-			conn.Spec.Management.Link.Switch.IP = fmt.Sprintf("%s.%d.%d/31", cfg.Subnet, ControlIPNet, control+1)
+			link := &conn.Spec.Management.Link
+			if link.Server.IP == "" || link.Switch.IP == "" {
+				if err := h.assignP2P(h.ips.control, control, conn.Name, &link.Server.IP, &link.Switch.IP); err != nil {
+					return nil, errors.Wrapf(err, "error assigning IPs to management connection %s", conn.Name)
+				}
+			}
 
-			control += 2
+			control++
 		}
 
 		if conn.Spec.Fabric != nil {
 			for idx := range conn.Spec.Fabric.Links {
-				conn.Spec.Fabric.Links[idx].Spine.IP = fmt.Sprintf("%s.%d.%d/31", cfg.Subnet, FabricIPNet+fabricNet, fabric)
-				conn.Spec.Fabric.Links[idx].Leaf.IP = fmt.Sprintf("%s.%d.%d/31", cfg.Subnet, FabricIPNet+fabricNet, fabric+1)
-
-				fabric += 2
-				if fabric > 254 {
-					fabricNet++
-					if fabricNet > 9 {
-						return errors.Errorf("too many fabric connections, ran out of IPs")
+				link := &conn.Spec.Fabric.Links[idx]
+				if link.Spine.IP == "" || link.Leaf.IP == "" {
+					if err := h.assignP2P(h.ips.fabric, fabric, fmt.Sprintf("%s/%d", conn.Name, idx), &link.Spine.IP, &link.Leaf.IP); err != nil {
+						return nil, errors.Wrapf(err, "error assigning IPs to fabric connection %s", conn.Name)
 					}
 				}
+
+				fabric++
 			}
 		}
 
 		if err := data.Update(conn); err != nil {
-			return errors.Wrapf(err, "error updating connection %s", conn.Name)
+			return nil, errors.Wrapf(err, "error updating connection %s", conn.Name)
+		}
+	}
+
+	return h.report, nil
+}
+
+type hydrator struct {
+	cfg        *HydrateConfig
+	plan       *IPPlan
+	ips        *ipPlanAllocators
+	asns       *asnRanges
+	data       *wiring.Data
+	usedIPs    map[netip.Addr]string
+	usedASNs   map[uint32]string
+	groupASN   map[string]uint32 // ASN of each ASN group, see asnRanges.group
+	leafGroups map[string]uint32 // ordinal of each leaf ASN group
+	mclagPeer  map[string]string
+	veSubnets  []netip.Prefix // virtual edge uplink subnets set by annotations or allocated
+	report     *HydrateReport
+}
+
+// reserveExisting marks all already assigned values as used and fails on collisions
+func (h *hydrator) reserveExisting(switches []*wiringapi.Switch, conns []*wiringapi.Connection) error {
+	collisions := []string{}
+	reserve := func(value, owner string, shared func(string) bool) {
+		if value == "" {
+			return
 		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			collisions = append(collisions, fmt.Sprintf("%s has invalid IP %s", owner, value))
+
+			return
+		}
+
+		if other, exist := h.usedIPs[prefix.Addr()]; exist && (shared == nil || !shared(other)) {
+			collisions = append(collisions, fmt.Sprintf("%s and %s have the same IP %s", other, owner, prefix.Addr()))
+
+			return
+		}
+
+		h.usedIPs[prefix.Addr()] = owner
+	}
+
+	for _, sw := range switches {
+		reserve(sw.Spec.IP, "switch "+sw.Name+" ip", nil)
+		reserve(sw.Spec.ProtocolIP, "switch "+sw.Name+" protocol ip", nil)
+
+		peer := h.mclagPeer[sw.Name]
+		reserve(sw.Spec.VTEPIP, "switch "+sw.Name+" vtep ip", func(other string) bool {
+			return peer != "" && other == "switch "+peer+" vtep ip"
+		})
+
+		if value, exist := sw.Annotations[VirtualEdgeCfg]; exist {
+			cfgs := map[string]agentapi.VirtualEdgeConfig{}
+			if err := json.Unmarshal([]byte(value), &cfgs); err != nil {
+				return errors.Wrapf(err, "error parsing virtual edge config of switch %s", sw.Name)
+			}
+			// only addresses are reserved as the only external used to get the whole pool as its subnet
+			for _, cfg := range cfgs {
+				reserve(cfg.IfIP, "virtual edge "+sw.Name, nil)
+				if cfg.NeighborIP != "" {
+					reserve(cfg.NeighborIP+"/32", "virtual edge neighbor "+sw.Name, nil)
+				}
+			}
+		}
+
+		if sw.Spec.ASN == 0 {
+			continue
+		}
+
+		group := h.asns.group(sw, h.mclagPeer)
+		if asn, exist := h.groupASN[group]; exist && asn != sw.Spec.ASN {
+			collisions = append(collisions, fmt.Sprintf("switch %s has ASN %d while others sharing ASN with it have %d", sw.Name, sw.Spec.ASN, asn))
+
+			continue
+		}
+		h.groupASN[group] = sw.Spec.ASN
+
+		if other, exist := h.usedASNs[sw.Spec.ASN]; exist && h.asns.group(h.data.Switch.Get(other), h.mclagPeer) != group {
+			collisions = append(collisions, fmt.Sprintf("switches %s and %s have the same ASN %d", other, sw.Name, sw.Spec.ASN))
+
+			continue
+		}
+		h.usedASNs[sw.Spec.ASN] = sw.Name
+	}
+
+	for _, conn := range conns {
+		if conn.Spec.Management != nil {
+			link := conn.Spec.Management.Link
+			if link.Server.IP != "" && link.Switch.IP != "" {
+				reserve(link.Server.IP, "management connection "+conn.Name, nil)
+				reserve(link.Switch.IP, "management connection "+conn.Name, nil)
+			}
+		}
+		if value := conn.Annotations[VirtualEdgeSubnet]; conn.Spec.External != nil && value != "" {
+			if prefix, err := netip.ParsePrefix(value); err == nil {
+				h.veSubnets = append(h.veSubnets, prefix.Masked())
+			}
+		}
+		if conn.Spec.Fabric != nil {
+			for idx, link := range conn.Spec.Fabric.Links {
+				if link.Spine.IP != "" && link.Leaf.IP != "" {
+					owner := fmt.Sprintf("fabric connection %s/%d", conn.Name, idx)
+					reserve(link.Spine.IP, owner, nil)
+					reserve(link.Leaf.IP, owner, nil)
+				}
+			}
+		}
+	}
+
+	if len(collisions) > 0 {
+		return errors.Errorf("collisions found in existing assignments:\n  %s", strings.Join(collisions, "\n  "))
+	}
+
+	return nil
+}
+
+func (h *hydrator) setASN(sw *wiringapi.Switch, asn uint32) {
+	sw.Spec.ASN = asn
+	if _, exist := h.usedASNs[asn]; !exist {
+		h.usedASNs[asn] = sw.Name
+	}
+	h.report.add("Switch", sw.Name, "asn", strconv.FormatUint(uint64(asn), 10))
+}
+
+// applyASNOverrides sets ASNs from the override annotations, they are always respected
+func (h *hydrator) applyASNOverrides(switches []*wiringapi.Switch) error {
+	for _, sw := range switches {
+		value, exist := sw.Annotations[ASNOverride]
+		if !exist {
+			continue
+		}
+
+		asn, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || asn == 0 {
+			return errors.Errorf("invalid ASN override %q for switch %s", value, sw.Name)
+		}
+
+		if sw.Spec.ASN != uint32(asn) {
+			h.setASN(sw, uint32(asn))
+		}
+	}
+
+	return nil
+}
+
+// assignASN assigns ASN to the switch if it's not set yet, all switches of the same group share ASN
+func (h *hydrator) assignASN(sw *wiringapi.Switch, r asnRange, idx uint32) error {
+	group := h.asns.group(sw, h.mclagPeer)
+	if sw.Spec.Role.IsLeaf() && h.asns.strategy != ASNStrategyPerLeaf {
+		if _, exist := h.leafGroups[group]; !exist {
+			h.leafGroups[group] = uint32(len(h.leafGroups))
+		}
+		idx = h.leafGroups[group]
+	}
+
+	if sw.Spec.ASN != 0 {
+		return nil
+	}
+
+	asn, exist := h.groupASN[group]
+	if !exist {
+		var err error
+		if asn, err = h.nextASN(r, idx); err != nil {
+			return err
+		}
+		h.groupASN[group] = asn
+	}
+
+	h.setASN(sw, asn)
+
+	return nil
+}
+
+// nextASN returns the first unused ASN in range starting from the idx-th one and wrapping around
+func (h *hydrator) nextASN(r asnRange, idx uint32) (uint32, error) {
+	size := uint64(r.end) - uint64(r.start) + 1
+	for offset := uint64(0); offset < size; offset++ {
+		asn := uint32(uint64(r.start) + (uint64(idx)+offset)%size)
+		if _, used := h.usedASNs[asn]; !used {
+			return asn, nil
+		}
+	}
+
+	return 0, errors.Errorf("%s ASN range %s is exhausted", r.name, r)
+}
+
+func (h *hydrator) assignSwitchIPs(sw *wiringapi.Switch, start uint64, vtep bool) error {
+	for _, field := range []struct {
+		name  string
+		value *string
+		pool  *ipAllocator
+		skip  bool
+	}{
+		{"ip", &sw.Spec.IP, h.ips.sw, false},
+		{"protocolIP", &sw.Spec.ProtocolIP, h.ips.protocol, false},
+		{"vtepIP", &sw.Spec.VTEPIP, h.ips.vtep, !vtep},
+	} {
+		if field.skip || *field.value != "" {
+			continue
+		}
+
+		idx, err := field.pool.nextFree(start, 1, h.isUsed)
+		if err != nil {
+			return err
+		}
+		addr, err := field.pool.host(idx)
+		if err != nil {
+			return err
+		}
+
+		*field.value = addr
+		h.markUsed(addr, "switch "+sw.Name+" "+field.name)
+		h.report.add("Switch", sw.Name, field.name, addr)
+	}
+
+	return nil
+}
+
+func (h *hydrator) assignP2P(pool *ipAllocator, start uint64, name string, left, right *string) error {
+	idx, err := pool.nextFree(start, uint64(1)<<(32-h.ips.p2pPrefix), h.isUsed)
+	if err != nil {
+		return err
+	}
+
+	*left, *right, err = pool.p2p(idx, h.ips.p2pPrefix)
+	if err != nil {
+		return err
+	}
+
+	h.markUsed(*left, "connection "+name)
+	h.markUsed(*right, "connection "+name)
+	h.report.add("Connection", name, "ips", *left+" "+*right)
+
+	return nil
+}
+
+func (h *hydrator) isUsed(addr netip.Addr) bool {
+	_, used := h.usedIPs[addr]
+
+	return used
+}
+
+func (h *hydrator) markUsed(value, owner string) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		h.usedIPs[prefix.Addr()] = owner
+	}
+}
+
+// createVirtualEdge configures the idx-th of the total virtual edges as an external attached to the border leaf,
+// settings from the external connection annotations are used if present
+func (h *hydrator) createVirtualEdge(sw *wiringapi.Switch, idx, total int, leaf uint64, conn *wiringapi.Connection) error {
+	sws, _, _, _, err := conn.Spec.Endpoints()
+	if err != nil || len(sws) != 1 {
+		return errors.Errorf("error getting border switch for external connection %s", conn.Name)
+	}
+	borderSw := h.data.Switch.Get(sws[0])
+	if borderSw == nil {
+		return nil
+	}
+
+	var subnet netip.Prefix
+	if value := conn.Annotations[VirtualEdgeSubnet]; value != "" {
+		if subnet, err = netip.ParsePrefix(value); err != nil || subnet.Masked() != subnet || subnet.Bits() > 30 {
+			return errors.Errorf("invalid subnet %q for external connection %s", value, conn.Name)
+		}
+	} else if total == 1 {
+		// the only external keeps the historical layout with the whole pool as its subnet
+		subnet = h.ips.virtualEdge.prefixes[0]
+	} else if subnet, err = h.virtualEdgeSubnet(); err != nil {
+		return errors.Wrapf(err, "error assigning virtual edge subnet")
+	}
+	pool := &ipAllocator{name: "virtualEdge " + sw.Name, prefixes: []netip.Prefix{subnet}}
+
+	neighborIP, err := pool.addr(1)
+	if err != nil {
+		return errors.Wrapf(err, "error assigning virtual edge neighbor IP")
+	}
+	start := uint64(h.plan.LeafOffset) + leaf
+	if start >= pool.size()-1 {
+		start = 2
+	}
+	ipIdx, err := pool.nextFree(start, 1, func(addr netip.Addr) bool {
+		return addr == neighborIP || h.isUsed(addr)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error assigning virtual edge IP")
+	}
+	ifIP, err := pool.subnet(ipIdx)
+	if err != nil {
+		return errors.Wrapf(err, "error assigning virtual edge IP")
+	}
+	h.markUsed(ifIP, "virtual edge "+sw.Name)
+	h.markUsed(neighborIP.String()+"/32", "virtual edge neighbor "+sw.Name)
+
+	vlan := fmt.Sprintf("%d", VirtualEdgeVLAN+idx)
+	if value := conn.Annotations[VirtualEdgeVLANOverride]; value != "" {
+		if parsed, err := strconv.ParseUint(value, 10, 16); err != nil || parsed == 0 || parsed > 4094 {
+			return errors.Errorf("invalid VLAN %q for external connection %s", value, conn.Name)
+		}
+		vlan = value
+	}
+
+	ifName := "E1/2"
+	if _, port, ok := strings.Cut(conn.Annotations[VirtualEdgeDest], "/"); ok {
+		ifName = port
+	}
+
+	communityIn, err := virtualEdgeCommunity(conn, VirtualEdgeOutboundCommunity, sw.Spec.ASN, borderSw.Spec.ASN)
+	if err != nil {
+		return err
+	}
+	communityOut, err := virtualEdgeCommunity(conn, VirtualEdgeInboundCommunity, borderSw.Spec.ASN, sw.Spec.ASN)
+	if err != nil {
+		return err
+	}
+
+	externalConfig := agentapi.VirtualEdgeConfig{
+		ASN:          fmt.Sprintf("%d", borderSw.Spec.ASN),
+		VRF:          "default",
+		CommunityIn:  communityIn,
+		CommunityOut: communityOut,
+		NeighborIP:   neighborIP.String(),
+		IfName:       ifName,
+		IfVlan:       vlan,
+		IfIP:         ifIP,
+	}
+
+	encodedConfig := map[string]agentapi.VirtualEdgeConfig{}
+	encodedConfig[borderSw.Name] = externalConfig
+	encoded, err := json.Marshal(encodedConfig)
+	if err != nil {
+		return errors.Wrapf(err, "error encoding external config")
+	}
+	if sw.Annotations == nil {
+		sw.Annotations = map[string]string{}
+	}
+	sw.Annotations[VirtualEdgeCfg] = string(encoded)
+	h.report.add("Switch", sw.Name, "virtualEdge", ifIP)
+
+	name, attachmentName := virtualEdgeExternalName(sw.Name, total), ""
+	for _, attachment := range h.data.ExternalAttachment.All() {
+		// keep names of the objects already generated for the connection
+		if attachment.Spec.Connection == conn.Name {
+			name, attachmentName = attachment.Spec.External, attachment.Name
+
+			break
+		}
+	}
+	attachmentName = cmp.Or(attachmentName, name+"-attachment")
+
+	// generated objects are only kept as is in the incremental mode, otherwise they're re-generated as everything else
+	if !h.cfg.Incremental || h.data.External.Get(name) == nil {
+		if err := createExternal(name, externalConfig, h.data); err != nil {
+			return errors.Wrapf(err, "error creating external object")
+		}
+		h.report.add("External", name, "", "")
+	}
+
+	if !h.cfg.Incremental || h.data.ExternalAttachment.Get(attachmentName) == nil {
+		if err := createExternalAttachment(attachmentName, name, externalConfig, h.data, conn.Name, sw.Spec.ASN, subnet.Bits()); err != nil {
+			return errors.Wrapf(err, "error creating external attachment object")
+		}
+		h.report.add("ExternalAttachment", attachmentName, "", "")
 	}
 
 	return nil
 }
+
+// virtualEdgeCommunity returns the standard community from the connection annotation or the default one built from
+// the ASNs, which only works if both of them are 16-bit
+func virtualEdgeCommunity(conn *wiringapi.Connection, annotation string, high, low uint32) (string, error) {
+	value := conn.Annotations[annotation]
+	if value == "" {
+		if high > math.MaxUint16 || low > math.MaxUint16 {
+			return "", errors.Errorf("can't build default community for external connection %s from 32-bit ASNs %d and %d, "+
+				"set it using %s annotation", conn.Name, high, low, annotation)
+		}
+
+		return fmt.Sprintf("%d:%d", high, low), nil
+	}
+
+	first, second, ok := strings.Cut(value, ":")
+	if !ok {
+		return "", errors.Errorf("invalid community %q for external connection %s", value, conn.Name)
+	}
+	for _, part := range []string{first, second} {
+		if _, err := strconv.ParseUint(part, 10, 16); err != nil {
+			return "", errors.Errorf("invalid community %q for external connection %s", value, conn.Name)
+		}
+	}
+
+	return value, nil
+}
+
+// virtualEdgeExternalName returns name of the new external for the virtual edge, the only external keeps the historical
+// name, existing externals are never renamed
+func virtualEdgeExternalName(sw string, total int) string {
+	if total == 1 {
+		return "virtual-edge"
+	}
+
+	return sw
+}
+
+// virtualEdgeSubnet returns the next uplink subnet of the plan prefix length from the virtual edge pool without
+// addresses of the existing virtual edges, so they're kept when new ones are added
+func (h *hydrator) virtualEdgeSubnet() (netip.Prefix, error) {
+	block := uint64(1) << (32 - h.plan.VirtualEdgePrefix)
+	idx, err := h.ips.virtualEdge.nextFree(0, block, func(addr netip.Addr) bool {
+		return h.isUsed(addr) || slices.ContainsFunc(h.veSubnets, func(subnet netip.Prefix) bool { return subnet.Contains(addr) })
+	})
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	addr, err := h.ips.virtualEdge.addr(idx * block)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	subnet := netip.PrefixFrom(addr, h.plan.VirtualEdgePrefix)
+	h.veSubnets = append(h.veSubnets, subnet)
+
+	return subnet, nil
+}
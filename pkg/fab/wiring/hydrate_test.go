@@ -0,0 +1,174 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+
+	agentapi "go.githedgehog.com/fabric/api/agent/v1alpha2"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_virtualEdgeCommunity(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		override  string
+		high, low uint32
+		result    string
+		err       bool
+	}{
+		{name: "default", high: 65101, low: 64102, result: "65101:64102"},
+		{name: "32-bit asn", high: 4200000001, low: 64102, err: true},
+		{name: "32-bit asn override", override: "65000:100", high: 4200000001, low: 64102, result: "65000:100"},
+		{name: "invalid override", override: "65000", high: 65101, low: 64102, err: true},
+		{name: "out of range override", override: "70000:1", high: 65101, low: 64102, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &wiringapi.Connection{ObjectMeta: metav1.ObjectMeta{Name: "conn"}}
+			if test.override != "" {
+				conn.Annotations = map[string]string{VirtualEdgeInboundCommunity: test.override}
+			}
+
+			res, err := virtualEdgeCommunity(conn, VirtualEdgeInboundCommunity, test.high, test.low)
+			if (err != nil) != test.err {
+				t.Fatalf("virtualEdgeCommunity() error = %v, want error %t", err, test.err)
+			}
+			if res != test.result {
+				t.Errorf("virtualEdgeCommunity() = %s, want %s", res, test.result)
+			}
+		})
+	}
+}
+
+func Test_Hydrate_AddVirtualEdge(t *testing.T) {
+	build := func(externals int) *wiring.Data {
+		topo := &Topology{LeafGroups: []TopologyLeafGroup{{Count: 2}}}
+		for range externals {
+			topo.Externals = append(topo.Externals, TopologyExternal{})
+		}
+
+		data, err := (&Builder{Topology: topo}).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+	edgeCfg := func(data *wiring.Data, name string) agentapi.VirtualEdgeConfig {
+		cfgs := map[string]agentapi.VirtualEdgeConfig{}
+		if err := json.Unmarshal([]byte(data.Switch.Get(name).Annotations[VirtualEdgeCfg]), &cfgs); err != nil {
+			t.Fatalf("error parsing virtual edge config of %s: %v", name, err)
+		}
+		for _, cfg := range cfgs {
+			return cfg
+		}
+		t.Fatalf("no virtual edge config for %s", name)
+
+		return agentapi.VirtualEdgeConfig{}
+	}
+
+	before := build(1)
+	if _, err := Hydrate(before, DefaultHydrateConfig()); err != nil {
+		t.Fatal(err)
+	}
+	first := edgeCfg(before, "virtual-edge-1")
+	if first.IfIP != "172.30.40.102/24" || first.NeighborIP != "172.30.40.1" {
+		t.Errorf("the only virtual edge should use the whole pool, got ifIP %s and neighbor %s", first.IfIP, first.NeighborIP)
+	}
+
+	// the second external is added to the already hydrated fabric
+	after := build(2)
+	after.Switch.Get("virtual-edge-1").Annotations = before.Switch.Get("virtual-edge-1").Annotations
+	for _, ext := range before.External.All() {
+		if err := after.Add(ext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, attachment := range before.ExternalAttachment.All() {
+		if err := after.Add(attachment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := DefaultHydrateConfig()
+	cfg.Incremental = true
+	if _, err := Hydrate(after, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := edgeCfg(after, "virtual-edge-1"); got != first {
+		t.Errorf("existing virtual edge config changed from %+v to %+v", first, got)
+	}
+	second := edgeCfg(after, "virtual-edge-2")
+	if second.IfIP != "172.30.40.34/27" || second.NeighborIP != "172.30.40.33" {
+		t.Errorf("new virtual edge should get the first /27 without used addresses, got ifIP %s and neighbor %s", second.IfIP, second.NeighborIP)
+	}
+
+	if ext := after.External.Get("virtual-edge"); ext == nil {
+		t.Errorf("existing external virtual-edge is gone")
+	}
+	if ext := after.External.Get("virtual-edge-2"); ext == nil {
+		t.Errorf("new external virtual-edge-2 is missing")
+	}
+	if n := len(after.External.All()); n != 2 {
+		t.Errorf("got %d externals, want 2", n)
+	}
+}
+
+func Test_Hydrate_AddVirtualEdgeToLegacy(t *testing.T) {
+	topo := &Topology{
+		LeafGroups: []TopologyLeafGroup{{Count: 2}},
+		Externals:  []TopologyExternal{{}, {}},
+	}
+	data, err := (&Builder{Topology: topo}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Hydrate(data, DefaultHydrateConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	// virtual edge hydrated before the uplink subnets were split uses the whole /24 pool
+	legacy := data.Switch.Get("virtual-edge-1")
+	legacy.Annotations[VirtualEdgeCfg] = `{"leaf-02":{"ASN":"65102","VRF":"default","communityIn":"64100:65102",` +
+		`"communityOut":"65102:64100","neighborIP":"172.30.40.1","ifName":"E1/2","ifVlan":"200","ifIP":"172.30.40.102/24"}}`
+	delete(data.Switch.Get("virtual-edge-2").Annotations, VirtualEdgeCfg)
+
+	cfg := DefaultHydrateConfig()
+	cfg.Incremental = true
+	if _, err := Hydrate(data, cfg); err != nil {
+		t.Fatalf("Hydrate() error = %v", err)
+	}
+
+	cfgs := map[string]agentapi.VirtualEdgeConfig{}
+	if err := json.Unmarshal([]byte(data.Switch.Get("virtual-edge-2").Annotations[VirtualEdgeCfg]), &cfgs); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range cfgs {
+		for _, addr := range []string{strings.Split(cfg.IfIP, "/")[0], cfg.NeighborIP} {
+			if addr == "172.30.40.1" || addr == "172.30.40.102" {
+				t.Errorf("new virtual edge reuses legacy address %s", addr)
+			}
+		}
+		if !netip.MustParsePrefix("172.30.40.0/24").Contains(netip.MustParseAddr(cfg.NeighborIP)) {
+			t.Errorf("new virtual edge neighbor %s is outside of the pool", cfg.NeighborIP)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	agentapi "go.githedgehog.com/fabric/api/agent/v1alpha2"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+)
+
+const (
+	IPAMFormatTable = "table"
+	IPAMFormatJSON  = "json"
+	IPAMFormatCSV   = "csv"
+
+	IPAMPoolReserved = "reserved"
+	IPAMPoolOther    = "other"
+)
+
+var IPAMFormats = []string{IPAMFormatTable, IPAMFormatJSON, IPAMFormatCSV}
+
+// IPAMEntry is a single address or subnet taken by the fabric
+type IPAMEntry struct {
+	Prefix  string `json:"prefix"`            // address or subnet with the prefix length, e.g. 172.30.10.100/32
+	Pool    string `json:"pool"`              // ip plan pool it belongs to, "reserved" or "other" if it's outside of the plan
+	Kind    string `json:"kind"`              // kind of the object that owns it, e.g. Switch or Connection
+	Name    string `json:"name"`              // name of the object that owns it
+	Purpose string `json:"purpose,omitempty"` // e.g. ip, protocolIP, vtepIP, spine, leaf
+}
+
+// IPAMPoolUsage is the utilization of a single ip plan pool, p2p pools are counted in links and others in addresses
+type IPAMPoolUsage struct {
+	Pool  string   `json:"pool"`
+	CIDRs []string `json:"cidrs"`
+	Unit  string   `json:"unit"`
+	Size  uint64   `json:"size"`
+	Used  uint64   `json:"used"`
+	Free  uint64   `json:"free"`
+}
+
+func (u IPAMPoolUsage) Utilization() float64 {
+	if u.Size == 0 {
+		return 0
+	}
+
+	return float64(u.Used) * 100 / float64(u.Size)
+}
+
+type IPAM struct {
+	Entries []IPAMEntry     `json:"entries"`
+	Pools   []IPAMPoolUsage `json:"pools"`
+}
+
+// BuildIPAM collects all addresses allocated in the hydrated wiring and calculates pool utilization, reserved entries
+// (e.g. control VIP, VPC loopback subnet) are added as is
+func BuildIPAM(data *wiring.Data, plan *IPPlan, reserved []IPAMEntry) (*IPAM, error) {
+	ips, err := plan.allocators()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error validating ip plan")
+	}
+
+	pools := []struct {
+		name  string
+		alloc *ipAllocator
+		block int
+	}{
+		{"switch", ips.sw, 32},
+		{"protocol", ips.protocol, 32},
+		{"vtep", ips.vtep, 32},
+		{"control", ips.control, ips.p2pPrefix},
+		{"fabric", ips.fabric, ips.p2pPrefix},
+		{"virtualEdge", ips.virtualEdge, 32},
+	}
+
+	res := &IPAM{}
+	add := func(value, kind, name, purpose string) error {
+		if value == "" {
+			return nil
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing %s of %s %s", purpose, kind, name)
+		}
+
+		pool := IPAMPoolOther
+		for _, p := range pools {
+			if p.alloc.contains(prefix.Addr()) {
+				pool = p.name
+
+				break
+			}
+		}
+
+		res.Entries = append(res.Entries, IPAMEntry{Prefix: prefix.String(), Pool: pool, Kind: kind, Name: name, Purpose: purpose})
+
+		return nil
+	}
+
+	// VTEP IPs are shared by MCLAG peers, so we only list each once
+	vteps := map[string]bool{}
+
+	for _, sw := range data.Switch.All() {
+		for _, field := range []struct {
+			purpose string
+			value   string
+		}{
+			{"ip", sw.Spec.IP},
+			{"protocolIP", sw.Spec.ProtocolIP},
+			{"vtepIP", sw.Spec.VTEPIP},
+		} {
+			if field.purpose == "vtepIP" {
+				if vteps[field.value] {
+					continue
+				}
+				vteps[field.value] = true
+			}
+
+			if err := add(field.value, wiringapi.KindSwitch, sw.Name, field.purpose); err != nil {
+				return nil, err
+			}
+		}
+
+		if value, exist := sw.Annotations[VirtualEdgeCfg]; exist {
+			cfgs := map[string]agentapi.VirtualEdgeConfig{}
+			if err := json.Unmarshal([]byte(value), &cfgs); err != nil {
+				return nil, errors.Wrapf(err, "error parsing virtual edge config of switch %s", sw.Name)
+			}
+
+			for border, cfg := range cfgs {
+				if err := add(cfg.IfIP, wiringapi.KindSwitch, sw.Name, "virtualEdge"); err != nil {
+					return nil, err
+				}
+				if cfg.NeighborIP != "" {
+					if err := add(cfg.NeighborIP+"/32", wiringapi.KindSwitch, border, "virtualEdgeNeighbor"); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	for _, conn := range data.Connection.All() {
+		if conn.Spec.Management != nil {
+			link := conn.Spec.Management.Link
+			if err := add(link.Server.IP, wiringapi.KindConnection, conn.Name, "server"); err != nil {
+				return nil, err
+			}
+			if err := add(link.Switch.IP, wiringapi.KindConnection, conn.Name, "switch"); err != nil {
+				return nil, err
+			}
+		}
+		if conn.Spec.Fabric != nil {
+			for idx, link := range conn.Spec.Fabric.Links {
+				name := fmt.Sprintf("%s/%d", conn.Name, idx)
+				if err := add(link.Spine.IP, wiringapi.KindConnection, name, "spine"); err != nil {
+					return nil, err
+				}
+				if err := add(link.Leaf.IP, wiringapi.KindConnection, name, "leaf"); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	poolIdx := func(pool string) int {
+		for idx, p := range pools {
+			if p.name == pool {
+				return idx
+			}
+		}
+
+		return len(pools)
+	}
+	slices.SortStableFunc(res.Entries, func(a, b IPAMEntry) int {
+		if c := poolIdx(a.Pool) - poolIdx(b.Pool); c != 0 {
+			return c
+		}
+
+		return netip.MustParsePrefix(a.Prefix).Addr().Compare(netip.MustParsePrefix(b.Prefix).Addr())
+	})
+
+	for _, entry := range reserved {
+		entry.Pool = IPAMPoolReserved
+		res.Entries = append(res.Entries, entry)
+	}
+
+	for _, p := range pools {
+		usage := IPAMPoolUsage{
+			Pool: p.name,
+			Unit: "address",
+			Size: p.alloc.size(),
+		}
+		if p.block != 32 {
+			usage.Unit = "link"
+			usage.Size /= uint64(1) << (32 - p.block)
+		}
+		for _, prefix := range p.alloc.prefixes {
+			usage.CIDRs = append(usage.CIDRs, prefix.String())
+		}
+
+		used := map[netip.Prefix]bool{}
+		for _, entry := range res.Entries {
+			if entry.Pool != p.name {
+				continue
+			}
+
+			used[netip.PrefixFrom(netip.MustParsePrefix(entry.Prefix).Addr(), p.block).Masked()] = true
+		}
+		usage.Used = uint64(len(used))
+		if usage.Used < usage.Size {
+			usage.Free = usage.Size - usage.Used
+		}
+
+		res.Pools = append(res.Pools, usage)
+	}
+
+	return res, nil
+}
+
+// ipamPurposePools is the ip plan pool each address is expected to be allocated from by its purpose
+var ipamPurposePools = map[string]string{
+	"ip":                  "switch",
+	"protocolIP":          "protocol",
+	"vtepIP":              "vtep",
+	"virtualEdge":         "virtualEdge",
+	"virtualEdgeNeighbor": "virtualEdge",
+	"server":              "control",
+	"switch":              "control",
+	"spine":               "fabric",
+	"leaf":                "fabric",
+}
+
+// CheckPools returns an error listing all addresses that aren't in the ip plan pool expected for their purpose, e.g.
+// if the wiring was hydrated using a different plan
+func (ipam *IPAM) CheckPools() error {
+	mismatches := []string{}
+	for _, e := range ipam.Entries {
+		expected, ok := ipamPurposePools[e.Purpose]
+		if !ok || e.Pool == expected {
+			continue
+		}
+
+		mismatches = append(mismatches, fmt.Sprintf("%s %s %s %s (in %s, expected %s)", e.Kind, e.Name, e.Purpose, e.Prefix, e.Pool, expected))
+	}
+
+	if len(mismatches) > 0 {
+		return errors.Errorf("addresses outside of the ip plan: %s", strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
+
+func (ipam *IPAM) Write(w io.Writer, format string) error {
+	switch format {
+	case IPAMFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return errors.Wrapf(enc.Encode(ipam), "error encoding ipam")
+	case IPAMFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"prefix", "pool", "kind", "name", "purpose"}); err != nil {
+			return errors.Wrapf(err, "error writing csv")
+		}
+		for _, e := range ipam.Entries {
+			if err := cw.Write([]string{e.Prefix, e.Pool, e.Kind, e.Name, e.Purpose}); err != nil {
+				return errors.Wrapf(err, "error writing csv")
+			}
+		}
+		cw.Flush()
+
+		return errors.Wrapf(cw.Error(), "error writing csv")
+	case IPAMFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PREFIX\tPOOL\tKIND\tNAME\tPURPOSE")
+		for _, e := range ipam.Entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Prefix, e.Pool, e.Kind, e.Name, e.Purpose)
+		}
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "POOL\tCIDRS\tUNIT\tSIZE\tUSED\tFREE\tUTILIZATION")
+		for _, u := range ipam.Pools {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s%%\n", u.Pool, strings.Join(u.CIDRs, ","), u.Unit, u.Size, u.Used, u.Free,
+				strconv.FormatFloat(u.Utilization(), 'f', 1, 64))
+		}
+
+		return errors.Wrapf(tw.Flush(), "error writing table")
+	default:
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(IPAMFormats, ", "))
+	}
+}
+
+// IPAMPath loads hydrated wiring from the file and writes all allocations in the format to stdout
+func IPAMPath(wiringPath string, ipPlanPath string, format string, reserved []IPAMEntry) error {
+	if wiringPath == "" {
+		return errors.Errorf("wiring path is not specified")
+	}
+	if !slices.Contains(IPAMFormats, format) {
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(IPAMFormats, ", "))
+	}
+
+	data, err := wiring.New()
+	if err != nil {
+		return errors.Wrapf(err, "error creating wiring data")
+	}
+	if _, err := LoadWiring(wiringPath, data); err != nil {
+		return errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
+	}
+
+	if err := IsHydrated(data); err != nil {
+		return errors.Wrapf(err, "wiring is not hydrated")
+	}
+
+	cfg := DefaultHydrateConfig()
+	plan, err := DefaultIPPlan(cfg.Subnet)
+	if err != nil {
+		return err
+	}
+	if ipPlanPath != "" {
+		if plan, err = LoadIPPlan(ipPlanPath, cfg.Subnet); err != nil {
+			return err
+		}
+	}
+
+	ipam, err := BuildIPAM(data, plan, reserved)
+	if err != nil {
+		return errors.Wrapf(err, "error building ipam")
+	}
+
+	return ipam.Write(os.Stdout, format)
+}
@@ -0,0 +1,324 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// IPPool is a list of CIDRs addresses are allocated from in order
+type IPPool []string
+
+// IPPlan defines where hydration takes IPs from for each purpose and how it assigns ASNs (see ASNPlan). Only IPv4 is
+// supported. Example:
+//
+//	switch: [10.10.0.0/26]
+//	protocol: [10.10.0.64/26]
+//	vtep: [10.10.0.128/26]
+//	control: [10.10.1.0/25]
+//	fabric: [10.10.2.0/24, 10.10.5.0/24]
+//	virtualEdge: [10.10.3.0/24]
+//	virtualEdgePrefix: 28
+//	p2pPrefix: 30
+//	spineOffset: 40
+//	leafOffset: 1
+type IPPlan struct {
+	Switch            IPPool  `json:"switch,omitempty"`            // switch IPs, /32 each
+	Protocol          IPPool  `json:"protocol,omitempty"`          // switch protocol IPs, /32 each
+	VTEP              IPPool  `json:"vtep,omitempty"`              // leaf VTEP IPs, /32 each
+	Control           IPPool  `json:"control,omitempty"`           // control node to switch management links, p2p subnet each
+	Fabric            IPPool  `json:"fabric,omitempty"`            // spine to leaf links, p2p subnet each
+	VirtualEdge       IPPool  `json:"virtualEdge,omitempty"`       // virtual edge uplink subnets, single CIDR used as is by the only one
+	VirtualEdgePrefix int     `json:"virtualEdgePrefix,omitempty"` // prefix length of virtual edge uplink subnets if more than one, 27 by default
+	P2PPrefix         int     `json:"p2pPrefix,omitempty"`         // prefix length for p2p links, 31 or 30
+	SpineOffset       uint32  `json:"spineOffset"`                 // index of the first spine in the switch and protocol pools
+	LeafOffset        uint32  `json:"leafOffset"`                  // index of the first leaf in the switch, protocol and vtep pools
+	ASN               ASNPlan `json:"asn,omitempty"`
+}
+
+// DefaultIPPlan returns plan with the historical layout for the x.y.0.0/16 subnet
+func DefaultIPPlan(subnet string) (*IPPlan, error) {
+	if !strings.HasSuffix(subnet, ".0.0/16") {
+		return nil, errors.Errorf("subnet %s is expected to be x.y.0.0/16", subnet)
+	}
+	prefix := strings.TrimSuffix(subnet, ".0.0/16")
+
+	net := func(third int, bits int) string {
+		return fmt.Sprintf("%s.%d.0/%d", prefix, third, bits)
+	}
+
+	return &IPPlan{
+		Switch:            IPPool{net(SwitchIPNet, 24)},
+		Protocol:          IPPool{net(ProtocolIPNet, 24)},
+		VTEP:              IPPool{net(VTEPIPNet, 24)},
+		Control:           IPPool{net(ControlIPNet, 24)},
+		Fabric:            IPPool{net(FabricIPNet, 23), net(FabricIPNet+2, 22), net(FabricIPNet+6, 23), net(FabricIPNet+8, 23)},
+		VirtualEdge:       IPPool{net(VirtualEdgeIPNet, 24)},
+		VirtualEdgePrefix: VirtualEdgePrefix,
+		P2PPrefix:         31,
+		SpineOffset:       SpineOffset,
+		LeafOffset:        LeafOffset,
+	}, nil
+}
+
+// LoadIPPlan loads plan from the YAML file, pools that aren't set are taken from the default plan for the subnet
+func LoadIPPlan(path string, subnet string) (*IPPlan, error) {
+	plan, err := DefaultIPPlan(subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading ip plan %s", path)
+	}
+
+	if err := yaml.UnmarshalStrict(data, plan); err != nil {
+		return nil, errors.Wrapf(err, "error parsing ip plan %s", path)
+	}
+
+	if err := plan.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "error validating ip plan %s", path)
+	}
+
+	return plan, nil
+}
+
+func (plan *IPPlan) Validate() error {
+	if _, err := plan.allocators(); err != nil {
+		return err
+	}
+
+	_, err := plan.ASN.ranges(DefaultHydrateConfig())
+
+	return err
+}
+
+type ipPlanAllocators struct {
+	p2pPrefix   int
+	sw          *ipAllocator
+	protocol    *ipAllocator
+	vtep        *ipAllocator
+	control     *ipAllocator
+	fabric      *ipAllocator
+	virtualEdge *ipAllocator
+}
+
+func (plan *IPPlan) allocators() (*ipPlanAllocators, error) {
+	if plan.P2PPrefix != 31 && plan.P2PPrefix != 30 {
+		return nil, errors.Errorf("p2p prefix should be 31 or 30, got %d", plan.P2PPrefix)
+	}
+	if len(plan.VirtualEdge) > 1 {
+		return nil, errors.Errorf("ip plan pool virtualEdge should be a single subnet, got %d", len(plan.VirtualEdge))
+	}
+
+	if plan.VirtualEdgePrefix <= 0 || plan.VirtualEdgePrefix > 30 {
+		return nil, errors.Errorf("virtual edge prefix should be between 1 and 30, got %d", plan.VirtualEdgePrefix)
+	}
+
+	res := &ipPlanAllocators{p2pPrefix: plan.P2PPrefix}
+	all := []*ipAllocator{}
+	for _, pool := range []struct {
+		name   string
+		pool   IPPool
+		target **ipAllocator
+		block  int
+	}{
+		{"switch", plan.Switch, &res.sw, 32},
+		{"protocol", plan.Protocol, &res.protocol, 32},
+		{"vtep", plan.VTEP, &res.vtep, 32},
+		{"control", plan.Control, &res.control, plan.P2PPrefix},
+		{"fabric", plan.Fabric, &res.fabric, plan.P2PPrefix},
+		{"virtualEdge", plan.VirtualEdge, &res.virtualEdge, plan.VirtualEdgePrefix},
+	} {
+		alloc, err := newIPAllocator(pool.name, pool.pool, pool.block)
+		if err != nil {
+			return nil, err
+		}
+
+		*pool.target = alloc
+		all = append(all, alloc)
+	}
+
+	for idx, a := range all {
+		for _, b := range all[idx+1:] {
+			if prefA, prefB, overlap := a.overlaps(b); overlap {
+				return nil, errors.Errorf("ip plan pools %s (%s) and %s (%s) overlap", a.name, prefA, b.name, prefB)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// ipAllocator gives addresses by index going through the pool prefixes in order
+type ipAllocator struct {
+	name     string
+	prefixes []netip.Prefix
+}
+
+func newIPAllocator(name string, pool IPPool, block int) (*ipAllocator, error) {
+	if len(pool) == 0 {
+		return nil, errors.Errorf("ip plan pool %s is empty", name)
+	}
+
+	res := &ipAllocator{name: name}
+	for _, cidr := range pool {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing ip plan pool %s cidr %s", name, cidr)
+		}
+		if !prefix.Addr().Is4() {
+			return nil, errors.Errorf("ip plan pool %s cidr %s is not IPv4", name, cidr)
+		}
+		if prefix.Masked() != prefix {
+			return nil, errors.Errorf("ip plan pool %s cidr %s has host bits set, expected %s", name, cidr, prefix.Masked())
+		}
+		if prefix.Bits() > block {
+			return nil, errors.Errorf("ip plan pool %s cidr %s is smaller than /%d", name, cidr, block)
+		}
+
+		res.prefixes = append(res.prefixes, prefix)
+	}
+
+	return res, nil
+}
+
+func (a *ipAllocator) overlaps(b *ipAllocator) (netip.Prefix, netip.Prefix, bool) {
+	for _, prefA := range a.prefixes {
+		for _, prefB := range b.prefixes {
+			if prefA.Overlaps(prefB) {
+				return prefA, prefB, true
+			}
+		}
+	}
+
+	return netip.Prefix{}, netip.Prefix{}, false
+}
+
+func (a *ipAllocator) size() uint64 {
+	var res uint64
+	for _, prefix := range a.prefixes {
+		res += prefixSize(prefix)
+	}
+
+	return res
+}
+
+func (a *ipAllocator) contains(addr netip.Addr) bool {
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func prefixSize(prefix netip.Prefix) uint64 {
+	return 1 << (32 - prefix.Bits())
+}
+
+// addr returns idx-th address in the pool
+func (a *ipAllocator) addr(idx uint64) (netip.Addr, error) {
+	for _, prefix := range a.prefixes {
+		size := prefixSize(prefix)
+		if idx < size {
+			base := prefix.Addr().As4()
+
+			return addrFromUint32(binary.BigEndian.Uint32(base[:]) + uint32(idx)), nil
+		}
+
+		idx -= size
+	}
+
+	return netip.Addr{}, errors.Errorf("ip plan pool %s is exhausted (%d addresses)", a.name, a.size())
+}
+
+// host returns idx-th address in the pool as /32
+func (a *ipAllocator) host(idx uint64) (string, error) {
+	addr, err := a.addr(idx)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.String() + "/32", nil
+}
+
+// p2p returns both ends of the idx-th p2p subnet in the pool, /31 uses both addresses and /30 skips network and broadcast
+func (a *ipAllocator) p2p(idx uint64, prefix int) (string, string, error) {
+	block := uint64(1) << (32 - prefix)
+	first := idx * block
+	if prefix == 30 {
+		first++
+	}
+
+	left, err := a.addr(first)
+	if err != nil {
+		return "", "", err
+	}
+	right, err := a.addr(first + 1)
+	if err != nil {
+		return "", "", err
+	}
+
+	return fmt.Sprintf("%s/%d", left, prefix), fmt.Sprintf("%s/%d", right, prefix), nil
+}
+
+// subnet returns idx-th address in the pool with the pool prefix length
+func (a *ipAllocator) subnet(idx uint64) (string, error) {
+	addr, err := a.addr(idx)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%d", addr, a.prefixes[0].Bits()), nil
+}
+
+func addrFromUint32(v uint32) netip.Addr {
+	var res [4]byte
+	binary.BigEndian.PutUint32(res[:], v)
+
+	return netip.AddrFrom4(res)
+}
+
+// nextFree returns index of the first block of the given size starting from the start block with all addresses unused
+func (a *ipAllocator) nextFree(start uint64, block uint64, used func(netip.Addr) bool) (uint64, error) {
+	for idx := start; ; idx++ {
+		free := true
+		for offset := uint64(0); offset < block; offset++ {
+			addr, err := a.addr(idx*block + offset)
+			if err != nil {
+				return 0, err
+			}
+			if used(addr) {
+				free = false
+
+				break
+			}
+		}
+
+		if free {
+			return idx, nil
+		}
+	}
+}
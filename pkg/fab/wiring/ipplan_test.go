@@ -0,0 +1,187 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"net/netip"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+)
+
+func Test_IPPlan_DefaultLayout(t *testing.T) {
+	plan, err := DefaultIPPlan("172.30.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := plan.allocators()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ip, _ := ips.sw.host(LeafOffset); ip != "172.30.10.100/32" {
+		t.Errorf("first leaf IP %s, want 172.30.10.100/32", ip)
+	}
+	if ip, _ := ips.vtep.host(LeafOffset + 1); ip != "172.30.12.101/32" {
+		t.Errorf("second leaf VTEP IP %s, want 172.30.12.101/32", ip)
+	}
+
+	for _, test := range []struct {
+		idx         uint64
+		left, right string
+	}{
+		{0, "172.30.30.0/31", "172.30.30.1/31"},
+		{1, "172.30.30.2/31", "172.30.30.3/31"},
+		{128, "172.30.31.0/31", "172.30.31.1/31"},
+		{1279, "172.30.39.254/31", "172.30.39.255/31"},
+	} {
+		left, right, err := ips.fabric.p2p(test.idx, ips.p2pPrefix)
+		if err != nil {
+			t.Errorf("fabric link %d: %v", test.idx, err)
+		}
+		if left != test.left || right != test.right {
+			t.Errorf("fabric link %d is %s-%s, want %s-%s", test.idx, left, right, test.left, test.right)
+		}
+	}
+
+	if _, _, err := ips.fabric.p2p(1280, ips.p2pPrefix); err == nil {
+		t.Errorf("expected fabric pool to be exhausted")
+	}
+}
+
+func Test_IPPlan_Custom(t *testing.T) {
+	plan := &IPPlan{
+		Switch:            IPPool{"10.10.0.0/26"},
+		Protocol:          IPPool{"10.10.0.64/26"},
+		VTEP:              IPPool{"10.10.0.128/26"},
+		Control:           IPPool{"10.10.1.0/25"},
+		Fabric:            IPPool{"10.10.2.0/30", "10.10.5.0/24"},
+		VirtualEdge:       IPPool{"10.10.3.0/24"},
+		VirtualEdgePrefix: 28,
+		P2PPrefix:         30,
+	}
+
+	ips, err := plan.allocators()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		idx         uint64
+		left, right string
+	}{
+		{0, "10.10.2.1/30", "10.10.2.2/30"},
+		{1, "10.10.5.1/30", "10.10.5.2/30"},
+		{2, "10.10.5.5/30", "10.10.5.6/30"},
+	} {
+		left, right, err := ips.fabric.p2p(test.idx, ips.p2pPrefix)
+		if err != nil {
+			t.Errorf("fabric link %d: %v", test.idx, err)
+		}
+		if left != test.left || right != test.right {
+			t.Errorf("fabric link %d is %s-%s, want %s-%s", test.idx, left, right, test.left, test.right)
+		}
+	}
+
+	for name, broken := range map[string]func(p IPPlan) IPPlan{
+		"overlap":         func(p IPPlan) IPPlan { p.Protocol = IPPool{"10.10.0.32/27"}; return p },
+		"p2p prefix":      func(p IPPlan) IPPlan { p.P2PPrefix = 29; return p },
+		"small fabric":    func(p IPPlan) IPPlan { p.Fabric = IPPool{"10.10.2.0/31"}; return p },
+		"host bits":       func(p IPPlan) IPPlan { p.Switch = IPPool{"10.10.0.1/26"}; return p },
+		"ipv6":            func(p IPPlan) IPPlan { p.Switch = IPPool{"fd00::/64"}; return p },
+		"empty pool":      func(p IPPlan) IPPlan { p.VTEP = nil; return p },
+		"multi vedge":     func(p IPPlan) IPPlan { p.VirtualEdge = IPPool{"10.10.3.0/25", "10.10.3.128/25"}; return p },
+		"vedge prefix":    func(p IPPlan) IPPlan { p.VirtualEdgePrefix = 23; return p },
+		"no vedge prefix": func(p IPPlan) IPPlan { p.VirtualEdgePrefix = 0; return p },
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := broken(*plan)
+			if err := p.Validate(); err == nil {
+				t.Errorf("expected validation error")
+			}
+		})
+	}
+}
+
+func Test_ipAllocator_nextFree(t *testing.T) {
+	alloc, err := newIPAllocator("test", IPPool{"10.0.0.0/29", "10.0.1.0/29"}, 31)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := map[netip.Addr]bool{
+		netip.MustParseAddr("10.0.0.1"): true,
+		netip.MustParseAddr("10.0.0.2"): true,
+		netip.MustParseAddr("10.0.0.7"): true,
+	}
+	isUsed := func(addr netip.Addr) bool { return used[addr] }
+
+	for _, test := range []struct {
+		start, block uint64
+		want         uint64
+		error        bool
+	}{
+		{start: 0, block: 1, want: 0},
+		{start: 1, block: 1, want: 3},
+		{start: 7, block: 1, want: 8},
+		{start: 0, block: 2, want: 2},
+		{start: 3, block: 2, want: 4},
+		{start: 8, block: 2, error: true},
+	} {
+		idx, err := alloc.nextFree(test.start, test.block, isUsed)
+		if test.error && err == nil {
+			t.Errorf("nextFree(%d, %d) expected error, got %d", test.start, test.block, idx)
+		}
+		if !test.error && (err != nil || idx != test.want) {
+			t.Errorf("nextFree(%d, %d) = %d, %v, want %d", test.start, test.block, idx, err, test.want)
+		}
+	}
+}
+
+func Test_IPAM_CheckPools(t *testing.T) {
+	data, err := (&Builder{
+		FabricMode:   meta.FabricModeSpineLeaf,
+		External:     true,
+		MCLAGServers: 2,
+		ESLAGServers: 2,
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Hydrate(data, DefaultHydrateConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := DefaultIPPlan(DefaultHydrateConfig().Subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipam, err := BuildIPAM(data, plan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.CheckPools(); err != nil {
+		t.Errorf("wiring hydrated with default plan doesn't match it: %v", err)
+	}
+
+	plan.Switch, plan.Protocol = plan.Protocol, plan.Switch
+	if ipam, err = BuildIPAM(data, plan, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.CheckPools(); err == nil {
+		t.Errorf("wiring hydrated with default plan matches plan with swapped pools")
+	}
+}
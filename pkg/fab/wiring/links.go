@@ -0,0 +1,163 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"strconv"
+	"strings"
+
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+)
+
+const (
+	LinkPurposeMCLAGPeer    = "mclag-peer"
+	LinkPurposeMCLAGSession = "mclag-session"
+
+	LinkDeviceExternal = "external" // device name for the far end of the external links
+)
+
+// LinkEnd is one end of the physical link
+type LinkEnd struct {
+	Device string
+	Port   string // local port name, e.g. E1/1
+	IP     string
+	MAC    string
+}
+
+func (e LinkEnd) String() string {
+	if e.Port == "" {
+		return e.Device
+	}
+
+	return e.Device + "/" + e.Port
+}
+
+// Link is a single physical cable of the connection
+type Link struct {
+	Connection string
+	Type       string // connection type, e.g. fabric or mclag
+	Purpose    string // same as type except for the MCLAG domain links that are mclag-peer or mclag-session
+	A, B       LinkEnd
+}
+
+// ConnectionLinks returns all physical links of the connection, server is always the A end for server links and
+// spine is always the A end for fabric links
+func ConnectionLinks(conn *wiringapi.Connection) []Link {
+	connType := ""
+	links := []Link{}
+	add := func(purpose string, a, b LinkEnd) {
+		if purpose == "" {
+			purpose = connType
+		}
+		links = append(links, Link{Connection: conn.Name, Type: connType, Purpose: purpose, A: a, B: b})
+	}
+	end := func(port wiringapi.BasePortName) LinkEnd {
+		return LinkEnd{Device: port.DeviceName(), Port: port.LocalPortName()}
+	}
+	serverLinks := func(ls []wiringapi.ServerToSwitchLink) {
+		for _, l := range ls {
+			add("", end(l.Server), end(l.Switch))
+		}
+	}
+	switchLinks := func(purpose string, ls []wiringapi.SwitchToSwitchLink) {
+		for _, l := range ls {
+			add(purpose, end(l.Switch1), end(l.Switch2))
+		}
+	}
+
+	spec := conn.Spec
+	switch {
+	case spec.Unbundled != nil:
+		connType = wiringapi.ConnectionTypeUnbundled
+		serverLinks([]wiringapi.ServerToSwitchLink{spec.Unbundled.Link})
+	case spec.Bundled != nil:
+		connType = wiringapi.ConnectionTypeBundled
+		serverLinks(spec.Bundled.Links)
+	case spec.MCLAG != nil:
+		connType = wiringapi.ConnectionTypeMCLAG
+		serverLinks(spec.MCLAG.Links)
+	case spec.ESLAG != nil:
+		connType = wiringapi.ConnectionTypeESLAG
+		serverLinks(spec.ESLAG.Links)
+	case spec.Management != nil:
+		connType = wiringapi.ConnectionTypeManagement
+		server, sw := end(spec.Management.Link.Server.BasePortName), end(spec.Management.Link.Switch.BasePortName)
+		server.IP, server.MAC = spec.Management.Link.Server.IP, spec.Management.Link.Server.MAC
+		sw.IP = spec.Management.Link.Switch.IP
+		add("", server, sw)
+	case spec.MCLAGDomain != nil:
+		connType = wiringapi.ConnectionTypeMCLAGDomain
+		switchLinks(LinkPurposeMCLAGPeer, spec.MCLAGDomain.PeerLinks)
+		switchLinks(LinkPurposeMCLAGSession, spec.MCLAGDomain.SessionLinks)
+	case spec.Fabric != nil:
+		connType = wiringapi.ConnectionTypeFabric
+		for _, l := range spec.Fabric.Links {
+			spine, leaf := end(l.Spine.BasePortName), end(l.Leaf.BasePortName)
+			spine.IP, leaf.IP = l.Spine.IP, l.Leaf.IP
+			add("", spine, leaf)
+		}
+	case spec.VPCLoopback != nil:
+		connType = wiringapi.ConnectionTypeVPCLoopback
+		switchLinks("", spec.VPCLoopback.Links)
+	case spec.External != nil:
+		connType = wiringapi.ConnectionTypeExternal
+		ext := LinkEnd{Device: LinkDeviceExternal}
+		if dest, exist := conn.Annotations[VirtualEdgeDest]; exist {
+			ext = end(wiringapi.BasePortName{Port: dest})
+		}
+		add("", end(spec.External.Link.Switch), ext)
+	case spec.StaticExternal != nil:
+		connType = wiringapi.ConnectionTypeStaticExternal
+		sw := end(spec.StaticExternal.Link.Switch.BasePortName)
+		sw.IP = spec.StaticExternal.Link.Switch.IP
+		add("", sw, LinkEnd{Device: LinkDeviceExternal, IP: spec.StaticExternal.Link.Switch.NextHop})
+	}
+
+	return links
+}
+
+// comparePorts compares port names naturally, so E1/2 goes before E1/10
+func comparePorts(a, b string) int {
+	for a != "" && b != "" {
+		aNum, aRest := cutNumber(a)
+		bNum, bRest := cutNumber(b)
+		if aNum != "" && bNum != "" {
+			an, _ := strconv.Atoi(aNum)
+			bn, _ := strconv.Atoi(bNum)
+			if an != bn {
+				return an - bn
+			}
+			a, b = aRest, bRest
+
+			continue
+		}
+
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+
+	return len(a) - len(b)
+}
+
+func cutNumber(s string) (string, string) {
+	idx := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if idx < 0 {
+		idx = len(s)
+	}
+
+	return s[:idx], s[idx:]
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"slices"
+	"testing"
+)
+
+func Test_comparePorts(t *testing.T) {
+	ports := []string{"E1/10", "M1", "E1/2", "E1/1/2", "E1/1", "E1/1/1", "enp2s10", "enp2s9"}
+	slices.SortFunc(ports, comparePorts)
+
+	want := []string{"E1/1", "E1/1/1", "E1/1/2", "E1/2", "E1/10", "M1", "enp2s9", "enp2s10"}
+	if !slices.Equal(ports, want) {
+		t.Errorf("got %v, want %v", ports, want)
+	}
+}
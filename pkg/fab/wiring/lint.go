@@ -0,0 +1,798 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.githedgehog.com/fabric/api/meta"
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1alpha2"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	LintFormatText = "text"
+	LintFormatJSON = "json" // SARIF 2.1.0
+)
+
+var LintFormats = []string{LintFormatText, LintFormatJSON}
+
+const (
+	LintLevelError   = "error"
+	LintLevelWarning = "warning"
+	LintLevelNote    = "note"
+)
+
+const (
+	LintRuleYAML              = "yaml"
+	LintRuleSchema            = "schema"
+	LintRuleDuplicateObject   = "duplicate-object"
+	LintRuleLoad              = "load"
+	LintRuleValidation        = "validation"
+	LintRuleNotHydrated       = "not-hydrated"
+	LintRuleUnknownReference  = "unknown-reference"
+	LintRulePortReuse         = "port-reuse"
+	LintRuleMCLAGAsymmetric   = "mclag-asymmetric"
+	LintRuleUnevenSpineLinks  = "uneven-spine-links"
+	LintRuleSingleHomed       = "single-homed"
+	LintRuleUnusedSwitchGroup = "unused-switch-group"
+	LintRuleMissingManagement = "missing-management"
+)
+
+type LintRule struct {
+	ID          string
+	Level       string // default level of the diagnostics
+	Description string
+}
+
+var LintRules = []LintRule{
+	{LintRuleYAML, LintLevelError, "File is not a valid YAML"},
+	{LintRuleSchema, LintLevelError, "Object doesn't match the API schema"},
+	{LintRuleDuplicateObject, LintLevelError, "Object with the same kind and name is defined more than once"},
+	{LintRuleLoad, LintLevelError, "Object is rejected by the wiring loader"},
+	{LintRuleValidation, LintLevelError, "Object or wiring is rejected by the fabric validation, install would fail"},
+	{LintRuleNotHydrated, LintLevelError, "Wiring is not hydrated, IPs and ASNs are missing"},
+	{LintRuleUnknownReference, LintLevelError, "Object references a device or group that doesn't exist"},
+	{LintRulePortReuse, LintLevelError, "Port is used by more than one link"},
+	{LintRuleMCLAGAsymmetric, LintLevelWarning, "MCLAG peers or links to them are not symmetric"},
+	{LintRuleUnevenSpineLinks, LintLevelWarning, "Leaf has different number of links to the spines of the fabric"},
+	{LintRuleSingleHomed, LintLevelWarning, "Server is attached to only some members of the redundancy group"},
+	{LintRuleUnusedSwitchGroup, LintLevelWarning, "Switch group isn't used by any switch"},
+	{LintRuleMissingManagement, LintLevelWarning, "Switch has no management link"},
+}
+
+// LintDiagnostic is a single problem found in the wiring, line and column are 1-based and zero if unknown
+type LintDiagnostic struct {
+	Rule    string
+	Level   string
+	Message string
+	File    string
+	Line    int
+	Column  int
+	Kind    string
+	Name    string
+}
+
+// lintIssue is a problem found in the loaded wiring that's mapped to the position in the file by the linter
+type lintIssue struct {
+	Rule    string
+	Level   string // rule default is used if empty
+	Kind    string
+	Name    string
+	Port    string // full port name to point to, e.g. leaf-01/E1/1
+	Message string
+}
+
+type lintPos struct {
+	Line   int
+	Column int
+}
+
+type lintObject struct {
+	pos   lintPos
+	ports map[string]lintPos // positions of the port names in the connection spec
+}
+
+type linter struct {
+	file    string
+	objects map[string]*lintObject // by kind/name
+	diags   []LintDiagnostic
+}
+
+// Lint checks the wiring file content and reports all problems at once: YAML and schema errors, objects rejected by
+// the loader or by the fabric validation, hydration and references problems and violations of the design rules,
+// fabric validation is skipped if fabric config isn't provided
+func Lint(ctx context.Context, file string, content []byte, fabricCfg *meta.FabricConfig) []LintDiagnostic {
+	l := &linter{
+		file:    file,
+		objects: map[string]*lintObject{},
+		diags:   []LintDiagnostic{},
+	}
+
+	if data := l.load(content); data != nil {
+		l.check(data)
+		if fabricCfg != nil {
+			l.validate(ctx, data, fabricCfg)
+		}
+	}
+
+	slices.SortStableFunc(l.diags, func(a, b LintDiagnostic) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+
+	return l.diags
+}
+
+func (l *linter) add(rule string, level string, pos lintPos, kind, name string, format string, args ...any) {
+	if level == "" {
+		for _, r := range LintRules {
+			if r.ID == rule {
+				level = r.Level
+			}
+		}
+	}
+
+	l.diags = append(l.diags, LintDiagnostic{
+		Rule:    rule,
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+		File:    l.file,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Kind:    kind,
+		Name:    name,
+	})
+}
+
+func (l *linter) issue(issue lintIssue) {
+	pos := lintPos{}
+	if obj, exist := l.objects[issue.Kind+"/"+issue.Name]; exist {
+		pos = obj.pos
+		if portPos, exist := obj.ports[issue.Port]; exist {
+			pos = portPos
+		}
+	}
+
+	l.add(issue.Rule, issue.Level, pos, issue.Kind, issue.Name, "%s", issue.Message)
+}
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// load parses all documents keeping positions of the objects and loads the ones that are valid
+func (l *linter) load(content []byte) *wiring.Data {
+	data, err := wiring.New()
+	if err != nil {
+		l.add(LintRuleLoad, "", lintPos{}, "", "", "error creating wiring data: %s", err)
+
+		return nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := &yaml.Node{}
+		if err := dec.Decode(doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			pos := lintPos{}
+			if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+				pos.Line, _ = strconv.Atoi(m[1])
+			}
+			l.add(LintRuleYAML, "", pos, "", "", "%s", err)
+
+			// nothing after the syntax error could be parsed
+			break
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		root := doc.Content[0]
+		pos := lintPos{Line: root.Line, Column: root.Column}
+		if root.Kind != yaml.MappingNode {
+			l.add(LintRuleSchema, "", pos, "", "", "document is not an object")
+
+			continue
+		}
+
+		kind, name := "", ""
+		if node := yamlLookup(root, "kind"); node != nil {
+			kind = node.Value
+		}
+		if node := yamlLookup(yamlLookup(root, "metadata"), "name"); node != nil {
+			name = node.Value
+			pos = lintPos{Line: node.Line, Column: node.Column}
+		}
+		if kind == "" {
+			l.add(LintRuleSchema, "", pos, "", name, "kind is not set")
+
+			continue
+		}
+		if name == "" {
+			l.add(LintRuleSchema, "", pos, kind, "", "%s has no name", kind)
+
+			continue
+		}
+
+		key := kind + "/" + name
+		if prev, exist := l.objects[key]; exist {
+			l.add(LintRuleDuplicateObject, "", pos, kind, name, "%s %s is already defined at line %d", kind, name, prev.pos.Line)
+
+			continue
+		}
+		obj := &lintObject{pos: pos, ports: map[string]lintPos{}}
+		l.objects[key] = obj
+		if kind == wiringapi.KindConnection {
+			yamlPorts(yamlLookup(root, "spec"), obj.ports)
+		}
+
+		// tenant objects are only checked against the schema as they aren't part of the wiring data
+		typed, tenant := newWiringObject(kind), false
+		if typed == nil {
+			typed, tenant = newTenantObject(kind), true
+		}
+		if typed == nil {
+			l.add(LintRuleSchema, "", pos, kind, name, "unsupported kind %q", kind)
+
+			continue
+		}
+		raw, err := yaml.Marshal(root)
+		if err != nil {
+			l.add(LintRuleSchema, "", pos, kind, name, "error marshaling %s %s: %s", kind, name, err)
+
+			continue
+		}
+		if err := kyaml.UnmarshalStrict(raw, typed); err != nil {
+			l.add(LintRuleSchema, "", pos, kind, name, "invalid %s %s: %s", kind, name, err)
+
+			continue
+		}
+		if tenant {
+			continue
+		}
+		if err := data.Add(typed); err != nil {
+			l.add(LintRuleLoad, "", pos, kind, name, "error adding %s %s: %s", kind, name, err)
+		}
+	}
+
+	return data
+}
+
+func newWiringObject(kind string) client.Object {
+	switch kind {
+	case wiringapi.KindSwitchGroup:
+		return &wiringapi.SwitchGroup{}
+	case wiringapi.KindSwitch:
+		return &wiringapi.Switch{}
+	case wiringapi.KindServer:
+		return &wiringapi.Server{}
+	case wiringapi.KindConnection:
+		return &wiringapi.Connection{}
+	case wiringapi.KindVLANNamespace:
+		return &wiringapi.VLANNamespace{}
+	case vpcapi.KindIPv4Namespace:
+		return &vpcapi.IPv4Namespace{}
+	case vpcapi.KindExternal:
+		return &vpcapi.External{}
+	case vpcapi.KindExternalAttachment:
+		return &vpcapi.ExternalAttachment{}
+	default:
+		return nil
+	}
+}
+
+func yamlLookup(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+
+	return nil
+}
+
+// yamlPorts collects positions of all port values in the node, only first one is kept for each port
+func yamlPorts(node *yaml.Node, ports map[string]lintPos) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yaml.MappingNode {
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			key, value := node.Content[idx], node.Content[idx+1]
+			if key.Value == "port" && value.Kind == yaml.ScalarNode {
+				if _, exist := ports[value.Value]; !exist {
+					ports[value.Value] = lintPos{Line: value.Line, Column: value.Column}
+				}
+			}
+		}
+	}
+	for _, child := range node.Content {
+		yamlPorts(child, ports)
+	}
+}
+
+func (l *linter) check(data *wiring.Data) {
+	for _, issue := range hydrationIssues(data) {
+		issue.Rule = LintRuleNotHydrated
+		l.issue(issue)
+	}
+
+	switches := map[string]*wiringapi.Switch{}
+	for _, sw := range data.Switch.All() {
+		switches[sw.Name] = sw
+	}
+	servers := map[string]*wiringapi.Server{}
+	for _, server := range data.Server.All() {
+		servers[server.Name] = server
+	}
+
+	links := []Link{}
+	used := map[string]string{}
+	for _, conn := range data.Connection.All() {
+		for _, link := range ConnectionLinks(conn) {
+			ends := []LinkEnd{link.A, link.B}
+			if link.Type == wiringapi.ConnectionTypeExternal || link.Type == wiringapi.ConnectionTypeStaticExternal {
+				ends = ends[:1]
+			}
+
+			valid := true
+			for _, end := range ends {
+				if switches[end.Device] == nil && servers[end.Device] == nil {
+					l.issue(lintIssue{
+						Rule: LintRuleUnknownReference, Kind: wiringapi.KindConnection, Name: conn.Name, Port: end.String(),
+						Message: fmt.Sprintf("connection %s references unknown device %s", conn.Name, end.Device),
+					})
+					valid = false
+
+					continue
+				}
+
+				port := end.String()
+				if other, exist := used[port]; exist {
+					msg := fmt.Sprintf("port %s is used by connections %s and %s", port, other, conn.Name)
+					if other == conn.Name {
+						msg = fmt.Sprintf("port %s is used more than once in connection %s", port, conn.Name)
+					}
+					l.issue(lintIssue{Rule: LintRulePortReuse, Kind: wiringapi.KindConnection, Name: conn.Name, Port: port, Message: msg})
+				} else {
+					used[port] = conn.Name
+				}
+			}
+			if valid {
+				links = append(links, link)
+			}
+		}
+	}
+
+	usedGroups := map[string]bool{}
+	for _, sw := range data.Switch.All() {
+		for _, group := range append(slices.Clone(sw.Spec.Groups), sw.Spec.Redundancy.Group) {
+			if group == "" {
+				continue
+			}
+			usedGroups[group] = true
+			if _, exist := l.objects[wiringapi.KindSwitchGroup+"/"+group]; !exist {
+				l.issue(lintIssue{
+					Rule: LintRuleUnknownReference, Kind: wiringapi.KindSwitch, Name: sw.Name,
+					Message: fmt.Sprintf("switch %s references unknown switch group %s", sw.Name, group),
+				})
+			}
+		}
+	}
+	for _, key := range sortedObjectKeys(l.objects, wiringapi.KindSwitchGroup) {
+		if !usedGroups[key] {
+			l.issue(lintIssue{
+				Rule: LintRuleUnusedSwitchGroup, Kind: wiringapi.KindSwitchGroup, Name: key,
+				Message: fmt.Sprintf("switch group %s isn't used by any switch", key),
+			})
+		}
+	}
+
+	l.checkDesign(data, links)
+}
+
+// lintValidator is implemented by the API objects validated by the fabric webhooks
+type lintValidator interface {
+	client.Object
+	Default()
+	Validate(ctx context.Context, kube client.Reader, fabricCfg *meta.FabricConfig) (admission.Warnings, error)
+}
+
+// validate runs the same validation as the fabric webhooks for each object and then for the whole wiring, the same
+// way it's done on install, fabric mode is taken from the wiring
+func (l *linter) validate(ctx context.Context, data *wiring.Data, fabricCfg *meta.FabricConfig) {
+	cfg := *fabricCfg
+	cfg.FabricMode = meta.FabricModeCollapsedCore
+	for _, sw := range data.Switch.All() {
+		if sw.Spec.Role.IsSpine() {
+			cfg.FabricMode = meta.FabricModeSpineLeaf
+		}
+	}
+
+	failed := false
+	for _, key := range sortedMapKeys(l.objects) {
+		kind, name, _ := strings.Cut(key, "/")
+		obj := wiringObject(data, kind, name)
+		if obj == nil {
+			continue // not loaded or not a wiring object
+		}
+		// defaulting is done on the copy to not change the loaded wiring
+		validator, ok := obj.DeepCopyObject().(lintValidator)
+		if !ok {
+			continue
+		}
+
+		validator.Default()
+		if _, err := validator.Validate(ctx, data.Native, &cfg); err != nil {
+			failed = true
+			l.issue(lintIssue{
+				Rule: LintRuleValidation, Kind: kind, Name: name,
+				Message: fmt.Sprintf("%s %s is invalid: %s", kind, name, err),
+			})
+		}
+	}
+
+	// whole wiring is only validated if all objects are valid as it stops on the first error
+	if failed {
+		return
+	}
+	if err := wiring.ValidateFabric(ctx, data.Native, &cfg); err != nil {
+		l.issue(lintValidationIssue(l.objects, err))
+	}
+}
+
+// lintValidationIssue returns the issue for the fabric validation error pointing to the object mentioned in it, the
+// longest name is used to not confuse e.g. leaf-1 and leaf-10
+func lintValidationIssue(objects map[string]*lintObject, err error) lintIssue {
+	msg := err.Error()
+	issue := lintIssue{Rule: LintRuleValidation, Message: "wiring is invalid: " + msg}
+	for _, key := range sortedMapKeys(objects) {
+		kind, name, _ := strings.Cut(key, "/")
+		if len(name) > len(issue.Name) && strings.Contains(msg, name) {
+			issue.Kind, issue.Name = kind, name
+		}
+	}
+
+	return issue
+}
+
+func sortedObjectKeys(objects map[string]*lintObject, kind string) []string {
+	res := []string{}
+	for key := range objects {
+		if name, ok := strings.CutPrefix(key, kind+"/"); ok {
+			res = append(res, name)
+		}
+	}
+	slices.Sort(res)
+
+	return res
+}
+
+// checkDesign checks the design rules that don't make the wiring invalid but are most probably mistakes
+func (l *linter) checkDesign(data *wiring.Data, links []Link) {
+	uplinks := map[string]map[string]int{} // leaf -> spine -> links
+	managed := map[string]bool{}
+	chained := false
+	connLinks := map[string][]Link{}
+	for _, link := range links {
+		switch link.Type {
+		case wiringapi.ConnectionTypeFabric:
+			if uplinks[link.B.Device] == nil {
+				uplinks[link.B.Device] = map[string]int{}
+			}
+			uplinks[link.B.Device][link.A.Device]++
+		case wiringapi.ConnectionTypeManagement:
+			managed[link.B.Device] = true
+			// front panel port is used if switches are chained to the control node
+			chained = chained || link.B.Port != "M1"
+		case wiringapi.ConnectionTypeMCLAG, wiringapi.ConnectionTypeESLAG:
+			connLinks[link.Connection] = append(connLinks[link.Connection], link)
+		}
+	}
+
+	total := func(sw string) int {
+		res := 0
+		for _, count := range uplinks[sw] {
+			res += count
+		}
+
+		return res
+	}
+
+	spines := []string{}
+	for _, sw := range data.Switch.All() {
+		if sw.Spec.Role.IsSpine() {
+			spines = append(spines, sw.Name)
+		}
+	}
+
+	members := map[string][]string{}
+	mclag := map[string]bool{}
+	for _, sw := range data.Switch.All() {
+		if sw.Spec.Redundancy.Group != "" {
+			members[sw.Spec.Redundancy.Group] = append(members[sw.Spec.Redundancy.Group], sw.Name)
+			mclag[sw.Spec.Redundancy.Group] = sw.Spec.Redundancy.Type == meta.RedundancyTypeMCLAG
+		}
+
+		// leaf is compared against all spines so missing links to some of them are reported as well
+		if sw.Spec.Role.IsLeaf() && len(spines) > 0 {
+			counts := []string{}
+			uneven := total(sw.Name) == 0
+			for _, spine := range spines {
+				counts = append(counts, fmt.Sprintf("%s=%d", spine, uplinks[sw.Name][spine]))
+				uneven = uneven || uplinks[sw.Name][spine] != uplinks[sw.Name][spines[0]]
+			}
+			if uneven {
+				l.issue(lintIssue{
+					Rule: LintRuleUnevenSpineLinks, Kind: wiringapi.KindSwitch, Name: sw.Name,
+					Message: fmt.Sprintf("leaf %s has uneven links to spines: %s", sw.Name, strings.Join(counts, ", ")),
+				})
+			}
+		}
+
+		if !managed[sw.Name] {
+			level := ""
+			if chained {
+				level = LintLevelNote
+			}
+			l.issue(lintIssue{
+				Rule: LintRuleMissingManagement, Level: level, Kind: wiringapi.KindSwitch, Name: sw.Name,
+				Message: fmt.Sprintf("switch %s has no management link, it's only reachable if control link chaining is used", sw.Name),
+			})
+		}
+	}
+
+	for _, group := range sortedMapKeys(members) {
+		if !mclag[group] {
+			continue
+		}
+		peers := members[group]
+		if len(peers) != 2 {
+			l.issue(lintIssue{
+				Rule: LintRuleMCLAGAsymmetric, Kind: wiringapi.KindSwitch, Name: peers[0],
+				Message: fmt.Sprintf("MCLAG redundancy group %s has %d switches, expected 2", group, len(peers)),
+			})
+
+			continue
+		}
+
+		sw1, sw2 := data.Switch.Get(peers[0]), data.Switch.Get(peers[1])
+		if sw1.Spec.Profile != sw2.Spec.Profile {
+			l.issue(lintIssue{
+				Rule: LintRuleMCLAGAsymmetric, Kind: wiringapi.KindSwitch, Name: sw2.Name,
+				Message: fmt.Sprintf("MCLAG peers %s and %s have different profiles: %s and %s", sw1.Name, sw2.Name, sw1.Spec.Profile, sw2.Spec.Profile),
+			})
+		}
+		if total(sw1.Name) != total(sw2.Name) {
+			l.issue(lintIssue{
+				Rule: LintRuleMCLAGAsymmetric, Kind: wiringapi.KindSwitch, Name: sw2.Name,
+				Message: fmt.Sprintf("MCLAG peers %s and %s have different number of spine links: %d and %d", sw1.Name, sw2.Name, total(sw1.Name), total(sw2.Name)),
+			})
+		}
+	}
+
+	for _, connName := range sortedMapKeys(connLinks) {
+		ls := connLinks[connName]
+		attached := map[string]int{}
+		for _, link := range ls {
+			attached[link.B.Device]++
+		}
+
+		groups := map[string]bool{}
+		for sw := range attached {
+			if group := data.Switch.Get(sw).Spec.Redundancy.Group; group != "" {
+				groups[group] = true
+			}
+		}
+		for _, group := range sortedMapKeys(groups) {
+			missing := []string{}
+			counts := []string{}
+			uneven := false
+			for _, member := range members[group] {
+				if attached[member] == 0 {
+					missing = append(missing, member)
+				}
+				counts = append(counts, fmt.Sprintf("%s=%d", member, attached[member]))
+				uneven = uneven || attached[member] != attached[members[group][0]]
+			}
+
+			if len(missing) > 0 {
+				l.issue(lintIssue{
+					Rule: LintRuleSingleHomed, Kind: wiringapi.KindConnection, Name: connName,
+					Message: fmt.Sprintf("server %s isn't attached to %s of redundancy group %s by connection %s",
+						ls[0].A.Device, strings.Join(missing, ", "), group, connName),
+				})
+			} else if uneven && mclag[group] {
+				l.issue(lintIssue{
+					Rule: LintRuleMCLAGAsymmetric, Kind: wiringapi.KindConnection, Name: connName,
+					Message: fmt.Sprintf("connection %s has uneven number of links to MCLAG peers: %s", connName, strings.Join(counts, ", ")),
+				})
+			}
+		}
+	}
+}
+
+func sortedMapKeys[V any](m map[string]V) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	slices.Sort(res)
+
+	return res
+}
+
+// WriteLint writes diagnostics in the format, see LintFormats
+func WriteLint(w io.Writer, format string, diags []LintDiagnostic) error {
+	switch format {
+	case LintFormatText:
+		counts := map[string]int{}
+		for _, d := range diags {
+			counts[d.Level]++
+			ref := ""
+			if d.Kind != "" && d.Name != "" {
+				ref = fmt.Sprintf(" (%s %s)", d.Kind, d.Name)
+			}
+			fmt.Fprintf(w, "%s:%d:%d: %s: %s [%s]%s\n", d.File, d.Line, d.Column, d.Level, d.Message, d.Rule, ref)
+		}
+		if len(diags) == 0 {
+			fmt.Fprintln(w, "No problems found")
+		} else {
+			fmt.Fprintf(w, "\n%d error(s), %d warning(s), %d note(s)\n", counts[LintLevelError], counts[LintLevelWarning], counts[LintLevelNote])
+		}
+
+		return nil
+	case LintFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return errors.Wrapf(enc.Encode(sarifLog(diags)), "error writing json")
+	default:
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(LintFormats, ", "))
+	}
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+	Region *sarifRegion `json:"region,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	Kind               string `json:"kind"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+func sarifLog(diags []LintDiagnostic) map[string]any {
+	rules := []sarifRule{}
+	for _, r := range LintRules {
+		rule := sarifRule{ID: r.ID, ShortDescription: sarifMessage{Text: r.Description}}
+		rule.DefaultConfiguration.Level = r.Level
+		rules = append(rules, rule)
+	}
+
+	results := []sarifResult{}
+	for _, d := range diags {
+		loc := sarifLocation{}
+		loc.PhysicalLocation.ArtifactLocation.URI = d.File
+		if d.Line > 0 {
+			loc.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+		}
+		if d.Kind != "" && d.Name != "" {
+			loc.LogicalLocations = []sarifLogicalLocation{{Name: d.Name, Kind: d.Kind, FullyQualifiedName: d.Kind + "/" + d.Name}}
+		}
+		results = append(results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     d.Level,
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{loc},
+		})
+	}
+
+	return map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []map[string]any{{
+			"tool": map[string]any{
+				"driver": map[string]any{
+					"name":  "hhfab-wiring-lint",
+					"rules": rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+}
+
+// LintPath lints the wiring file and writes diagnostics in the format to stdout, returns error if any errors found
+func LintPath(ctx context.Context, wiringPath string, format string, fabricCfg *meta.FabricConfig) error {
+	if wiringPath == "" {
+		return errors.Errorf("wiring path is not specified")
+	}
+	if !slices.Contains(LintFormats, format) {
+		return errors.Errorf("unknown format %q, supported: %s", format, strings.Join(LintFormats, ", "))
+	}
+
+	content, err := os.ReadFile(wiringPath)
+	if err != nil {
+		return errors.Wrapf(err, "error reading wiring %s", wiringPath)
+	}
+
+	diags := Lint(ctx, wiringPath, content, fabricCfg)
+	if err := WriteLint(os.Stdout, format, diags); err != nil {
+		return err
+	}
+
+	errs := 0
+	for _, d := range diags {
+		if d.Level == LintLevelError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return errors.Errorf("found %d error(s) in %s", errs, wiringPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const lintTestWiring = `apiVersion: wiring.githedgehog.com/v1alpha2
+kind: SwitchGroup
+metadata:
+  name: mclag-1
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: SwitchGroup
+metadata:
+  name: spare
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: spine-1
+spec:
+  role: spine
+  asn: 65100
+  ip: 172.30.10.200/32
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: spine-2
+spec:
+  role: spine
+  asn: 65100
+  ip: 172.30.10.201/32
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: leaf-1
+spec:
+  role: server-leaf
+  asn: 65101
+  ip: 172.30.10.100/32
+  groups:
+  - mclag-1
+  redundancy:
+    group: mclag-1
+    type: mclag
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: leaf-2
+spec:
+  role: server-leaf
+  asn: 65101
+  ip: 172.30.10.101/32
+  groups:
+  - mclag-2
+  redundancy:
+    group: mclag-1
+    type: mclag
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Server
+metadata:
+  name: server-1
+spec:
+  color: red
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Server
+metadata:
+  name: server-2
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Server
+metadata:
+  name: server-2
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Connection
+metadata:
+  name: spine-1--leaf-1--fabric
+spec:
+  fabric:
+    links:
+    - spine:
+        port: spine-1/E1/1
+        ip: 172.30.30.0/31
+      leaf:
+        port: leaf-1/E1/49
+        ip: 172.30.30.1/31
+    - spine:
+        port: spine-1/E1/2
+        ip: 172.30.30.2/31
+      leaf:
+        port: leaf-1/E1/50
+        ip: 172.30.30.3/31
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Connection
+metadata:
+  name: spine-2--leaf-1--fabric
+spec:
+  fabric:
+    links:
+    - spine:
+        port: spine-2/E1/1
+        ip: 172.30.30.4/31
+      leaf:
+        port: leaf-1/E1/51
+        ip: 172.30.30.5/31
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Connection
+metadata:
+  name: server-2--mclag--leaf-1--leaf-2
+spec:
+  mclag:
+    links:
+    - server:
+        port: server-2/enp2s1
+      switch:
+        port: leaf-1/E1/1
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Connection
+metadata:
+  name: server-3--unbundled--leaf-1
+spec:
+  unbundled:
+    link:
+      server:
+        port: server-3/enp2s1
+      switch:
+        port: leaf-1/E1/1
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Foo
+metadata:
+  name: foo
+`
+
+func Test_Lint(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "all-rules",
+			content: lintTestWiring,
+			want: []string{
+				"9:9 warning unused-switch-group SwitchGroup/spare",
+				"14:9 warning missing-management Switch/spine-1",
+				"23:9 warning missing-management Switch/spine-2",
+				"32:9 warning uneven-spine-links Switch/leaf-1",
+				"32:9 warning missing-management Switch/leaf-1",
+				"46:9 error unknown-reference Switch/leaf-2",
+				"46:9 warning uneven-spine-links Switch/leaf-2",
+				"46:9 warning missing-management Switch/leaf-2",
+				"46:9 warning mclag-asymmetric Switch/leaf-2",
+				"60:9 error schema Server/server-1",
+				"72:9 error duplicate-object Server/server-2",
+				"111:9 warning single-homed Connection/server-2--mclag--leaf-1--leaf-2",
+				"128:15 error unknown-reference Connection/server-3--unbundled--leaf-1",
+				"130:15 error port-reuse Connection/server-3--unbundled--leaf-1",
+				"135:9 error schema Foo/foo",
+			},
+		},
+		{
+			name:    "yaml-error",
+			content: "kind: Switch\nmetadata:\n  name: [leaf-1\n",
+			want:    []string{"2:0 error yaml /"},
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    []string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, d := range Lint(context.Background(), "wiring.yaml", []byte(tt.content), nil) {
+				got = append(got, fmt.Sprintf("%d:%d %s %s %s/%s", d.Line, d.Column, d.Level, d.Rule, d.Kind, d.Name))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Lint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_WriteLint_JSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteLint(buf, LintFormatJSON, Lint(context.Background(), "wiring.yaml", []byte(lintTestWiring), nil)); err != nil {
+		t.Fatalf("WriteLint() error = %v", err)
+	}
+
+	log := struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("WriteLint() produced invalid json: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 15 {
+		t.Fatalf("WriteLint() unexpected result: %+v", log)
+	}
+	if res := log.Runs[0].Results[0]; res.RuleID != LintRuleUnusedSwitchGroup || res.Locations[0].PhysicalLocation.Region.StartLine != 9 {
+		t.Errorf("WriteLint() unexpected first result: %+v", res)
+	}
+}
+
+func Test_Lint_UnevenSpineLinks(t *testing.T) {
+	diags := Lint(context.Background(), "wiring.yaml", []byte(lintTestWiring), nil)
+	got := map[string]string{}
+	for _, d := range diags {
+		if d.Rule == LintRuleUnevenSpineLinks {
+			got[d.Name] = d.Message
+		}
+	}
+
+	want := map[string]string{
+		"leaf-1": "leaf leaf-1 has uneven links to spines: spine-1=2, spine-2=1",
+		"leaf-2": "leaf leaf-2 has uneven links to spines: spine-1=0, spine-2=0",
+	}
+	if len(got) != len(want) || got["leaf-1"] != want["leaf-1"] || got["leaf-2"] != want["leaf-2"] {
+		t.Errorf("got uneven spine links %q, want %q", got, want)
+	}
+}
+
+func Test_lintValidationIssue(t *testing.T) {
+	objects := map[string]*lintObject{
+		"Switch/leaf-1":  {},
+		"Switch/leaf-10": {},
+		"Connection/server-1--unbundled--leaf-10": {},
+	}
+
+	for _, tt := range []struct {
+		err  string
+		kind string
+		name string
+	}{
+		{"switch leaf-10 has no ASN", "Switch", "leaf-10"},
+		{"switch leaf-1 has no ASN", "Switch", "leaf-1"},
+		{"connection server-1--unbundled--leaf-10 has invalid port", "Connection", "server-1--unbundled--leaf-10"},
+		{"fabric mode is not set", "", ""},
+	} {
+		issue := lintValidationIssue(objects, errors.New(tt.err))
+		if issue.Rule != LintRuleValidation || issue.Kind != tt.kind || issue.Name != tt.name || !strings.HasSuffix(issue.Message, tt.err) {
+			t.Errorf("lintValidationIssue(%q) = %+v, want %s/%s", tt.err, issue, tt.kind, tt.name)
+		}
+	}
+}
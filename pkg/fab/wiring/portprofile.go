@@ -0,0 +1,295 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.githedgehog.com/fabric/api/meta"
+)
+
+const (
+	PortRoleAny    = ""
+	PortRoleUplink = "uplink" // fabric, MCLAG session and peer, control and external links
+	PortRoleServer = "server" // server links and VPC loopbacks
+)
+
+var PortRoles = []string{PortRoleAny, PortRoleUplink, PortRoleServer}
+
+// SwitchPortProfile describes front panel ports of the switch model for the builder to allocate them, example:
+//
+//	name: lab-s5248
+//	ports:
+//	  - names: E1/1-48
+//	    speed: 25G
+//	    role: server
+//	  - names: E1/49-52
+//	    breakouts: [4x25G, 4x10G]
+//	    breakout: 4x25G
+//	    role: server
+//	  - names: E1/53-56
+//	    speed: 100G
+//	    breakouts: [4x25G, 4x10G]
+//	    role: uplink
+type SwitchPortProfile struct {
+	Name  string            `json:"name"` // profile name, it's set as the switch profile
+	Ports []SwitchPortGroup `json:"ports"`
+}
+
+// SwitchPortGroup is a single port or a range of ports with the same speed, breakouts and role
+type SwitchPortGroup struct {
+	Names     string   `json:"names"`               // port name or range, e.g. E1/55 or E1/1-48
+	Step      uint8    `json:"step,omitempty"`      // step for the range, 1 by default
+	Speed     string   `json:"speed,omitempty"`     // port speed to configure, switch default if empty
+	Breakouts []string `json:"breakouts,omitempty"` // supported breakout modes, e.g. 4x25G
+	Breakout  string   `json:"breakout,omitempty"`  // breakout mode to configure, sub-ports are allocated to servers only, e.g. E1/1/1-4
+	Role      string   `json:"role,omitempty"`      // uplink or server to reserve ports for them, any if empty
+}
+
+// VSPortProfile is the built-in profile for the virtual switch with the same ports as VLAB provides
+var VSPortProfile = SwitchPortProfile{
+	Name: meta.SwitchProfileVS,
+	Ports: []SwitchPortGroup{
+		{Names: "E1/1-48"},
+		{Names: "E1/49-73", Step: 4},
+	},
+}
+
+type profilePort struct {
+	name      string
+	speed     string
+	breakouts []string
+	role      string
+	parent    string // port the breakout is configured on, empty if not broken out
+	breakout  string // breakout mode of the parent port
+}
+
+// ports expands all port groups of the profile in order
+func (p *SwitchPortProfile) ports() ([]profilePort, error) {
+	if p.Name == "" {
+		return nil, errors.Errorf("name is required")
+	}
+
+	ports := []profilePort{}
+	seen := map[string]bool{}
+	for _, group := range p.Ports {
+		if !slices.Contains(PortRoles, group.Role) {
+			return nil, errors.Errorf("profile %s: unknown port role %q for %s", p.Name, group.Role, group.Names)
+		}
+
+		names, err := expandPortNames(group.Names, group.Step)
+		if err != nil {
+			return nil, errors.Wrapf(err, "profile %s", p.Name)
+		}
+
+		for _, name := range names {
+			if seen[name] {
+				return nil, errors.Errorf("profile %s: duplicate port %s", p.Name, name)
+			}
+			seen[name] = true
+
+			ports = append(ports, profilePort{name: name, speed: group.Speed, breakouts: group.Breakouts, role: group.Role})
+		}
+
+		if group.Breakout != "" {
+			breakouts := map[string]string{}
+			for _, name := range names {
+				breakouts[name] = group.Breakout
+			}
+			if ports, err = applyBreakouts(ports, breakouts); err != nil {
+				return nil, errors.Wrapf(err, "profile %s", p.Name)
+			}
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, errors.Errorf("profile %s: no ports", p.Name)
+	}
+
+	return ports, nil
+}
+
+// expandPortNames expands range in the last part of the port name, e.g. E1/1-4 to E1/1, E1/2, E1/3 and E1/4
+func expandPortNames(names string, step uint8) ([]string, error) {
+	prefix, last := "", names
+	if idx := strings.LastIndex(names, "/"); idx >= 0 {
+		prefix, last = names[:idx+1], names[idx+1:]
+	}
+
+	fromStr, toStr, isRange := strings.Cut(last, "-")
+	if !isRange {
+		if names == "" || step > 1 {
+			return nil, errors.Errorf("invalid port name %q", names)
+		}
+
+		return []string{names}, nil
+	}
+
+	from, err := strconv.ParseUint(fromStr, 10, 16)
+	if err != nil {
+		return nil, errors.Errorf("invalid port range %q", names)
+	}
+	to, err := strconv.ParseUint(toStr, 10, 16)
+	if err != nil || to < from {
+		return nil, errors.Errorf("invalid port range %q", names)
+	}
+
+	step = max(step, 1)
+	res := []string{}
+	for id := from; id <= to; id += uint64(step) {
+		res = append(res, fmt.Sprintf("%s%d", prefix, id))
+	}
+
+	return res, nil
+}
+
+// breakoutPorts returns sub-ports of the port for the breakout mode, e.g. E1/1/1-4 for E1/1 and 4x25G, the port itself
+// is returned for the single lane mode
+func breakoutPorts(name, mode string) ([]string, error) {
+	lanesStr, speed, ok := strings.Cut(mode, "x")
+	lanes, err := strconv.ParseUint(lanesStr, 10, 8)
+	if !ok || err != nil || !slices.Contains([]uint64{1, 2, 4, 8}, lanes) || parseSpeed(speed) == 0 {
+		return nil, errors.Errorf("invalid breakout mode %q for port %s", mode, name)
+	}
+	if lanes == 1 {
+		return []string{name}, nil
+	}
+
+	res := []string{}
+	for lane := uint64(1); lane <= lanes; lane++ {
+		res = append(res, fmt.Sprintf("%s/%d", name, lane))
+	}
+
+	return res, nil
+}
+
+// applyBreakouts replaces ports with their sub-ports according to the breakout modes by port name keeping the order,
+// breakout mode should be supported by the port if the profile lists any
+func applyBreakouts(ports []profilePort, breakouts map[string]string) ([]profilePort, error) {
+	res := []profilePort{}
+	found := map[string]bool{}
+	for _, port := range ports {
+		mode, exist := breakouts[port.name]
+		if !exist {
+			res = append(res, port)
+
+			continue
+		}
+
+		found[port.name] = true
+		if port.parent != "" {
+			return nil, errors.Errorf("port %s is already broken out", port.name)
+		}
+		if len(port.breakouts) > 0 && !slices.Contains(port.breakouts, mode) {
+			return nil, errors.Errorf("breakout mode %s isn't supported by port %s, supported: %s", mode, port.name,
+				strings.Join(port.breakouts, ", "))
+		}
+
+		names, err := breakoutPorts(port.name, mode)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			res = append(res, profilePort{name: name, breakouts: port.breakouts, role: port.role, parent: port.name, breakout: mode})
+		}
+	}
+
+	for _, name := range sortedMapKeys(breakouts) {
+		if !found[name] {
+			return nil, errors.Errorf("port %s for breakout not found", name)
+		}
+	}
+
+	return res, nil
+}
+
+// parseBreakouts parses comma separated port ranges with breakout modes, e.g. E1/1-4=4x25G,E1/5=2x50G, into the
+// breakout modes by port range
+func parseBreakouts(in string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, part := range strings.Split(in, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		names, mode, ok := strings.Cut(part, "=")
+		if !ok || names == "" || mode == "" {
+			return nil, errors.Errorf("invalid breakout %q, expected PORTS=MODE", part)
+		}
+		res[names] = mode
+	}
+
+	return res, nil
+}
+
+// expandBreakouts expands breakout modes by port range into the ones by port name
+func expandBreakouts(breakouts map[string]string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, names := range sortedMapKeys(breakouts) {
+		ports, err := expandPortNames(names, 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range ports {
+			if _, exist := res[port]; exist {
+				return nil, errors.Errorf("duplicate breakout for port %s", port)
+			}
+			res[port] = breakouts[names]
+		}
+	}
+
+	return res, nil
+}
+
+// switchPorts tracks ports allocated on the switch
+type switchPorts struct {
+	profile string
+	ports   []profilePort
+	used    []bool
+}
+
+// next allocates first free port for the role, ports reserved for other role are skipped and breakout sub-ports are
+// only used for servers
+func (s *switchPorts) next(role string) (profilePort, error) {
+	return s.alloc(role, role == PortRoleServer)
+}
+
+// alloc allocates first free port for the role, breakout sub-ports are skipped unless allowed
+func (s *switchPorts) alloc(role string, subPorts bool) (profilePort, error) {
+	for idx, port := range s.ports {
+		if s.used[idx] || (port.role != PortRoleAny && port.role != role) || (port.parent != "" && !subPorts) {
+			continue
+		}
+
+		s.used[idx] = true
+
+		return port, nil
+	}
+
+	kind := "free"
+	if role != PortRoleAny {
+		kind = "free " + role
+	}
+	if role == PortRoleServer && !subPorts {
+		kind += " non-breakout"
+	}
+
+	return profilePort{}, errors.Errorf("no %s ports left in profile %s", kind, s.profile)
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"strings"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+)
+
+func Test_switchPorts_next(t *testing.T) {
+	profile := SwitchPortProfile{Name: "test", Ports: []SwitchPortGroup{
+		{Names: "E1/1-2", Role: PortRoleServer},
+		{Names: "E1/3"},
+		{Names: "E1/4-8", Step: 4, Role: PortRoleUplink},
+	}}
+	ports, err := profile.ports()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sp := &switchPorts{profile: profile.Name, ports: ports, used: make([]bool, len(ports))}
+	for _, step := range []struct {
+		role string
+		port string
+	}{
+		{PortRoleUplink, "E1/3"},
+		{PortRoleServer, "E1/1"},
+		{PortRoleUplink, "E1/4"},
+		{PortRoleUplink, "E1/8"},
+		{PortRoleUplink, ""},
+		{PortRoleServer, "E1/2"},
+		{PortRoleServer, ""},
+	} {
+		port, err := sp.next(step.role)
+		if step.port == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got port %s", step.role, port.name)
+			}
+
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if port.name != step.port {
+			t.Errorf("%s: got port %s, want %s", step.role, port.name, step.port)
+		}
+	}
+}
+
+func Test_switchPorts_next_breakout(t *testing.T) {
+	profile := SwitchPortProfile{Name: "test", Ports: []SwitchPortGroup{
+		{Names: "E1/1", Breakout: "2x50G"},
+		{Names: "E1/2"},
+	}}
+	ports, err := profile.ports()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sp := &switchPorts{profile: profile.Name, ports: ports, used: make([]bool, len(ports))}
+	if port, err := sp.next(PortRoleUplink); err != nil || port.name != "E1/2" {
+		t.Errorf("uplink: got port %s (%v), want E1/2 as sub-ports are only for servers", port.name, err)
+	}
+	if port, err := sp.next(PortRoleServer); err != nil || port.name != "E1/1/1" {
+		t.Errorf("server: got port %s (%v), want E1/1/1", port.name, err)
+	}
+	if port, err := sp.next(PortRoleUplink); err == nil {
+		t.Errorf("uplink: expected error, got port %s", port.name)
+	}
+
+	sp = &switchPorts{profile: profile.Name, ports: ports, used: make([]bool, len(ports))}
+	if port, err := sp.alloc(PortRoleServer, false); err != nil || port.name != "E1/2" {
+		t.Errorf("loopback: got port %s (%v), want E1/2 as loopbacks don't use sub-ports", port.name, err)
+	}
+	if port, err := sp.alloc(PortRoleServer, false); err == nil {
+		t.Errorf("loopback: expected error, got port %s", port.name)
+	}
+}
+
+func Test_applyBreakouts(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		groups    []SwitchPortGroup
+		breakouts map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:   "profile",
+			groups: []SwitchPortGroup{{Names: "E1/1-2", Breakouts: []string{"4x25G"}, Breakout: "4x25G"}, {Names: "E1/3"}},
+			want:   "E1/1/1 E1/1/2 E1/1/3 E1/1/4 E1/2/1 E1/2/2 E1/2/3 E1/2/4 E1/3",
+		},
+		{
+			name:      "override",
+			groups:    []SwitchPortGroup{{Names: "E1/1-3"}},
+			breakouts: map[string]string{"E1/2": "2x50G", "E1/3": "1x100G"},
+			want:      "E1/1 E1/2/1 E1/2/2 E1/3",
+		},
+		{
+			name:      "unsupported",
+			groups:    []SwitchPortGroup{{Names: "E1/1", Breakouts: []string{"4x25G"}}},
+			breakouts: map[string]string{"E1/1": "4x10G"},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid",
+			groups:    []SwitchPortGroup{{Names: "E1/1"}},
+			breakouts: map[string]string{"E1/1": "3x25G"},
+			wantErr:   true,
+		},
+		{
+			name:      "twice",
+			groups:    []SwitchPortGroup{{Names: "E1/1", Breakout: "4x25G"}},
+			breakouts: map[string]string{"E1/1": "4x25G"},
+			wantErr:   true,
+		},
+		{
+			name:      "not-found",
+			groups:    []SwitchPortGroup{{Names: "E1/1"}},
+			breakouts: map[string]string{"E1/2": "4x25G"},
+			wantErr:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := SwitchPortProfile{Name: "test", Ports: tt.groups}
+			ports, err := profile.ports()
+			if err == nil && tt.breakouts != nil {
+				ports, err = applyBreakouts(ports, tt.breakouts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyBreakouts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			names := []string{}
+			for _, port := range ports {
+				names = append(names, port.name)
+			}
+			if got := strings.Join(names, " "); !tt.wantErr && got != tt.want {
+				t.Errorf("applyBreakouts() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Builder_VPCLoopbacksSkipBreakouts(t *testing.T) {
+	data, err := (&Builder{
+		FabricMode:    meta.FabricModeSpineLeaf,
+		VPCLoopbacks:  2,
+		LeafBreakouts: "E1/1-8=4x25G",
+	}).Build()
+	if err != nil {
+		t.Fatalf("error building wiring: %v", err)
+	}
+
+	loopbacks := 0
+	for _, conn := range data.Connection.All() {
+		if conn.Spec.VPCLoopback == nil {
+			continue
+		}
+		for _, link := range conn.Spec.VPCLoopback.Links {
+			loopbacks++
+			for _, port := range []string{link.Switch1.LocalPortName(), link.Switch2.LocalPortName()} {
+				if strings.Count(port, "/") > 1 {
+					t.Errorf("connection %s: VPC loopback uses breakout sub-port %s", conn.Name, port)
+				}
+			}
+		}
+	}
+	if loopbacks == 0 {
+		t.Errorf("expected VPC loopbacks to be generated")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	agentapi "go.githedgehog.com/fabric/api/agent/v1alpha2"
+	"go.githedgehog.com/fabric/api/meta"
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1alpha2"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	agentctrl "go.githedgehog.com/fabric/pkg/ctrl/agent"
+	"go.githedgehog.com/fabric/pkg/manager/librarian"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// RenderAgent builds the Agent for the switch offline by running the fabric controller Agent reconciler against the
+// in-memory API loaded with the wiring and tenants, wiring should be hydrated
+func RenderAgent(ctx context.Context, data *wiring.Data, tenants *Tenants, fabricCfg *meta.FabricConfig, name string) (*agentapi.Agent, error) {
+	sw := data.Switch.Get(name)
+	if sw == nil {
+		return nil, errors.Errorf("switch %s not found", name)
+	}
+	if sw.Spec.Role.IsVirtualEdge() {
+		return nil, errors.Errorf("switch %s is a virtual edge and isn't configured by the fabric", name)
+	}
+	if tenants == nil {
+		tenants = &Tenants{}
+	}
+
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme, wiringapi.AddToScheme, vpcapi.AddToScheme, agentapi.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			return nil, errors.Wrapf(err, "error adding to scheme")
+		}
+	}
+
+	objs := []client.Object{}
+	for _, kind := range applyKinds {
+		objs = append(objs, wiringObjects(data, kind)...)
+	}
+	for _, obj := range data.IPv4Namespace.All() {
+		objs = append(objs, obj)
+	}
+	for _, obj := range data.External.All() {
+		objs = append(objs, obj)
+	}
+	for _, obj := range data.ExternalAttachment.All() {
+		objs = append(objs, obj)
+	}
+	objs = append(objs, tenants.Objects()...)
+
+	kube := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&agentapi.Agent{}).Build()
+	for _, obj := range objs {
+		obj = obj.DeepCopyObject().(client.Object)
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(metav1.NamespaceDefault)
+		}
+		if err := kube.Create(ctx, obj); err != nil {
+			return nil, errors.Wrapf(err, "error creating %s %s", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName())
+		}
+	}
+
+	key := types.NamespacedName{Namespace: metav1.NamespaceDefault, Name: name}
+	reconciler := &agentctrl.AgentReconciler{
+		Client:  kube,
+		Scheme:  scheme,
+		Cfg:     fabricCfg,
+		LibMngr: librarian.NewLibrarianManager(fabricCfg),
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		return nil, errors.Wrapf(err, "error reconciling agent")
+	}
+
+	agent := &agentapi.Agent{}
+	if err := kube.Get(ctx, key, agent); err != nil {
+		return nil, errors.Wrapf(err, "error getting agent built by the controller")
+	}
+
+	return agent, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"context"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RenderAgent(t *testing.T) {
+	ctx := context.Background()
+	data := diffTestData(t, 65101, "leaf-1/E1/1", "172.30.30.1/31", nil)
+	tenants := &Tenants{
+		VPCs: []*vpcapi.VPC{{
+			ObjectMeta: metav1.ObjectMeta{Name: "vpc-1"},
+			Spec: vpcapi.VPCSpec{Subnets: map[string]*vpcapi.VPCSubnet{
+				"default": {Subnet: "10.0.1.0/24", VLAN: 1001},
+			}},
+		}},
+		Attachments: []*vpcapi.VPCAttachment{{
+			ObjectMeta: metav1.ObjectMeta{Name: "server-1--leaf-1--unbundled--vpc-1--default"},
+			Spec:       vpcapi.VPCAttachmentSpec{Subnet: "vpc-1/default", Connection: "server-1--leaf-1--unbundled"},
+		}},
+	}
+	fabricCfg := &meta.FabricConfig{ControlVIP: "172.30.1.1/32", FabricMTU: 9100, ServerFacingMTUOffset: 64}
+
+	agent, err := RenderAgent(ctx, data, tenants, fabricCfg, "leaf-1")
+	if err != nil {
+		t.Fatalf("RenderAgent() error = %v", err)
+	}
+
+	if agent.Name != "leaf-1" {
+		t.Errorf("expected agent leaf-1, got %s", agent.Name)
+	}
+	if agent.Spec.Switch.ASN != 65101 || agent.Spec.Switch.Role != data.Switch.Get("leaf-1").Spec.Role {
+		t.Errorf("expected agent for the leaf-1 switch spec, got %+v", agent.Spec.Switch)
+	}
+	for _, name := range []string{"spine-1--leaf-1--fabric", "server-1--leaf-1--unbundled"} {
+		if _, exist := agent.Spec.Connections[name]; !exist {
+			t.Errorf("expected connection %s in the agent spec, got %v", name, agent.Spec.Connections)
+		}
+	}
+
+	if _, err := RenderAgent(ctx, data, nil, fabricCfg, "leaf-3"); err == nil {
+		t.Errorf("expected error for unknown switch")
+	}
+}
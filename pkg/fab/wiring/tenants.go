@@ -0,0 +1,397 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	vpcapi "go.githedgehog.com/fabric/api/vpc/v1alpha2"
+	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
+	"go.githedgehog.com/fabric/pkg/wiring"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	TenantsNone         = "none"
+	TenantsPerServer    = "per-server"     // VPC per server with a single subnet
+	TenantsPerLeafGroup = "per-leaf-group" // VPC per redundancy group or orphan leaf with all its servers in a single subnet
+	TenantsShared       = "shared"         // single VPC with subnet per server
+
+	tenantsVLANStart = 1000 // first VLAN of the default VLAN namespace
+)
+
+var TenantsPatterns = []string{TenantsNone, TenantsPerServer, TenantsPerLeafGroup, TenantsShared}
+
+// Tenants are the VPC objects generated for the wiring, they aren't part of the wiring data and only written next to it
+type Tenants struct {
+	VPCs             []*vpcapi.VPC
+	Attachments      []*vpcapi.VPCAttachment
+	Peerings         []*vpcapi.VPCPeering
+	ExternalPeerings []*vpcapi.ExternalPeering
+}
+
+func (t *Tenants) Objects() []client.Object {
+	objs := []client.Object{}
+	for _, vpc := range t.VPCs {
+		objs = append(objs, vpc)
+	}
+	for _, attach := range t.Attachments {
+		objs = append(objs, attach)
+	}
+	for _, peering := range t.Peerings {
+		objs = append(objs, peering)
+	}
+	for _, peering := range t.ExternalPeerings {
+		objs = append(objs, peering)
+	}
+
+	return objs
+}
+
+// Append adds all objects of the other tenants
+func (t *Tenants) Append(other *Tenants) {
+	for _, obj := range other.Objects() {
+		t.add(obj)
+	}
+}
+
+func (t *Tenants) add(obj client.Object) {
+	switch obj := obj.(type) {
+	case *vpcapi.VPC:
+		t.VPCs = append(t.VPCs, obj)
+	case *vpcapi.VPCAttachment:
+		t.Attachments = append(t.Attachments, obj)
+	case *vpcapi.VPCPeering:
+		t.Peerings = append(t.Peerings, obj)
+	case *vpcapi.ExternalPeering:
+		t.ExternalPeerings = append(t.ExternalPeerings, obj)
+	}
+}
+
+func newTenantObject(kind string) client.Object {
+	switch kind {
+	case vpcapi.KindVPC:
+		return &vpcapi.VPC{}
+	case vpcapi.KindVPCAttachment:
+		return &vpcapi.VPCAttachment{}
+	case vpcapi.KindVPCPeering:
+		return &vpcapi.VPCPeering{}
+	case vpcapi.KindExternalPeering:
+		return &vpcapi.ExternalPeering{}
+	default:
+		return nil
+	}
+}
+
+// Write writes tenant objects as YAML documents, each of them starts with the separator so they could be appended to
+// the wiring data
+func (t *Tenants) Write(w io.Writer) error {
+	for _, obj := range t.Objects() {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling %s", obj.GetName())
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return errors.Wrapf(err, "error writing %s", obj.GetName())
+		}
+	}
+
+	return nil
+}
+
+// SaveTo writes tenant objects to the file, the file is removed if there are no objects
+func (t *Tenants) SaveTo(path string) error {
+	if len(t.Objects()) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "error removing %s", path)
+		}
+
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := t.Write(buf); err != nil {
+		return err
+	}
+
+	return errors.Wrapf(os.WriteFile(path, buf.Bytes(), 0o644), "error writing %s", path)
+}
+
+// LoadTenants loads tenant objects from the file, missing file means no tenants
+func LoadTenants(path string) (*Tenants, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Tenants{}, nil
+	}
+
+	data, err := wiring.New()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating wiring data")
+	}
+
+	return LoadWiring(path, data)
+}
+
+// tenantServer is a server with all its connections to the leafs
+type tenantServer struct {
+	name  string
+	group string // redundancy group or leaf name for the orphan leafs
+	conns []string
+}
+
+// BuildTenants generates VPCs with attachments for all non-control servers using the pattern, consecutive VPCs are
+// peered with each other and the first VPC is peered with all externals
+func BuildTenants(data *wiring.Data, pattern string) (*Tenants, error) {
+	if !slices.Contains(TenantsPatterns, pattern) {
+		return nil, errors.Errorf("unknown tenants pattern %q, supported: %s", pattern, strings.Join(TenantsPatterns, ", "))
+	}
+
+	res := &Tenants{}
+	if pattern == TenantsNone {
+		return res, nil
+	}
+
+	servers := map[string]*tenantServer{}
+	for _, conn := range data.Connection.All() {
+		var links []wiringapi.ServerToSwitchLink
+		switch {
+		case conn.Spec.Unbundled != nil:
+			links = []wiringapi.ServerToSwitchLink{conn.Spec.Unbundled.Link}
+		case conn.Spec.Bundled != nil:
+			links = conn.Spec.Bundled.Links
+		case conn.Spec.MCLAG != nil:
+			links = conn.Spec.MCLAG.Links
+		case conn.Spec.ESLAG != nil:
+			links = conn.Spec.ESLAG.Links
+		}
+		if len(links) == 0 {
+			continue
+		}
+
+		name := links[0].Server.DeviceName()
+		if server := data.Server.Get(name); server == nil || server.IsControl() {
+			continue
+		}
+		if servers[name] == nil {
+			group := links[0].Switch.DeviceName()
+			if sw := data.Switch.Get(group); sw != nil && sw.Spec.Redundancy.Group != "" {
+				group = sw.Spec.Redundancy.Group
+			}
+			servers[name] = &tenantServer{name: name, group: group}
+		}
+		servers[name].conns = append(servers[name].conns, conn.Name)
+	}
+
+	subnetID := 0
+	nextSubnet := func() (*vpcapi.VPCSubnet, error) {
+		subnetID++
+		if subnetID > 255 {
+			return nil, errors.Errorf("too many VPC subnets, only 255 fit into the default IPv4 namespace")
+		}
+
+		return &vpcapi.VPCSubnet{
+			Subnet: fmt.Sprintf("10.0.%d.0/24", subnetID),
+			VLAN:   uint16(tenantsVLANStart + subnetID), //nolint:gosec
+			DHCP: vpcapi.VPCDHCP{
+				Enable: true,
+				Range:  &vpcapi.VPCDHCPRange{Start: fmt.Sprintf("10.0.%d.10", subnetID)},
+			},
+		}, nil
+	}
+	newVPC := func() *vpcapi.VPC {
+		vpc := &vpcapi.VPC{
+			TypeMeta:   metav1.TypeMeta{Kind: vpcapi.KindVPC, APIVersion: vpcapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("vpc-%d", len(res.VPCs)+1)},
+			Spec: vpcapi.VPCSpec{
+				IPv4Namespace: "default",
+				VLANNamespace: "default",
+				Subnets:       map[string]*vpcapi.VPCSubnet{},
+			},
+		}
+		res.VPCs = append(res.VPCs, vpc)
+
+		return vpc
+	}
+	attach := func(vpc *vpcapi.VPC, subnet string, server *tenantServer) {
+		for _, conn := range server.conns {
+			res.Attachments = append(res.Attachments, &vpcapi.VPCAttachment{
+				TypeMeta:   metav1.TypeMeta{Kind: vpcapi.KindVPCAttachment, APIVersion: vpcapi.GroupVersion.String()},
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s--%s", vpc.Name, conn)},
+				Spec: vpcapi.VPCAttachmentSpec{
+					Subnet:     vpc.Name + "/" + subnet,
+					Connection: conn,
+				},
+			})
+		}
+	}
+
+	// servers and groups are sorted naturally, so server-2 goes before server-10
+	serverNames := sortedMapKeys(servers)
+	slices.SortFunc(serverNames, comparePorts)
+
+	switch pattern {
+	case TenantsPerServer:
+		for _, name := range serverNames {
+			subnet, err := nextSubnet()
+			if err != nil {
+				return nil, err
+			}
+			vpc := newVPC()
+			vpc.Spec.Subnets["default"] = subnet
+			attach(vpc, "default", servers[name])
+		}
+	case TenantsPerLeafGroup:
+		groups := map[string][]*tenantServer{}
+		groupNames := []string{}
+		for _, name := range serverNames {
+			if _, exist := groups[servers[name].group]; !exist {
+				groupNames = append(groupNames, servers[name].group)
+			}
+			groups[servers[name].group] = append(groups[servers[name].group], servers[name])
+		}
+		slices.SortFunc(groupNames, comparePorts)
+		for _, group := range groupNames {
+			subnet, err := nextSubnet()
+			if err != nil {
+				return nil, err
+			}
+			vpc := newVPC()
+			vpc.Spec.Subnets["default"] = subnet
+			for _, server := range groups[group] {
+				attach(vpc, "default", server)
+			}
+		}
+	case TenantsShared:
+		vpc := newVPC()
+		for idx, name := range serverNames {
+			subnet, err := nextSubnet()
+			if err != nil {
+				return nil, err
+			}
+			subnetName := fmt.Sprintf("subnet-%d", idx+1)
+			vpc.Spec.Subnets[subnetName] = subnet
+			attach(vpc, subnetName, servers[name])
+		}
+	}
+
+	for idx := 1; idx < len(res.VPCs); idx++ {
+		vpc1, vpc2 := res.VPCs[idx-1].Name, res.VPCs[idx].Name
+		res.Peerings = append(res.Peerings, &vpcapi.VPCPeering{
+			TypeMeta:   metav1.TypeMeta{Kind: vpcapi.KindVPCPeering, APIVersion: vpcapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s--%s", vpc1, vpc2)},
+			Spec: vpcapi.VPCPeeringSpec{
+				Permit: []map[string]vpcapi.VPCPeer{{vpc1: {}, vpc2: {}}},
+			},
+		})
+	}
+
+	if len(res.VPCs) == 0 {
+		return res, nil
+	}
+	vpc := res.VPCs[0]
+	for _, ext := range tenantExternals(data) {
+		res.ExternalPeerings = append(res.ExternalPeerings, &vpcapi.ExternalPeering{
+			TypeMeta:   metav1.TypeMeta{Kind: vpcapi.KindExternalPeering, APIVersion: vpcapi.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s--%s", vpc.Name, ext)},
+			Spec: vpcapi.ExternalPeeringSpec{
+				Permit: vpcapi.ExternalPeeringSpecPermit{
+					VPC: vpcapi.ExternalPeeringSpecVPC{
+						Name:    vpc.Name,
+						Subnets: sortedMapKeys(vpc.Spec.Subnets),
+					},
+					External: vpcapi.ExternalPeeringSpecExternal{
+						Name:     ext,
+						Prefixes: []vpcapi.ExternalPeeringSpecPrefix{{Prefix: "0.0.0.0/0"}},
+					},
+				},
+			},
+		})
+	}
+
+	return res, nil
+}
+
+// tenantExternals returns names of the externals, for not yet hydrated wiring they're the ones hydration will create
+// for the virtual edges
+func tenantExternals(data *wiring.Data) []string {
+	names := []string{}
+	for _, ext := range data.External.All() {
+		names = append(names, ext.Name)
+	}
+	if len(names) > 0 {
+		return names
+	}
+
+	edges := []string{}
+	for _, sw := range data.Switch.All() {
+		if sw.Spec.Role.IsVirtualEdge() {
+			edges = append(edges, sw.Name)
+		}
+	}
+	for _, edge := range edges {
+		names = append(names, virtualEdgeExternalName(edge, len(edges)))
+	}
+
+	return names
+}
+
+var yamlDocSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// LoadWiring loads wiring data from the file skipping the tenant objects that are returned separately
+func LoadWiring(path string, data *wiring.Data) (*Tenants, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+
+	tenants := &Tenants{}
+	wiringObjs := []client.Object{}
+	for _, doc := range yamlDocSeparator.Split(string(content), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		meta := &metav1.TypeMeta{}
+		if err := yaml.Unmarshal([]byte(doc), meta); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", path)
+		}
+
+		obj, tenant := newTenantObject(meta.Kind), true
+		if obj == nil {
+			if obj, tenant = newWiringObject(meta.Kind), false; obj == nil {
+				return nil, errors.Errorf("unsupported kind %q in %s", meta.Kind, path)
+			}
+		}
+		if err := yaml.UnmarshalStrict([]byte(doc), obj); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s in %s", meta.Kind, path)
+		}
+
+		if tenant {
+			tenants.add(obj)
+		} else {
+			wiringObjs = append(wiringObjs, obj)
+		}
+	}
+
+	return tenants, errors.Wrapf(data.Add(wiringObjs...), "error adding wiring objects")
+}
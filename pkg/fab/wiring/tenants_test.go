@@ -0,0 +1,143 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+	"go.githedgehog.com/fabric/pkg/wiring"
+)
+
+func Test_BuildTenants(t *testing.T) {
+	data, err := (&Builder{
+		FabricMode:       meta.FabricModeSpineLeaf,
+		External:         true,
+		MCLAGServers:     2,
+		ESLAGServers:     2,
+		UnbundledServers: 1,
+		BundledServers:   1,
+	}).Build()
+	if err != nil {
+		t.Fatalf("error building wiring: %v", err)
+	}
+
+	for _, tt := range []struct {
+		pattern          string
+		vpcs             int
+		attachments      int
+		peerings         int
+		externalPeerings int
+	}{
+		{pattern: TenantsNone},
+		{pattern: TenantsPerServer, vpcs: 10, attachments: 10, peerings: 9, externalPeerings: 1},
+		{pattern: TenantsPerLeafGroup, vpcs: 3, attachments: 10, peerings: 2, externalPeerings: 1},
+		{pattern: TenantsShared, vpcs: 1, attachments: 10, externalPeerings: 1},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			tenants, err := BuildTenants(data, tt.pattern)
+			if err != nil {
+				t.Fatalf("BuildTenants() error = %v", err)
+			}
+			if len(tenants.VPCs) != tt.vpcs || len(tenants.Attachments) != tt.attachments ||
+				len(tenants.Peerings) != tt.peerings || len(tenants.ExternalPeerings) != tt.externalPeerings {
+				t.Errorf("expected %d VPCs, %d attachments, %d peerings and %d external peerings, got %d, %d, %d and %d",
+					tt.vpcs, tt.attachments, tt.peerings, tt.externalPeerings,
+					len(tenants.VPCs), len(tenants.Attachments), len(tenants.Peerings), len(tenants.ExternalPeerings))
+			}
+		})
+	}
+
+	t.Run("load", func(t *testing.T) {
+		tenants, err := BuildTenants(data, TenantsPerLeafGroup)
+		if err != nil {
+			t.Fatalf("BuildTenants() error = %v", err)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := data.Write(buf); err != nil {
+			t.Fatalf("error writing wiring: %v", err)
+		}
+		if err := tenants.Write(buf); err != nil {
+			t.Fatalf("error writing tenants: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), "wiring.yaml")
+		if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+
+		loaded, err := wiring.New()
+		if err != nil {
+			t.Fatalf("error creating wiring data: %v", err)
+		}
+		loadedTenants, err := LoadWiring(path, loaded)
+		if err != nil {
+			t.Fatalf("LoadWiring() error = %v", err)
+		}
+		if len(loaded.Switch.All()) != len(data.Switch.All()) {
+			t.Errorf("expected %d switches, got %d", len(data.Switch.All()), len(loaded.Switch.All()))
+		}
+		if len(loadedTenants.Objects()) != len(tenants.Objects()) {
+			t.Errorf("expected %d tenant objects, got %d", len(tenants.Objects()), len(loadedTenants.Objects()))
+		}
+	})
+}
+
+func Test_Builder_Tenants(t *testing.T) {
+	b := &Builder{
+		FabricMode:       meta.FabricModeSpineLeaf,
+		MCLAGServers:     2,
+		UnbundledServers: 1,
+		TenantsPattern:   TenantsPerServer,
+	}
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("error building wiring: %v", err)
+	}
+
+	tenants := b.Tenants()
+	if len(tenants.VPCs) == 0 || len(tenants.VPCs) != len(tenants.Attachments) {
+		t.Fatalf("expected a VPC and an attachment per server, got %d and %d", len(tenants.VPCs), len(tenants.Attachments))
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tenants.yaml")
+	if err := tenants.SaveTo(path); err != nil {
+		t.Fatalf("SaveTo() error = %v", err)
+	}
+	loaded, err := LoadTenants(path)
+	if err != nil {
+		t.Fatalf("LoadTenants() error = %v", err)
+	}
+	if len(loaded.Objects()) != len(tenants.Objects()) {
+		t.Errorf("expected %d tenant objects, got %d", len(tenants.Objects()), len(loaded.Objects()))
+	}
+
+	if err := (&Tenants{}).SaveTo(path); err != nil {
+		t.Fatalf("SaveTo() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected empty tenants to remove %s, got %v", path, err)
+	}
+	loaded, err = LoadTenants(path)
+	if err != nil {
+		t.Fatalf("LoadTenants() error = %v", err)
+	}
+	if len(loaded.Objects()) != 0 {
+		t.Errorf("expected no tenant objects, got %d", len(loaded.Objects()))
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/pkg/errors"
+	"go.githedgehog.com/fabric/api/meta"
+	"sigs.k8s.io/yaml"
+)
+
+// Topology is a declarative description of the fabric the Builder generates wiring from. Example:
+//
+//	fabricMode: spine-leaf
+//	spines: 2
+//	fabricLinks: 2
+//	leafGroups:
+//	  - redundancy: mclag
+//	    count: 2
+//	    servers: {mclag: 4, unbundled: 1, bundled: 1}
+//	  - redundancy: eslag
+//	    leafs: 4
+//	    servers: {eslag: 2, eslagLinks: 2}
+//	  - leafs: 2
+//	    servers: {unbundled: 2}
+//	externals:
+//	  - leaf: leaf-10
+//
+// Leaf groups could be described per rack instead, leafs, servers and switch groups are named after the rack then,
+// e.g. rack-2-leaf-1, rack-2-server-1 and rack-2-mclag-1, spines are named spine-1 or pod-1-spine-1 if spines per pod.
+// Numbers are only zero-padded in names (spine-01, leaf-01, server-01) if there are no racks:
+//
+//	spinesPerPod: true
+//	racks:
+//	  - count: 2
+//	    pod: pod-1
+//	    chainControlLink: true
+//	    leafGroups:
+//	      - redundancy: mclag
+//	        servers: {mclag: 2}
+//	  - pod: pod-2
+//	    leafGroups:
+//	      - leafs: 2
+//	        servers: {unbundled: 2}
+type Topology struct {
+	FabricMode       meta.FabricMode     `json:"fabricMode,omitempty"`       // spine-leaf (default) or collapsed-core
+	Spines           uint8               `json:"spines,omitempty"`           // number of spines, 2 by default for spine-leaf
+	FabricLinks      uint8               `json:"fabricLinks,omitempty"`      // number of links for each spine <> leaf pair, 2 by default
+	ChainControlLink bool                `json:"chainControlLink,omitempty"` // true if not all switches attached directly to control node
+	ControlLinks     uint8               `json:"controlLinks,omitempty"`     // number of control links if chaining, 2 by default
+	ControlNodes     uint8               `json:"controlNodes,omitempty"`     // number of control nodes, 1 by default or 3 for HA kube API and registry, switch management isn't HA as switches are attached to the first one
+	VPCLoopbacks     uint8               `json:"vpcLoopbacks,omitempty"`     // number of VPC loopbacks per leaf, 2 by default
+	LeafGroups       []TopologyLeafGroup `json:"leafGroups,omitempty"`       // leafs are named leaf-01, leaf-02, ... in the groups order
+	Racks            []TopologyRack      `json:"racks,omitempty"`            // racks with their own leaf groups, used instead of leaf groups
+	SpinesPerPod     bool                `json:"spinesPerPod,omitempty"`     // each pod gets its own spines connected only to its racks
+	Externals        []TopologyExternal  `json:"externals,omitempty"`
+	Profiles         []SwitchPortProfile `json:"profiles,omitempty"`       // switch port profiles in addition to the built-in vs one
+	SpineProfile     string              `json:"spineProfile,omitempty"`   // port profile for spines, vs by default
+	LeafProfile      string              `json:"leafProfile,omitempty"`    // port profile for leafs, vs by default
+	SwitchProfiles   map[string]string   `json:"switchProfiles,omitempty"` // port profile overrides per switch name
+	LeafBreakouts    map[string]string   `json:"leafBreakouts,omitempty"`  // breakout modes by leaf port range on top of the profiles, e.g. E1/1-4: 4x25G
+}
+
+// TopologyRack is a set of identical racks, each with its own leaf groups and servers
+type TopologyRack struct {
+	Name             string              `json:"name,omitempty"`             // rack-N by default, where N is the rack position
+	Count            uint8               `json:"count,omitempty"`            // number of such racks, 1 by default, name should be empty if more than 1
+	Pod              string              `json:"pod,omitempty"`              // pod-1 by default
+	ChainControlLink bool                `json:"chainControlLink,omitempty"` // true if rack leafs are chained to control node, always if chained for the fabric
+	ControlLinks     uint8               `json:"controlLinks,omitempty"`     // number of control links in the rack if chaining, fabric one by default
+	LeafGroups       []TopologyLeafGroup `json:"leafGroups,omitempty"`       // leafs are named rack-N-leaf-1, rack-N-leaf-2, ... in the groups order
+}
+
+// TopologyLeafGroup is a set of identical leaf groups with the same redundancy and servers
+type TopologyLeafGroup struct {
+	Redundancy   meta.RedundancyType `json:"redundancy,omitempty"`   // mclag, eslag or empty for orphan leafs
+	Leafs        uint8               `json:"leafs,omitempty"`        // leafs in each group, always 2 for mclag, 2-4 for eslag, 1 by default
+	Count        uint8               `json:"count,omitempty"`        // number of such groups, 1 by default
+	SessionLinks uint8               `json:"sessionLinks,omitempty"` // MCLAG session links, 2 by default
+	PeerLinks    uint8               `json:"peerLinks,omitempty"`    // MCLAG peer links, 2 by default
+	Servers      TopologyServers     `json:"servers,omitempty"`      // servers attached to each group (to each leaf for orphans)
+	Profile      string              `json:"profile,omitempty"`      // port profile for the group leafs, topology leaf profile by default
+}
+
+// TopologyServers is the server mix for the leaf group, unbundled servers are attached to the first leaf of the group
+// and bundled ones to the second one (or the only one for orphan leafs)
+type TopologyServers struct {
+	Unbundled    uint8 `json:"unbundled,omitempty"`
+	Bundled      uint8 `json:"bundled,omitempty"`
+	MCLAG        uint8 `json:"mclag,omitempty"`
+	ESLAG        uint8 `json:"eslag,omitempty"`
+	BundledLinks uint8 `json:"bundledLinks,omitempty"` // links per bundled server, 2 by default
+	MCLAGLinks   uint8 `json:"mclagLinks,omitempty"`   // links to each leaf per MCLAG server, 1 by default
+	ESLAGLinks   uint8 `json:"eslagLinks,omitempty"`   // links to each leaf per ESLAG server, 1 by default
+}
+
+// TopologyExternal is a virtual external switch attached to the border leaf, externals are named virtual-edge-N in
+// order and values that aren't set are allocated by hydration
+type TopologyExternal struct {
+	Leaf              string `json:"leaf,omitempty"`              // orphan leafs from the last one by default, one per external
+	VLAN              uint16 `json:"vlan,omitempty"`              // 200 for the first external, next VLAN for the next ones
+	Subnet            string `json:"subnet,omitempty"`            // uplink subnet, part of the virtual edge pool by default
+	ASN               uint32 `json:"asn,omitempty"`               // virtual edge ASN, should be a 2-byte one
+	InboundCommunity  string `json:"inboundCommunity,omitempty"`  // <border leaf ASN>:<virtual edge ASN> by default, only for 16-bit ASNs
+	OutboundCommunity string `json:"outboundCommunity,omitempty"` // <virtual edge ASN>:<border leaf ASN> by default, only for 16-bit ASNs
+}
+
+var communityRegexp = regexp.MustCompile(`^\d{1,5}:\d{1,5}$`)
+
+func LoadTopology(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading topology %s", path)
+	}
+
+	topo := &Topology{}
+	if err := yaml.UnmarshalStrict(data, topo); err != nil {
+		return nil, errors.Wrapf(err, "error parsing topology %s", path)
+	}
+
+	return topo, nil
+}
+
+// Default fills in all defaults, including the default leaf groups if there are none
+func (t *Topology) Default() {
+	if t.FabricMode == "" {
+		t.FabricMode = meta.FabricModeSpineLeaf
+	}
+	if t.FabricMode == meta.FabricModeSpineLeaf {
+		if t.Spines == 0 {
+			t.Spines = 2
+		}
+		if t.FabricLinks == 0 {
+			t.FabricLinks = 2
+		}
+		if t.ChainControlLink && t.ControlLinks == 0 {
+			t.ControlLinks = 2
+		}
+	}
+	if t.ControlNodes == 0 {
+		t.ControlNodes = 1
+	}
+	if t.VPCLoopbacks == 0 {
+		t.VPCLoopbacks = 2
+	}
+	if t.SpineProfile == "" {
+		t.SpineProfile = meta.SwitchProfileVS
+	}
+	if t.LeafProfile == "" {
+		t.LeafProfile = meta.SwitchProfileVS
+	}
+
+	for idx := range t.Racks {
+		rack := &t.Racks[idx]
+		if rack.Count == 0 {
+			rack.Count = 1
+		}
+		if rack.Pod == "" {
+			rack.Pod = "pod-1"
+		}
+		if (rack.ChainControlLink || t.ChainControlLink) && rack.ControlLinks == 0 {
+			rack.ControlLinks = t.ControlLinks
+			if rack.ControlLinks == 0 {
+				rack.ControlLinks = 2
+			}
+		}
+		defaultLeafGroups(rack.LeafGroups)
+	}
+
+	if len(t.LeafGroups) == 0 && len(t.Racks) == 0 {
+		t.LeafGroups = append(t.LeafGroups, TopologyLeafGroup{
+			Redundancy: meta.RedundancyTypeMCLAG,
+			Servers:    TopologyServers{MCLAG: 2, Unbundled: 1, Bundled: 1},
+		})
+		if t.FabricMode == meta.FabricModeSpineLeaf {
+			t.LeafGroups = append(t.LeafGroups, TopologyLeafGroup{
+				Redundancy: meta.RedundancyTypeESLAG,
+				Servers:    TopologyServers{ESLAG: 2, Unbundled: 1, Bundled: 1},
+			}, TopologyLeafGroup{
+				Servers: TopologyServers{Unbundled: 1, Bundled: 1},
+			})
+		}
+	}
+
+	defaultLeafGroups(t.LeafGroups)
+}
+
+func defaultLeafGroups(groups []TopologyLeafGroup) {
+	for idx := range groups {
+		group := &groups[idx]
+		if group.Count == 0 {
+			group.Count = 1
+		}
+		if group.Leafs == 0 {
+			group.Leafs = 1
+			if group.Redundancy != meta.RedundancyTypeNone {
+				group.Leafs = 2
+			}
+		}
+		if group.Redundancy == meta.RedundancyTypeMCLAG {
+			if group.SessionLinks == 0 {
+				group.SessionLinks = 2
+			}
+			if group.PeerLinks == 0 {
+				group.PeerLinks = 2
+			}
+		}
+		if group.Servers.BundledLinks == 0 {
+			group.Servers.BundledLinks = 2
+		}
+		if group.Servers.MCLAGLinks == 0 {
+			group.Servers.MCLAGLinks = 1
+		}
+		if group.Servers.ESLAGLinks == 0 {
+			group.Servers.ESLAGLinks = 1
+		}
+	}
+}
+
+func (t *Topology) Validate() error {
+	if len(t.Racks) > 0 {
+		if t.FabricMode != meta.FabricModeSpineLeaf {
+			return errors.Errorf("racks are only supported for spine-leaf fabric mode")
+		}
+		if len(t.LeafGroups) > 0 {
+			return errors.Errorf("leaf groups should be specified either for the fabric or per rack")
+		}
+	} else if t.SpinesPerPod {
+		return errors.Errorf("spines per pod require racks")
+	}
+
+	switch t.FabricMode {
+	case meta.FabricModeSpineLeaf:
+		if t.ChainControlLink && t.ControlLinks == 0 {
+			return errors.Errorf("control links count must be greater than 0 if chaining control links")
+		}
+	case meta.FabricModeCollapsedCore:
+		if t.ChainControlLink {
+			return errors.Errorf("control link chaining not supported for collapsed core fabric mode")
+		}
+		if len(t.Externals) > 0 {
+			return errors.Errorf("external not supported for collapsed core fabric mode")
+		}
+		if t.Spines > 0 {
+			return errors.Errorf("spines not supported for collapsed core fabric mode")
+		}
+		if t.FabricLinks > 0 {
+			return errors.Errorf("fabric links not supported for collapsed core fabric mode")
+		}
+		if len(t.LeafGroups) != 1 || t.LeafGroups[0].Redundancy != meta.RedundancyTypeMCLAG || t.LeafGroups[0].Count != 1 {
+			return errors.Errorf("exactly one MCLAG leaf pair required for collapsed core fabric mode")
+		}
+	default:
+		return errors.Errorf("unsupported fabric mode %s", t.FabricMode)
+	}
+
+	for idx, ext := range t.Externals {
+		if ext.VLAN > 4094 {
+			return errors.Errorf("external %d: invalid VLAN %d", idx+1, ext.VLAN)
+		}
+		if ext.Subnet != "" {
+			if prefix, err := netip.ParsePrefix(ext.Subnet); err != nil || prefix.Masked() != prefix || prefix.Bits() > 30 {
+				return errors.Errorf("external %d: invalid subnet %s", idx+1, ext.Subnet)
+			}
+		}
+		if ext.ASN > 65535 {
+			return errors.Errorf("external %d: ASN %d should be 2-byte", idx+1, ext.ASN)
+		}
+		for _, community := range []string{ext.InboundCommunity, ext.OutboundCommunity} {
+			if community != "" && !communityRegexp.MatchString(community) {
+				return errors.Errorf("external %d: invalid community %s, expected <asn>:<value>", idx+1, community)
+			}
+		}
+	}
+
+	if t.ControlNodes != 1 && t.ControlNodes != 3 {
+		return errors.Errorf("only 1 or 3 control nodes are supported, found %d", t.ControlNodes)
+	}
+
+	for _, rack := range t.Racks {
+		if rack.Name != "" && rack.Count > 1 {
+			return errors.Errorf("rack %s: name is only supported for a single rack", rack.Name)
+		}
+	}
+
+	profiles, err := t.portProfiles()
+	if err != nil {
+		return err
+	}
+	for _, profile := range []string{t.SpineProfile, t.LeafProfile} {
+		if _, exist := profiles[profile]; !exist {
+			return errors.Errorf("unknown switch profile %s", profile)
+		}
+	}
+	for name, profile := range t.SwitchProfiles {
+		if _, exist := profiles[profile]; !exist {
+			return errors.Errorf("unknown switch profile %s for switch %s", profile, name)
+		}
+	}
+	if len(t.LeafBreakouts) > 0 {
+		breakouts, err := expandBreakouts(t.LeafBreakouts)
+		if err != nil {
+			return errors.Wrapf(err, "invalid leaf breakouts")
+		}
+		if _, err := applyBreakouts(profiles[t.LeafProfile], breakouts); err != nil {
+			return errors.Wrapf(err, "invalid leaf breakouts for switch profile %s", t.LeafProfile)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, rack := range t.RackList() {
+		if names[rack.Name] {
+			return errors.Errorf("duplicate rack %s", rack.Name)
+		}
+		names[rack.Name] = true
+
+		if len(rack.LeafGroups) == 0 {
+			return errors.Errorf("rack %s: at least one leaf group required", rack.Name)
+		}
+		if err := validateLeafGroups(rack.LeafGroups, profiles); err != nil {
+			return errors.Wrapf(err, "rack %s", rack.Name)
+		}
+	}
+
+	return validateLeafGroups(t.LeafGroups, profiles)
+}
+
+// portProfiles returns ports of all available switch profiles by name
+func (t *Topology) portProfiles() (map[string][]profilePort, error) {
+	profiles := map[string][]profilePort{}
+	for _, profile := range append([]SwitchPortProfile{VSPortProfile}, t.Profiles...) {
+		if _, exist := profiles[profile.Name]; exist {
+			return nil, errors.Errorf("duplicate switch profile %s", profile.Name)
+		}
+
+		ports, err := profile.ports()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing switch profile")
+		}
+		profiles[profile.Name] = ports
+	}
+
+	return profiles, nil
+}
+
+// RackList returns all racks one by one with the names and pods set
+func (t *Topology) RackList() []TopologyRack {
+	racks := []TopologyRack{}
+	for _, rack := range t.Racks {
+		for i := uint8(0); i < max(rack.Count, 1); i++ {
+			r := rack
+			r.Count = 1
+			if r.Name == "" || rack.Count > 1 {
+				r.Name = fmt.Sprintf("rack-%d", len(racks)+1)
+			}
+			if r.Pod == "" {
+				r.Pod = "pod-1"
+			}
+			racks = append(racks, r)
+		}
+	}
+
+	return racks
+}
+
+func validateLeafGroups(groups []TopologyLeafGroup, profiles map[string][]profilePort) error {
+	for idx, group := range groups {
+		if _, exist := profiles[group.Profile]; group.Profile != "" && !exist {
+			return errors.Errorf("leaf group %d: unknown switch profile %s", idx, group.Profile)
+		}
+
+		if !slices.Contains(meta.RedundancyTypes, group.Redundancy) {
+			return errors.Errorf("leaf group %d: unknown redundancy type %q", idx, group.Redundancy)
+		}
+
+		switch group.Redundancy {
+		case meta.RedundancyTypeMCLAG:
+			if group.Leafs != 2 {
+				return errors.Errorf("leaf group %d: MCLAG group must have 2 leafs", idx)
+			}
+			if group.Servers.ESLAG > 0 {
+				return errors.Errorf("leaf group %d: ESLAG servers are only supported for ESLAG groups", idx)
+			}
+		case meta.RedundancyTypeESLAG:
+			if group.Leafs < 2 || group.Leafs > 4 {
+				return errors.Errorf("leaf group %d: ESLAG group must have 2-4 leafs", idx)
+			}
+			if group.Servers.MCLAG > 0 {
+				return errors.Errorf("leaf group %d: MCLAG servers are only supported for MCLAG groups", idx)
+			}
+		case meta.RedundancyTypeNone:
+			if group.Servers.MCLAG > 0 || group.Servers.ESLAG > 0 {
+				return errors.Errorf("leaf group %d: MCLAG and ESLAG servers are not supported for orphan leafs", idx)
+			}
+		}
+
+		if group.Redundancy != meta.RedundancyTypeMCLAG && (group.SessionLinks > 0 || group.PeerLinks > 0) {
+			return errors.Errorf("leaf group %d: session and peer links are only supported for MCLAG groups", idx)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wiring
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go.githedgehog.com/fabric/api/meta"
+)
+
+func Test_Topology_Validate(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		topo  Topology
+		error bool
+	}{
+		{
+			name: "default-spine-leaf",
+		},
+		{
+			name: "default-collapsed-core",
+			topo: Topology{FabricMode: meta.FabricModeCollapsedCore},
+		},
+		{
+			name: "groups",
+			topo: Topology{LeafGroups: []TopologyLeafGroup{
+				{Redundancy: meta.RedundancyTypeMCLAG, Count: 3, Servers: TopologyServers{MCLAG: 2}},
+				{Redundancy: meta.RedundancyTypeESLAG, Leafs: 4, Servers: TopologyServers{ESLAG: 2}},
+				{Leafs: 5, Servers: TopologyServers{Unbundled: 1}},
+			}},
+		},
+		{
+			name:  "mclag-leafs",
+			topo:  Topology{LeafGroups: []TopologyLeafGroup{{Redundancy: meta.RedundancyTypeMCLAG, Leafs: 3}}},
+			error: true,
+		},
+		{
+			name:  "eslag-leafs",
+			topo:  Topology{LeafGroups: []TopologyLeafGroup{{Redundancy: meta.RedundancyTypeESLAG, Leafs: 5}}},
+			error: true,
+		},
+		{
+			name:  "orphan-mclag-servers",
+			topo:  Topology{LeafGroups: []TopologyLeafGroup{{Servers: TopologyServers{MCLAG: 1}}}},
+			error: true,
+		},
+		{
+			name:  "eslag-session-links",
+			topo:  Topology{LeafGroups: []TopologyLeafGroup{{Redundancy: meta.RedundancyTypeESLAG, SessionLinks: 2}}},
+			error: true,
+		},
+		{
+			name:  "unknown-redundancy",
+			topo:  Topology{LeafGroups: []TopologyLeafGroup{{Redundancy: "vpc"}}},
+			error: true,
+		},
+		{
+			name:  "collapsed-core-spines",
+			topo:  Topology{FabricMode: meta.FabricModeCollapsedCore, Spines: 2},
+			error: true,
+		},
+		{
+			name: "collapsed-core-two-pairs",
+			topo: Topology{FabricMode: meta.FabricModeCollapsedCore, LeafGroups: []TopologyLeafGroup{
+				{Redundancy: meta.RedundancyTypeMCLAG, Count: 2},
+			}},
+			error: true,
+		},
+		{
+			name: "racks",
+			topo: Topology{SpinesPerPod: true, Racks: []TopologyRack{
+				{Count: 2, ChainControlLink: true, LeafGroups: []TopologyLeafGroup{{Redundancy: meta.RedundancyTypeMCLAG}}},
+				{Name: "edge", Pod: "pod-2", LeafGroups: []TopologyLeafGroup{{Leafs: 2}}},
+			}},
+		},
+		{
+			name:  "racks-and-leaf-groups",
+			topo:  Topology{LeafGroups: []TopologyLeafGroup{{}}, Racks: []TopologyRack{{LeafGroups: []TopologyLeafGroup{{}}}}},
+			error: true,
+		},
+		{
+			name:  "racks-no-leaf-groups",
+			topo:  Topology{Racks: []TopologyRack{{}}},
+			error: true,
+		},
+		{
+			name:  "racks-named-count",
+			topo:  Topology{Racks: []TopologyRack{{Name: "edge", Count: 2, LeafGroups: []TopologyLeafGroup{{}}}}},
+			error: true,
+		},
+		{
+			name: "racks-duplicate",
+			topo: Topology{Racks: []TopologyRack{
+				{Count: 2, LeafGroups: []TopologyLeafGroup{{}}},
+				{Name: "rack-2", LeafGroups: []TopologyLeafGroup{{}}},
+			}},
+			error: true,
+		},
+		{
+			name: "externals",
+			topo: Topology{Externals: []TopologyExternal{
+				{},
+				{Leaf: "leaf-01", VLAN: 300, Subnet: "100.64.0.0/24", ASN: 64999, InboundCommunity: "64999:1", OutboundCommunity: "1:64999"},
+			}},
+		},
+		{
+			name:  "external-subnet",
+			topo:  Topology{Externals: []TopologyExternal{{Subnet: "100.64.0.1/24"}}},
+			error: true,
+		},
+		{
+			name:  "external-community",
+			topo:  Topology{Externals: []TopologyExternal{{InboundCommunity: "64999"}}},
+			error: true,
+		},
+		{
+			name:  "spines-per-pod-no-racks",
+			topo:  Topology{SpinesPerPod: true},
+			error: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.topo.Default()
+			err := test.topo.Validate()
+			if test.error && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.error && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_Topology_RackList(t *testing.T) {
+	topo := Topology{Racks: []TopologyRack{
+		{Count: 2},
+		{Name: "edge", Pod: "pod-2"},
+		{},
+	}}
+	topo.Default()
+
+	want := []string{"rack-1/pod-1", "rack-2/pod-1", "edge/pod-2", "rack-4/pod-1"}
+	got := []string{}
+	for _, rack := range topo.RackList() {
+		got = append(got, rack.Name+"/"+rack.Pod)
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got racks %v, want %v", got, want)
+	}
+}
+
+func Test_Builder_Names(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		topo *Topology
+		want []string
+	}{
+		{
+			name: "no-racks",
+			topo: &Topology{LeafGroups: []TopologyLeafGroup{{Redundancy: meta.RedundancyTypeMCLAG, Servers: TopologyServers{MCLAG: 1}}}},
+			want: []string{"leaf-01", "leaf-02", "mclag-1", "server-01", "spine-01", "spine-02"},
+		},
+		{
+			name: "racks",
+			topo: &Topology{Racks: []TopologyRack{{LeafGroups: []TopologyLeafGroup{{Redundancy: meta.RedundancyTypeMCLAG, Servers: TopologyServers{MCLAG: 1}}}}}},
+			want: []string{"rack-1-leaf-1", "rack-1-leaf-2", "rack-1-mclag-1", "rack-1-server-1", "spine-1", "spine-2"},
+		},
+		{
+			name: "spines-per-pod",
+			topo: &Topology{SpinesPerPod: true, Racks: []TopologyRack{{LeafGroups: []TopologyLeafGroup{{Leafs: 1}}}}},
+			want: []string{"pod-1-spine-1", "pod-1-spine-2", "rack-1-leaf-1"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := (&Builder{Topology: test.topo}).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, sw := range data.Switch.All() {
+				got = append(got, sw.Name)
+			}
+			for _, sg := range data.SwitchGroup.All() {
+				// skip the default and per rack groups
+				if sg.Name != "empty" && sg.Name != "rack-1" {
+					got = append(got, sg.Name)
+				}
+			}
+			for _, server := range data.Server.All() {
+				if !strings.HasPrefix(server.Name, "control-") {
+					got = append(got, server.Name)
+				}
+			}
+			slices.Sort(got)
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got names %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_oniePortName(t *testing.T) {
+	for _, test := range []struct {
+		port   string
+		result string
+		err    bool
+	}{
+		{port: "E1/1", result: "eth1"},
+		{port: "E1/49", result: "eth49"},
+		{port: "E1/5/1", err: true},
+		{port: "M1", err: true},
+		{port: "E1/x", err: true},
+	} {
+		t.Run(test.port, func(t *testing.T) {
+			res, err := oniePortName(test.port)
+			if (err != nil) != test.err {
+				t.Fatalf("oniePortName() error = %v, want error %t", err, test.err)
+			}
+			if res != test.result {
+				t.Errorf("oniePortName() = %s, want %s", res, test.result)
+			}
+		})
+	}
+}
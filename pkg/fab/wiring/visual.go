@@ -16,166 +16,126 @@ package wiring
 
 import (
 	"fmt"
-	"sort"
+	"slices"
+	"strings"
 
 	"github.com/pkg/errors"
 	wiringapi "go.githedgehog.com/fabric/api/wiring/v1alpha2"
-	"go.githedgehog.com/fabric/pkg/util/pointer"
 	"go.githedgehog.com/fabric/pkg/wiring"
 	"go.githedgehog.com/fabricator/pkg/fab/wiring/visual"
 )
 
-func Visualize(wiringPath string) (string, error) {
+// linkStyles defines color and style for each link purpose, it's also the order of the legend entries
+var linkStyles = []visual.LegendEntry{
+	{Type: wiringapi.ConnectionTypeManagement, Color: "#e41a1c", Style: "dashed"},
+	{Type: wiringapi.ConnectionTypeFabric, Color: "#ff7f00"},
+	{Type: LinkPurposeMCLAGPeer, Color: "#4daf4a"},
+	{Type: LinkPurposeMCLAGSession, Color: "#4daf4a", Style: "dashed"},
+	{Type: wiringapi.ConnectionTypeVPCLoopback, Color: "#e7298a"},
+	{Type: wiringapi.ConnectionTypeUnbundled, Color: "#000000"},
+	{Type: wiringapi.ConnectionTypeBundled, Color: "#377eb8"},
+	{Type: wiringapi.ConnectionTypeMCLAG, Color: "#984ea3"},
+	{Type: wiringapi.ConnectionTypeESLAG, Color: "#1b9e77"},
+	{Type: wiringapi.ConnectionTypeExternal, Color: "#a65628"},
+	{Type: wiringapi.ConnectionTypeStaticExternal, Color: "#999999", Style: "dotted"},
+}
+
+// Visualize loads wiring from the file and renders it in the format, see visual.Formats
+func Visualize(wiringPath string, format string, opts visual.Options) (string, error) {
 	if wiringPath == "" {
 		return "", errors.Errorf("wiring path is not specified")
 	}
+	if !slices.Contains(visual.Formats, format) {
+		return "", errors.Errorf("unknown format %q, supported: %s", format, strings.Join(visual.Formats, ", "))
+	}
 
 	data, err := wiring.New()
 	if err != nil {
 		return "", errors.Wrapf(err, "error creating wiring data")
 	}
-	err = wiring.LoadDataFrom(wiringPath, data)
+	_, err = LoadWiring(wiringPath, data)
 	if err != nil {
 		return "", errors.Wrapf(err, "error loading wiring data from %s", wiringPath)
 	}
 
+	res, err := Graph(data).Render(format, opts)
+
+	return res, errors.Wrapf(err, "error generating graph")
+}
+
+// Graph builds graph of the wiring with all connection types, switches and servers are grouped by racks (if rack
+// annotations are present) and switches are additionally grouped by redundancy groups
+func Graph(data *wiring.Data) *visual.Graph {
 	vis := visual.New()
 
 	endpoints := map[string][]visual.Endpoint{}
+	seen := map[string]bool{}
+	endpoint := func(end LinkEnd) string {
+		id := end.Device + "--" + end.Port
+		if end.Port == "" {
+			id = end.Device
+		}
+		if !seen[id] {
+			seen[id] = true
+			props := map[string]string{}
+			if end.IP != "" {
+				props["ip"] = end.IP
+			}
+			endpoints[end.Device] = append(endpoints[end.Device], visual.Endpoint{ID: id, Name: end.Port, Properties: props})
+		}
 
-	for _, conn := range data.Connection.All() {
-		if conn.Spec.Management != nil {
-			link := conn.Spec.Management.Link
+		return id
+	}
 
-			endpoints[link.Server.DeviceName()] = append(endpoints[link.Server.DeviceName()], visual.Endpoint{
-				ID:   endpointID(&link.Server),
-				Name: link.Server.LocalPortName(),
-				Properties: map[string]string{
-					"ip": link.Server.IP,
-				},
-			})
-			endpoints[link.Switch.DeviceName()] = append(endpoints[link.Switch.DeviceName()], visual.Endpoint{
-				ID:   endpointID(&link.Switch),
-				Name: link.Switch.LocalPortName(),
-				Properties: map[string]string{
-					"ip": link.Switch.IP,
-				},
-			})
+	purposes := map[string]bool{}
+	external := false
+	for _, conn := range data.Connection.All() {
+		for _, link := range ConnectionLinks(conn) {
+			idx := slices.IndexFunc(linkStyles, func(e visual.LegendEntry) bool { return e.Type == link.Purpose })
+			if idx < 0 {
+				continue
+			}
+			style := linkStyles[idx]
+			purposes[link.Purpose] = true
+			external = external || link.B.Device == LinkDeviceExternal
 
 			vis.Links = append(vis.Links, visual.Link{
-				From:  endpointID(&link.Server),
-				To:    endpointID(&link.Switch),
-				Color: "red",
+				From:  endpoint(link.A),
+				To:    endpoint(link.B),
+				Color: style.Color,
+				Type:  link.Purpose,
+				Style: style.Style,
 			})
-		} else if conn.Spec.Fabric != nil {
-			for _, link := range conn.Spec.Fabric.Links {
-				endpoints[link.Spine.DeviceName()] = append(endpoints[link.Spine.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Spine)),
-					Name: link.Spine.LocalPortName(),
-					Properties: map[string]string{
-						"ip": link.Spine.IP,
-					},
-				})
-				endpoints[link.Leaf.DeviceName()] = append(endpoints[link.Leaf.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Leaf)),
-					Name: link.Leaf.LocalPortName(),
-					Properties: map[string]string{
-						"ip": link.Leaf.IP,
-					},
-				})
-
-				vis.Links = append(vis.Links, visual.Link{
-					From:  endpointID(pointer.To(link.Spine)),
-					To:    endpointID(pointer.To(link.Leaf)),
-					Color: "orange",
-				})
-			}
-		} else if conn.Spec.MCLAGDomain != nil {
-			for _, link := range append(conn.Spec.MCLAGDomain.PeerLinks, conn.Spec.MCLAGDomain.SessionLinks...) {
-				endpoints[link.Switch1.DeviceName()] = append(endpoints[link.Switch1.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Switch1)),
-					Name: link.Switch1.LocalPortName(),
-				})
-				endpoints[link.Switch2.DeviceName()] = append(endpoints[link.Switch2.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Switch2)),
-					Name: link.Switch2.LocalPortName(),
-				})
-
-				vis.Links = append(vis.Links, visual.Link{
-					From:  endpointID(pointer.To(link.Switch1)),
-					To:    endpointID(pointer.To(link.Switch2)),
-					Color: "green",
-				})
-			}
-		} else if conn.Spec.VPCLoopback != nil {
-			for _, link := range conn.Spec.VPCLoopback.Links {
-				endpoints[link.Switch1.DeviceName()] = append(endpoints[link.Switch1.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Switch1)),
-					Name: link.Switch1.LocalPortName(),
-				})
-				endpoints[link.Switch2.DeviceName()] = append(endpoints[link.Switch2.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Switch2)),
-					Name: link.Switch2.LocalPortName(),
-				})
-
-				vis.Links = append(vis.Links, visual.Link{
-					From:  endpointID(pointer.To(link.Switch1)),
-					To:    endpointID(pointer.To(link.Switch2)),
-					Color: "magenta",
-				})
-			}
-		} else if conn.Spec.Unbundled != nil {
-			link := conn.Spec.Unbundled.Link
+		}
+	}
+	for _, entry := range linkStyles {
+		if purposes[entry.Type] {
+			vis.Legend = append(vis.Legend, entry)
+		}
+	}
 
-			endpoints[link.Server.DeviceName()] = append(endpoints[link.Server.DeviceName()], visual.Endpoint{
-				ID:   endpointID(&link.Server),
-				Name: link.Server.LocalPortName(),
-			})
-			endpoints[link.Switch.DeviceName()] = append(endpoints[link.Switch.DeviceName()], visual.Endpoint{
-				ID:   endpointID(&link.Switch),
-				Name: link.Switch.LocalPortName(),
-			})
+	sortedEndpoints := func(device string) []visual.Endpoint {
+		res := endpoints[device]
+		slices.SortFunc(res, func(a, b visual.Endpoint) int { return comparePorts(a.Name, b.Name) })
 
-			vis.Links = append(vis.Links, visual.Link{
-				From:  endpointID(&link.Server),
-				To:    endpointID(&link.Switch),
-				Color: "black",
-			})
-		} else if conn.Spec.Bundled != nil {
-			for _, link := range conn.Spec.Bundled.Links {
-				endpoints[link.Server.DeviceName()] = append(endpoints[link.Server.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Server)),
-					Name: link.Server.LocalPortName(),
-				})
-				endpoints[link.Switch.DeviceName()] = append(endpoints[link.Switch.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Switch)),
-					Name: link.Switch.LocalPortName(),
-				})
-
-				vis.Links = append(vis.Links, visual.Link{
-					From:  endpointID(pointer.To(link.Server)),
-					To:    endpointID(pointer.To(link.Switch)),
-					Color: "blue",
-				})
-			}
-		} else if conn.Spec.MCLAG != nil {
-			for _, link := range conn.Spec.MCLAG.Links {
-				endpoints[link.Server.DeviceName()] = append(endpoints[link.Server.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Server)),
-					Name: link.Server.LocalPortName(),
-				})
-				endpoints[link.Switch.DeviceName()] = append(endpoints[link.Switch.DeviceName()], visual.Endpoint{
-					ID:   endpointID(pointer.To(link.Switch)),
-					Name: link.Switch.LocalPortName(),
-				})
-
-				vis.Links = append(vis.Links, visual.Link{
-					From:  endpointID(pointer.To(link.Server)),
-					To:    endpointID(pointer.To(link.Switch)),
-					Color: "purple",
-				})
-			}
+		return res
+	}
+
+	groups := map[string]bool{}
+	addGroup := func(group visual.Group) {
+		if !groups[group.ID] {
+			groups[group.ID] = true
+			vis.Groups = append(vis.Groups, group)
+		}
+	}
+	rackGroup := func(annotations map[string]string) string {
+		rack := annotations[RackAnnotation]
+		if rack == "" {
+			return ""
 		}
+		addGroup(visual.Group{ID: "rack--" + rack, Name: rack})
+
+		return "rack--" + rack
 	}
 
 	for _, role := range wiringapi.SwitchRoles {
@@ -184,20 +144,45 @@ func Visualize(wiringPath string) (string, error) {
 				continue
 			}
 
-			devEndpoints := endpoints[sw.Name]
-			sort.Slice(devEndpoints, func(i, j int) bool {
-				return devEndpoints[i].ID < devEndpoints[j].ID
-			})
+			kind := visual.KindLeaf
+			switch {
+			case sw.Spec.Role.IsSpine():
+				kind = visual.KindSpine
+			case sw.Spec.Role.IsVirtualEdge():
+				kind = visual.KindExternal
+			}
+
+			group := rackGroup(sw.Annotations)
+			if redundancy := sw.Spec.Redundancy.Group; redundancy != "" {
+				id := "redundancy--" + redundancy
+				addGroup(visual.Group{ID: id, Name: fmt.Sprintf("%s (%s)", redundancy, sw.Spec.Redundancy.Type), Parent: group})
+				group = id
+			}
+
+			props := map[string]string{
+				"role":      string(sw.Spec.Role),
+				"switch-ip": sw.Spec.IP,
+			}
+			if sw.Spec.ASN != 0 {
+				props["asn"] = fmt.Sprintf("%d", sw.Spec.ASN)
+			}
+			if len(sw.Spec.PortBreakouts) > 0 {
+				ports := sortedMapKeys(sw.Spec.PortBreakouts)
+				slices.SortFunc(ports, comparePorts)
+				breakouts := []string{}
+				for _, port := range ports {
+					breakouts = append(breakouts, port+":"+sw.Spec.PortBreakouts[port])
+				}
+				props["breakouts"] = strings.Join(breakouts, ",")
+			}
 
 			vis.Devices = append(vis.Devices, visual.Device{
-				ID:        sw.Name,
-				Name:      sw.Name,
-				Endpoints: devEndpoints,
-				Properties: map[string]string{
-					"role":      string(sw.Spec.Role),
-					"asn":       fmt.Sprintf("%d", sw.Spec.ASN),
-					"switch-ip": sw.Spec.IP,
-				},
+				ID:         sw.Name,
+				Name:       sw.Name,
+				Kind:       kind,
+				Group:      group,
+				Endpoints:  sortedEndpoints(sw.Name),
+				Properties: props,
 			})
 		}
 	}
@@ -208,15 +193,17 @@ func Visualize(wiringPath string) (string, error) {
 				continue
 			}
 
-			devEndpoints := endpoints[srv.Name]
-			sort.Slice(devEndpoints, func(i, j int) bool {
-				return devEndpoints[i].ID < devEndpoints[j].ID
-			})
+			kind := visual.KindServer
+			if srv.Spec.Type == wiringapi.ServerTypeControl {
+				kind = visual.KindControl
+			}
 
 			vis.Devices = append(vis.Devices, visual.Device{
 				ID:        srv.Name,
 				Name:      srv.Name,
-				Endpoints: devEndpoints,
+				Kind:      kind,
+				Group:     rackGroup(srv.Annotations),
+				Endpoints: sortedEndpoints(srv.Name),
 				Properties: map[string]string{
 					"type": string(srv.Spec.Type),
 				},
@@ -224,11 +211,14 @@ func Visualize(wiringPath string) (string, error) {
 		}
 	}
 
-	res, err := vis.Dot()
-
-	return res, errors.Wrapf(err, "error generating graph")
-}
+	if external {
+		vis.Devices = append(vis.Devices, visual.Device{
+			ID:        LinkDeviceExternal,
+			Name:      LinkDeviceExternal,
+			Kind:      visual.KindExternal,
+			Endpoints: sortedEndpoints(LinkDeviceExternal),
+		})
+	}
 
-func endpointID(port wiringapi.IPort) string {
-	return fmt.Sprintf("%s--%s", port.DeviceName(), port.LocalPortName())
+	return vis
 }
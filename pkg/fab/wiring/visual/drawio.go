@@ -0,0 +1,146 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visual
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type drawioFile struct {
+	XMLName xml.Name      `xml:"mxfile"`
+	Host    string        `xml:"host,attr"`
+	Diagram drawioDiagram `xml:"diagram"`
+}
+
+type drawioDiagram struct {
+	ID    string      `xml:"id,attr"`
+	Name  string      `xml:"name,attr"`
+	Model drawioModel `xml:"mxGraphModel"`
+}
+
+type drawioModel struct {
+	Grid       int          `xml:"grid,attr"`
+	PageWidth  int          `xml:"pageWidth,attr"`
+	PageHeight int          `xml:"pageHeight,attr"`
+	Cells      []drawioCell `xml:"root>mxCell"`
+}
+
+type drawioCell struct {
+	ID       string          `xml:"id,attr"`
+	Value    string          `xml:"value,attr,omitempty"`
+	Style    string          `xml:"style,attr,omitempty"`
+	Vertex   string          `xml:"vertex,attr,omitempty"`
+	Edge     string          `xml:"edge,attr,omitempty"`
+	Parent   string          `xml:"parent,attr,omitempty"`
+	Source   string          `xml:"source,attr,omitempty"`
+	Target   string          `xml:"target,attr,omitempty"`
+	Geometry *drawioGeometry `xml:"mxGeometry,omitempty"`
+}
+
+type drawioGeometry struct {
+	X        float64 `xml:"x,attr,omitempty"`
+	Y        float64 `xml:"y,attr,omitempty"`
+	Width    float64 `xml:"width,attr,omitempty"`
+	Height   float64 `xml:"height,attr,omitempty"`
+	Relative string  `xml:"relative,attr,omitempty"`
+	As       string  `xml:"as,attr"`
+}
+
+// DrawIO renders the graph as a draw.io (diagrams.net) file using the same layout as SVG, so it could be opened and
+// adjusted manually
+func (g *Graph) DrawIO(opts Options) (string, error) {
+	v := g.view(opts)
+	l := v.layout()
+
+	cells := []drawioCell{{ID: "0"}, {ID: "1", Parent: "0"}}
+	vertex := func(id, value, style string, b box) {
+		cells = append(cells, drawioCell{
+			ID: id, Value: value, Style: style, Vertex: "1", Parent: "1",
+			Geometry: &drawioGeometry{X: b.X, Y: b.Y, Width: b.W, Height: b.H, As: "geometry"},
+		})
+	}
+
+	groups := slices.Clone(l.Groups)
+	slices.SortStableFunc(groups, func(a, b groupBox) int { return cmp.Compare(a.Depth, b.Depth) })
+	for _, group := range groups {
+		vertex("group-"+group.Group.ID, html.EscapeString(group.Group.Name),
+			"rounded=1;whiteSpace=wrap;html=1;dashed=1;fillColor=none;strokeColor=#888888;fontStyle=2;verticalAlign=top;align=left;spacingLeft=6;",
+			group.Box)
+	}
+
+	for _, dev := range v.Devices {
+		b, exist := l.Devices[dev.ID]
+		if !exist {
+			continue
+		}
+
+		lines := v.DeviceLines(dev)
+		for idx := range lines {
+			lines[idx] = html.EscapeString(lines[idx])
+		}
+		lines[0] = "<b>" + lines[0] + "</b>"
+		vertex("dev-"+dev.ID, strings.Join(lines, "<br>"),
+			fmt.Sprintf("rounded=1;whiteSpace=wrap;html=1;fillColor=%s;strokeColor=#333333;fontSize=11;", kindFills[dev.Kind]), b)
+	}
+
+	for idx, link := range v.Links {
+		style := fmt.Sprintf("endArrow=none;html=1;strokeWidth=2;strokeColor=%s;fontSize=9;", cmp.Or(link.Color, "#000000"))
+		if link.Style == "dashed" || link.Style == "dotted" {
+			style += "dashed=1;"
+		}
+		cells = append(cells, drawioCell{
+			ID: fmt.Sprintf("link-%d", idx), Value: html.EscapeString(v.LinkLabel(link)), Style: style, Edge: "1", Parent: "1",
+			Source: "dev-" + v.DeviceOf(link.From), Target: "dev-" + v.DeviceOf(link.To),
+			Geometry: &drawioGeometry{Relative: "1", As: "geometry"},
+		})
+	}
+
+	for idx, entry := range v.Legend {
+		label := "── " + entry.Type
+		if entry.Style == "dashed" || entry.Style == "dotted" {
+			label = "- - " + entry.Type
+		}
+		vertex(fmt.Sprintf("legend-%d", idx), html.EscapeString(label), "text;html=1;align=left;fontStyle=1;fontColor="+entry.Color+";",
+			box{X: margin + float64(idx%4)*legendWidth, Y: l.Height + float64(idx/4)*legendRow, W: legendWidth, H: legendRow})
+	}
+
+	file := drawioFile{
+		Host: "hhfab",
+		Diagram: drawioDiagram{
+			ID:   "wiring",
+			Name: "Wiring",
+			Model: drawioModel{
+				Grid:       1,
+				PageWidth:  int(l.Width),
+				PageHeight: int(l.Height + float64(len(v.Legend)/4+1)*legendRow),
+				Cells:      cells,
+			},
+		},
+	}
+
+	data, err := xml.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "error marshaling drawio")
+	}
+
+	return string(data) + "\n", nil
+}
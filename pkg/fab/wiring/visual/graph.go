@@ -16,20 +16,57 @@ package visual
 
 import (
 	"bytes"
+	"slices"
 	"strings"
 	"text/template"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	FormatDot     = "dot"
+	FormatSVG     = "svg"
+	FormatHTML    = "html"
+	FormatMermaid = "mermaid"
+	FormatDrawIO  = "drawio"
+)
+
+var Formats = []string{FormatDot, FormatSVG, FormatHTML, FormatMermaid, FormatDrawIO}
+
+// Device kinds, they define the tier the device is drawn in
+const (
+	KindControl  = "control"
+	KindExternal = "external"
+	KindSpine    = "spine"
+	KindLeaf     = "leaf"
+	KindServer   = "server"
+)
+
 type Graph struct {
 	Devices []Device
 	Links   []Link
+	Groups  []Group       // racks and redundancy groups devices are drawn in
+	Legend  []LegendEntry // link types present in the graph
+}
+
+// Options toggles labels in the rendered graph
+type Options struct {
+	Ports bool // port names on the links and endpoints
+	IPs   bool // IPs and ASNs on the devices and endpoints
+}
+
+// Group is a rack or a redundancy group, parent is set for the groups nested into racks
+type Group struct {
+	ID     string
+	Name   string
+	Parent string
 }
 
 type Device struct {
 	ID         string
 	Name       string
+	Kind       string
+	Group      string // innermost group the device belongs to
 	Properties map[string]string
 	Endpoints  []Endpoint
 }
@@ -44,6 +81,14 @@ type Link struct {
 	From  string
 	To    string
 	Color string
+	Type  string // connection type or link purpose, e.g. fabric or mclag-peer
+	Style string // solid (default), dashed or dotted
+}
+
+type LegendEntry struct {
+	Type  string
+	Color string
+	Style string
 }
 
 func New() *Graph {
@@ -53,8 +98,152 @@ func New() *Graph {
 	}
 }
 
-func (g *Graph) Dot() (string, error) {
-	return executeTemplate(tmplGraphDot, g)
+// Render renders the graph in the format, see Formats
+func (g *Graph) Render(format string, opts Options) (string, error) {
+	switch format {
+	case FormatDot:
+		return g.Dot(opts)
+	case FormatSVG:
+		return g.SVG(opts)
+	case FormatHTML:
+		return g.HTML(opts)
+	case FormatMermaid:
+		return g.Mermaid(opts)
+	case FormatDrawIO:
+		return g.DrawIO(opts)
+	default:
+		return "", errors.Errorf("unknown format %q, supported: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+func (g *Graph) Dot(opts Options) (string, error) {
+	return executeTemplate(tmplGraphDot, g.view(opts))
+}
+
+// view is the graph prepared for rendering with labels filtered according to the options
+type view struct {
+	Graph
+	Opts         Options
+	Root         *groupNode
+	endpoints    map[string]string // endpoint ID to device ID
+	endpointByID map[string]Endpoint
+}
+
+// groupNode is a group with nested groups and devices, the root one has no group
+type groupNode struct {
+	Group   Group
+	Groups  []*groupNode
+	Devices []Device
+}
+
+func (g *Graph) view(opts Options) *view {
+	v := &view{
+		Opts:         opts,
+		endpoints:    map[string]string{},
+		endpointByID: map[string]Endpoint{},
+	}
+
+	v.Graph.Groups = g.Groups
+	v.Graph.Links = g.Links
+	v.Graph.Legend = g.Legend
+	for _, dev := range g.Devices {
+		dev.Properties = filterProperties(dev.Properties, opts)
+		endpoints := []Endpoint{}
+		for _, ep := range dev.Endpoints {
+			v.endpoints[ep.ID] = dev.ID
+			v.endpointByID[ep.ID] = ep
+			if !opts.Ports {
+				continue
+			}
+			ep.Properties = filterProperties(ep.Properties, opts)
+			endpoints = append(endpoints, ep)
+		}
+		dev.Endpoints = endpoints
+		v.Graph.Devices = append(v.Graph.Devices, dev)
+	}
+
+	nodes := map[string]*groupNode{}
+	v.Root = &groupNode{}
+	for _, group := range g.Groups {
+		nodes[group.ID] = &groupNode{Group: group}
+	}
+	for _, group := range g.Groups {
+		parent := v.Root
+		if p, exist := nodes[group.Parent]; exist {
+			parent = p
+		}
+		parent.Groups = append(parent.Groups, nodes[group.ID])
+	}
+	for _, dev := range v.Graph.Devices {
+		parent := v.Root
+		if p, exist := nodes[dev.Group]; exist {
+			parent = p
+		}
+		parent.Devices = append(parent.Devices, dev)
+	}
+
+	return v
+}
+
+// DeviceOf returns device ID for the endpoint ID
+func (v *view) DeviceOf(endpointID string) string {
+	return v.endpoints[endpointID]
+}
+
+// LinkLabel returns label for the link with the port names and IPs of both ends if enabled
+func (v *view) LinkLabel(link Link) string {
+	if !v.Opts.Ports {
+		return ""
+	}
+
+	end := func(id string) string {
+		ep := v.endpointByID[id]
+		res := ep.Name
+		if ip := ep.Properties["ip"]; v.Opts.IPs && ip != "" {
+			res += " (" + ip + ")"
+		}
+
+		return res
+	}
+
+	return end(link.From) + " - " + end(link.To)
+}
+
+// DeviceLines returns device name followed by its properties if enabled
+func (v *view) DeviceLines(dev Device) []string {
+	lines := []string{dev.Name}
+	for _, key := range sortedKeys(dev.Properties) {
+		if value := dev.Properties[key]; value != "" {
+			lines = append(lines, key+"="+value)
+		}
+	}
+
+	return lines
+}
+
+// ipProperties are only shown if IPs are enabled
+var ipProperties = map[string]bool{"ip": true, "asn": true, "switch-ip": true, "vtep-ip": true, "protocol-ip": true}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func filterProperties(props map[string]string, opts Options) map[string]string {
+	res := map[string]string{}
+	for k, v := range props {
+		if ipProperties[k] && !opts.IPs {
+			continue
+		}
+		res[k] = v
+	}
+
+	return res
 }
 
 func executeTemplate(tmplText string, data any) (string, error) {
@@ -76,26 +265,49 @@ func executeTemplate(tmplText string, data any) (string, error) {
 }
 
 const tmplGraphDot = `
-graph {
-	graph [pad="0.5", nodesep="0.1", ranksep="2"];
-	node [shape = "Mrecord"];
-
-	overlap = false;
-    splines = true;
-
-	{{ range .Devices }}
+{{- define "device" }}
 	subgraph "cluster_{{ .ID }}" {
 		label = <<b>{{ .Name }}</b>{{ range $k, $v := .Properties }}{{ if $v }}, {{ $k }}={{ $v }}{{ end }}{{ end }}>;
+		style = solid;
 
-		{{ range .Endpoints }}
+		{{ if .Endpoints }}{{ range .Endpoints }}
 		"{{ .ID }}" [label = <<b>{{ .Name }}</b>{{ range $k, $v := .Properties }}{{ if $v }}<br/>{{ $k }}={{ $v }}{{ end }}{{ end }}> ];
+		{{ end }}{{ else }}
+		"{{ .ID }}" [label = "{{ .Name }}", shape = box];
 		{{ end }}
 	}
+{{- end }}
+{{- define "group" }}
+	{{ range .Groups }}
+	subgraph "cluster_group_{{ .Group.ID }}" {
+		label = <<i>{{ .Group.Name }}</i>>;
+		style = dashed;
+		{{ template "group" . }}
+	}
 	{{ end }}
+	{{ range .Devices }}{{ template "device" . }}{{ end }}
+{{- end }}
+graph {
+	graph [pad="0.5", nodesep="0.1", ranksep="2"];
+	node [shape = "Mrecord"];
+
+	overlap = false;
+    splines = true;
 
+	{{ template "group" .Root }}
 
 	{{ range .Links }}
-	"{{ .From }}" -- "{{ .To }}" {{ if .Color }}[color = {{ .Color }}]{{ end }};
+	"{{ if $.Opts.Ports }}{{ .From }}{{ else }}{{ $.DeviceOf .From }}{{ end }}" -- "{{ if $.Opts.Ports }}{{ .To }}{{ else }}{{ $.DeviceOf .To }}{{ end }}" [{{ if .Color }}color = "{{ .Color }}", {{ end }}style = {{ if .Style }}{{ .Style }}{{ else }}solid{{ end }}];
 	{{ end }}
+
+	subgraph "cluster_legend" {
+		label = <<b>Legend</b>>;
+		style = solid;
+		{{ range $idx, $e := .Legend }}
+		"legend_{{ $idx }}_a" [label = "", shape = point];
+		"legend_{{ $idx }}_b" [label = "{{ $e.Type }}", shape = plaintext];
+		"legend_{{ $idx }}_a" -- "legend_{{ $idx }}_b" [color = "{{ $e.Color }}", style = {{ if $e.Style }}{{ $e.Style }}{{ else }}solid{{ end }}];
+		{{ end }}
+	}
   }
 `
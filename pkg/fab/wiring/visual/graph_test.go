@@ -0,0 +1,124 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visual
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testGraph() *Graph {
+	g := New()
+	g.Groups = []Group{{ID: "rack-1", Name: "rack-1"}, {ID: "mclag-1", Name: "mclag-1", Parent: "rack-1"}}
+	g.Devices = []Device{
+		{ID: "spine-1", Name: "spine-1", Kind: KindSpine, Properties: map[string]string{"asn": "65100"},
+			Endpoints: []Endpoint{{ID: "spine-1--E1/1", Name: "E1/1", Properties: map[string]string{"ip": "172.30.30.0/31"}}}},
+		{ID: "leaf-1", Name: "leaf-1", Kind: KindLeaf, Group: "mclag-1", Properties: map[string]string{"asn": "65101"},
+			Endpoints: []Endpoint{{ID: "leaf-1--E1/49", Name: "E1/49", Properties: map[string]string{"ip": "172.30.30.1/31"}}, {ID: "leaf-1--E1/1", Name: "E1/1"}}},
+		{ID: "server-1", Name: "server-1", Kind: KindServer, Group: "rack-1",
+			Endpoints: []Endpoint{{ID: "server-1--enp2s1", Name: "enp2s1"}}},
+	}
+	g.Links = []Link{
+		{From: "spine-1--E1/1", To: "leaf-1--E1/49", Color: "#ff7f00", Type: "fabric"},
+		{From: "server-1--enp2s1", To: "leaf-1--E1/1", Color: "#000000", Type: "unbundled"},
+	}
+	g.Legend = []LegendEntry{{Type: "fabric", Color: "#ff7f00"}, {Type: "unbundled", Color: "#000000"}}
+
+	return g
+}
+
+func Test_Graph_Render(t *testing.T) {
+	for _, tt := range []struct {
+		format  string
+		opts    Options
+		want    []string
+		notWant []string
+		xml     bool
+	}{
+		{
+			format: FormatDot,
+			opts:   Options{Ports: true, IPs: true},
+			want:   []string{`"spine-1--E1/1" -- "leaf-1--E1/49"`, "cluster_group_mclag-1", "asn=65100", "legend_0"},
+		},
+		{
+			format:  FormatDot,
+			opts:    Options{},
+			want:    []string{`"spine-1" -- "leaf-1"`},
+			notWant: []string{"asn=", "E1/1"},
+		},
+		{
+			format: FormatSVG,
+			opts:   Options{Ports: true, IPs: true},
+			want:   []string{"leaf-1", "E1/49", "172.30.30.1/31", "rack-1", "unbundled"},
+			xml:    true,
+		},
+		{
+			format:  FormatSVG,
+			opts:    Options{Ports: true},
+			want:    []string{"E1/49"},
+			notWant: []string{"172.30.30.1/31", "65100"},
+			xml:     true,
+		},
+		{
+			format: FormatHTML,
+			opts:   Options{Ports: true},
+			want:   []string{"<svg", `id="ports" checked`, "hide-ips", "172.30.30.1/31"},
+		},
+		{
+			format: FormatMermaid,
+			opts:   Options{Ports: true, IPs: true},
+			want:   []string{"flowchart TB", "subgraph group_mclag_1", `dev_spine_1 ---|"E1/1 (172.30.30.0/31) - E1/49 (172.30.30.1/31)"| dev_leaf_1`, "linkStyle 1 stroke:#000000"},
+		},
+		{
+			format: FormatDrawIO,
+			opts:   Options{Ports: true, IPs: true},
+			want:   []string{"<mxfile", `source="dev-spine-1" target="dev-leaf-1"`, "group-rack-1"},
+			xml:    true,
+		},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			res, err := testGraph().Render(tt.format, tt.opts)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(res, want) {
+					t.Errorf("Render() result doesn't contain %q", want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(res, notWant) {
+					t.Errorf("Render() result contains %q", notWant)
+				}
+			}
+			if tt.xml {
+				dec := xml.NewDecoder(strings.NewReader(res))
+				for {
+					if _, err := dec.Token(); err == io.EOF {
+						break
+					} else if err != nil {
+						t.Fatalf("Render() result is not valid XML: %v", err)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := testGraph().Render("png", Options{}); err == nil {
+		t.Errorf("Render() expected error for unknown format")
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visual
+
+import "slices"
+
+const (
+	nodeWidth  = 150
+	lineHeight = 14
+	gapX       = 20
+	columnGap  = 60
+	tierHeight = 200
+	margin     = 40
+	groupPad   = 10
+	groupLabel = 16
+)
+
+// tiers devices are drawn in from top to bottom
+var tiers = map[string]int{
+	KindControl:  0,
+	KindExternal: 0,
+	KindSpine:    1,
+	KindLeaf:     2,
+	KindServer:   3,
+}
+
+type box struct {
+	X, Y, W, H float64
+}
+
+func (b box) CX() float64 { return b.X + b.W/2 }
+func (b box) CY() float64 { return b.Y + b.H/2 }
+
+func (b box) union(o box) box {
+	x1, y1 := min(b.X, o.X), min(b.Y, o.Y)
+	x2, y2 := max(b.X+b.W, o.X+o.W), max(b.Y+b.H, o.Y+o.H)
+
+	return box{X: x1, Y: y1, W: x2 - x1, H: y2 - y1}
+}
+
+type groupBox struct {
+	Group Group
+	Box   box
+	Depth int
+}
+
+// layout is a simple layered layout: control nodes and externals, spines, leafs and servers from top to bottom, leafs
+// and servers are split into columns by the top level group (usually rack), so all groups are drawn as boxes
+type layout struct {
+	Width, Height float64
+	NodeHeight    float64
+	Devices       map[string]box
+	Groups        []groupBox
+}
+
+func (v *view) layout() *layout {
+	l := &layout{Devices: map[string]box{}}
+
+	maxLines := 1
+	for _, dev := range v.Graph.Devices {
+		maxLines = max(maxLines, len(v.DeviceLines(dev)))
+	}
+	l.NodeHeight = float64(maxLines*lineHeight + 12)
+
+	parents := map[string]string{}
+	for _, group := range v.Graph.Groups {
+		parents[group.ID] = group.Parent
+	}
+	top := func(group string) string {
+		for parents[group] != "" {
+			group = parents[group]
+		}
+
+		return group
+	}
+
+	// column for each device, servers without a group go to the column of the first leaf they are attached to
+	columns := []string{}
+	column := map[string]string{}
+	addColumn := func(dev, col string) {
+		column[dev] = col
+		for _, c := range columns {
+			if c == col {
+				return
+			}
+		}
+		columns = append(columns, col)
+	}
+	for _, dev := range v.Graph.Devices {
+		if dev.Kind == KindLeaf {
+			addColumn(dev.ID, top(dev.Group))
+		}
+	}
+	for _, dev := range v.Graph.Devices {
+		if dev.Kind != KindServer {
+			continue
+		}
+		if dev.Group != "" {
+			addColumn(dev.ID, top(dev.Group))
+
+			continue
+		}
+		col := ""
+		for _, link := range v.Graph.Links {
+			from, to := v.DeviceOf(link.From), v.DeviceOf(link.To)
+			if from == dev.ID {
+				from, to = to, from
+			}
+			if to == dev.ID {
+				if c, exist := column[from]; exist {
+					col = c
+
+					break
+				}
+			}
+		}
+		addColumn(dev.ID, col)
+	}
+
+	tierY := func(tier int) float64 {
+		return margin + groupLabel*3 + float64(tier)*(tierHeight+l.NodeHeight)
+	}
+
+	x := float64(margin)
+	for _, col := range columns {
+		leafs, servers := []Device{}, []Device{}
+		for _, dev := range v.Graph.Devices {
+			if c, exist := column[dev.ID]; !exist || c != col {
+				continue
+			}
+			if dev.Kind == KindLeaf {
+				leafs = append(leafs, dev)
+			} else {
+				servers = append(servers, dev)
+			}
+		}
+
+		width := float64(max(len(leafs), len(servers), 1))*(nodeWidth+gapX) - gapX
+		for _, row := range []struct {
+			tier    int
+			devices []Device
+		}{{tiers[KindLeaf], leafs}, {tiers[KindServer], servers}} {
+			rowWidth := float64(len(row.devices))*(nodeWidth+gapX) - gapX
+			rx := x + (width-rowWidth)/2
+			for _, dev := range row.devices {
+				l.Devices[dev.ID] = box{X: rx, Y: tierY(row.tier), W: nodeWidth, H: l.NodeHeight}
+				rx += nodeWidth + gapX
+			}
+		}
+
+		x += width + columnGap
+	}
+	l.Width = max(x-columnGap+margin, 2*margin+nodeWidth)
+
+	for _, kinds := range [][]string{{KindControl, KindExternal}, {KindSpine}} {
+		row := []Device{}
+		for _, dev := range v.Graph.Devices {
+			if slices.Contains(kinds, dev.Kind) {
+				row = append(row, dev)
+			}
+		}
+
+		rowWidth := float64(len(row))*(nodeWidth+gapX) - gapX
+		l.Width = max(l.Width, rowWidth+2*margin)
+		rx := (l.Width - rowWidth) / 2
+		for _, dev := range row {
+			l.Devices[dev.ID] = box{X: rx, Y: tierY(tiers[dev.Kind]), W: nodeWidth, H: l.NodeHeight}
+			rx += nodeWidth + gapX
+		}
+	}
+	l.Height = tierY(tiers[KindServer]) + l.NodeHeight + margin
+
+	// group boxes are calculated bottom up, so nested groups are inside of their parents
+	var groupBoxOf func(node *groupNode, depth int) (box, bool)
+	groupBoxOf = func(node *groupNode, depth int) (box, bool) {
+		res, found := box{}, false
+		add := func(b box) {
+			if !found {
+				res, found = b, true
+			} else {
+				res = res.union(b)
+			}
+		}
+		for _, dev := range node.Devices {
+			add(l.Devices[dev.ID])
+		}
+		for _, child := range node.Groups {
+			if b, ok := groupBoxOf(child, depth+1); ok {
+				add(b)
+			}
+		}
+		if !found || node.Group.ID == "" {
+			return res, found
+		}
+
+		res = box{X: res.X - groupPad, Y: res.Y - groupPad - groupLabel, W: res.W + 2*groupPad, H: res.H + 2*groupPad + groupLabel}
+		l.Groups = append(l.Groups, groupBox{Group: node.Group, Box: res, Depth: depth})
+
+		return res, true
+	}
+	groupBoxOf(v.Root, -1)
+
+	return l
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visual
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mermaid renders the graph as a Mermaid flowchart with groups as nested subgraphs, ports are shown as link labels
+func (g *Graph) Mermaid(opts Options) (string, error) {
+	v := g.view(opts)
+
+	b := &strings.Builder{}
+	b.WriteString("flowchart TB\n")
+
+	var group func(node *groupNode, indent string)
+	group = func(node *groupNode, indent string) {
+		for _, child := range node.Groups {
+			fmt.Fprintf(b, "%ssubgraph %s [\"%s\"]\n", indent, mermaidID("group", child.Group.ID), mermaidText(child.Group.Name))
+			group(child, indent+"  ")
+			fmt.Fprintf(b, "%send\n", indent)
+		}
+		for _, dev := range node.Devices {
+			lines := v.DeviceLines(dev)
+			for idx := range lines {
+				lines[idx] = mermaidText(lines[idx])
+			}
+			lines[0] = "<b>" + lines[0] + "</b>"
+			fmt.Fprintf(b, "%s%s[\"%s\"]\n", indent, mermaidID("dev", dev.ID), strings.Join(lines, "<br/>"))
+		}
+	}
+	group(v.Root, "  ")
+
+	styles := []string{}
+	for idx, link := range v.Links {
+		edge := "---"
+		if link.Style == "dashed" || link.Style == "dotted" {
+			edge = "-.-"
+		}
+		if label := v.LinkLabel(link); label != "" {
+			edge += "|\"" + mermaidText(label) + "\"|"
+		}
+		fmt.Fprintf(b, "  %s %s %s\n", mermaidID("dev", v.DeviceOf(link.From)), edge, mermaidID("dev", v.DeviceOf(link.To)))
+		styles = append(styles, fmt.Sprintf("  linkStyle %d stroke:%s,stroke-width:2px", idx, cmp.Or(link.Color, "#000000")))
+	}
+
+	if len(v.Legend) > 0 {
+		b.WriteString("  subgraph legend [\"Legend\"]\n")
+		for idx, entry := range v.Legend {
+			fmt.Fprintf(b, "    legend_%d[\"%s\"]\n", idx, mermaidText(entry.Type))
+		}
+		b.WriteString("  end\n")
+		for idx, entry := range v.Legend {
+			dash := ""
+			if entry.Style == "dashed" || entry.Style == "dotted" {
+				dash = ",stroke-dasharray:5 5"
+			}
+			styles = append(styles, fmt.Sprintf("  style legend_%d stroke:%s,stroke-width:2px%s", idx, entry.Color, dash))
+		}
+	}
+
+	for _, style := range styles {
+		b.WriteString(style + "\n")
+	}
+
+	return b.String(), nil
+}
+
+var mermaidIDReplacer = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func mermaidID(prefix, id string) string {
+	return prefix + "_" + mermaidIDReplacer.ReplaceAllString(id, "_")
+}
+
+func mermaidText(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
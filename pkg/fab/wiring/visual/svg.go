@@ -0,0 +1,286 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visual
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+)
+
+const (
+	legendWidth = 160
+	legendRow   = 18
+	linkOffset  = 6
+)
+
+var kindFills = map[string]string{
+	KindControl:  "#e8e8e8",
+	KindExternal: "#f5e6d3",
+	KindSpine:    "#fde9c9",
+	KindLeaf:     "#d9ecf7",
+	KindServer:   "#ffffff",
+}
+
+func (g *Graph) SVG(opts Options) (string, error) {
+	return g.view(opts).svg(), nil
+}
+
+// svg renders the graph using the simple layered layout, port and IP labels are marked with the port-label and
+// ip-label classes so they could be toggled in the HTML page
+func (v *view) svg() string {
+	l := v.layout()
+
+	legendCols := max(1, int((l.Width-2*margin)/legendWidth))
+	legendRows := (len(v.Legend) + legendCols - 1) / legendCols
+	height := l.Height
+	if len(v.Legend) > 0 {
+		height += float64(legendRows+1)*legendRow + margin/2
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="11">`+"\n",
+		l.Width, height, l.Width, height)
+	b.WriteString(`<style>
+.group rect { fill: none; stroke: #888; stroke-dasharray: 6 3; }
+.group text { font-style: italic; fill: #555; }
+.device rect { stroke: #333; }
+.device .name { font-weight: bold; }
+.link { fill: none; stroke-width: 1.5; }
+.link-label { font-size: 9px; fill: #333; }
+</style>
+<rect width="100%" height="100%" fill="#ffffff"/>
+`)
+
+	// outer groups first so the nested ones are drawn on top of them
+	groups := slices.Clone(l.Groups)
+	slices.SortStableFunc(groups, func(a, b groupBox) int { return cmp.Compare(a.Depth, b.Depth) })
+	for _, group := range groups {
+		gb := group.Box
+		fmt.Fprintf(b, `<g class="group"><rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" rx="6"/>`, gb.X, gb.Y, gb.W, gb.H)
+		fmt.Fprintf(b, `<text x="%.0f" y="%.0f">%s</text></g>`+"\n", gb.X+6, gb.Y+groupLabel-4, esc(group.Group.Name))
+	}
+
+	pairs := map[[2]string]int{}
+	for _, link := range v.Links {
+		from, to := v.DeviceOf(link.From), v.DeviceOf(link.To)
+		fromBox, fromOk := l.Devices[from]
+		toBox, toOk := l.Devices[to]
+		if !fromOk || !toOk {
+			continue
+		}
+
+		pair := [2]string{min(from, to), max(from, to)}
+		idx := pairs[pair]
+		pairs[pair]++
+
+		path, lx, ly := linkPath(fromBox, toBox, idx)
+		fmt.Fprintf(b, `<path class="link" d="%s" stroke="%s"%s><title>%s</title></path>`+"\n",
+			path, cmp.Or(link.Color, "#000000"), dashArray(link.Style), esc(link.Type))
+
+		if label := v.linkLabelSVG(link); label != "" {
+			fmt.Fprintf(b, `<text class="link-label port-label" x="%.0f" y="%.0f" text-anchor="middle">%s</text>`+"\n", lx, ly, label)
+		}
+	}
+
+	for _, dev := range v.Devices {
+		db, exist := l.Devices[dev.ID]
+		if !exist {
+			continue
+		}
+
+		fmt.Fprintf(b, `<g class="device kind-%s"><rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" rx="4" fill="%s"/>`,
+			dev.Kind, db.X, db.Y, db.W, db.H, kindFills[dev.Kind])
+		y := db.Y + lineHeight + 2
+		for idx, line := range v.DeviceLines(dev) {
+			class := ""
+			switch {
+			case idx == 0:
+				class = "name"
+			case ipProperties[strings.SplitN(line, "=", 2)[0]]:
+				class = "ip-label"
+			}
+			fmt.Fprintf(b, `<text class="%s" x="%.0f" y="%.0f" text-anchor="middle">%s</text>`, class, db.CX(), y, esc(line))
+			y += lineHeight
+		}
+		b.WriteString("</g>\n")
+	}
+
+	if len(v.Legend) > 0 {
+		y := l.Height
+		fmt.Fprintf(b, `<g class="legend"><text x="%d" y="%.0f" font-weight="bold">Legend</text>`, margin, y)
+		for idx, entry := range v.Legend {
+			x := float64(margin + (idx%legendCols)*legendWidth)
+			ey := y + float64(idx/legendCols+1)*legendRow
+			fmt.Fprintf(b, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" stroke="%s" stroke-width="2"%s/>`,
+				x, ey-4, x+40, ey-4, entry.Color, dashArray(entry.Style))
+			fmt.Fprintf(b, `<text x="%.0f" y="%.0f">%s</text>`, x+48, ey, esc(entry.Type))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	b.WriteString("</svg>\n")
+
+	return b.String()
+}
+
+// linkLabelSVG is the same as LinkLabel but with IPs marked as ip-label
+func (v *view) linkLabelSVG(link Link) string {
+	if !v.Opts.Ports {
+		return ""
+	}
+
+	end := func(id string) string {
+		ep := v.endpointByID[id]
+		res := esc(ep.Name)
+		if ip := ep.Properties["ip"]; v.Opts.IPs && ip != "" {
+			res += `<tspan class="ip-label"> (` + esc(ip) + `)</tspan>`
+		}
+
+		return res
+	}
+
+	return end(link.From) + " - " + end(link.To)
+}
+
+// linkPath returns SVG path between two devices and the position of its label, links between the devices in the same
+// tier are drawn as arcs below them, loops on the right side of the device, parallel links are shifted by idx
+func linkPath(a, b box, idx int) (string, float64, float64) {
+	shift := float64(idx) * linkOffset
+
+	if a == b {
+		x, y1, y2 := a.X+a.W, a.Y+a.H/3+shift, a.Y+2*a.H/3+shift
+		cx := x + 30 + shift
+
+		return fmt.Sprintf("M %.0f %.0f C %.0f %.0f, %.0f %.0f, %.0f %.0f", x, y1, cx, y1, cx, y2, x, y2), cx + 4, (y1 + y2) / 2
+	}
+
+	if a.Y == b.Y {
+		if a.X > b.X {
+			a, b = b, a
+		}
+		y := a.Y + a.H
+		cx, cy := (a.CX()+b.CX())/2, y+40+shift*2
+
+		return fmt.Sprintf("M %.0f %.0f Q %.0f %.0f, %.0f %.0f", a.CX()+shift, y, cx, cy, b.CX()-shift, y), cx, (y+cy)/2 + 4
+	}
+
+	if a.Y > b.Y {
+		a, b = b, a
+	}
+	x1, y1 := a.CX()+shift-linkOffset, a.Y+a.H
+	x2, y2 := b.CX()+shift-linkOffset, b.Y
+
+	// label is placed closer to the lower end to avoid overlapping labels next to the upper tier
+	return fmt.Sprintf("M %.0f %.0f L %.0f %.0f", x1, y1, x2, y2), x1 + (x2-x1)*0.7, y1 + (y2-y1)*0.7
+}
+
+func dashArray(style string) string {
+	switch style {
+	case "dashed":
+		return ` stroke-dasharray="6 4"`
+	case "dotted":
+		return ` stroke-dasharray="2 3"`
+	default:
+		return ""
+	}
+}
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
+
+// HTML renders standalone page with the SVG graph that could be zoomed with the mouse wheel and panned by dragging,
+// port and IP labels could be toggled, options define their initial state
+func (g *Graph) HTML(opts Options) (string, error) {
+	svg := g.view(Options{Ports: true, IPs: true}).svg()
+
+	return executeTemplate(tmplGraphHTML, map[string]any{
+		"SVG":   svg,
+		"Ports": opts.Ports,
+		"IPs":   opts.IPs,
+	})
+}
+
+const tmplGraphHTML = `
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Wiring diagram</title>
+<style>
+html, body { margin: 0; height: 100%; font-family: sans-serif; font-size: 13px; }
+#toolbar { position: fixed; top: 0; left: 0; right: 0; padding: 6px 10px; background: #f4f4f4; border-bottom: 1px solid #ccc; z-index: 1; }
+#toolbar label { margin-right: 1em; }
+#canvas { position: absolute; top: 34px; left: 0; right: 0; bottom: 0; overflow: hidden; cursor: grab; }
+#canvas svg { width: 100%; height: 100%; }
+body.hide-ports .port-label, body.hide-ips .ip-label { display: none; }
+</style>
+</head>
+<body class="{{ if not .Ports }}hide-ports{{ end }} {{ if not .IPs }}hide-ips{{ end }}">
+<div id="toolbar">
+<label><input type="checkbox" id="ports"{{ if .Ports }} checked{{ end }}> Ports</label>
+<label><input type="checkbox" id="ips"{{ if .IPs }} checked{{ end }}> IPs</label>
+<button id="reset">Reset zoom</button>
+<span>Scroll to zoom, drag to pan</span>
+</div>
+<div id="canvas">
+{{ .SVG }}
+</div>
+<script>
+const svg = document.querySelector("#canvas svg");
+svg.removeAttribute("width");
+svg.removeAttribute("height");
+const initial = svg.getAttribute("viewBox");
+const vb = svg.viewBox.baseVal;
+
+document.getElementById("ports").addEventListener("change", e => document.body.classList.toggle("hide-ports", !e.target.checked));
+document.getElementById("ips").addEventListener("change", e => document.body.classList.toggle("hide-ips", !e.target.checked));
+document.getElementById("reset").addEventListener("click", () => svg.setAttribute("viewBox", initial));
+
+function point(e) {
+  const p = svg.createSVGPoint();
+  p.x = e.clientX;
+  p.y = e.clientY;
+  return p.matrixTransform(svg.getScreenCTM().inverse());
+}
+
+svg.addEventListener("wheel", e => {
+  e.preventDefault();
+  const p = point(e);
+  const scale = e.deltaY > 0 ? 1.1 : 1 / 1.1;
+  vb.x = p.x - (p.x - vb.x) * scale;
+  vb.y = p.y - (p.y - vb.y) * scale;
+  vb.width *= scale;
+  vb.height *= scale;
+}, { passive: false });
+
+let drag = null;
+svg.addEventListener("mousedown", e => { drag = point(e); svg.parentNode.style.cursor = "grabbing"; });
+window.addEventListener("mouseup", () => { drag = null; svg.parentNode.style.cursor = ""; });
+svg.addEventListener("mousemove", e => {
+  if (!drag) {
+    return;
+  }
+  const p = point(e);
+  vb.x -= p.x - drag.x;
+  vb.y -= p.y - drag.y;
+});
+</script>
+</body>
+</html>
+`
@@ -74,9 +74,14 @@ func (cfg *Zot) Hydrate(_ cnc.Preset, _ meta.FabricMode) error {
 	return nil
 }
 
-func (cfg *Zot) Build(_ string, _ cnc.Preset, _ meta.FabricMode, get cnc.GetComponent, _ *wiring.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
+func (cfg *Zot) Build(_ string, _ cnc.Preset, _ meta.FabricMode, get cnc.GetComponent, data *wiring.Data, run cnc.AddBuildOp, install cnc.AddRunOp) error {
 	cfg.Ref = cfg.Ref.Fallback(BaseConfig(get).Source)
 
+	nodes, err := getControlNodes(data)
+	if err != nil {
+		return errors.Wrap(err, "error getting control nodes")
+	}
+
 	run(BundleControlInstall, StageInstall0Prep, "zot-airgap-files",
 		&cnc.FilesORAS{
 			Ref: cfg.Ref.Fallback(BaseConfig(get).Source),
@@ -128,21 +133,33 @@ func (cfg *Zot) Build(_ string, _ cnc.Preset, _ meta.FabricMode, get cnc.GetComp
 			),
 		})
 
-	run(BundleControlInstall, StageInstall0Prep, "zot-ca-file",
-		&cnc.FileGenerate{
-			File: cnc.File{
-				Name:          "zot-ca.crt",
-				InstallTarget: "/etc/ssl/certs",
-				InstallName:   "hh-registry-ca.pem",
+	install(BundleControlInstall, Stage, "zot-preflight",
+		&cnc.Preflight{
+			Disks: []cnc.PreflightDisk{
+				{Path: PreflightDataDir, Size: PreflightZotDisk},
 			},
-			Content: cnc.FromValue(cfg.TLS.CA.Cert),
+			TCPPorts: []int{ZotNodePort},
 		})
 
-	install(BundleControlInstall, StageInstall0Prep, "zot-ca-install",
-		&cnc.ExecCommand{
-			Name: "update-ca-certificates",
-			Args: []string{"|", "grep", "-v", "=\\>"}, // don't print all cert names
-		})
+	// registry is available on all control nodes using the control VIP
+	for _, node := range nodes {
+		run(node.Bundle, StageInstall0Prep, "zot-ca-file",
+			&cnc.FileGenerate{
+				File: cnc.File{
+					Name:          "zot-ca.crt",
+					InstallTarget: "/etc/ssl/certs",
+					InstallName:   "hh-registry-ca.pem",
+					InstallBackup: true,
+				},
+				Content: cnc.FromValue(cfg.TLS.CA.Cert),
+			})
+
+		install(node.Bundle, StageInstall0Prep, "zot-ca-install",
+			&cnc.ExecCommand{
+				Name: "update-ca-certificates",
+				Args: []string{"|", "grep", "-v", "=\\>"}, // don't print all cert names
+			})
+	}
 
 	install(BundleControlInstall, StageInstall1K3sZot, "zot-wait",
 		&cnc.WaitURL{